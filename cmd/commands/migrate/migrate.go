@@ -96,7 +96,11 @@ func RunMigration(cmd *commands.Command, args []string) int {
 	}
 	beeLogger.Log.Infof("Using '%s' as 'driver'", mDriver)
 	beeLogger.Log.Infof("Using '%s' as 'conn'", mConn)
-	driverStr, connStr := string(mDriver), string(mConn)
+	driverStr := string(mDriver)
+	connStr, err := config.ResolveSecrets(string(mConn))
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not resolve the connection string: %s", err)
+	}
 	if len(args) == 0 {
 		// run all outstanding migrations
 		beeLogger.Log.Info("Running all outstanding migrations")
@@ -134,7 +138,7 @@ func migrate(goal, currpath, driver, connStr string) {
 	// Connect to database
 	db, err := sql.Open(driver, connStr)
 	if err != nil {
-		beeLogger.Log.Fatalf("Could not connect to database using '%s': %s", connStr, err)
+		beeLogger.Log.Fatalf("Could not connect to database using '%s': %s", config.RedactSecrets(connStr), err)
 	}
 	defer db.Close()
 
@@ -15,10 +15,13 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	beeLogger "github.com/skOak/hee/logger"
 	"gopkg.in/yaml.v2"
 )
@@ -36,6 +39,9 @@ var Conf = struct {
 	EnableReload       bool              `json:"enable_reload" yaml:"enable_reload"`
 	EnableNotification bool              `json:"enable_notification" yaml:"enable_notification"`
 	Scripts            map[string]string `json:"scripts" yaml:"scripts"`
+	Appcode            appcode           `json:"appcode" yaml:"appcode"`
+	// Profiles holds named sets of options overriding the ones above, see UseProfile
+	Profiles map[string]interface{} `json:"profiles" yaml:"profiles"`
 }{
 	GoInstall: true,
 	DirStruct: dirStruct{
@@ -52,6 +58,20 @@ var Conf = struct {
 	},
 	EnableNotification: true,
 	Scripts:            map[string]string{},
+	Appcode: appcode{
+		Router: appcodeRouter{
+			VersionPrefix: "/v1",
+		},
+		Tables: map[string]appcodeTable{},
+		Logger: appcodeLogger{
+			Level:         "warn",
+			SlowThreshold: "200ms",
+		},
+		Pagination: appcodePagination{
+			DefaultLimit: 10,
+			MaxLimit:     100,
+		},
+	},
 }
 
 // dirStruct describes the application's directory structure
@@ -75,8 +95,193 @@ type database struct {
 	Conn   string
 }
 
+// appcode holds the options used by "generate appcode"
+type appcode struct {
+	Router appcodeRouter
+	Files  appcodeFiles
+	Tables map[string]appcodeTable // per table options, keyed by table name
+	// Tags holds the custom struct tags added to the model fields, keyed by tag name.
+	// The values are templates rendered with the column tag information, e.g. {{.Column}}
+	Tags map[string]string
+	// Logger holds the default logging of the generated models
+	Logger appcodeLogger
+	// Gorm holds the options of the database opened by the generated models
+	Gorm appcodeGorm
+	// Orm of the generated models, either gorm or sqlx for structs queried with jmoiron/sqlx, see -orm
+	Orm string
+	// Retry makes the generated controllers retry the model calls failing with a transient error
+	Retry appcodeRetry
+	// Breaker makes the generated controllers call the models through a circuit breaker per table
+	Breaker appcodeBreaker
+	// Pagination holds the page sizes of the generated list functions and endpoints
+	Pagination appcodePagination
+	// I18n localizes the error messages of the generated controllers and handlers
+	I18n appcodeI18n
+	// Tenant scopes the queries of the tables owned by a tenant to the rows of the tenant of the request
+	Tenant appcodeTenant
+	// Money reads the integer amount columns, e.g. total_cents, as a models.Money of their currency
+	Money appcodeMoney
+	// SemanticPatterns holds the regular expressions matching the names or the comments of
+	// the columns holding an email, a phone number or a URL, keyed by email, phone or url.
+	// They replace the default ones, an empty one turning the detection of its kind off.
+	SemanticPatterns map[string]string `json:"semantic_patterns" yaml:"semantic_patterns"`
+	// MaxOverwrites is the number of existing files of the tables whose schema changed
+	// a generation may overwrite without -force-major, 20 when not set
+	MaxOverwrites int `json:"max_overwrites" yaml:"max_overwrites"`
+	// Features lists the optional parts of the generated code, e.g. soft-delete-api, export
+	// and audit, the default ones being generated when it is not set
+	Features []string
+	// ApiVersions freezes the DTOs of the former versions of the API to the columns of a
+	// schema snapshot, keyed by version, e.g. v1, each version being generated into dto/<version>
+	ApiVersions map[string]appcodeApiVersion `json:"api_versions" yaml:"api_versions"`
+	// DI generates the dependency injection of the database into the net/http handlers,
+	// either with google/wire provider sets (wire) or with an uber/fx module (fx)
+	DI string
+	// Level is the generation level used when -level is not given, 3 when not set
+	Level string
+	// Include lists the tables generated when -tables is not given, all of them when not set
+	Include []string
+	// Output holds the directories of the generated packages
+	Output appcodeOutput
+}
+
+// appcodeOutput describes where the generated packages are written, relative to the
+// application path, e.g. internal/models. The import paths of the generated code follow
+// the directories, while the package names are kept, each defaulting to its own name.
+type appcodeOutput struct {
+	Models      string
+	Controllers string
+	Routers     string
+	Handlers    string
+	Queries     string
+	Jobs        string
+	Api         string
+	Domain      string
+	Persistence string // infrastructure/persistence when not set
+}
+
+// appcodeApiVersion describes the columns of the records served by a version of the API
+type appcodeApiVersion struct {
+	Snapshot string // name of the schema snapshot of .hee/snapshots, e.g. 20260102_150405
+	// Renames holds the columns of the snapshot renamed since then, keyed by table,
+	// then by name in the snapshot, e.g. {"users": {"mail": "email"}}
+	Renames map[string]map[string]string
+}
+
+// appcodeTenant describes the ownership of the rows
+type appcodeTenant struct {
+	Column string // column holding the owner of a row, e.g. tenant_id or user_id, scoping the tables having it
+}
+
+// appcodeMoney describes the amount columns, holding minor units, e.g. cents
+type appcodeMoney struct {
+	Enabled  bool
+	Suffixes []string // ends of the names of the amount columns, _cents and _amount when not set
+	Currency string   // currency of the amounts of the tables without a currency column, e.g. USD
+}
+
+// appcodeI18n describes the message catalog of the generated controllers and handlers
+type appcodeI18n struct {
+	Languages []string // e.g. en and zh, the first one being the default
+}
+
+// appcodePagination describes the page sizes of the lists
+type appcodePagination struct {
+	DefaultLimit int64 `json:"default_limit" yaml:"default_limit"` // records listed when no limit is requested
+	MaxLimit     int64 `json:"max_limit" yaml:"max_limit"`         // cap of the requested limit, 0 for none
+}
+
+// appcodeBreaker describes the circuit breakers of the generated models, see github.com/sony/gobreaker
+type appcodeBreaker struct {
+	Enabled             bool
+	MaxRequests         uint32 `json:"max_requests" yaml:"max_requests"` // requests allowed while half-open
+	Interval            string // cyclic period of the closed state clearing the counts, e.g. 1m
+	Timeout             string // period of the open state, e.g. 30s
+	ConsecutiveFailures uint32 `json:"consecutive_failures" yaml:"consecutive_failures"` // failures opening the breaker
+}
+
+// appcodeRetry describes how the transient database errors are retried
+type appcodeRetry struct {
+	MaxAttempts int    `json:"max_attempts" yaml:"max_attempts"` // attempts, the first one included, retries are enabled above 1
+	BaseDelay   string `json:"base_delay" yaml:"base_delay"`     // delay before the first retry, doubled at each attempt, e.g. 50ms
+	MaxDelay    string `json:"max_delay" yaml:"max_delay"`       // upper bound of the delay, e.g. 1s
+}
+
+// appcodeGorm describes the gorm options set by the generated Open
+type appcodeGorm struct {
+	// Version of gorm, either v1 for github.com/jinzhu/gorm or v2 for gorm.io/gorm, see -gorm
+	Version string
+	// PrepareStmt caches the prepared statements, gorm v2 only
+	PrepareStmt bool `json:"prepare_stmt" yaml:"prepare_stmt"`
+	// SkipDefaultTransaction doesn't wrap single writes in a transaction, gorm v2 only
+	SkipDefaultTransaction bool `json:"skip_default_transaction" yaml:"skip_default_transaction"`
+}
+
+// appcodeLogger describes how the generated models log the SQL statements
+type appcodeLogger struct {
+	Level         string // either silent, error, warn or info
+	SlowThreshold string `json:"slow_threshold" yaml:"slow_threshold"` // duration from which a query is logged at the warn level, e.g. 200ms
+	JSON          bool   // one JSON object per line instead of the text format of gorm
+	// SlowLog also records the slow queries in a rotating file, whatever the level
+	SlowLog appcodeSlowLog `json:"slow_log" yaml:"slow_log"`
+}
+
+// appcodeSlowLog describes the file recording the slow queries
+type appcodeSlowLog struct {
+	File       string // path of the file, relative to the working directory of the application, e.g. logs/slow.log
+	MaxSizeMB  int    `json:"max_size_mb" yaml:"max_size_mb"` // size from which the file is rotated, 100 by default
+	MaxBackups int    `json:"max_backups" yaml:"max_backups"` // rotated files kept, 3 by default
+}
+
+// appcodeRouter describes how the generated routes look like
+type appcodeRouter struct {
+	VersionPrefix string `json:"version_prefix" yaml:"version_prefix"`
+	Pluralize     bool   // use pluralized kebab-case resource paths, e.g. /v1/user-accounts
+	// Modules groups the tables by module, each module getting its own routes file
+	Modules map[string][]string
+}
+
+// appcodeFiles describes how the generated files are named
+type appcodeFiles struct {
+	Case             string // either snake (default), e.g. user_account.go, or camel, e.g. userAccount.go
+	ModelSuffix      string `json:"model_suffix" yaml:"model_suffix"`           // e.g. _dao gives user_dao.go
+	ControllerSuffix string `json:"controller_suffix" yaml:"controller_suffix"` // e.g. _controller gives user_controller.go
+}
+
+// appcodeTable holds the generation options of a single table
+type appcodeTable struct {
+	DisabledMethods []string          `json:"disabled_methods" yaml:"disabled_methods"`   // HTTP verbs not to generate, e.g. delete
+	ReadOnly        bool              `json:"read_only" yaml:"read_only"`                 // only generate read paths
+	Immutable       []string          `json:"immutable_columns" yaml:"immutable_columns"` // columns never updated after insert
+	Rename          map[string]string `json:"rename" yaml:"rename"`                       // model field names keyed by column name
+	Level           string            // generation level of the table narrowing the one of the command, e.g. 1 for models only
+	Large           bool              // unfiltered lists count the rows from the statistics of the database
+	Jobs            []string          // background jobs generated for the table: import, export or purge
+	Retention       string            // soft deleted rows older than it are purged by a scheduled task, e.g. 720h
+	RetentionColumn string            `json:"retention_column" yaml:"retention_column"` // time of deletion, defaults to the column updated on each write
+	Unscoped        bool              // the tenant column doesn't scope the queries of the table
+	DefaultScope    string            `json:"default_scope" yaml:"default_scope"` // SQL condition restricting the queries of the table, e.g. status != 'draft'
+	Tree            bool              // the table is an adjacency list, its foreign key to itself referencing the parent of a row
+	Encrypted       []string          `json:"encrypted_columns" yaml:"encrypted_columns"` // string columns stored encrypted with AES-GCM
+	SignatureColumn string            `json:"signature_column" yaml:"signature_column"`   // column holding the HMAC of the signed columns, defaults to signature, checksum or hmac
+	Signed          []string          `json:"signed_columns" yaml:"signed_columns"`       // columns of the signed records, defaults to the ones written as they are
+	Cache           appcodeCache      // in-process cache of the records read by id
+	ReadModel       bool              `json:"read_model" yaml:"read_model"` // the records are also served with the records referencing them
+	Sensitive       map[string]string // masking of the columns in the responses keyed by column name: phone, id_card, email or full
+	Excluded        []string          `json:"excluded_columns" yaml:"excluded_columns"` // columns left out of the model, e.g. legacy or internal ones
+	// Types holds the Go types of the model fields keyed by column name, qualified by the
+	// import path of their package, e.g. github.com/shopspring/decimal.Decimal or *string
+	Types map[string]string
+}
+
+// appcodeCache describes the LRU cache of the records of a read-heavy table
+type appcodeCache struct {
+	Size int    // records held at most
+	TTL  string // time after which a cached record is read again, e.g. 5m
+}
+
 // LoadConfig loads the bee tool configuration.
-// It looks for Beefile or hee.json in the current path,
+// It looks for Beefile, hee.yaml, hee.toml or hee.json in the current path,
 // and falls back to default configuration in case not found.
 func LoadConfig() {
 	currentPath, err := os.Getwd()
@@ -105,7 +310,7 @@ func LoadConfig() {
 				}
 				break
 			}
-		case "Beefile":
+		case "Beefile", "hee.yaml":
 			{
 				err = parseYAML(filepath.Join(currentPath, file.Name()), &Conf)
 				if err != nil {
@@ -113,6 +318,14 @@ func LoadConfig() {
 				}
 				break
 			}
+		case "hee.toml":
+			{
+				err = parseTOML(filepath.Join(currentPath, file.Name()), &Conf)
+				if err != nil {
+					beeLogger.Log.Errorf("Failed to parse TOML file: %s", err)
+				}
+				break
+			}
 		}
 	}
 
@@ -132,6 +345,57 @@ func LoadConfig() {
 	}
 }
 
+// LoadConfigFile overlays the configuration file at path onto the configuration,
+// its format being told by its extension: .json, .toml, or YAML otherwise
+func LoadConfigFile(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return parseJSON(path, &Conf)
+	case ".toml":
+		return parseTOML(path, &Conf)
+	default:
+		return parseYAML(path, &Conf)
+	}
+}
+
+// UseProfile overlays the named profile of the configuration onto it,
+// the options set by the profile replace the top-level ones
+func UseProfile(name string) error {
+	profile, ok := Conf.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile '%s' not found", name)
+	}
+	// decoding JSON into the configuration only replaces the options present,
+	// the json and yaml names of the options being the same
+	data, err := json.Marshal(stringKeys(profile))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &Conf)
+}
+
+// stringKeys converts the maps decoded from YAML, keyed by interface{},
+// into maps keyed by string which can be encoded as JSON
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = stringKeys(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = stringKeys(e)
+		}
+	}
+	return v
+}
+
 func parseJSON(path string, v interface{}) error {
 	var (
 		data []byte
@@ -157,3 +421,17 @@ func parseYAML(path string, v interface{}) error {
 	err = yaml.Unmarshal(data, v)
 	return err
 }
+
+// parseTOML decodes the TOML file at path into v through JSON,
+// the TOML keys being the json names of the options
+func parseTOML(path string, v interface{}) error {
+	var m map[string]interface{}
+	if _, err := toml.DecodeFile(path, &m); err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
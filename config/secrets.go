@@ -0,0 +1,97 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var secretRef = regexp.MustCompile(`\$\{(env|file|cmd):([^}]*)\}`)
+
+// ResolveSecrets replaces the secret references found in value, so that credentials
+// such as connection strings don't have to be written in the configuration or typed
+// on the command line:
+//
+//	${env:NAME}    the value of the environment variable NAME
+//	${file:path}   the content of a file, e.g. a Docker secret
+//	${cmd:command} the output of a shell command, which must not contain '}'
+func ResolveSecrets(value string) (string, error) {
+	var err error
+	resolved := secretRef.ReplaceAllStringFunc(value, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := secretRef.FindStringSubmatch(ref)
+		var secret string
+		secret, err = resolveSecret(m[1], m[2])
+		return secret
+	})
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+func resolveSecret(kind, ref string) (string, error) {
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("environment variable '%s' is not set", ref)
+		}
+		return v, nil
+	case "file":
+		data, err := ioutil.ReadFile(ref)
+		if err != nil {
+			return "", fmt.Errorf("could not read secret file: %s", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", ref)
+		} else {
+			cmd = exec.Command("sh", "-c", ref)
+		}
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("could not run secret command '%s': %s", ref, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+}
+
+var (
+	urlPassword   = regexp.MustCompile(`(://[^:/@]*:)[^/?#]*@`)
+	paramPassword = regexp.MustCompile(`(?i)\b((?:password|pwd)\s*=\s*)[^;&\s]*`)
+	dsnPassword   = regexp.MustCompile(`^([^:/@\s]+[:/])[^(]*@`)
+)
+
+// RedactSecrets hides the password of a connection string, e.g. before logging it:
+// the password of URLs, of the password and pwd parameters, and of the user:password@
+// and user/password@ prefixes of the MySQL and Oracle DSNs
+func RedactSecrets(conn string) string {
+	conn = paramPassword.ReplaceAllString(conn, "${1}***")
+	if strings.Contains(conn, "://") {
+		return urlPassword.ReplaceAllString(conn, "${1}***@")
+	}
+	return dsnPassword.ReplaceAllString(conn, "${1}***@")
+}
@@ -24,3 +24,26 @@ var Fields utils.DocValue
 var DDL utils.DocValue
 var Path utils.DocValue
 var DownSwagger bool
+var Sqlc bool
+var ServeMux bool
+var Contract bool
+var SoftUnique bool
+var TimeWrapper bool
+var TimeLayout utils.DocValue
+var TimeZone utils.DocValue
+var TargetConn utils.DocValue
+var Profile utils.DocValue
+var KeepPkName bool
+var Examples bool
+var Diagram utils.DocValue
+var ForceMajor bool
+var PgDriver utils.DocValue
+var GormVersion utils.DocValue
+var GormShim bool
+var ORM utils.DocValue
+var Only utils.DocValue
+var Skip utils.DocValue
+var ConfigFile utils.DocValue
+var Hexagonal bool
+var Refresh bool
+var DebugTemplates bool
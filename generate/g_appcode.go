@@ -17,15 +17,19 @@ package generate
 import (
 	"database/sql"
 	"fmt"
+	"go/format"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"text/template"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	"github.com/skOak/hee/config"
 	beeLogger "github.com/skOak/hee/logger"
 	"github.com/skOak/hee/logger/colors"
 	"github.com/skOak/hee/utils"
@@ -35,6 +39,11 @@ const (
 	OModel byte = 1 << iota
 	OController
 	ORouter
+	OSqlc
+	OJobs
+	OHandlers
+	OContract
+	ODomain
 )
 
 // DbTransformer has method to reverse engineer a database schema to restful api code
@@ -47,22 +56,92 @@ type DbTransformer interface {
 
 // MysqlDB is the MySQL version of DbTransformer
 type MysqlDB struct {
+	// TiDB, whose primary keys may be AUTO_RANDOM and whose rows may not be
+	// clustered by their primary key
+	tidb bool
 }
 
 // PostgresDB is the PostgreSQL version of DbTransformer
 type PostgresDB struct {
+	// CockroachDB, whose primary keys are INT8 filled in by unique_rowid() or
+	// UUID filled in by gen_random_uuid()
+	cockroach bool
 }
 
 // dbDriver maps a DBMS name to its version of DbTransformer
 var dbDriver = map[string]DbTransformer{
-	"mysql":    &MysqlDB{},
-	"postgres": &PostgresDB{},
+	"mysql":      &MysqlDB{},
+	"tidb":       &MysqlDB{tidb: true},
+	"postgres":   &PostgresDB{},
+	"cockroach":  &PostgresDB{cockroach: true},
+	"sqlite":     &SqliteDB{},
+	"mssql":      &MssqlDB{},
+	"oracle":     &OracleDB{},
+	"clickhouse": &ClickHouseDB{},
+}
+
+// taggedDrivers are the database/sql drivers of the DBMS only built in with a build
+// tag, keyed by DBMS name, see g_<tag>_driver.go
+var taggedDrivers = map[string]struct{ Name, Tag string }{
+	"sqlite":     {"sqlite3", "sqlite"},
+	"mssql":      {"sqlserver", "mssql"},
+	"oracle":     {"oracle", "oracle"},
+	"clickhouse": {"clickhouse", "clickhouse"},
+}
+
+// driverDialects maps the DBMS speaking the wire protocol and the SQL of another one
+// to the DBMS whose code is generated for them, their own DbTransformer introspecting them
+var driverDialects = map[string]string{
+	"cockroach": "postgres",
+	"tidb":      "mysql",
+}
+
+// driverDialect returns the DBMS whose code is generated for the database of driver
+func driverDialect(driver string) string {
+	if dbms, ok := driverDialects[driver]; ok {
+		return dbms
+	}
+	return driver
+}
+
+// sqlDriverName returns the name of the database/sql driver of dbms, failing when
+// hee was built without it
+func sqlDriverName(dbms string) string {
+	driver, ok := taggedDrivers[dbms]
+	if !ok {
+		return dbms
+	}
+	for _, name := range sql.Drivers() {
+		if name == driver.Name {
+			return name
+		}
+	}
+	beeLogger.Log.Fatalf("hee is built without the %s driver, rebuild it with: go install -tags %s github.com/skOak/hee", dbms, driver.Tag)
+	return ""
 }
 
 type MvcPath struct {
-	ModelPath      string
-	ControllerPath string
-	RouterPath     string
+	ModelPath       string
+	ControllerPath  string
+	RouterPath      string
+	SqlcPath        string
+	JobsPath        string
+	HandlersPath    string
+	ContractPath    string
+	DomainPath      string
+	PersistencePath string
+}
+
+// templateFuncs holds the functions available to the appcode templates
+var templateFuncs = template.FuncMap{
+	"hasPrefix":   strings.HasPrefix,
+	"camelCase":   utils.CamelCase,
+	"wrapCalls":   wrapCalls,
+	"i18n":        i18nEnabled,
+	"join":        strings.Join,
+	"idempotency": idempotencyEnabled,
+	"di":          diEnabled,
+	"gormV2":      gormV2,
 }
 
 // typeMapping maps SQL data type to corresponding Go data type
@@ -145,17 +224,49 @@ type Table struct {
 	Pk            string
 	PkType        string
 	Uk            []string
+	UkNames       map[string]string // names of the single column unique keys, keyed by column
 	Fk            map[string]*ForeignKey
 	Columns       []*Column
 	ImportTimePkg bool
-	IdDelete      bool // 是否存在is_deleleted字段
+	IdDelete      bool     // 是否存在is_deleleted字段
+	Notes         []string // lines of the doc comment of the model, e.g. on the storage of the table
+	CustomImports []string // packages of the custom types of the fields, see appcode.tables.<table>.types
+
+	ReadOnly        bool           // only read paths are generated for the table
+	Large           bool           // rows are counted from the statistics of the database when unfiltered
+	Jobs            []string       // background jobs generated for the table, e.g. JobImport
+	Retention       time.Duration  // soft deleted rows older than it are purged, see RetentionColumn
+	RetentionColumn string         // column holding the time of deletion of soft deleted rows
+	TenantColumn    string         // column holding the owner of a row, scoping the queries
+	DefaultScope    string         // SQL condition restricting the queries unless Unscoped
+	Localization    *localization  // translations of the columns, see detectLocalizations
+	TreeParent      string         // column referencing the parent of a row of a tree, see applyTree
+	Closure         *closure       // closure table of the tree, see detectClosures
+	Money           []*moneyColumn // amount columns read as a Money, see applyMoney
+	Sequence        string         // Oracle sequence the ids of the new rows are read from
+	SignatureColumn string         // column holding the HMAC of the Signed columns of a row
+	Signed          []string
+	CacheSize       int           // records of the LRU cache of the records read by id, none when 0
+	CacheTTL        time.Duration // time after which a cached record expires
+	ReadModel       bool          // the records are also read with the records of the Children
+	Children        []*ViewChild
+	DisabledMethods map[string]bool // HTTP methods the controller must not serve
+
+	Versioning   string // VersioningSystem or VersioningHistory when past rows are kept
+	HistoryTable string // table holding the past rows, with VersioningHistory
+	HistoryFrom  string // columns of HistoryTable holding the validity period of a row
+	HistoryTo    string
 }
 
 // Column reprsents a column for a table
 type Column struct {
-	Name string
-	Type string
-	Tag  *OrmTag
+	Name      string
+	Type      string
+	SQLType   string // full column type in the database, e.g. varchar(255)
+	Tag       *OrmTag
+	Immutable bool   // excluded from updates once the row is created
+	Mask      string // masking of the sensitive column in the responses, e.g. phone
+	Encrypted bool   // stored encrypted, see encryptedType
 }
 
 // ForeignKey represents a foreign key column for a table
@@ -180,19 +291,31 @@ type OrmTag struct {
 	AutoNow     bool
 	AutoNowAdd  bool
 	Type        string
-	Default     string
+	Precision   string // fractional seconds precision of temporal columns
+	Default     string // literal default, quoted when it is not a number, e.g. 'active'
+	DefaultExpr string // default computed by the database, e.g. uuid()
 	RelOne      bool
 	ReverseOne  bool
 	RelFk       bool
 	TableFk     string
+	FkNull      bool // the column of the relation accepts NULL
 	ReverseMany bool
 	RelM2M      bool
 	Comment     string //column comment
+	Example     string // anonymized sampled value, see sampleExamples
+	Semantic    string // kind of the values, e.g. email, see applySemantics
 }
 
 // String returns the source code string for the Table struct
 func (tb *Table) String() string {
-	rv := fmt.Sprintf("type %s struct {\n", utils.CamelCase(tb.Name))
+	rv := ""
+	if len(tb.Notes) > 0 {
+		rv = fmt.Sprintf("// %s is a record of %s.\n//\n", utils.CamelCase(tb.Name), tb.Name)
+		for _, note := range tb.Notes {
+			rv += "// " + note + "\n"
+		}
+	}
+	rv += fmt.Sprintf("type %s struct {\n", utils.CamelCase(tb.Name))
 	for _, v := range tb.Columns {
 		rv += v.String() + "\n"
 	}
@@ -203,21 +326,96 @@ func (tb *Table) String() string {
 // String returns the source code string of a field in Table struct
 // It maps to a column in database table. e.g. Id int `gorm:"column:id;auto"`
 func (col *Column) String() string {
-	return fmt.Sprintf("%s %s %s", col.Name, col.Type, col.Tag.String())
+	return fmt.Sprintf("%s %s %s", col.Name, col.Type, col.Tag.string(col.Immutable))
+}
+
+// BaseType returns the Go type of the column without pointer indirection
+func (col *Column) BaseType() string {
+	return strings.TrimPrefix(col.Type, "*")
+}
+
+// UniqueColumns returns the columns with a unique constraint, primary key excluded
+func (tb *Table) UniqueColumns() (cols []*Column) {
+	for _, name := range tb.Uk {
+		if col := tb.Column(name); col != nil && name != tb.Pk {
+			cols = append(cols, col)
+		}
+	}
+	return
+}
+
+// nameUniqueKeys records the names of the single column keys of keys, the columns
+// of the unique keys keyed by name
+func (tb *Table) nameUniqueKeys(keys map[string][]string) {
+	tb.UkNames = make(map[string]string)
+	for name, cols := range keys {
+		if len(cols) == 1 {
+			tb.UkNames[cols[0]] = name
+		}
+	}
+}
+
+// ConflictColumns returns the unique columns whose values are checked before a record
+// is created, the encrypted columns and the relations, which can't be compared, left out
+func (tb *Table) ConflictColumns() (cols []*Column) {
+	for _, col := range tb.UniqueColumns() {
+		if !col.Encrypted && !col.Tag.RelFk {
+			cols = append(cols, col)
+		}
+	}
+	return
+}
+
+// IdentityColumns returns the columns identifying a record or tracking its life
+// rather than holding business data: the primary key, the creation, update and
+// deletion times, the soft delete flag and the signature
+func (tb *Table) IdentityColumns() (cols []*Column) {
+	for _, col := range tb.Columns {
+		switch col.Tag.Column {
+		case tb.Pk, "created_at", "updated_at", "is_deleted", tb.RetentionColumn, tb.SignatureColumn:
+			cols = append(cols, col)
+		}
+	}
+	return
+}
+
+// Nullable reports whether the column is held by a pointer, nil standing for NULL
+func (col *Column) Nullable() bool {
+	return strings.HasPrefix(col.Type, "*") && !col.Tag.RelFk
+}
+
+// Filterable reports whether the column gets a field in the generated filter struct.
+// Relations, the soft delete flags and the encrypted columns, which can't be compared, are left out.
+func (col *Column) Filterable() bool {
+	return !col.Tag.RelFk && col.Tag.Column != "is_deleted" && col.Type != "gorm.DeletedAt" && !col.Encrypted
+}
+
+// Ranged reports whether the generated filter struct supports range conditions
+// on the column, which is the case for numbers and times
+func (col *Column) Ranged() bool {
+	t := col.BaseType()
+	return strings.HasPrefix(t, "int") || strings.HasPrefix(t, "uint") ||
+		strings.HasPrefix(t, "float") || t == "time.Time" || t == "Time"
 }
 
 // String returns the ORM tag string for a column
 func (tag *OrmTag) String() string {
+	return tag.string(false)
+}
+
+// string returns the ORM tag string for a column, written on create only if createOnly
+func (tag *OrmTag) string(createOnly bool) string {
 	var ormOptions []string
-	var sqlOptions []string
 	if tag.Column != "" {
 		ormOptions = append(ormOptions, fmt.Sprintf("column:%s", tag.Column))
 	}
-	if tag.Auto {
+	if tag.Auto && gormV2() {
+		ormOptions = append(ormOptions, "autoIncrement")
+	} else if tag.Auto {
 		ormOptions = append(ormOptions, "AUTO_INCREMENT")
 	}
 	if tag.Size != "" {
-		ormOptions = append(ormOptions, fmt.Sprintf("size:%s:", tag.Size))
+		ormOptions = append(ormOptions, fmt.Sprintf("size:%s", tag.Size))
 	}
 	if tag.Type != "" {
 		ormOptions = append(ormOptions, fmt.Sprintf("type:%s", tag.Type))
@@ -227,7 +425,14 @@ func (tag *OrmTag) String() string {
 	}
 	if tag.AutoNow || tag.AutoNowAdd {
 		//ormOptions = append(ormOptions, "auto_now")
-		sqlOptions = append(sqlOptions, "default:current_timestamp")
+		if tag.Precision != "" {
+			ormOptions = append(ormOptions, fmt.Sprintf("default:current_timestamp(%s)", tag.Precision))
+		} else {
+			ormOptions = append(ormOptions, "default:current_timestamp")
+		}
+	}
+	if tag.DefaultExpr != "" {
+		ormOptions = append(ormOptions, fmt.Sprintf("default:%s", tag.DefaultExpr))
 	}
 	//if tag.AutoNowAdd {
 	//	ormOptions = append(ormOptions, "auto_now_add")
@@ -250,40 +455,117 @@ func (tag *OrmTag) String() string {
 	//if tag.RelM2M {
 	//	ormOptions = append(ormOptions, "rel(m2m)")
 	//}
-	if tag.Pk {
+	if tag.Pk && gormV2() {
+		ormOptions = append(ormOptions, "primaryKey")
+	} else if tag.Pk {
 		ormOptions = append(ormOptions, "primary_key")
 	}
 	if tag.Unique {
 		ormOptions = append(ormOptions, "unique")
 	}
 	if tag.Default != "" {
-		ormOptions = append(sqlOptions, fmt.Sprintf("default:%s", tag.Default))
+		ormOptions = append(ormOptions, fmt.Sprintf("default:%s", tag.Default))
+	}
+	if (createOnly || tag.AutoNowAdd) && !tag.Pk && gormV2() {
+		// gorm v2 leaves the column out of the updates
+		ormOptions = append(ormOptions, "<-:create")
 	}
 
 	if len(ormOptions) == 0 {
 		return ""
 	}
-	if tag.Comment != "" {
-		return fmt.Sprintf("`json:\"%s\" gorm:\"%s\" description:\"%s\"`", tag.Column, strings.Join(ormOptions, ";"), tag.Comment)
-	}
-	if len(sqlOptions) > 0 {
-		return fmt.Sprintf("`json:\"%s\" gorm:\"%s\" sql:\"%s\"`", tag.Column, strings.Join(ormOptions, ";"), strings.Join(sqlOptions, ";"))
+	st := new(StructTag)
+	st.Add("json", tag.Column)
+	if sqlxMode() {
+		st.Add("db", tag.Column)
+	} else {
+		st.Add("gorm", ormOptions...)
 	}
-	return fmt.Sprintf("`json:\"%s\" gorm:\"%s\"`", tag.Column, strings.Join(ormOptions, ";"))
+	st.Add("description", tag.Comment).Add("example", tag.Example)
+	st.Add("validate", tag.semanticValidation()...)
+	addCustomTags(st, tag)
+	return st.String()
 }
 
-func GenerateAppcode(driver, connStr, level, tables, currpath string) {
-	var mode byte
+// levelMode returns the mode of a generation level, i.e. 1=models; 2=models and controllers;
+// 3=models, controllers and routers
+func levelMode(level string) (byte, bool) {
 	switch level {
 	case "1":
-		mode = OModel
+		return OModel, true
 	case "2":
-		mode = OModel | OController
+		return OModel | OController, true
 	case "3":
-		mode = OModel | OController | ORouter
-	default:
+		return OModel | OController | ORouter, true
+	}
+	return 0, false
+}
+
+// artifactMode returns the mode generating the kinds of files of a comma separated list,
+// e.g. models,routers
+func artifactMode(kinds string) (mode byte) {
+	for _, kind := range strings.Split(kinds, ",") {
+		switch strings.TrimSpace(kind) {
+		case "models", "model":
+			mode |= OModel
+		case "controllers", "controller":
+			mode |= OController
+		case "routers", "router":
+			mode |= ORouter
+		case "sqlc":
+			mode |= OSqlc
+		case "jobs":
+			mode |= OJobs
+		case "handlers":
+			mode |= OHandlers
+		case "contract":
+			mode |= OContract
+		case "domain":
+			mode |= ODomain
+		default:
+			beeLogger.Log.Fatalf("Unknown kind of file '%s'. Must be either \"models\", \"controllers\", \"routers\", \"sqlc\", \"jobs\", \"handlers\", \"contract\" or \"domain\"", kind)
+		}
+	}
+	return
+}
+
+func GenerateAppcode(driver, connStr, level, tables, currpath string) {
+	mode, ok := levelMode(level)
+	if !ok {
 		beeLogger.Log.Fatal("Invalid level value. Must be either \"1\", \"2\", or \"3\"")
 	}
+	applyFeatures()
+	if Sqlc {
+		mode |= OSqlc
+	}
+	if jobsConfigured() {
+		mode |= OJobs
+	}
+	if ServeMux || diEnabled() {
+		// the database is injected into the net/http handlers
+		mode |= OHandlers
+	}
+	if Contract {
+		// the implementation is left to the server interface of oapi-codegen
+		mode = OContract
+	}
+	if Hexagonal {
+		// the models are the persistence structs of the domain entities
+		mode = OModel | ODomain
+	}
+	if Only != "" {
+		mode = artifactMode(Only.String())
+	}
+	if Skip != "" {
+		mode &^= artifactMode(Skip.String())
+	}
+	if sqlxMode() {
+		// the other kinds of files are built on the gorm models
+		mode &= OModel | OSqlc
+	}
+	if mode == 0 {
+		beeLogger.Log.Fatal("Nothing to generate, every kind of file is skipped")
+	}
 	var selectedTables map[string]bool
 	if tables != "" {
 		selectedTables = make(map[string]bool)
@@ -294,23 +576,33 @@ func GenerateAppcode(driver, connStr, level, tables, currpath string) {
 	switch driver {
 	case "mysql":
 	case "postgres":
+	case "cockroach":
+	case "tidb":
 	case "sqlite":
-		beeLogger.Log.Fatal("Generating app code from SQLite database is not supported yet.")
+	case "mssql":
+	case "oracle":
+	case "clickhouse":
 	default:
-		beeLogger.Log.Fatal("Unknown database driver. Must be either \"mysql\", \"postgres\" or \"sqlite\"")
+		beeLogger.Log.Fatal("Unknown database driver. Must be either \"mysql\", \"tidb\", \"postgres\", \"cockroach\", \"sqlite\", \"mssql\", \"oracle\" or \"clickhouse\"")
 	}
+	checkIdempotency(driver)
+	checkHexagonal(driverDialect(driver))
+	checkGormV2(driverDialect(driver))
+	checkGormShim()
+	checkSqlx(driverDialect(driver))
 	gen(driver, connStr, mode, selectedTables, currpath)
 }
 
 // Generate takes table, column and foreign key information from database connection
 // and generate corresponding golang source files
-func gen(dbms, connStr string, mode byte, selectedTableNames map[string]bool, apppath string) {
-	db, err := sql.Open(dbms, connStr)
+func gen(driver, connStr string, mode byte, selectedTableNames map[string]bool, apppath string) {
+	dbms := driverDialect(driver)
+	db, err := openSchemaCache(dbms, connStr)
 	if err != nil {
-		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", dbms, connStr, err)
+		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", driver, config.RedactSecrets(connStr), err)
 	}
 	defer db.Close()
-	if trans, ok := dbDriver[dbms]; ok {
+	if trans, ok := dbDriver[driver]; ok {
 		beeLogger.Log.Info("Analyzing database tables...")
 		var tableNames []string
 		if len(selectedTableNames) != 0 {
@@ -321,15 +613,67 @@ func gen(dbms, connStr string, mode byte, selectedTableNames map[string]bool, ap
 			tableNames = trans.GetTableNames(db)
 		}
 		tables := getTableObjects(tableNames, db, trans)
+		fingerprint := fingerprintDatabase(dbms, db, tables, len(selectedTableNames) == 0)
+		checkDatabaseFingerprint(fingerprint, apppath)
+		checkMajorChange(tables, len(selectedTableNames) == 0, mode, apppath)
+		snapshotSchema(tables, len(selectedTableNames) == 0, apppath)
+		if TargetConn != "" {
+			beeLogger.Log.Info("Diffing against the target database...")
+			tables = restrictToTarget(dbms, TargetConn.String(), trans, tables)
+		}
+		applyTableConfig(tables)
+		if gormV2() {
+			useGormV2(tables)
+		}
+		if sqlxMode() {
+			useSqlx(tables)
+		}
+		if TimeWrapper {
+			useTimeWrapper(tables)
+		}
+		detectLocalizations(db, trans, tables)
+		detectClosures(db, trans, tables)
+		if featureEnabled(FeatureAudit) {
+			detectVersioning(dbms, db, trans, tables)
+		}
+		if Examples {
+			beeLogger.Log.Info("Sampling the examples of the columns...")
+			sampleExamples(dbms, db, tables)
+		}
 		mvcPath := new(MvcPath)
-		mvcPath.ModelPath = path.Join(apppath, "models")
-		mvcPath.ControllerPath = path.Join(apppath, "controllers")
-		mvcPath.RouterPath = path.Join(apppath, "routers")
+		mvcPath.ModelPath = path.Join(apppath, outputDir("models"))
+		mvcPath.ControllerPath = path.Join(apppath, outputDir("controllers"))
+		mvcPath.RouterPath = path.Join(apppath, outputDir("routers"))
+		mvcPath.SqlcPath = path.Join(apppath, outputDir("queries"))
+		mvcPath.JobsPath = path.Join(apppath, outputDir("jobs"))
+		mvcPath.HandlersPath = path.Join(apppath, outputDir("handlers"))
+		mvcPath.ContractPath = path.Join(apppath, outputDir("api"))
+		mvcPath.DomainPath = path.Join(apppath, outputDir("domain"))
+		mvcPath.PersistencePath = path.Join(apppath, outputDir("persistence"))
 		createPaths(mode, mvcPath)
 		pkgPath := getPackagePath(apppath)
+		setOutputImports(pkgPath)
+		checkFileNames(selectTables(tables, selectedTableNames), mode)
 		writeSourceFiles(dbms, pkgPath, tables, mode, mvcPath, selectedTableNames)
+		updateManifest(selectTables(tables, selectedTableNames), mode, fingerprint, apppath)
+		if apiVersioned() {
+			beeLogger.Log.Info("Creating the DTOs of the former API versions...")
+			writeDtoFiles(selectTables(tables, selectedTableNames), pkgPath, apppath)
+		}
+		if Diagram != "" {
+			beeLogger.Log.Info("Creating the ER diagram...")
+			writeDiagram(tablesInFKOrder(tables), Diagram.String(), apppath)
+		}
+		if SoftUnique {
+			beeLogger.Log.Info("Creating soft delete aware unique key migrations...")
+			writeSoftUniqueMigrations(dbms, selectTables(tablesInFKOrder(tables), selectedTableNames), apppath)
+		}
+		if idempotencyEnabled() {
+			writeIdempotencyMigration(dbms, apppath)
+		}
+		lintSchema(dbms, db, tables)
 	} else {
-		beeLogger.Log.Fatalf("Generating app code from '%s' database is not supported yet.", dbms)
+		beeLogger.Log.Fatalf("Generating app code from '%s' database is not supported yet.", driver)
 	}
 }
 
@@ -377,7 +721,7 @@ func getTableObjects(tableNames []string, db *sql.DB, dbTransformer DbTransforme
 func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
 	rows, err := db.Query(
 		`SELECT
-			c.constraint_type, u.column_name, u.referenced_table_schema, u.referenced_table_name, referenced_column_name, u.ordinal_position
+			c.constraint_type, c.constraint_name, u.column_name, u.referenced_table_schema, u.referenced_table_name, referenced_column_name, u.ordinal_position
 		FROM
 			information_schema.table_constraints c
 		INNER JOIN
@@ -388,9 +732,10 @@ func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bo
 	if err != nil {
 		beeLogger.Log.Fatal("Could not query INFORMATION_SCHEMA for PK/UK/FK information")
 	}
+	uks := make(map[string][]string)
 	for rows.Next() {
-		var constraintTypeBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
-		if err := rows.Scan(&constraintTypeBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
+		var constraintTypeBytes, constraintNameBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
+		if err := rows.Scan(&constraintTypeBytes, &constraintNameBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
 			beeLogger.Log.Fatal("Could not read INFORMATION_SCHEMA for PK/UK/FK information")
 		}
 		constraintType, columnName, refTableSchema, refTableName, refColumnName, refOrdinalPos :=
@@ -407,6 +752,7 @@ func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bo
 			}
 		} else if constraintType == "UNIQUE" {
 			table.Uk = append(table.Uk, columnName)
+			uks[string(constraintNameBytes)] = append(uks[string(constraintNameBytes)], columnName)
 		} else if constraintType == "FOREIGN KEY" {
 			fk := new(ForeignKey)
 			fk.Name = columnName
@@ -416,11 +762,16 @@ func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bo
 			table.Fk[columnName] = fk
 		}
 	}
+	table.nameUniqueKeys(uks)
 }
 
 // GetColumns retrieves columns details from
 // information_schema and fill in the Column struct
 func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+	var storage tidbStorage
+	if mysqlDB.tidb {
+		storage = tidbTableStorage(db, table)
+	}
 	// retrieve columns
 	colDefRows, err := db.Query(
 		`SELECT
@@ -443,6 +794,11 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 		}
 		colName, dataType, columnType, isNullable, columnDefault, extra, columnComment :=
 			string(colNameBytes), string(dataTypeBytes), string(columnTypeBytes), string(isNullableBytes), string(columnDefaultBytes), string(extraBytes), string(columnCommentBytes)
+		// invisible columns (MySQL 8) are left out of SELECT *, so they can't be mapped
+		if strings.Contains(strings.ToUpper(extra), "INVISIBLE") {
+			beeLogger.Log.Infof("Skipping invisible column '%s.%s'", table.Name, colName)
+			continue
+		}
 
 		// create a column
 		col := new(Column)
@@ -470,12 +826,18 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 		tag.Column = colName
 		tag.Comment = columnComment
 		if table.Pk == colName {
-			col.Name = "Id"
+			if KeepPkName {
+				// gorm only guesses the primary key of a field named Id
+				tag.Pk = true
+			} else {
+				col.Name = "Id"
+			}
 			//col.Type = "int"
 			table.PkType = col.Type
-			if extra == "auto_increment" {
+			if strings.Contains(extra, "auto_increment") {
 				tag.Auto = true
 			} else {
+				// the AUTO_RANDOM ids left empty are generated, then read back as the last insert id
 				tag.Pk = true
 			}
 		} else {
@@ -489,12 +851,13 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 				tag.RelFk = true
 				refStructName := fkCol.RefTable
 				tag.TableFk = refStructName
+				tag.FkNull = isNullable == "YES"
 				col.Name = utils.CamelCase(colName)
 				col.Type = "*" + utils.CamelCase(refStructName)
 			} else {
 				// if the name of column is Id, and it's not primary key
 				if colName == "id" {
-					col.Name = "Id_RENAME"
+					col.Name = idFieldName
 				}
 				if isNullable == "YES" {
 					tag.Null = true
@@ -502,17 +865,31 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 				if isSQLStringType(dataType) {
 					tag.Size = extractColSize(columnType)
 				}
-				if isSQLTemporalType(dataType) {
+				if isSQLTextType(dataType) {
 					tag.Type = dataType
+				}
+				if isSQLTemporalType(dataType) {
+					// column_type keeps the fractional seconds precision, e.g. datetime(3)
+					tag.Type = columnType
+					tag.Precision = extractTemporalPrecision(columnType)
 					//check auto_now, auto_now_add
-					if columnDefault == "CURRENT_TIMESTAMP" && extra == "on update CURRENT_TIMESTAMP" {
+					if isCurrentTimestamp(columnDefault) && isOnUpdateCurrentTimestamp(extra) {
 						tag.AutoNow = true
-					} else if columnDefault == "CURRENT_TIMESTAMP" {
+					} else if isCurrentTimestamp(columnDefault) {
 						tag.AutoNowAdd = true
 					}
+					// NULL must not be read as the zero time, use a pointer instead
+					if tag.Null {
+						col.Type = "*" + col.Type
+					}
 					// need to import time package
 					table.ImportTimePkg = true
 				}
+				if !tag.AutoNow && !tag.AutoNowAdd && isDefaultExpr(columnDefault, extra) {
+					tag.DefaultExpr = columnDefault
+				} else if !tag.AutoNow && !tag.AutoNowAdd && columnDefault != "" {
+					tag.Default = literalDefault(colName, columnDefault)
+				}
 				if isSQLDecimal(dataType) {
 					tag.Digits, tag.Decimals = extractDecimal(columnType)
 				}
@@ -524,9 +901,14 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 				}
 			}
 		}
+		col.SQLType = columnType
 		col.Tag = tag
 		table.Columns = append(table.Columns, col)
 	}
+	if mysqlDB.tidb {
+		pk := table.Column(table.Pk)
+		table.Notes = tidbNotes(storage, pk != nil && pk.Tag.Auto)
+	}
 }
 
 // GetGoDataType maps an SQL data type to Golang data type
@@ -564,6 +946,7 @@ func (*PostgresDB) GetConstraints(db *sql.DB, table *Table, blackList map[string
 	rows, err := db.Query(
 		`SELECT
 			c.constraint_type,
+			c.constraint_name,
 			u.column_name,
 			cu.table_catalog AS referenced_table_catalog,
 			cu.table_name AS referenced_table_name,
@@ -585,9 +968,10 @@ func (*PostgresDB) GetConstraints(db *sql.DB, table *Table, blackList map[string
 		beeLogger.Log.Fatalf("Could not query INFORMATION_SCHEMA for PK/UK/FK information: %s", err)
 	}
 
+	uks := make(map[string][]string)
 	for rows.Next() {
-		var constraintTypeBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
-		if err := rows.Scan(&constraintTypeBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
+		var constraintTypeBytes, constraintNameBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
+		if err := rows.Scan(&constraintTypeBytes, &constraintNameBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
 			beeLogger.Log.Fatalf("Could not read INFORMATION_SCHEMA for PK/UK/FK information: %s", err)
 		}
 		constraintType, columnName, refTableSchema, refTableName, refColumnName, refOrdinalPos :=
@@ -604,6 +988,7 @@ func (*PostgresDB) GetConstraints(db *sql.DB, table *Table, blackList map[string
 			}
 		} else if constraintType == "UNIQUE" {
 			table.Uk = append(table.Uk, columnName)
+			uks[string(constraintNameBytes)] = append(uks[string(constraintNameBytes)], columnName)
 		} else if constraintType == "FOREIGN KEY" {
 			fk := new(ForeignKey)
 			fk.Name = columnName
@@ -613,24 +998,33 @@ func (*PostgresDB) GetConstraints(db *sql.DB, table *Table, blackList map[string
 			table.Fk[columnName] = fk
 		}
 	}
+	table.nameUniqueKeys(uks)
 }
 
 // GetColumns for PostgreSQL
 func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+	extra := "''"
+	if postgresDB.cockroach {
+		// the rowid primary key of the tables created without one is hidden
+		extra = "CASE WHEN is_hidden = 'YES' THEN 'hidden' ELSE '' END"
+	}
 	// retrieve columns
 	colDefRows, err := db.Query(
 		`SELECT
 			column_name,
 			data_type,
-			data_type ||
 			CASE
-				WHEN data_type = 'character' THEN '('||character_maximum_length||')'
-				WHEN data_type = 'numeric' THEN '(' || numeric_precision || ',' || numeric_scale ||')'
-				ELSE ''
+				WHEN data_type IN ('character', 'character varying') AND character_maximum_length IS NOT NULL THEN
+					data_type || '(' || character_maximum_length || ')'
+				WHEN data_type = 'numeric' THEN data_type || '(' || numeric_precision || ',' || numeric_scale ||')'
+				WHEN data_type LIKE 'time%' AND datetime_precision <> 6 THEN
+					regexp_replace(data_type, '^(timestamp|time)', '\1(' || datetime_precision || ')')
+				ELSE data_type
 			END AS column_type,
 			is_nullable,
 			column_default,
-			'' AS extra
+			`+extra+` AS extra,
+			COALESCE(col_description((quote_ident(table_schema) || '.' || quote_ident(table_name))::regclass, ordinal_position), '') AS column_comment
 		FROM
 			information_schema.columns
 		WHERE
@@ -644,12 +1038,20 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 
 	for colDefRows.Next() {
 		// datatype as bytes so that SQL <null> values can be retrieved
-		var colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes []byte
-		if err := colDefRows.Scan(&colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes); err != nil {
+		var colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes, columnCommentBytes []byte
+		if err := colDefRows.Scan(&colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes, &columnCommentBytes); err != nil {
 			beeLogger.Log.Fatalf("Could not query INFORMATION_SCHEMA for column information: %s", err)
 		}
-		colName, dataType, columnType, isNullable, columnDefault, extra :=
-			string(colNameBytes), string(dataTypeBytes), string(columnTypeBytes), string(isNullableBytes), string(columnDefaultBytes), string(extraBytes)
+		colName, dataType, columnType, isNullable, columnDefault, extra, columnComment :=
+			string(colNameBytes), string(dataTypeBytes), string(columnTypeBytes), string(isNullableBytes), string(columnDefaultBytes), string(extraBytes), string(columnCommentBytes)
+		if extra == "hidden" {
+			if table.Pk == colName {
+				beeLogger.Log.Warnf("Table '%s' has no primary key of its own, it is generated without primary key", table.Name)
+				table.Pk = ""
+				blackList[table.Name] = true
+			}
+			continue
+		}
 		// Create a column
 		col := new(Column)
 		col.Name = utils.CamelCase(colName)
@@ -665,14 +1067,25 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 		// Tag info
 		tag := new(OrmTag)
 		tag.Column = colName
+		tag.Comment = columnComment
 		if table.Pk == colName {
-			col.Name = "Id"
-			col.Type = "int"
-			if extra == "auto_increment" {
-				tag.Auto = true
-			} else {
+			if KeepPkName {
+				// gorm only guesses the primary key of a field named Id
 				tag.Pk = true
+			} else {
+				col.Name = "Id"
+			}
+			if postgresDB.cockroach {
+				cockroachPk(col, tag, dataType, columnDefault)
+			} else {
+				col.Type = "int"
+				if extra == "auto_increment" {
+					tag.Auto = true
+				} else {
+					tag.Pk = true
+				}
 			}
+			table.PkType = col.Type
 		} else {
 			fkCol, isFk := table.Fk[colName]
 			isBl := false
@@ -684,12 +1097,13 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 				tag.RelFk = true
 				refStructName := fkCol.RefTable
 				tag.TableFk = refStructName
+				tag.FkNull = isNullable == "YES"
 				col.Name = utils.CamelCase(colName)
 				col.Type = "*" + utils.CamelCase(refStructName)
 			} else {
 				// if the name of column is Id, and it's not primary key
 				if colName == "id" {
-					col.Name = "Id_RENAME"
+					col.Name = idFieldName
 				}
 				if isNullable == "YES" {
 					tag.Null = true
@@ -697,20 +1111,34 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 				if isSQLStringType(dataType) {
 					tag.Size = extractColSize(columnType)
 				}
-				if isSQLTemporalType(dataType) || strings.HasPrefix(dataType, "timestamp") {
+				if isSQLTextType(dataType) {
 					tag.Type = dataType
-					//check auto_now, auto_now_add
-					if columnDefault == "CURRENT_TIMESTAMP" && extra == "on update CURRENT_TIMESTAMP" {
-						tag.AutoNow = true
-					} else if columnDefault == "CURRENT_TIMESTAMP" {
+				}
+				if isSQLTemporalType(dataType) || strings.HasPrefix(dataType, "timestamp") {
+					// column_type keeps the fractional seconds precision, e.g. timestamp(3) without time zone
+					tag.Type = columnType
+					tag.Precision = extractTemporalPrecision(columnType)
+					// PostgreSQL has no ON UPDATE, only auto_now_add
+					if isCurrentTimestamp(columnDefault) {
 						tag.AutoNowAdd = true
 					}
+					// NULL must not be read as the zero time, use a pointer instead
+					if tag.Null {
+						col.Type = "*" + col.Type
+					}
 					// need to import time package
 					table.ImportTimePkg = true
 				}
+				if !tag.AutoNow && !tag.AutoNowAdd && columnDefault != "" && !isCurrentTimestamp(columnDefault) {
+					tag.Default, tag.DefaultExpr = pgDefault(colName, columnDefault)
+				}
 				if isSQLDecimal(dataType) {
 					tag.Digits, tag.Decimals = extractDecimal(columnType)
 				}
+				if dataType == "numeric" && pgxDriver() {
+					// exact, unlike float64
+					col.Type = "pgtype.Numeric"
+				}
 				if isSQLBinaryType(dataType) {
 					tag.Size = extractColSize(columnType)
 				}
@@ -719,11 +1147,30 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 				}
 			}
 		}
+		col.SQLType = columnType
 		col.Tag = tag
 		table.Columns = append(table.Columns, col)
 	}
 }
 
+// cockroachPk sets the type of the primary key of a CockroachDB table, which is kept
+// as declared since INT is INT8, and whether the database fills it in
+func cockroachPk(col *Column, tag *OrmTag, dataType, columnDefault string) {
+	switch {
+	case columnDefault == "unique_rowid()" || strings.HasPrefix(columnDefault, "nextval("):
+		tag.Auto = true
+	case columnDefault == "gen_random_uuid()":
+		// left out of the INSERT when empty, then read back
+		tag.Pk = true
+		tag.DefaultExpr = columnDefault
+	default:
+		tag.Pk = true
+	}
+	if dataType == "uuid" {
+		tag.Type = dataType
+	}
+}
+
 // GetGoDataType returns the Go type from the mapped Postgres type
 func (*PostgresDB) GetGoDataType(sqlType string) (string, error) {
 	if v, ok := typeMappingPostgres[sqlType]; ok {
@@ -734,14 +1181,36 @@ func (*PostgresDB) GetGoDataType(sqlType string) (string, error) {
 
 // deleteAndRecreatePaths removes several directories completely
 func createPaths(mode byte, paths *MvcPath) {
+	var dirs []string
 	if (mode & OModel) == OModel {
-		os.Mkdir(paths.ModelPath, 0777)
+		dirs = append(dirs, paths.ModelPath)
 	}
 	if (mode & OController) == OController {
-		os.Mkdir(paths.ControllerPath, 0777)
+		dirs = append(dirs, paths.ControllerPath)
 	}
 	if (mode & ORouter) == ORouter {
-		os.Mkdir(paths.RouterPath, 0777)
+		dirs = append(dirs, paths.RouterPath)
+	}
+	if (mode & OSqlc) == OSqlc {
+		dirs = append(dirs, paths.SqlcPath)
+	}
+	if (mode & OJobs) == OJobs {
+		dirs = append(dirs, paths.JobsPath)
+	}
+	if (mode & OHandlers) == OHandlers {
+		dirs = append(dirs, paths.HandlersPath)
+	}
+	if (mode & OContract) == OContract {
+		dirs = append(dirs, paths.ContractPath)
+	}
+	if (mode & ODomain) == ODomain {
+		dirs = append(dirs, paths.DomainPath, paths.PersistencePath)
+	}
+	for _, dir := range dirs {
+		// parents are created as well, existing directories keep their permissions
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			beeLogger.Log.Fatalf("Could not create directory '%s': %s", dir, err)
+		}
 	}
 }
 
@@ -752,21 +1221,48 @@ func writeSourceFiles(dbms, pkgPath string, tables []*Table, mode byte, paths *M
 	if (OModel & mode) == OModel {
 		beeLogger.Log.Info("Creating model files...")
 		writeModelFiles(dbms, tables, paths.ModelPath, selectedTables)
+		if GormShim {
+			beeLogger.Log.Info("Creating the gorm v1 shim of the models...")
+			writeGormShim(paths.ModelPath, pkgPath)
+		}
 	}
 	if (OController & mode) == OController {
 		beeLogger.Log.Info("Creating controller files...")
-		writeControllerFiles(tables, paths.ControllerPath, selectedTables, pkgPath)
+		writeControllerFiles(tablesWithMode(tables, OController, mode), paths.ControllerPath, selectedTables, pkgPath)
 	}
 	if (ORouter & mode) == ORouter {
 		beeLogger.Log.Info("Creating router files...")
-		writeRouterFile(tables, paths.RouterPath, selectedTables, pkgPath)
+		writeRouterFile(tablesWithMode(tables, ORouter, mode), paths.RouterPath, selectedTables, pkgPath)
+	}
+	if (OSqlc & mode) == OSqlc {
+		beeLogger.Log.Info("Creating sqlc query files...")
+		writeSqlcFiles(dbms, tables, paths.SqlcPath, selectedTables)
+	}
+	if (OJobs & mode) == OJobs {
+		beeLogger.Log.Info("Creating background job files...")
+		writeJobFiles(selectTables(tables, selectedTables), paths.JobsPath, pkgPath)
+	}
+	if (OHandlers & mode) == OHandlers {
+		beeLogger.Log.Info("Creating net/http handler files...")
+		writeHandlerFiles(selectTables(tablesWithMode(tables, OHandlers, mode), selectedTables), tables, paths.HandlersPath, pkgPath)
+	}
+	if (OContract & mode) == OContract {
+		beeLogger.Log.Info("Creating the OpenAPI contract...")
+		// the contract describes every table, selected or not
+		writeContractFiles(tables, paths.ContractPath)
+	}
+	if (ODomain & mode) == ODomain {
+		beeLogger.Log.Info("Creating domain, persistence and mapper files...")
+		writeDomainFiles(selectTables(tables, selectedTables), paths.DomainPath, paths.PersistencePath, pkgPath)
 	}
 }
 
 // writeModelFiles generates model files
 func writeModelFiles(dbms string, tables []*Table, mPath string, selectedTables map[string]bool) {
-	w := colors.NewColorWriter(os.Stdout)
-
+	if sqlxMode() {
+		writeSqlxModelFiles(dbms, tables, mPath, selectedTables)
+		return
+	}
 	for _, tb := range tables {
 		// if selectedTables map is not nil and this table is not selected, ignore it
 		if selectedTables != nil {
@@ -774,31 +1270,11 @@ func writeModelFiles(dbms string, tables []*Table, mPath string, selectedTables
 				continue
 			}
 		}
-		filename := getFileName(tb.Name)
-		fpath := path.Join(mPath, filename+".go")
-		var f *os.File
-		var err error
-		if utils.IsExist(fpath) {
-			beeLogger.Log.Warnf("'%s' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
-			if utils.AskForConfirmation() {
-				f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
-				if err != nil {
-					beeLogger.Log.Warnf("%s", err)
-					continue
-				}
-			} else {
-				beeLogger.Log.Warnf("Skipped create file '%s'", fpath)
-				continue
-			}
-		} else {
-			f, err = os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0666)
-			if err != nil {
-				beeLogger.Log.Warnf("%s", err)
-				continue
-			}
-		}
+		fpath := path.Join(mPath, modelFileName(tb.Name)+".go")
 		var tmpl string
-		if tb.Pk == "" {
+		if dbms == "clickhouse" {
+			tmpl = ClickHouseModelTPL
+		} else if tb.Pk == "" {
 			tmpl = StructModelTPL
 		} else {
 			tmpl = ModelTPL
@@ -807,6 +1283,7 @@ func writeModelFiles(dbms string, tables []*Table, mPath string, selectedTables
 		fileStr = strings.Replace(fileStr, "{{modelName}}", utils.CamelCase(tb.Name), -1)
 		fileStr = strings.Replace(fileStr, "{{tableName}}", tb.Name, -1)
 		fileStr = strings.Replace(fileStr, "{{pkType}}", tb.PkType, -1)
+		fileStr = strings.Replace(fileStr, "{{pkField}}", tb.PkField(), -1)
 
 		// If table contains time field, import time.Time package
 		//timePkg := ""
@@ -817,69 +1294,51 @@ func writeModelFiles(dbms string, tables []*Table, mPath string, selectedTables
 		//}
 		//fileStr = strings.Replace(fileStr, "{{timePkg}}", timePkg, -1)
 		//fileStr = strings.Replace(fileStr, "{{importTimePkg}}", importTimePkg, -1)
-		//if _, err := f.WriteString(fileStr); err != nil {
-		//	beeLogger.Log.Fatalf("Could not write model file to '%s': %s", fpath, err)
-		//}
-		t, err := template.New("").Parse(fileStr)
-		if err != nil {
-			beeLogger.Log.Fatalf("new template fileStr failed <%s>", err)
-		}
-		err = t.Execute(f, tb)
-		if err != nil {
-			beeLogger.Log.Fatalf("execute template fileStr failed <%s>", err)
-			f.Truncate(0)
-		}
-		utils.CloseFile(f)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
-		utils.FormatSourceCode(fpath)
+		writeGeneratedFile(fpath, executeTemplate(fileStr, tb))
 	}
 
-	//generate models.go
-	fpath := path.Join(mPath, "models.go")
-	var f *os.File
-	var err error
-	if utils.IsExist(fpath) {
-		beeLogger.Log.Warnf("'%s' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
-		if utils.AskForConfirmation() {
-			f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
-			if err != nil {
-				beeLogger.Log.Warnf("%s", err)
-				return
-			}
-		} else {
-			beeLogger.Log.Warnf("Skipped create file '%s'", fpath)
-			return
-		}
-	} else {
-		f, err = os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0666)
-		if err != nil {
-			beeLogger.Log.Warnf("%s", err)
-			return
-		}
-	}
+	// generate registry.go describing every generated model, in foreign key order
+	writeGeneratedFile(path.Join(mPath, "registry.go"), executeTemplate(RegistryTPL, selectTables(tablesInFKOrder(tables), selectedTables)))
+	writeTruncateFile(dbms, mPath)
+	writeOracleFile(dbms, mPath)
+	writeImportFile(tables, mPath)
 
-	t, err := template.New("").Parse(ModelsTPL)
-	if err != nil {
-		beeLogger.Log.Fatalf("template ModelsTPL faield <%s>", err)
-		utils.CloseFile(f)
-		return
+	if TimeWrapper {
+		writeTimeFile(mPath)
 	}
-	err = t.Execute(f, &struct{ Dialect string }{dbms})
-	if err != nil {
-		beeLogger.Log.Fatalf("template ModelsTPL faield <%s>", err)
-		f.Truncate(0)
-		utils.CloseFile(f)
-		return
+	if retryEnabled() {
+		writeRetryFile(dbms, mPath)
+	}
+	writeRetentionFile(tables, mPath)
+	writeMaskFile(tables, mPath)
+	writeKeyFiles(tables, mPath)
+	writeCacheFile(tables, mPath)
+	writeTreeFile(tables, mPath)
+	writeMoneyFile(tables, mPath)
+	writeProjectionFile(tables, mPath)
+	if tenantScoped(tables) {
+		writeTenantFile(mPath)
+	}
+	if idempotencyEnabled() {
+		writeIdempotencyFile(mPath)
+	}
+	if breakerEnabled() {
+		writeBreakerFile(dbms, mPath)
+	}
+	writeSlowLogFile(mPath)
+	if wrapCalls() {
+		writeGeneratedFile(path.Join(mPath, "call.go"), executeTemplate(CallTPL, struct{ Retry, Breaker bool }{retryEnabled(), breakerEnabled()}))
+	}
+
+	//generate models.go, and models_init.go once as it belongs to the user afterwards
+	writeGeneratedFile(path.Join(mPath, "models.go"), executeTemplate(ModelsTPL, newModelsData(dbms)))
+	if fpath := path.Join(mPath, "models_init.go"); !utils.IsExist(fpath) {
+		writeGeneratedFile(fpath, executeTemplate(ModelsInitTPL, nil))
 	}
-	utils.CloseFile(f)
-	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
-	utils.FormatSourceCode(fpath)
 }
 
 // writeControllerFiles generates controller files
 func writeControllerFiles(tables []*Table, cPath string, selectedTables map[string]bool, pkgPath string) {
-	w := colors.NewColorWriter(os.Stdout)
-
 	for _, tb := range tables {
 		// If selectedTables map is not nil and this table is not selected, ignore it
 		if selectedTables != nil {
@@ -890,91 +1349,89 @@ func writeControllerFiles(tables []*Table, cPath string, selectedTables map[stri
 		if tb.Pk == "" {
 			continue
 		}
-		filename := getFileName(tb.Name)
-		fpath := path.Join(cPath, filename+".go")
-		var f *os.File
-		var err error
-		if utils.IsExist(fpath) {
-			beeLogger.Log.Warnf("'%s' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
-			if utils.AskForConfirmation() {
-				f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
-				if err != nil {
-					beeLogger.Log.Warnf("%s", err)
-					continue
-				}
-			} else {
-				beeLogger.Log.Warnf("Skipped create file '%s'", fpath)
-				continue
-			}
-		} else {
-			f, err = os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0666)
-			if err != nil {
-				beeLogger.Log.Warnf("%s", err)
-				continue
-			}
-		}
+		writeCustomCtrlFile(tb, cPath)
 		fileStr := strings.Replace(CtrlTPL, "{{ctrlName}}", utils.CamelCase(tb.Name), -1)
+		fileStr = strings.Replace(fileStr, "{{pkField}}", tb.PkField(), -1)
 		fileStr = strings.Replace(fileStr, "{{pkgPath}}", pkgPath, -1)
-		if _, err := f.WriteString(fileStr); err != nil {
-			beeLogger.Log.Fatalf("Could not write controller file to '%s': %s", fpath, err)
-		}
-		utils.CloseFile(f)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
-		utils.FormatSourceCode(fpath)
+		writeGeneratedFile(path.Join(cPath, controllerFileName(tb.Name)+".go"), executeTemplate(fileStr, tb))
+	}
+
+	// generate pagination.go shared by all the controllers
+	writeGeneratedFile(path.Join(cPath, "pagination.go"), PaginationTPL)
+	writeRecycleFile(tables, cPath)
+	if tenantScoped(tables) {
+		writeCtrlTenantFile(cPath, pkgPath)
+	}
+	if i18nEnabled() {
+		writeI18nFile(cPath, pkgPath, false)
+	}
+	if idempotencyEnabled() {
+		writeCtrlIdempotencyFile(tables, cPath, pkgPath)
 	}
 }
 
-// writeRouterFile generates router file
+// writeRouterFile generates the route fragments of the tables and the registry
+// mounting them. router.go is only created when missing, so that the routes added
+// to it by hand survive regeneration.
 func writeRouterFile(tables []*Table, rPath string, selectedTables map[string]bool, pkgPath string) {
-	w := colors.NewColorWriter(os.Stdout)
+	writeRouteFragments(selectTables(tables, selectedTables), rPath, pkgPath)
+
+	fpath := filepath.Join(rPath, "router.go")
+	if utils.IsExist(fpath) {
+		if data, err := ioutil.ReadFile(fpath); err == nil && !strings.Contains(string(data), "generatedNamespaces()") {
+			beeLogger.Log.Warnf("'%s' doesn't mount generatedNamespaces(), the generated routes won't be served", fpath)
+		}
+		return
+	}
+	writeGeneratedFile(fpath, strings.Replace(RouterTPL, "{{versionPrefix}}", versionPrefix(), 1))
+}
 
-	var nameSpaces []string
+// selectTables returns the tables present in selectedTables, or all of them
+// when no table has been selected
+func selectTables(tables []*Table, selectedTables map[string]bool) []*Table {
+	if selectedTables == nil {
+		return tables
+	}
+	var selected []*Table
 	for _, tb := range tables {
-		// If selectedTables map is not nil and this table is not selected, ignore it
-		if selectedTables != nil {
-			if _, selected := selectedTables[tb.Name]; !selected {
-				continue
-			}
+		if _, ok := selectedTables[tb.Name]; ok {
+			selected = append(selected, tb)
 		}
-		if tb.Pk == "" {
-			continue
+	}
+	return selected
+}
+
+// writeGeneratedFile writes content to fpath, asking for confirmation before an
+// existing file is overwritten. Go source files are formatted afterwards.
+func writeGeneratedFile(fpath, content string) {
+	w := colors.NewColorWriter(os.Stdout)
+
+	if strings.HasSuffix(fpath, ".go") {
+		content = rewriteImports(content)
+		if src, err := format.Source([]byte(content)); err == nil {
+			content = string(src)
+		} else if DebugTemplates {
+			beeLogger.Log.Errorf("%s", debugSource(fpath, content, err))
+		} else {
+			beeLogger.Log.Warnf("Could not format '%s': %s", fpath, err)
 		}
-		// Add namespaces
-		nameSpace := strings.Replace(NamespaceTPL, "{{nameSpace}}", tb.Name, -1)
-		nameSpace = strings.Replace(nameSpace, "{{ctrlName}}", utils.CamelCase(tb.Name), -1)
-		nameSpaces = append(nameSpaces, nameSpace)
 	}
-	// Add export controller
-	fpath := filepath.Join(rPath, "router.go")
-	routerStr := strings.Replace(RouterTPL, "{{nameSpaces}}", strings.Join(nameSpaces, ""), 1)
-	routerStr = strings.Replace(routerStr, "{{pkgPath}}", pkgPath, 1)
-	var f *os.File
-	var err error
+	if existing, err := ioutil.ReadFile(fpath); err == nil && string(existing) == content {
+		fmt.Fprintf(w, "	%s%sidentical%s	 %s%s\n", "\x1b[34m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+		return
+	}
 	if utils.IsExist(fpath) {
 		beeLogger.Log.Warnf("'%s' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
-		if utils.AskForConfirmation() {
-			f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
-			if err != nil {
-				beeLogger.Log.Warnf("%s", err)
-				return
-			}
-		} else {
+		if !utils.AskForConfirmation() {
 			beeLogger.Log.Warnf("Skipped create file '%s'", fpath)
 			return
 		}
-	} else {
-		f, err = os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0666)
-		if err != nil {
-			beeLogger.Log.Warnf("%s", err)
-			return
-		}
 	}
-	if _, err := f.WriteString(routerStr); err != nil {
-		beeLogger.Log.Fatalf("Could not write router file to '%s': %s", fpath, err)
+	// the content is renamed into place, a failing write leaving the former file untouched
+	if err := utils.WriteFileAtomic(fpath, []byte(content), 0644); err != nil {
+		beeLogger.Log.Fatalf("Could not write file to '%s': %s", fpath, err)
 	}
-	utils.CloseFile(f)
 	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
-	utils.FormatSourceCode(fpath)
 }
 
 func isSQLTemporalType(t string) bool {
@@ -982,7 +1439,17 @@ func isSQLTemporalType(t string) bool {
 }
 
 func isSQLStringType(t string) bool {
-	return t == "char" || t == "varchar"
+	return t == "char" || t == "varchar" || t == "character" || t == "character varying"
+}
+
+// isSQLTextType reports the text and blob family, which has no size but must keep its
+// type for the length limit, e.g. text is limited to 64KB where longtext is 4GB
+func isSQLTextType(t string) bool {
+	switch t {
+	case "tinytext", "text", "mediumtext", "longtext", "tinyblob", "blob", "mediumblob", "longblob":
+		return true
+	}
+	return false
 }
 
 func isSQLSignedIntType(t string) bool {
@@ -1004,40 +1471,123 @@ func isSQLStrangeType(t string) bool {
 	return t == "interval" || t == "uuid" || t == "json"
 }
 
-// extractColSize extracts field size: e.g. varchar(255) => 255
+// extractColSize extracts field size: e.g. varchar(255) => 255,
+// or an empty string for types without one, e.g. text
 func extractColSize(colType string) string {
-	regex := regexp.MustCompile(`^[a-z]+\(([0-9]+)\)$`)
+	regex := regexp.MustCompile(`^[a-z ]+\(([0-9]+)\)`)
 	size := regex.FindStringSubmatch(colType)
+	if size == nil {
+		return ""
+	}
 	return size[1]
 }
 
 func extractIntSignness(colType string) string {
-	regex := regexp.MustCompile(`(int|smallint|mediumint|bigint)\([0-9]+\)(.*)`)
+	// MySQL 8.0.19+ no longer reports the display width, e.g. int unsigned
+	regex := regexp.MustCompile(`(int|smallint|mediumint|bigint)(\([0-9]+\))?(.*)`)
 	signRegex := regex.FindStringSubmatch(colType)
-	return strings.Trim(signRegex[2], " ")
+	return strings.Trim(signRegex[3], " ")
 }
 
-func extractDecimal(colType string) (digits string, decimals string) {
-	decimalRegex := regexp.MustCompile(`decimal\(([0-9]+),([0-9]+)\)`)
-	decimal := decimalRegex.FindStringSubmatch(colType)
-	digits, decimals = decimal[1], decimal[2]
-	return
+// isCurrentTimestamp reports whether a column default is the current time,
+// e.g. CURRENT_TIMESTAMP, CURRENT_TIMESTAMP(6), now() or, as PostgreSQL and
+// CockroachDB cast it, now():::TIMESTAMPTZ
+func isCurrentTimestamp(def string) bool {
+	regex := regexp.MustCompile(`^(?i)\(?(current_timestamp|now|localtimestamp|transaction_timestamp|statement_timestamp)(\([0-9]*\))?\)?(:{2,3}[a-z ]+)?$`)
+	return regex.MatchString(def)
 }
 
-func getFileName(tbName string) (filename string) {
-	// avoid test file
-	filename = tbName
-	for strings.HasSuffix(filename, "_test") {
-		pos := strings.LastIndex(filename, "_")
-		filename = filename[:pos] + filename[pos+1:]
-	}
-	return
+// isOnUpdateCurrentTimestamp reports whether the extra information of a MySQL column
+// holds ON UPDATE CURRENT_TIMESTAMP, possibly prefixed with DEFAULT_GENERATED (MySQL 8)
+// and with a fractional seconds precision
+func isOnUpdateCurrentTimestamp(extra string) bool {
+	regex := regexp.MustCompile(`(?i)on update (current_timestamp|now|localtimestamp)(\([0-9]*\))?`)
+	return regex.MatchString(extra)
 }
 
-func getPackagePath(curpath string) (packpath string) {
-	gopath := os.Getenv("GOPATH")
-	if gopath == "" {
-		beeLogger.Log.Fatal("GOPATH environment variable is not set or empty")
+// isDefaultExpr reports whether a MySQL 8 column default is an expression, e.g. (uuid()),
+// rather than a literal. Expressions containing characters breaking a struct tag are ignored.
+func isDefaultExpr(def, extra string) bool {
+	return def != "" && strings.Contains(strings.ToUpper(extra), "DEFAULT_GENERATED") &&
+		!strings.ContainsAny(def, "\"`;")
+}
+
+// literalDefault returns a literal column default as written in the gorm tag:
+// numbers and bit values as is, anything else quoted as a SQL string with its quotes doubled.
+// Defaults gorm can't parse out of its tag are dropped with a warning.
+func literalDefault(colName, def string) string {
+	if def == "NULL" {
+		// MariaDB reports a NULL default as the NULL literal
+		return ""
+	}
+	if strings.ContainsAny(def, "`;") {
+		beeLogger.Log.Warnf("Default value of column '%s' can't be written in a struct tag, skipped", colName)
+		return ""
+	}
+	numeric := regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$|^[bB]'[01]*'$`)
+	if numeric.MatchString(def) {
+		return def
+	}
+	if len(def) > 1 && strings.HasPrefix(def, "'") && strings.HasSuffix(def, "'") {
+		// MariaDB reports string defaults already quoted
+		return def
+	}
+	return "'" + strings.Replace(def, "'", "''", -1) + "'"
+}
+
+// pgDefault splits a PostgreSQL column default in a literal, with its type cast removed,
+// e.g. 'active'::character varying => 'active', or an expression, e.g. gen_random_uuid().
+// Sequences are left to the database.
+func pgDefault(colName, def string) (literal, expr string) {
+	if strings.HasPrefix(def, "nextval(") || strings.HasPrefix(def, "NULL::") {
+		return "", ""
+	}
+	castRegex := regexp.MustCompile(`^('(?:[^']|'')*')::[a-z ]+$`)
+	if m := castRegex.FindStringSubmatch(def); m != nil {
+		return literalDefault(colName, m[1]), ""
+	}
+	if def == "true" || def == "false" || regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`).MatchString(def) {
+		return def, ""
+	}
+	if strings.ContainsAny(def, "`;\"") {
+		beeLogger.Log.Warnf("Default value of column '%s' can't be written in a struct tag, skipped", colName)
+		return "", ""
+	}
+	return "", def
+}
+
+// extractTemporalPrecision extracts the fractional seconds precision of a temporal type,
+// e.g. datetime(3) => 3, timestamp(6) without time zone => 6
+func extractTemporalPrecision(colType string) string {
+	regex := regexp.MustCompile(`^[a-z]+\(([0-9]+)\)`)
+	precision := regex.FindStringSubmatch(colType)
+	if precision == nil || precision[1] == "0" {
+		return ""
+	}
+	return precision[1]
+}
+
+func extractDecimal(colType string) (digits string, decimals string) {
+	decimalRegex := regexp.MustCompile(`decimal\(([0-9]+),([0-9]+)\)`)
+	decimal := decimalRegex.FindStringSubmatch(colType)
+	digits, decimals = decimal[1], decimal[2]
+	return
+}
+
+func getFileName(tbName string) (filename string) {
+	// avoid test file
+	filename = tbName
+	for strings.HasSuffix(filename, "_test") {
+		pos := strings.LastIndex(filename, "_")
+		filename = filename[:pos] + filename[pos+1:]
+	}
+	return
+}
+
+func getPackagePath(curpath string) (packpath string) {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		beeLogger.Log.Fatal("GOPATH environment variable is not set or empty")
 	}
 
 	beeLogger.Log.Debugf("GOPATH: %s", utils.FILE(), utils.LINE(), gopath)
@@ -1069,21 +1619,30 @@ func getPackagePath(curpath string) (packpath string) {
 
 const (
 	StructModelTPL = `package models
-{{if .ImportTimePkg}}
+{{if or .ImportTimePkg .ImportPgtype .ImportMssql .ImportGorm .CustomImports}}
 import (
-	"time"
-)
+{{if .ImportTimePkg}}	"time"
+{{end}}{{if .ImportPgtype}}	"github.com/jackc/pgtype"
+{{end}}{{if .ImportMssql}}	"github.com/denisenkom/go-mssqldb"
+{{end}}{{if .ImportGorm}}	"github.com/jinzhu/gorm"
+{{end}}{{range .CustomImports}}	"{{.}}"
+{{end}})
 {{end}}
 {{modelStruct}}
 `
 
 	ModelTPL = `package models
 import (
-{{if .ImportTimePkg}}
+	"fmt"
+{{if .Importable}}	"io"
+{{end}}{{if or .ImportTimePkg .RetentionColumn .CacheSize .Versioning}}
 	"time"
 
 {{end}}
-	"github.com/jinzhu/gorm"
+{{if .ImportPgtype}}	"github.com/jackc/pgtype"
+{{end}}{{if .ImportMssql}}	"github.com/denisenkom/go-mssqldb"
+{{end}}{{range .CustomImports}}	"{{.}}"
+{{end}}	"github.com/jinzhu/gorm"
 )
 
 {{modelStruct}}
@@ -1092,78 +1651,476 @@ func ({{modelName}}) TableName() string {
 	return "{{tableName}}"
 }
 
-// Add{{modelName}} insert a new {{modelName}} into database and returns
+// Column names of {{tableName}}, to be used when building queries
+const (
+{{range .Columns}}	{{modelName}}Col{{.Name}} = "{{.Tag.Column}}"
+{{end}})
+
+// is{{modelName}}Column reports whether field is a column of {{tableName}}
+func is{{modelName}}Column(field string) bool {
+	switch field {
+	case {{range $i, $c := .Columns}}{{if $i}}, {{end}}{{modelName}}Col{{$c.Name}}{{end}}:
+		return true
+	}
+	return false
+}
+
+// order{{modelName}}s sorts qs by order, it fails on the columns which are not columns of {{tableName}}
+func order{{modelName}}s(qs *gorm.DB, order []OrderBy) (*gorm.DB, error) {
+	for _, o := range order {
+		if !is{{modelName}}Column(o.Column) {
+			return nil, &ParamError{Key: "unknown_column", Args: []interface{}{o.Column, "{{tableName}}"}}
+		}
+		qs = qs.Order(o.clause())
+	}
+	return qs, nil
+}
+
+// Order{{modelName}}By returns the OrderBy sorting {{modelName}}s by field,
+// it fails if field is not a column of {{tableName}}
+func Order{{modelName}}By(field string, desc bool) (OrderBy, error) {
+	if !is{{modelName}}Column(field) {
+		return OrderBy{}, &ParamError{Key: "unknown_column", Args: []interface{}{field, "{{tableName}}"}}
+	}
+	return OrderBy{Column: field, Desc: desc}, nil
+}
+
+// Diff{{modelName}} returns the old and new values of the columns which differ from a to b,
+// keyed by column name, e.g. to tell what an update changed. Relations are left out.
+func Diff{{modelName}}(a, b *{{modelName}}) map[string]Change {
+	changes := make(map[string]Change)
+{{range .Columns}}{{if not .Tag.RelFk}}	if valuesDiffer(a.{{.Name}}, b.{{.Name}}) {
+		changes[{{modelName}}Col{{.Name}}] = Change{Old: a.{{.Name}}, New: b.{{.Name}}}
+	}
+{{end}}{{end}}	return changes
+}
+
+// Clone{{modelName}} returns a copy of src{{if .IdentityColumns}} without {{range $i, $c := .IdentityColumns}}{{if $i}}, {{end}}{{$c.Tag.Column}}{{end}}{{end}},
+// ready to be added as a new record. Unique columns are copied as is.
+func Clone{{modelName}}(src *{{modelName}}) *{{modelName}} {
+	c := *src
+{{range .Columns}}{{if .Nullable}}	if src.{{.Name}} != nil {
+		v := *src.{{.Name}}
+		c.{{.Name}} = &v
+	}
+{{end}}{{end}}{{range .IdentityColumns}}	c.{{.Name}} = {{modelName}}{}.{{.Name}}
+{{end}}	return &c
+}
+
+{{if .CacheSize}}// cache{{modelName}} caches the {{modelName}}s read by Get{{modelName}}ById with a nil tx
+var cache{{modelName}} = newRecordCache({{.CacheSize}}, {{.CacheTTLLiteral}})
+
+{{end}}{{if not .ReadOnly}}// Add{{modelName}} insert a new {{modelName}} into database and returns
 // last inserted Id on success.
 func Add{{modelName}}(tx *gorm.DB, m *{{modelName}}) (id {{pkType}}, err error) {
     db := tx
     if db == nil {
         db = DB()
     }
-	err = db.Create(m).Error
+	{{if .TenantColumn}}if err = setTenant(db, m, "{{.TenantColumn}}"); err != nil {
+		return id, err
+	}
+	{{end}}err = db.Create(m).Error
 	if err != nil {
-		return 0, err
+		return id, err
+	}
+	return m.{{pkField}}, nil
+}
+
+// BulkAdd{{modelName}}s inserts ms, all of them or none: they are inserted in tx, or in
+// a transaction of their own when tx is nil
+func BulkAdd{{modelName}}s(tx *gorm.DB, ms []*{{modelName}}) (err error) {
+	db := tx
+	if db == nil {
+		if db = DB().Begin(); db.Error != nil {
+			return db.Error
+		}
+		defer func() {
+			if err != nil {
+				db.Rollback()
+				return
+			}
+			err = db.Commit().Error
+		}()
+	}
+	for i, m := range ms {
+		if _, err = Add{{modelName}}(db, m); err != nil {
+			return fmt.Errorf("record %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+{{if .Importable}}
+func (m *{{modelName}}) importField(column string) interface{} {
+	switch column {
+{{range .ImportColumns}}	case {{modelName}}Col{{.Name}}:
+		return &m.{{.Name}}
+{{end}}	}
+	return nil
+}
+
+// Import{{modelName}}s reads {{modelName}}s from a CSV or xlsx file, the format being told by the
+// extension of name, whose header row holds the column names. They are inserted with
+// BulkAdd{{modelName}}s unless dryRun, nothing being inserted when a row is invalid.
+func Import{{modelName}}s(tx *gorm.DB, r io.Reader, name string, dryRun bool) (*ImportResult, error) {
+	rows, err := readImportRows(r, name)
+	if err != nil {
+		return nil, err
+	}
+	records, rowErrs, err := parseImportRows(rows, []string{ {{range .ImportColumns}}{{if .Required}}{{modelName}}Col{{.Name}}, {{end}}{{end}}}, func() importer { return new({{modelName}}) })
+	if err != nil {
+		return nil, err
 	}
-	return m.Id, nil
+	res := &ImportResult{Records: len(records), DryRun: dryRun, Errors: rowErrs}
+	if len(rowErrs) > 0 || dryRun {
+		return res, nil
+	}
+	ms := make([]*{{modelName}}, len(records))
+	for i, record := range records {
+		ms[i] = record.(*{{modelName}})
+	}
+	return res, BulkAdd{{modelName}}s(tx, ms)
 }
+{{end}}{{end}}
 
 {{if .IdDelete}}
-// Get{{modelName}}ById retrieves {{modelName}} by Id(not deleted). Returns error if
+// Get{{modelName}}ById retrieves {{modelName}} by Id(not deleted). Returns ErrNotFound if
 // Id doesn't exist
 func Get{{modelName}}ById(tx *gorm.DB, id {{pkType}}) (v *{{modelName}}, err error) {
-	db := tx
+	{{template "cached" .}}db := tx
 	if db == nil {
 		db = DB()
 	}
-	v = &{{modelName}}{Id: id}
-	err = db.Where("is_deleted=?", 0).First(v).Error
+	v = &{{modelName}}{{{pkField}}: id}
+	err = notFound({{template "scope" .}}.Where("is_deleted=?", 0).First(v).Error)
 	return
 }
 
-// Get{{modelName}}ById retrieves {{modelName}} by Id(including deleted). Returns error if
+// Get{{modelName}}ByIdIncludingDeleted retrieves {{modelName}} by Id(including deleted). Returns ErrNotFound if
 // Id doesn't exist
 func Get{{modelName}}ByIdIncludingDeleted(tx *gorm.DB, id {{pkType}}) (v *{{modelName}}, err error) {
 	db := tx
 	if db == nil {
 		db = DB()
 	}
-	v = &{{modelName}}{Id: id}
-	err = db.First(v).Error
+	v = &{{modelName}}{{{pkField}}: id}
+	err = notFound({{template "scope" .}}.First(v).Error)
 	return
 }
 {{else}}
-// Get{{modelName}}ById retrieves {{modelName}} by Id. Returns error if
+// Get{{modelName}}ById retrieves {{modelName}} by Id. Returns ErrNotFound if
 // Id doesn't exist
 func Get{{modelName}}ById(tx *gorm.DB, id {{pkType}}) (v *{{modelName}}, err error) {
-    db := tx
+	{{template "cached" .}}db := tx
     if db == nil {
         db = DB() }
-	v = &{{modelName}}{Id: id}
-	err = db.First(v).Error
+	v = &{{modelName}}{{{pkField}}: id}
+	err = notFound({{template "scope" .}}.First(v).Error)
+	return
+}
+{{end}}{{with .Localization}}
+// {{modelName}}Localized is a {{modelName}} whose columns are translated by {{.Table}}
+type {{modelName}}Localized struct {
+	{{modelName}}
+	// Locale is the locale of the translation, nil when the record isn't translated
+	// in the requested locale and keeps its own columns
+	Locale *string ` + "`" + `json:"locale"` + "`" + `
+{{range .Columns}}{{if not .Base}}	{{.Name}} *{{.Type}} ` + "`" + `json:"{{.Column}}"` + "`" + `
+{{end}}{{end}}}
+
+// Get{{modelName}}Localized retrieves {{modelName}} by Id with its columns translated in locale
+// by {{.Table}}, keeping its own columns when it isn't translated. Returns ErrNotFound
+// if Id doesn't exist
+func Get{{modelName}}Localized(tx *gorm.DB, id {{pkType}}, locale string) (v *{{modelName}}Localized, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var row struct {
+		{{modelName}}
+		I18nLocale *string ` + "`" + `gorm:"column:i18n_{{.LocaleColumn}}"` + "`" + `
+{{range .Columns}}		I18n{{.Name}} *{{.Type}} ` + "`" + `gorm:"column:i18n_{{.Column}}"` + "`" + `
+{{end}}	}
+	err = notFound({{template "localizedScope" $}}.Table("{{tableName}}").Select("{{$.LocalizedSelect}}").
+		Joins("LEFT JOIN {{.Table}} ON {{.Table}}.{{.FkColumn}} = {{tableName}}.{{$.Pk}} AND {{.Table}}.{{.LocaleColumn}} = ?", locale).
+		Where("{{tableName}}.{{$.Pk}} = ?", id){{if $.IdDelete}}.Where("{{tableName}}.is_deleted = ?", 0){{end}}.Limit(1).Scan(&row).Error)
+	if err != nil {
+		return nil, err
+	}
+	v = &{{modelName}}Localized{ {{modelName}}: row.{{modelName}}, Locale: row.I18nLocale}
+{{range .Columns}}{{if not .Base}}	v.{{.Name}} = row.I18n{{.Name}}
+{{else}}	if row.I18n{{.Name}} != nil {
+		v.{{.Name}} = {{if not .Base.Nullable}}*{{end}}row.I18n{{.Name}}
+	}
+{{end}}{{end}}	return
+}
+{{end}}{{if .TreeParent}}
+// Get{{modelName}}Subtree retrieves the {{modelName}} of id and its descendants by {{.TreeParent}},
+// ordered by depth. Returns ErrNotFound if Id doesn't exist
+func Get{{modelName}}Subtree(tx *gorm.DB, id {{pkType}}) ([]*{{modelName}}, error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var ids []{{pkType}}
+	if err := db.Raw(subtreeSQL(dialectName(db), "{{tableName}}", "{{.Pk}}", "{{.TreeParent}}", {{.IdDelete}}), id, maxTreeDepth).Pluck("{{.Pk}}", &ids).Error; err != nil {
+		return nil, err
+	}
+	return get{{modelName}}sInOrder(db, id, ids)
+}
+
+// Get{{modelName}}Path retrieves the ancestors of the {{modelName}} of id by {{.TreeParent}}, from
+// the root to the {{modelName}} itself. Returns ErrNotFound if Id doesn't exist
+func Get{{modelName}}Path(tx *gorm.DB, id {{pkType}}) ([]*{{modelName}}, error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var ids []{{pkType}}
+	if err := db.Raw(pathSQL(dialectName(db), "{{tableName}}", "{{.Pk}}", "{{.TreeParent}}"), id, maxTreeDepth).Pluck("{{.Pk}}", &ids).Error; err != nil {
+		return nil, err
+	}
+	return get{{modelName}}sInOrder(db, id, ids)
+}
+{{if not .Closure}}
+// Move{{modelName}}Subtree moves the {{modelName}} of id, with its descendants, under parent,
+// or to the roots when parent is nil. Returns ErrTreeCycle if parent is in the subtree,
+// and ErrNotFound if Id doesn't exist. Use a transaction to check and move atomically.
+func Move{{modelName}}Subtree(tx *gorm.DB, id {{pkType}}, parent *{{pkType}}) error {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	{{if .CacheSize}}defer cache{{modelName}}.remove(id)
+	{{end}}if parent != nil {
+		var ids []{{pkType}}
+		if err := db.Raw(subtreeSQL(dialectName(db), "{{tableName}}", "{{.Pk}}", "{{.TreeParent}}", false), id, maxTreeDepth).Pluck("{{.Pk}}", &ids).Error; err != nil {
+			return err
+		}
+		for _, node := range ids {
+			if node == *parent {
+				return ErrTreeCycle
+			}
+		}
+	}
+	res := {{template "scope" .}}.Table("{{tableName}}").Where("{{.Pk}} = ?", id){{if .IdDelete}}.Where("is_deleted = ?", 0){{end}}.UpdateColumn("{{.TreeParent}}", parent)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+{{end}}
+// get{{modelName}}sInOrder retrieves the {{modelName}}s of ids in their order, those out of the
+// scope of db being left out. Returns ErrNotFound if the {{modelName}} of id isn't retrieved
+func get{{modelName}}sInOrder(db *gorm.DB, id {{pkType}}, ids []{{pkType}}) ([]*{{modelName}}, error) {
+	if len(ids) == 0 {
+		return nil, ErrNotFound
+	}
+	ml, err := find{{modelName}}Nodes({{template "scope" .}}{{if .IdDelete}}.Where("is_deleted = ?", 0){{end}}.Where("{{.Pk}} IN (?)", ids))
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[{{pkType}}]*{{modelName}}, len(ml))
+	for _, m := range ml {
+		byId[m.{{pkField}}] = m
+	}
+	if _, ok := byId[id]; !ok {
+		return nil, ErrNotFound
+	}
+	result := make([]*{{modelName}}, 0, len(ml))
+	for _, node := range ids {
+		if m, ok := byId[node]; ok {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+{{end}}{{if or .TreeParent .Closure}}
+// find{{modelName}}Nodes retrieves the {{modelName}}s of qs{{with .NodeParentField}}, the relation to their parent
+// only holding its {{pkField}}{{end}}
+func find{{modelName}}Nodes(qs *gorm.DB) ([]*{{modelName}}, error) {
+{{if .NodeRelations}}	// gorm v1 can't scan the relations, the other columns are read{{if .NodeParentField}} with the parent{{end}}
+	var rows []struct {
+		{{modelName}}
+{{if .NodeParentField}}		NodeParent *{{pkType}} ` + "`" + `gorm:"column:node_parent"` + "`" + `
+{{end}}	}
+	if err := qs.Select("{{.NodeSelect}}").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	ml := make([]*{{modelName}}, len(rows))
+	for i := range rows {
+		ml[i] = &rows[i].{{modelName}}
+{{with .NodeParentField}}		if rows[i].NodeParent != nil {
+			ml[i].{{.}} = &{{modelName}}{ {{pkField}}: *rows[i].NodeParent}
+		}
+{{end}}	}
+	return ml, nil
+{{else}}	ml := make([]*{{modelName}}, 0)
+	err := qs.Find(&ml).Error
+	return ml, err
+{{end}}}
+{{end}}{{if .Sequence}}
+// BeforeCreate reads the id of the new {{modelName}} from {{.Sequence}}, Oracle not returning it
+func (m *{{modelName}}) BeforeCreate(tx *gorm.DB) error {
+	if m.{{pkField}} != 0 {
+		return nil
+	}
+	return tx.Raw("SELECT {{.Sequence}}.NEXTVAL AS id FROM DUAL").Row().Scan(&m.{{pkField}})
+}
+{{end}}{{with .Closure}}
+// AfterCreate inserts the rows of the new {{modelName}} into {{.Table}}, in the transaction of its creation
+func (m *{{modelName}}) AfterCreate(tx *gorm.DB) error {
+	return tx.Exec(closureInsertSQL(dialectName(tx), "{{.Table}}", "{{.AncestorColumn}}", "{{.DescendantColumn}}", "{{.DepthColumn}}", "{{tableName}}", "{{$.Pk}}", "{{.ParentColumn}}"),
+		{{if .ParentColumn}}m.{{pkField}}, m.{{pkField}}, {{end}}m.{{pkField}}, m.{{pkField}}).Error
+}
+
+// BeforeDelete deletes the rows of the {{modelName}} from {{.Table}}, in the transaction of its deletion
+func (m *{{modelName}}) BeforeDelete(tx *gorm.DB) error {
+	return tx.Exec("DELETE FROM {{.Table}} WHERE {{.DescendantColumn}} = ? OR {{.AncestorColumn}} = ?", m.{{pkField}}, m.{{pkField}}).Error
+}
+
+// Get{{modelName}}Descendants retrieves the descendants of the {{modelName}} of id by {{.Table}}, the
+// nearest first, down to maxDepth levels unless it is 0. Returns empty list if it has none
+func Get{{modelName}}Descendants(tx *gorm.DB, id {{pkType}}, maxDepth int) (ml []*{{modelName}}, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	qs := {{template "localizedScope" $}}.Joins("JOIN {{.Table}} ON {{.Table}}.{{.DescendantColumn}} = {{tableName}}.{{$.Pk}}").
+		Where("{{.Table}}.{{.AncestorColumn}} = ? AND {{.Table}}.{{.DepthColumn}} > 0", id){{if $.IdDelete}}.Where("{{tableName}}.is_deleted = ?", 0){{end}}
+	if maxDepth > 0 {
+		qs = qs.Where("{{.Table}}.{{.DepthColumn}} <= ?", maxDepth)
+	}
+	return find{{modelName}}Nodes(qs.Order("{{.Table}}.{{.DepthColumn}}, {{tableName}}.{{$.Pk}}"))
+}
+
+// Get{{modelName}}Ancestors retrieves the ancestors of the {{modelName}} of id by {{.Table}}, from
+// the root to its parent. Returns empty list if it has none
+func Get{{modelName}}Ancestors(tx *gorm.DB, id {{pkType}}) (ml []*{{modelName}}, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	return find{{modelName}}Nodes({{template "localizedScope" $}}.Joins("JOIN {{.Table}} ON {{.Table}}.{{.AncestorColumn}} = {{tableName}}.{{$.Pk}}").
+		Where("{{.Table}}.{{.DescendantColumn}} = ? AND {{.Table}}.{{.DepthColumn}} > 0", id){{if $.IdDelete}}.Where("{{tableName}}.is_deleted = ?", 0){{end}}.
+		Order("{{.Table}}.{{.DepthColumn}} DESC"))
+}
+
+// Move{{modelName}}Subtree moves the {{modelName}} of id, with its descendants, under parent, or to
+// the roots when parent is nil, updating {{.Table}} in tx, or in a transaction of its own when
+// tx is nil. Returns ErrTreeCycle if parent is in the subtree, and ErrNotFound if Id doesn't exist
+func Move{{modelName}}Subtree(tx *gorm.DB, id {{pkType}}, parent *{{pkType}}) (err error) {
+	db := tx
+	if db == nil {
+		if db = DB().Begin(); db.Error != nil {
+			return db.Error
+		}
+		defer func() {
+			if err != nil {
+				db.Rollback()
+				return
+			}
+			err = db.Commit().Error
+		}()
+	}
+	{{if $.CacheSize}}defer cache{{modelName}}.remove(id)
+	{{end}}if parent != nil {
+		var inSubtree int64
+		if err = db.Table("{{.Table}}").Where("{{.AncestorColumn}} = ? AND {{.DescendantColumn}} = ?", id, *parent).Count(&inSubtree).Error; err != nil {
+			return err
+		}
+		if inSubtree > 0 {
+			return ErrTreeCycle
+		}
+	}
+	{{if .ParentColumn}}res := {{template "scope" $}}.Table("{{tableName}}").Where("{{$.Pk}} = ?", id){{if $.IdDelete}}.Where("is_deleted = ?", 0){{end}}.UpdateColumn("{{.ParentColumn}}", parent)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	{{else}}var found int64
+	if err = {{template "scope" $}}.Table("{{tableName}}").Where("{{$.Pk}} = ?", id){{if $.IdDelete}}.Where("is_deleted = ?", 0){{end}}.Count(&found).Error; err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrNotFound
+	}
+	{{end}}if err = db.Exec(closureDetachSQL("{{.Table}}", "{{.AncestorColumn}}", "{{.DescendantColumn}}"), id, id).Error; err != nil {
+		return err
+	}
+	if parent != nil {
+		err = db.Exec(closureAttachSQL("{{.Table}}", "{{.AncestorColumn}}", "{{.DescendantColumn}}", "{{.DepthColumn}}"), *parent, id).Error
+	}
+	return
+}
+{{end}}
+{{if eq .Versioning "system"}}
+// Get{{modelName}}AsOf retrieves {{modelName}} by Id as it was at ts, from the system-versioned
+// {{tableName}}. Returns ErrNotFound if the record didn't exist at that time
+func Get{{modelName}}AsOf(tx *gorm.DB, id {{pkType}}, ts time.Time) (v *{{modelName}}, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	v = &{{modelName}}{}
+	err = notFound(db.Raw("SELECT * FROM {{tableName}} FOR SYSTEM_TIME AS OF TIMESTAMP ? WHERE {{.Pk}} = ? LIMIT 1", ts, id).Scan(v).Error)
+	return
+}
+{{else if eq .Versioning "history"}}
+// Get{{modelName}}AsOf retrieves {{modelName}} by Id as it was at ts: the row of {{.HistoryTable}}
+// valid at ts, or the current record if it hasn't changed since then. Returns ErrNotFound
+// if the record didn't exist at that time{{if not .CreatedField}}; a record never changed is
+// taken as existing at any time, {{tableName}} having no creation time column{{end}}
+func Get{{modelName}}AsOf(tx *gorm.DB, id {{pkType}}, ts time.Time) (v *{{modelName}}, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	v = &{{modelName}}{}
+	err = {{template "scope" .}}.Table("{{.HistoryTable}}").Where("{{.Pk}} = ? AND {{.HistoryFrom}} <= ? AND {{.HistoryTo}} > ?", id, ts, ts).
+		Order("{{.HistoryFrom}} desc").First(v).Error
+	if !IsNotFound(err) {
+		return
+	}
+	// no past row covers ts: the record didn't exist yet if it has been changed since
+	var later int64
+	if err = {{template "scope" .}}.Table("{{.HistoryTable}}").Where("{{.Pk}} = ? AND {{.HistoryFrom}} > ?", id, ts).Count(&later).Error; err != nil {
+		return nil, err
+	}
+	if later > 0 {
+		return nil, ErrNotFound
+	}
+	if v, err = Get{{modelName}}ById{{if .IdDelete}}IncludingDeleted{{end}}(tx, id); err != nil {
+		return nil, err
+	}{{if .CreatedField}}
+	if v.{{.CreatedField}}.After(ts) {
+		return nil, ErrNotFound
+	}{{end}}
 	return
 }
 {{end}}
 
 // Search{{modelName}}s retrieves all {{modelName}}(not deleted recoreds) matches certain condition. Returns empty list if
-// no records exist
-func Search{{modelName}}s(tx *gorm.DB, order string, offset, limit uint64, query string, queryArgs ...interface{}) (ml []*{{modelName}}, err error) {
-	{{if .IdDelete}}if query != "" {
-		query += " and is_deleted = 0"
-	} else {
-		query = "is_deleted = 0"
-	}
-	{{end}}db := tx
+// no records exist. order is built from the column constants, e.g. OrderBy{Column: {{modelName}}Col{{pkField}}}, or with Order{{modelName}}By from a field name.
+func Search{{modelName}}s(tx *gorm.DB, order []OrderBy, offset, limit uint64, query string, queryArgs ...interface{}) (ml []*{{modelName}}, err error) {
+	db := tx
     if db == nil {
         db = DB()
     }
-	qs := db.Where(query, queryArgs...)
-	if order != "" {
-		qs = qs.Order(order)
+	qs, err := order{{modelName}}s(where{{modelName}}s(db, query, queryArgs...), order)
+	if err != nil {
+		return nil, err
 	}
 	if offset > 0 {
-		qs = qs.Offset(offset)
+		qs = qs.Offset(int(offset))
 	}
 	if limit > 0 {
-		qs = qs.Limit(limit)
+		qs = qs.Limit(int(limit))
 	}
 	ml = make([]*{{modelName}}, 0)
 	err = qs.Find(&ml).Error
@@ -1172,124 +2129,628 @@ func Search{{modelName}}s(tx *gorm.DB, order string, offset, limit uint64, query
 // Count{{modelName}}s retrieves count of all {{modelName}}(not deleted recoreds) matches certain condition. Returns 0 if
 // no records exist
 func Count{{modelName}}s(tx *gorm.DB, query string, queryArgs ...interface{}) (count int64, err error) {
-	{{if .IdDelete}}if query != "" {
-		query += " and is_deleted = 0"
-	} else {
-		query = "is_deleted = 0"
-	}
-	{{end}}db := tx
+	db := tx
     if db == nil {
         db = DB()
     }
-	err = db.Model(&{{modelName}}{}).Where(query, queryArgs...).Count(&count).Error
+	err = where{{modelName}}s(db.Model(&{{modelName}}{}), query, queryArgs...).Count(&count).Error
 	return
 }
 
-// Update{{modelName}} updates {{modelName}}(all changed fields) by Id and returns error if
-// the record to be updated doesn't exist
-func Update{{modelName}}ById(tx *gorm.DB, m *{{modelName}}) (err error) {
-    db := tx
-    if db == nil {
-        db = DB()
-    }
-	return db.Save(m).Error
+{{with .MaskedColumns}}// Masked returns a copy of m with its sensitive columns masked, as served by the controllers
+func (m *{{modelName}}) Masked() *{{modelName}} {
+	c := *m
+{{range .}}{{if .Nullable}}	if c.{{.Name}} != nil {
+		v := {{.MaskExpr (printf "*c.%s" .Name)}}
+		c.{{.Name}} = &v
+	}
+{{else}}	c.{{.Name}} = {{.MaskExpr (printf "c.%s" .Name)}}
+{{end}}{{end}}	return &c
 }
 
-// BatchUpdate{{modelName}}s updates all qualified {{modelName}}s
-// return the record number affected and error
-func BatchUpdate{{modelName}}s(tx *gorm.DB, kvs map[string]interface{}, query string, queryArgs ...interface{}) (affected int64, err error) {
-	if len(kvs) == 0 || query == "" {
-		// nothing to update, omit
-		return
+// unmask restores the sensitive columns of m holding the masked value of old, e.g. sent
+// back as read through the controllers, to their value in old
+func (m *{{modelName}}) unmask(old *{{modelName}}) {
+	masked := old.Masked()
+{{range .}}{{if .Nullable}}	if m.{{.Name}} != nil && masked.{{.Name}} != nil && *m.{{.Name}} == *masked.{{.Name}} {
+{{else}}	if m.{{.Name}} == masked.{{.Name}} {
+{{end}}		m.{{.Name}} = old.{{.Name}}
 	}
-    db := tx
-    if db == nil {
-        db = DB()
-    }
-	ret := db.Table("{{.Name}}").Where(query, queryArgs...).Updates(kvs)
-	return ret.RowsAffected, ret.Error
-}
+{{end}}}
 
-// Delete{{modelName}} deletes {{modelName}}(set IsDeleted to 1) by Id and returns error if
-// the record to be deleted doesn't exist
-func Delete{{modelName}}(tx *gorm.DB, id {{pkType}}) (err error) {
-	// ascertain id exists in the database
-    db := tx
-    if db == nil {
-        db = DB()
-    }
-	v := {{modelName}}{Id: id}
-    if err = db.First(&v).Error; err == nil {
-        {{if .IdDelete}}v.IsDeleted = 1
-        return db.Save(&v).Error
-        {{else}}return db.Delete(&v).Error{{end}}
-    }
-	return
+{{end}}{{range .Money}}// {{.Name}}Money returns {{.Amount.Tag.Column}} as a Money{{if .Currency}}, its currency being {{.Currency.Tag.Column}}{{end}}
+func (m *{{modelName}}) {{.Name}}Money() Money {
+	return Money{Minor: int64(m.{{.Amount.Name}}), Currency: {{if .Currency}}m.{{.Currency.Name}}{{else}}DefaultCurrency{{end}}}
 }
-`
-	CtrlTPL = `package controllers
-
-import (
-	"{{pkgPath}}/models"
-	"encoding/json"
-	"errors"
-	"strconv"
-	"strings"
 
-	"github.com/astaxie/beego"
-)
-
-// {{ctrlName}}Controller operations for {{ctrlName}}
-type {{ctrlName}}Controller struct {
-	beego.Controller
+// Set{{.Name}}Money sets {{.Amount.Tag.Column}}{{if .Currency}} and {{.Currency.Tag.Column}}{{end}} to v{{if not .Currency}}, failing with ErrCurrencyMismatch
+// when v isn't of DefaultCurrency{{end}}
+func (m *{{modelName}}) Set{{.Name}}Money(v Money) error {
+	{{if .Currency}}m.{{.Currency.Name}} = v.Currency
+	{{else}}if v.Currency != DefaultCurrency {
+		return ErrCurrencyMismatch
+	}
+	{{end}}m.{{.Amount.Name}} = {{.Amount.Type}}(v.Minor)
+	return nil
 }
 
-// URLMapping ...
-func (c *{{ctrlName}}Controller) URLMapping() {
-	c.Mapping("Post", c.Post)
-	c.Mapping("GetOne", c.GetOne)
-	c.Mapping("GetAll", c.GetAll)
-	c.Mapping("Put", c.Put)
-	c.Mapping("Delete", c.Delete)
+{{end}}{{if .SignatureColumn}}// BeforeSave signs m, {{.SignatureColumn}} holding the HMAC of {{.Pk}}, {{join .Signed ", "}}. A new
+// {{modelName}} without {{pkField}} is signed by AfterSave, once it is created.
+func (m *{{modelName}}) BeforeSave(tx *gorm.DB) (err error) {
+	if m.{{pkField}} == {{if eq .PkType "string"}}""{{else}}0{{end}} {
+		m.{{.SignatureField}} = ""
+		return nil
+	}
+	m.{{.SignatureField}}, err = sign(m.{{pkField}}, {{.SignedFields "m"}})
+	return
 }
 
-// Post ...
-// @Title Post
+// AfterSave signs the {{modelName}} created without {{pkField}}, in the transaction of its creation
+func (m *{{modelName}}) AfterSave(tx *gorm.DB) (err error) {
+	if m.{{.SignatureField}} != "" {
+		return nil
+	}
+	if m.{{.SignatureField}}, err = sign(m.{{pkField}}, {{.SignedFields "m"}}); err != nil {
+		return
+	}
+	return tx.Model(m).UpdateColumn("{{.SignatureColumn}}", m.{{.SignatureField}}).Error
+}
+
+// AfterFind verifies the signature of m, failing with ErrBadSignature when it has been tampered with.
+// A {{modelName}} read with some of its columns only isn't verified.
+func (m *{{modelName}}) AfterFind(tx *gorm.DB) error {
+	if partial, ok := tx.Get(partialSetting); ok && partial == true {
+		return nil
+	}
+	return verify(m.{{.SignatureField}}, m.{{pkField}}, {{.SignedFields "m"}})
+}
+
+{{end}}{{if .ReadModel}}// {{modelName}}View is the read model of the {{modelName}} aggregate: the record with the records referencing it.
+// It is shared by the readers and must not be modified.
+type {{modelName}}View struct {
+	{{modelName}}
+{{range .Children}}	{{.Model}} []*{{.Model}} ` + "`" + `json:"{{.Table}}"` + "`" + `
+{{end}}}
+
+// view{{modelName}} holds the {{modelName}}Views, maintained from the change events of their records
+var view{{modelName}} = newProjection()
+
+func init() {
+	OnChange("{{tableName}}", func(e ChangeEvent) {
+		if m, ok := e.Record.(*{{modelName}}); ok {
+			view{{modelName}}.drop(m.{{pkField}})
+		} else {
+			view{{modelName}}.reset()
+		}
+	})
+{{range .Children}}	// the {{modelName}}s a {{.Model}} referenced before being written are unknown
+	OnChange("{{.Table}}", func(ChangeEvent) { view{{modelName}}.reset() })
+{{end}}}
+
+// Get{{modelName}}View retrieves the read model of the {{modelName}} of id. Returns ErrNotFound if
+// Id doesn't exist
+func Get{{modelName}}View(id {{pkType}}) (v *{{modelName}}View, err error) {
+	if cached, ok := view{{modelName}}.get(id); ok {
+		return cached.(*{{modelName}}View), nil
+	}
+	gen := view{{modelName}}.generation()
+	m, err := Get{{modelName}}ById(nil, id)
+	if err != nil {
+		return nil, err
+	}
+	v = &{{modelName}}View{ {{modelName}}: *m }
+{{range .Children}}	if err = where{{.Model}}s(DB(), "{{.Column}} = ?", id).Find(&v.{{.Model}}).Error; err != nil {
+		return nil, err
+	}
+{{end}}	view{{modelName}}.add(id, v, gen)
+	return v, nil
+}
+
+// Search{{modelName}}Views retrieves the read models of the {{modelName}}s{{if .IdDelete}}(not deleted records){{end}} in the order of their Id
+func Search{{modelName}}Views(offset, limit uint64) ([]*{{modelName}}View, error) {
+	ml, err := Search{{modelName}}s(nil, []OrderBy{ {Column: "{{.Pk}}"} }, offset, limit, "")
+	if err != nil {
+		return nil, err
+	}
+	views := make([]*{{modelName}}View, 0, len(ml))
+	for _, m := range ml {
+		v, err := Get{{modelName}}View(m.{{pkField}})
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, nil
+}
+{{if .ViewMasked}}
+// Masked returns a copy of v with the sensitive columns of its records masked, as served by the controllers
+func (v *{{modelName}}View) Masked() *{{modelName}}View {
+	c := *v
+	{{if .MaskedColumns}}c.{{modelName}} = *v.{{modelName}}.Masked()
+{{end}}{{range .Children}}{{if .Masked}}	c.{{.Model}} = make([]*{{.Model}}, len(v.{{.Model}}))
+	for i, m := range v.{{.Model}} {
+		c.{{.Model}}[i] = m.Masked()
+	}
+{{end}}{{end}}	return &c
+}
+{{end}}
+{{end}}{{if .RetentionColumn}}// PurgeDeleted{{modelName}}sOlderThan hard deletes the {{modelName}}s soft deleted for longer than d,
+// {{.RetentionColumn}} holding the time of deletion. Returns the number of purged rows.
+func PurgeDeleted{{modelName}}sOlderThan(tx *gorm.DB, d time.Duration) (int64, error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	{{if .CacheSize}}defer cache{{modelName}}.purge()
+	{{end}}res := db.Unscoped().Where("is_deleted = ? AND {{.RetentionColumn}} < ?", 1, time.Now().Add(-d)).Delete(&{{modelName}}{})
+	return res.RowsAffected, res.Error
+}
+
+{{end}}// where{{modelName}}s adds the condition of Search{{modelName}}s and Count{{modelName}}s as a separate,
+// parenthesized WHERE clause{{if .IdDelete}}: whatever the query holds, deleted records can't be matched{{end}}{{if .DefaultScope}}.
+// The records out of the default scope, {{.DefaultScope}}, are only matched with Unscoped.{{end}}
+func where{{modelName}}s(db *gorm.DB, query string, queryArgs ...interface{}) *gorm.DB {
+	{{if .TenantColumn}}db = scopeTenant(db, "{{.TenantColumn}}")
+	{{end}}{{if .DefaultScope}}db = scopeDefault(db, {{printf "%q" .DefaultScope}})
+	{{end}}{{if .IdDelete}}db = db.Where("is_deleted = ?", 0)
+	{{end}}if query != "" {
+		db = db.Where(query, queryArgs...)
+	}
+	return db
+}
+{{if .Large}}
+// Count{{modelName}}sEstimate returns the approximate number of rows of {{tableName}}{{if .IdDelete}}, deleted ones included,{{end}}
+// from the statistics of the database, which is much faster than Count{{modelName}}s on large tables.
+// It falls back on the exact count when the table has never been analyzed.
+func Count{{modelName}}sEstimate(tx *gorm.DB) (count int64, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var rows []int64
+	switch dialectName(db) {
+	case "postgres":
+		err = db.Raw("SELECT reltuples::bigint FROM pg_class WHERE oid = to_regclass(?)", "{{tableName}}").Pluck("reltuples", &rows).Error
+	case "sqlite3":
+		// SQLite keeps no row count
+	case "mssql":
+		err = db.Raw("SELECT SUM(rows) AS table_rows FROM sys.partitions WHERE object_id = OBJECT_ID(?) AND index_id IN (0, 1)", "{{tableName}}").Pluck("table_rows", &rows).Error
+	case "oracle":
+		err = db.Raw("SELECT COALESCE(num_rows, -1) AS table_rows FROM user_tables WHERE table_name = UPPER(?)", "{{tableName}}").Pluck("table_rows", &rows).Error
+	default:
+		err = db.Raw("SELECT table_rows FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", "{{tableName}}").Pluck("table_rows", &rows).Error
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 || rows[0] < 0 {
+		return Count{{modelName}}s(tx, "")
+	}
+	return rows[0], nil
+}
+{{end}}
+// GetAll{{modelName}} retrieves {{modelName}}s{{if .IdDelete}}(not deleted records){{end}} as listed by the generated controller:
+// query holds column/value pairs, fields the columns to load (all when empty), sortby and
+// order the sort columns and their directions. total counts the matching records whatever
+// offset and limit are.
+func GetAll{{modelName}}(tx *gorm.DB, query map[string]string, fields, sortby, order []string, offset, limit int64) (ml []*{{modelName}}, total int64, err error) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &ParamError{Key: "invalid_page", Args: []interface{}{offset, limit}}
+	}
+	for _, field := range fields {
+		if !is{{modelName}}Column(field) {
+			return nil, 0, &ParamError{Key: "unknown_column", Args: []interface{}{field, "{{tableName}}"}}
+		}
+	}
+	cond, args, err := queryCondition(query, is{{modelName}}Column)
+	if err != nil {
+		return nil, 0, err
+	}
+	orderBy, err := parseOrder(sortby, order)
+	if err != nil {
+		return nil, 0, err
+	}
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	{{if and .Large (not .DefaultScope)}}{{if .TenantColumn}}_, scoped := tenantOf(db)
+	if cond == "" && !scoped {{else}}if cond == "" {{end}}{
+		// counting every row of a large table is too slow, its estimate is enough for paging
+		total, err = Count{{modelName}}sEstimate(db)
+	} else {
+		total, err = Count{{modelName}}s(db, cond, args...)
+	}{{else}}total, err = Count{{modelName}}s(db, cond, args...){{end}}
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(fields) > 0 {
+		db = db.Select(fields){{if .SignatureColumn}}.Set(partialSetting, true){{end}}
+	}
+	ml, err = Search{{modelName}}s(db, orderBy, uint64(offset), uint64(limit), cond, args...)
+	return
+}
+
+// {{modelName}}Filter holds the conditions used by Search{{modelName}}sByFilter and
+// Count{{modelName}}sByFilter. Nil fields are ignored, From/To bounds are inclusive.
+type {{modelName}}Filter struct {
+{{range .Columns}}{{if .Filterable}}	{{.Name}} *{{.BaseType}}
+{{if .Ranged}}	{{.Name}}From *{{.BaseType}}
+	{{.Name}}To *{{.BaseType}}
+{{end}}{{if .Nullable}}	{{.Name}}IsNull *bool
+{{end}}{{end}}{{end}}}
+
+// where applies the conditions of the filter to db
+func (f *{{modelName}}Filter) where(db *gorm.DB) *gorm.DB {
+	{{if .TenantColumn}}db = scopeTenant(db, "{{.TenantColumn}}")
+	{{end}}{{if .DefaultScope}}db = scopeDefault(db, {{printf "%q" .DefaultScope}})
+	{{end}}{{if .IdDelete}}db = db.Where("is_deleted = ?", 0)
+	{{end}}if f == nil {
+		return db
+	}
+{{range .Columns}}{{if .Filterable}}	if f.{{.Name}} != nil {
+		db = db.Where("{{.Tag.Column}} = ?", *f.{{.Name}})
+	}
+{{if .Ranged}}	if f.{{.Name}}From != nil {
+		db = db.Where("{{.Tag.Column}} >= ?", *f.{{.Name}}From)
+	}
+	if f.{{.Name}}To != nil {
+		db = db.Where("{{.Tag.Column}} <= ?", *f.{{.Name}}To)
+	}
+{{end}}{{if .Nullable}}	if f.{{.Name}}IsNull != nil {
+		if *f.{{.Name}}IsNull {
+			db = db.Where("{{.Tag.Column}} IS NULL")
+		} else {
+			db = db.Where("{{.Tag.Column}} IS NOT NULL")
+		}
+	}
+{{end}}{{end}}{{end}}	return db
+}
+
+// Search{{modelName}}sByFilter retrieves all {{modelName}}{{if .IdDelete}}(not deleted records){{end}} matching the filter.
+// Returns empty list if no records exist
+func Search{{modelName}}sByFilter(tx *gorm.DB, f *{{modelName}}Filter, order []OrderBy, offset, limit uint64) (ml []*{{modelName}}, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	qs, err := order{{modelName}}s(f.where(db), order)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		qs = qs.Offset(int(offset))
+	}
+	if limit > 0 {
+		qs = qs.Limit(int(limit))
+	}
+	ml = make([]*{{modelName}}, 0)
+	err = qs.Find(&ml).Error
+	return
+}
+
+// Count{{modelName}}sByFilter retrieves count of all {{modelName}}{{if .IdDelete}}(not deleted records){{end}} matching the filter
+func Count{{modelName}}sByFilter(tx *gorm.DB, f *{{modelName}}Filter) (count int64, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	err = f.where(db.Model(&{{modelName}}{})).Count(&count).Error
+	return
+}
+
+{{if not .ReadOnly}}
+{{range .UniqueColumns}}{{if not .Encrypted}}
+// IsUnique{{modelName}}{{.Name}} reports whether no other {{modelName}}{{if $.IdDelete}}(not deleted){{end}} has v as {{.Tag.Column}}.
+// excludeId skips the record being updated, pass the zero value when creating one.{{if $.TenantColumn}}
+// Only the records of the tenant of tx, if any, are compared.{{end}}
+func IsUnique{{modelName}}{{.Name}}(tx *gorm.DB, v {{.BaseType}}, excludeId {{pkType}}) (bool, error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var count int64
+	err := {{if $.TenantColumn}}scopeTenant(db, "{{$.TenantColumn}}"){{else}}db{{end}}.Model(&{{modelName}}{}).Where("{{.Tag.Column}} = ? and {{$.Pk}} <> ?", v, excludeId){{if $.IdDelete}}.Where("is_deleted = ?", 0){{end}}.Count(&count).Error
+	return count == 0, err
+}
+{{end}}{{end}}{{range .ConflictColumns}}
+// Exists{{modelName}}By{{.Name}} reports whether a {{modelName}}{{if $.IdDelete}}(not deleted){{end}}{{if $.TenantColumn}} of the tenant of tx, if any,{{end}} has v as {{.Tag.Column}}
+func Exists{{modelName}}By{{.Name}}(tx *gorm.DB, v {{.BaseType}}) (bool, error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var count int64
+	err := {{if $.TenantColumn}}scopeTenant(db, "{{$.TenantColumn}}"){{else}}db{{end}}.Model(&{{modelName}}{}).Where("{{.Tag.Column}} = ?", v){{if $.IdDelete}}.Where("is_deleted = ?", 0){{end}}.Count(&count).Error
+	return count > 0, err
+}
+{{end}}
+// Update{{modelName}} updates {{modelName}}(all changed fields) by Id and returns error if
+// the record to be updated doesn't exist
+func Update{{modelName}}ById(tx *gorm.DB, m *{{modelName}}) (err error) {
+    db := tx
+    if db == nil {
+        db = DB()
+    }
+	{{if .MaskedColumns}}// {{if .TenantColumn}}only the records of the tenant of db can be updated, {{end}}the sensitive columns sent back masked keep their value
+	old := {{modelName}}{}
+	if err = notFound({{template "scope" .}}.Where("{{.Pk}} = ?", m.{{pkField}}).First(&old).Error); err != nil {
+		return
+	}
+	m.unmask(&old)
+	{{else if .TenantColumn}}// only the records of the tenant of db can be updated
+	if err = notFound({{template "scope" .}}.Where("{{.Pk}} = ?", m.{{pkField}}).First(&{{modelName}}{}).Error); err != nil {
+		return
+	}
+	{{end}}{{if .CacheSize}}defer cache{{modelName}}.remove(m.{{pkField}})
+	{{end}}return db{{if .ImmutableList}}.Omit({{.ImmutableList}}){{end}}.Save(m).Error
+}
+
+// BatchUpdate{{modelName}}s updates all qualified {{modelName}}s
+// return the record number affected and error
+func BatchUpdate{{modelName}}s(tx *gorm.DB, kvs map[string]interface{}, query string, queryArgs ...interface{}) (affected int64, err error) {
+	{{if .ImmutableList}}// immutable columns are never updated, the map of the caller is left untouched
+	updates := make(map[string]interface{}, len(kvs))
+	for k, v := range kvs {
+		updates[k] = v
+	}
+	for _, col := range []string{ {{.ImmutableList}} } {
+		delete(updates, col)
+	}
+	kvs = updates
+	{{end}}{{if .SignatureColumn}}for _, col := range []string{ {{.SignedList}} } {
+		if _, ok := kvs[col]; ok {
+			// the signature covers the whole record, it is only computed by Update{{modelName}}ById
+			return 0, fmt.Errorf("signed column '%s' of {{tableName}} can't be batch updated", col)
+		}
+	}
+	{{end}}if len(kvs) == 0 || query == "" {
+		// nothing to update, omit
+		return
+	}
+    db := tx
+    if db == nil {
+        db = DB()
+    }
+	{{if .CacheSize}}defer cache{{modelName}}.purge()
+	{{end}}ret := {{template "scope" .}}.Table("{{.Name}}").Where(query, queryArgs...).Updates(kvs)
+	return ret.RowsAffected, ret.Error
+}
+{{if .UpdatableColumns}}
+// {{modelName}}Updates builds the kvs of BatchUpdate{{modelName}}s with one setter per
+// updatable column, e.g. New{{modelName}}Updates().Set{{(index .UpdatableColumns 0).Name}}(v)
+type {{modelName}}Updates map[string]interface{}
+
+// New{{modelName}}Updates returns {{modelName}}Updates setting no column
+func New{{modelName}}Updates() {{modelName}}Updates {
+	return {{modelName}}Updates{}
+}
+{{range .UpdatableColumns}}
+// Set{{.Name}} sets {{.Tag.Column}} to v
+func (u {{modelName}}Updates) Set{{.Name}}(v {{.Type}}) {{modelName}}Updates {
+	u[{{modelName}}Col{{.Name}}] = v
+	return u
+}
+{{end}}{{end}}
+// Delete{{modelName}} deletes {{modelName}}(set IsDeleted to 1) by Id and returns ErrNotFound if
+// the record to be deleted doesn't exist
+func Delete{{modelName}}(tx *gorm.DB, id {{pkType}}) (err error) {
+	// ascertain id exists in the database
+    db := tx
+    if db == nil {
+        db = DB()
+    }
+	{{if .TenantColumn}}db = scopeTenant(db, "{{.TenantColumn}}")
+	{{end}}{{if .CacheSize}}defer cache{{modelName}}.remove(id)
+	{{end}}v := {{modelName}}{{{pkField}}: id}
+    if err = db.First(&v).Error; err == nil {
+        {{if .IdDelete}}v.IsDeleted = 1
+        return db.Save(&v).Error
+        {{else}}return db.Delete(&v).Error{{end}}
+    }
+	return notFound(err)
+}
+{{if .IdDelete}}
+// SearchDeleted{{modelName}}s retrieves the deleted {{modelName}}s, the last created first. Returns empty list if
+// no records exist
+func SearchDeleted{{modelName}}s(tx *gorm.DB, offset, limit uint64) (ml []*{{modelName}}, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	qs := {{template "scope" .}}.Where("is_deleted = ?", 1).Order("{{.Pk}} desc")
+	if offset > 0 {
+		qs = qs.Offset(int(offset))
+	}
+	if limit > 0 {
+		qs = qs.Limit(int(limit))
+	}
+	ml = make([]*{{modelName}}, 0)
+	err = qs.Find(&ml).Error
+	return
+}
+
+// CountDeleted{{modelName}}s retrieves count of the deleted {{modelName}}s
+func CountDeleted{{modelName}}s(tx *gorm.DB) (count int64, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	err = {{template "scope" .}}.Model(&{{modelName}}{}).Where("is_deleted = ?", 1).Count(&count).Error
+	return
+}
+
+// Restore{{modelName}} restores the deleted {{modelName}} of id(set IsDeleted to 0) and returns ErrNotFound if
+// no deleted record has this id
+func Restore{{modelName}}(tx *gorm.DB, id {{pkType}}) error {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	{{if .CacheSize}}defer cache{{modelName}}.remove(id)
+	{{end}}res := {{template "scope" .}}.Model(&{{modelName}}{}).Where("{{.Pk}} = ? AND is_deleted = ?", id, 1).UpdateColumn("is_deleted", 0)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return res.Error
+}
+{{end}}{{end}}{{define "cached"}}{{if .CacheSize}}if tx == nil {
+		if cached, ok := cache{{modelName}}.get(id); ok {
+			c := cached.({{modelName}})
+			return &c, nil
+		}
+		gen := cache{{modelName}}.generation()
+		defer func() {
+			if err == nil {
+				cache{{modelName}}.add(id, *v, gen)
+			}
+		}()
+	}
+	{{end}}{{end}}{{define "scope"}}{{if .DefaultScope}}scopeDefault({{end}}{{if .TenantColumn}}scopeTenant(db, "{{.TenantColumn}}"){{else}}db{{end}}{{if .DefaultScope}}, {{printf "%q" .DefaultScope}}){{end}}{{end}}{{define "localizedScope"}}{{if .DefaultScope}}scopeDefault({{end}}{{if .TenantColumn}}scopeTenant(db, "{{.Name}}.{{.TenantColumn}}"){{else}}db{{end}}{{if .DefaultScope}}, {{printf "%q" .DefaultScope}}){{end}}{{end}}`
+	CtrlTPL = `package controllers
+
+import (
+	"{{pkgPath}}/models"
+{{if or (.Allows "post") (.Allows "put")}}	"encoding/json"
+{{end}}{{if and (.Allows "get") (not i18n)}}	"errors"
+{{end}}{{if and (ne .PkType "string") (or (.Allows "get") (.Allows "put") (.Allows "delete"))}}	"strconv"
+{{end}}{{if .Allows "get"}}	"strings"
+{{end}}
+	"github.com/astaxie/beego"
+)
+
+// {{ctrlName}}Controller operations for {{ctrlName}}
+type {{ctrlName}}Controller struct {
+	beego.Controller
+}
+
+// URLMapping ...
+func (c *{{ctrlName}}Controller) URLMapping() {
+{{if .Allows "post"}}	c.Mapping("Post", c.Post)
+{{end}}{{if .Allows "get"}}	c.Mapping("GetOne", c.GetOne)
+	c.Mapping("GetAll", c.GetAll)
+{{if .ReadModel}}	c.Mapping("GetView", c.GetView)
+	c.Mapping("GetViews", c.GetViews)
+{{end}}{{end}}{{if .Importable}}	c.Mapping("Import", c.Import)
+{{end}}{{if .Allows "put"}}	c.Mapping("Put", c.Put)
+{{end}}{{if .Allows "delete"}}	c.Mapping("Delete", c.Delete)
+{{end}}}
+{{if .Allows "post"}}
+// Post ...
+// @Title Post
 // @Description create {{ctrlName}}
 // @Param	body		body 	models.{{ctrlName}}	true		"body for {{ctrlName}} content"
-// @Success 201 {int} models.{{ctrlName}}
+{{if idempotency}}// @Param	Idempotency-Key	header	string	false	"key replaying the response of the first request sent with it"
+{{end}}// @Success 201 {int} models.{{ctrlName}}
 // @Failure 403 body is empty
+// @Failure 409 a unique column is already taken{{if idempotency}}, or a request with the same Idempotency-Key is in progress
+// @Failure 422 the Idempotency-Key is already used by another request{{end}}
 // @router / [post]
 func (c *{{ctrlName}}Controller) Post() {
 	var v models.{{ctrlName}}
 	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &v); err == nil {
-		if _, err := models.Add{{ctrlName}}(&v); err == nil {
+		{{if .ConflictColumns}}if column, err := c.conflict(&v); err != nil || column != "" {
+			if err == nil {
+				c.Ctx.Output.SetStatus(409)
+				c.Data["json"] = {{if i18n}}tr(c.Ctx, "conflict", column){{else}}column + " already exists"{{end}}
+			} else {
+				c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+			}
+			c.ServeJSON()
+			return
+		}
+		{{end}}{{if wrapCalls}}if err := models.CallWrite("{{.Name}}", func() error {
+			_, err := models.Add{{ctrlName}}({{template "db" .}}, &v)
+			return err
+		}); err == nil{{else}}if _, err := models.Add{{ctrlName}}({{template "db" .}}, &v); err == nil{{end}} {
 			c.Ctx.Output.SetStatus(201)
-			c.Data["json"] = v
+			c.Data["json"] = {{if .MaskedColumns}}v.Masked(){{else}}v{{end}}
 		} else {
-			c.Data["json"] = err.Error()
+			if models.IsDuplicateKey(err) {
+				c.Ctx.Output.SetStatus(409)
+			} else if models.IsForeignKeyViolation(err) || models.IsCheckViolation(err) {
+				c.Ctx.Output.SetStatus(400)
+			}
+			c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
 		}
 	} else {
-		c.Data["json"] = err.Error()
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
 	}
 	c.ServeJSON()
 }
-
+{{if .Importable}}
+// Import ...
+// @Title Import
+// @Description create {{ctrlName}}s from a CSV or xlsx file whose header row holds the column names, all of them or none
+// @Param	file	formData	file	true	"the .csv or .xlsx file"
+// @Param	dry_run	query	bool	false	"only check the rows, nothing is inserted"
+// @Success 200 {object} models.ImportResult
+// @Failure 400 the file can't be read or its rows violate a constraint
+// @Failure 409 a unique column is already taken
+// @Failure 422 invalid rows, listed by the errors of the result
+// @router /import [post]
+func (c *{{ctrlName}}Controller) Import() {
+	file, header, err := c.GetFile("file")
+	if err != nil {
+		c.Ctx.Output.SetStatus(400)
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+		c.ServeJSON()
+		return
+	}
+	defer file.Close()
+	dryRun, _ := c.GetBool("dry_run")
+	if res, err := models.Import{{ctrlName}}s({{template "db" .}}, file, header.Filename, dryRun); err == nil {
+		if len(res.Errors) > 0 {
+			c.Ctx.Output.SetStatus(422)
+		}
+		c.Data["json"] = res
+	} else {
+		if models.IsDuplicateKey(err) {
+			c.Ctx.Output.SetStatus(409)
+		} else if models.IsInvalidImport(err) || models.IsForeignKeyViolation(err) || models.IsCheckViolation(err) {
+			c.Ctx.Output.SetStatus(400)
+		}
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+	}
+	c.ServeJSON()
+}
+{{end}}{{if .ConflictColumns}}
+// conflict returns the unique column of v already taken by another {{ctrlName}}, if any
+func (c *{{ctrlName}}Controller) conflict(v *models.{{ctrlName}}) (string, error) {
+{{range .ConflictColumns}}{{if .Nullable}}	if v.{{.Name}} != nil {
+		if exists, err := models.Exists{{ctrlName}}By{{.Name}}({{template "db" $}}, *v.{{.Name}}); err != nil || exists {
+			return "{{.Tag.Column}}", err
+		}
+	}
+{{else}}	if exists, err := models.Exists{{ctrlName}}By{{.Name}}({{template "db" $}}, v.{{.Name}}); err != nil || exists {
+		return "{{.Tag.Column}}", err
+	}
+{{end}}{{end}}	return "", nil
+}
+{{end}}{{end}}{{if .Allows "get"}}
 // GetOne ...
 // @Title Get One
 // @Description get {{ctrlName}} by id
 // @Param	id		path 	string	true		"The key for staticblock"
 // @Success 200 {object} models.{{ctrlName}}
 // @Failure 403 :id is empty
+// @Failure 404 :id doesn't exist
 // @router /:id [get]
 func (c *{{ctrlName}}Controller) GetOne() {
 	idStr := c.Ctx.Input.Param(":id")
-	id, _ := strconv.Atoi(idStr)
-	v, err := models.Get{{ctrlName}}ById(id)
+{{template "parseId" .}}{{if wrapCalls}}	var v *models.{{ctrlName}}
+	if err := models.Call("{{.Name}}", func() (err error) {
+		v, err = models.Get{{ctrlName}}ById({{template "db" .}}, id)
+		return
+	}); err != nil {
+{{else}}	v, err := models.Get{{ctrlName}}ById({{template "db" .}}, id)
 	if err != nil {
-		c.Data["json"] = err.Error()
+{{end}}		if models.IsNotFound(err) {
+			c.Ctx.Output.SetStatus(404)
+		}
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
 	} else {
-		c.Data["json"] = v
+		c.Data["json"] = v{{if .MaskedColumns}}.Masked(){{end}}
 	}
 	c.ServeJSON()
 }
@@ -1311,17 +2772,18 @@ func (c *{{ctrlName}}Controller) GetAll() {
 	var sortby []string
 	var order []string
 	var query = make(map[string]string)
-	var limit int64 = 10
+	var limit int64 = models.DefaultPageSize
 	var offset int64
 
-	// fields: col1,col2,entity.col3
+	// fields: col1,col2
 	if v := c.GetString("fields"); v != "" {
 		fields = strings.Split(v, ",")
 	}
-	// limit: 10 (default is 10)
+	// limit: 10 (default is models.DefaultPageSize, capped to models.MaxPageSize)
 	if v, err := c.GetInt64("limit"); err == nil {
 		limit = v
 	}
+	limit = models.PageLimit(limit)
 	// offset: 0 (default is 0)
 	if v, err := c.GetInt64("offset"); err == nil {
 		offset = v
@@ -1339,7 +2801,7 @@ func (c *{{ctrlName}}Controller) GetAll() {
 		for _, cond := range strings.Split(v, ",") {
 			kv := strings.SplitN(cond, ":", 2)
 			if len(kv) != 2 {
-				c.Data["json"] = errors.New("Error: invalid query key/value pair")
+				c.Data["json"] = {{if i18n}}tr(c.Ctx, "invalid_query"){{else}}errors.New("Error: invalid query key/value pair"){{end}}
 				c.ServeJSON()
 				return
 			}
@@ -1348,15 +2810,87 @@ func (c *{{ctrlName}}Controller) GetAll() {
 		}
 	}
 
-	l, err := models.GetAll{{ctrlName}}(query, fields, sortby, order, offset, limit)
+{{if wrapCalls}}	var l []*models.{{ctrlName}}
+	var total int64
+	err := models.Call("{{.Name}}", func() (err error) {
+		l, total, err = models.GetAll{{ctrlName}}({{template "db" .}}, query, fields, sortby, order, offset, limit)
+		return
+	})
+{{else}}	l, total, err := models.GetAll{{ctrlName}}({{template "db" .}}, query, fields, sortby, order, offset, limit)
+{{end}}	if err != nil {
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+	} else {
+		setPaginationHeaders(c.Ctx, total, offset, limit)
+{{if .MaskedColumns}}		for i := range l {
+			l[i] = l[i].Masked()
+		}
+{{end}}		c.Data["json"] = l
+	}
+	c.ServeJSON()
+}
+{{if .ReadModel}}
+// GetView ...
+// @Title Get View
+// @Description get {{ctrlName}} by id with the records referencing it
+// @Param	id		path 	string	true		"The key of the {{ctrlName}}"
+// @Success 200 {object} models.{{ctrlName}}View
+// @Failure 403 :id is empty
+// @Failure 404 :id doesn't exist
+// @router /:id/view [get]
+func (c *{{ctrlName}}Controller) GetView() {
+	idStr := c.Ctx.Input.Param(":id")
+{{template "parseId" .}}{{if wrapCalls}}	var v *models.{{ctrlName}}View
+	if err := models.Call("{{.Name}}", func() (err error) {
+		v, err = models.Get{{ctrlName}}View(id)
+		return
+	}); err != nil {
+{{else}}	v, err := models.Get{{ctrlName}}View(id)
 	if err != nil {
-		c.Data["json"] = err.Error()
+{{end}}		if models.IsNotFound(err) {
+			c.Ctx.Output.SetStatus(404)
+		}
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
 	} else {
-		c.Data["json"] = l
+		c.Data["json"] = v{{if .ViewMasked}}.Masked(){{end}}
 	}
 	c.ServeJSON()
 }
 
+// GetViews ...
+// @Title Get Views
+// @Description get {{ctrlName}}s with the records referencing them
+// @Param	limit	query	string	false	"Limit the size of result set. Must be an integer"
+// @Param	offset	query	string	false	"Start position of result set. Must be an integer"
+// @Success 200 {object} models.{{ctrlName}}View
+// @Failure 403
+// @router /views [get]
+func (c *{{ctrlName}}Controller) GetViews() {
+	var limit int64 = models.DefaultPageSize
+	var offset int64
+	if v, err := c.GetInt64("limit"); err == nil {
+		limit = v
+	}
+	limit = models.PageLimit(limit)
+	if v, err := c.GetInt64("offset"); err == nil && v > 0 {
+		offset = v
+	}
+{{if wrapCalls}}	var l []*models.{{ctrlName}}View
+	err := models.Call("{{.Name}}", func() (err error) {
+		l, err = models.Search{{ctrlName}}Views(uint64(offset), uint64(limit))
+		return
+	})
+{{else}}	l, err := models.Search{{ctrlName}}Views(uint64(offset), uint64(limit))
+{{end}}	if err != nil {
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+	} else {
+{{if .ViewMasked}}		for i := range l {
+			l[i] = l[i].Masked()
+		}
+{{end}}		c.Data["json"] = l
+	}
+	c.ServeJSON()
+}
+{{end}}{{end}}{{if .Allows "put"}}
 // Put ...
 // @Title Put
 // @Description update the {{ctrlName}}
@@ -1364,43 +2898,190 @@ func (c *{{ctrlName}}Controller) GetAll() {
 // @Param	body		body 	models.{{ctrlName}}	true		"body for {{ctrlName}} content"
 // @Success 200 {object} models.{{ctrlName}}
 // @Failure 403 :id is not int
+// @Failure 409 a unique column is already taken
 // @router /:id [put]
 func (c *{{ctrlName}}Controller) Put() {
 	idStr := c.Ctx.Input.Param(":id")
-	id, _ := strconv.Atoi(idStr)
-	v := models.{{ctrlName}}{Id: id}
+{{template "parseId" .}}	v := models.{{ctrlName}}{{{pkField}}: id}
 	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &v); err == nil {
-		if err := models.Update{{ctrlName}}ById(&v); err == nil {
+		if err := {{if wrapCalls}}models.CallWrite("{{.Name}}", func() error { return models.Update{{ctrlName}}ById({{template "db" .}}, &v) }){{else}}models.Update{{ctrlName}}ById({{template "db" .}}, &v){{end}}; err == nil {
 			c.Data["json"] = "OK"
 		} else {
-			c.Data["json"] = err.Error()
+			if models.IsDuplicateKey(err) {
+				c.Ctx.Output.SetStatus(409)
+			} else if models.IsForeignKeyViolation(err) || models.IsCheckViolation(err) {
+				c.Ctx.Output.SetStatus(400)
+			}
+			c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
 		}
 	} else {
-		c.Data["json"] = err.Error()
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
 	}
 	c.ServeJSON()
 }
-
+{{end}}{{if .Allows "delete"}}
 // Delete ...
 // @Title Delete
 // @Description delete the {{ctrlName}}
 // @Param	id		path 	string	true		"The id you want to delete"
 // @Success 200 {string} delete success!
 // @Failure 403 id is empty
+// @Failure 404 id doesn't exist
+// @Failure 409 id is still referenced
 // @router /:id [delete]
 func (c *{{ctrlName}}Controller) Delete() {
 	idStr := c.Ctx.Input.Param(":id")
-	id, _ := strconv.Atoi(idStr)
-	if err := models.Delete{{ctrlName}}(id); err == nil {
+{{template "parseId" .}}	if err := {{if wrapCalls}}models.CallWrite("{{.Name}}", func() error { return models.Delete{{ctrlName}}({{template "db" .}}, id) }){{else}}models.Delete{{ctrlName}}({{template "db" .}}, id){{end}}; err == nil {
 		c.Data["json"] = "OK"
 	} else {
-		c.Data["json"] = err.Error()
+		if models.IsNotFound(err) {
+			c.Ctx.Output.SetStatus(404)
+		} else if models.IsForeignKeyViolation(err) {
+			// the record is still referenced
+			c.Ctx.Output.SetStatus(409)
+		}
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
 	}
 	c.ServeJSON()
 }
-`
-	RouterTPL = `// @APIVersion 1.0.0
-// @Title beego Test API
+{{end}}{{if .Recyclable}}
+// {{ctrlName}}RecycleController serves the deleted {{ctrlName}}s
+type {{ctrlName}}RecycleController struct {
+	beego.Controller
+}
+
+// URLMapping ...
+func (c *{{ctrlName}}RecycleController) URLMapping() {
+	c.Mapping("GetAll", c.GetAll)
+	c.Mapping("Restore", c.Restore)
+}
+
+// Prepare restricts the recycle bin to the requests allowed by RecycleAllowed
+func (c *{{ctrlName}}RecycleController) Prepare() {
+	checkRecycleAllowed(&c.Controller)
+}
+
+// GetAll ...
+// @Title Get All Deleted
+// @Description get the deleted {{ctrlName}}s
+// @Param	limit	query	string	false	"Limit the size of result set. Must be an integer"
+// @Param	offset	query	string	false	"Start position of result set. Must be an integer"
+// @Success 200 {object} models.{{ctrlName}}
+// @Failure 403 the request isn't allowed by RecycleAllowed
+// @router / [get]
+func (c *{{ctrlName}}RecycleController) GetAll() {
+	var limit int64 = models.DefaultPageSize
+	var offset int64
+	if v, err := c.GetInt64("limit"); err == nil {
+		limit = v
+	}
+	limit = models.PageLimit(limit)
+	if v, err := c.GetInt64("offset"); err == nil && v > 0 {
+		offset = v
+	}
+	total, err := models.CountDeleted{{ctrlName}}s({{template "db" .}})
+	if err != nil {
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+		c.ServeJSON()
+		return
+	}
+	if l, err := models.SearchDeleted{{ctrlName}}s({{template "db" .}}, uint64(offset), uint64(limit)); err != nil {
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+	} else {
+		setPaginationHeaders(c.Ctx, total, offset, limit)
+{{if .MaskedColumns}}		for i := range l {
+			l[i] = l[i].Masked()
+		}
+{{end}}		c.Data["json"] = l
+	}
+	c.ServeJSON()
+}
+
+// Restore ...
+// @Title Restore
+// @Description restore the deleted {{ctrlName}}
+// @Param	id		path 	string	true		"The id you want to restore"
+// @Success 200 {string} restore success!
+// @Failure 403 id is empty, or the request isn't allowed by RecycleAllowed
+// @Failure 404 id isn't deleted
+// @Failure 409 a record took its unique values
+// @router /:id/restore [post]
+func (c *{{ctrlName}}RecycleController) Restore() {
+	idStr := c.Ctx.Input.Param(":id")
+{{template "parseId" .}}	if err := models.Restore{{ctrlName}}({{template "db" .}}, id); err == nil {
+		c.Data["json"] = "OK"
+	} else {
+		if models.IsNotFound(err) {
+			c.Ctx.Output.SetStatus(404)
+		} else if models.IsDuplicateKey(err) {
+			// a record took the unique values of the deleted one meanwhile
+			c.Ctx.Output.SetStatus(409)
+		}
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+	}
+	c.ServeJSON()
+}
+{{end}}{{define "db"}}{{if .TenantColumn}}tenantDB(c.Ctx){{else}}nil{{end}}{{end}}{{define "parseId"}}{{if eq .PkType "string"}}	id := idStr
+{{else}}	pk, err := strconv.Parse{{if hasPrefix .PkType "uint"}}Uint{{else}}Int{{end}}(idStr, 10, 64)
+	if err != nil {
+		c.Data["json"] = {{if i18n}}errorMessage(c.Ctx, err){{else}}err.Error(){{end}}
+		c.ServeJSON()
+		return
+	}
+	id := {{.PkType}}(pk)
+{{end}}{{end}}`
+	PaginationTPL = `package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/astaxie/beego/context"
+)
+
+// setPaginationHeaders exposes the total number of records as X-Total-Count, the applied
+// offset and limit as X-Offset and X-Limit, and links to the first, previous, next and
+// last pages as an RFC 5988 Link header
+func setPaginationHeaders(ctx *context.Context, total, offset, limit int64) {
+	ctx.Output.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	ctx.Output.Header("X-Offset", strconv.FormatInt(offset, 10))
+	ctx.Output.Header("X-Limit", strconv.FormatInt(limit, 10))
+	ctx.Output.Header("Access-Control-Expose-Headers", "X-Total-Count, X-Offset, X-Limit, Link")
+	if limit <= 0 {
+		return
+	}
+
+	page := func(offset int64, rel string) string {
+		u := *ctx.Request.URL
+		q := u.Query()
+		q.Set("offset", strconv.FormatInt(offset, 10))
+		q.Set("limit", strconv.FormatInt(limit, 10))
+		u.RawQuery = q.Encode()
+		return fmt.Sprintf("<%s>; rel=\"%s\"", (&url.URL{Path: u.Path, RawQuery: u.RawQuery}).String(), rel)
+	}
+	last := int64(0)
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+	links := []string{page(0, "first")}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, page(prev, "prev"))
+	}
+	if offset+limit < total {
+		links = append(links, page(offset+limit, "next"))
+	}
+	links = append(links, page(last, "last"))
+	ctx.Output.Header("Link", strings.Join(links, ", "))
+}
+`
+	RouterTPL = `// @APIVersion 1.0.0
+// @Title beego Test API
 // @Description beego has a very cool tools to autogenerate documents for your API
 // @Contact astaxie@gmail.com
 // @TermsOfServiceUrl http://beego.me/
@@ -1409,44 +3090,400 @@ func (c *{{ctrlName}}Controller) Delete() {
 package routers
 
 import (
-	"{{pkgPath}}/controllers"
-
 	"github.com/astaxie/beego"
 )
 
 func init() {
-	ns := beego.NewNamespace("/v1",
-		{{nameSpaces}}
-	)
+	// routes of the generated controllers, see routes_registry.go
+	ns := beego.NewNamespace("{{versionPrefix}}", generatedNamespaces()...)
 	beego.AddNamespace(ns)
+
+	// add your own routes here, this file is never overwritten by generate appcode
 }
 `
-	NamespaceTPL = `
-		beego.NSNamespace("/{{nameSpace}}",
-			beego.NSInclude(
-				&controllers.{{ctrlName}}Controller{},
-			),
-		),
+
+	RegistryTPL = `package models
+
+// ColumnMeta describes a column of a generated model
+type ColumnMeta struct {
+	Name    string // column name in the database
+	Field   string // field name in the model struct
+	Type    string // Go type of the field
+	Pk        bool
+	Null      bool
+	Immutable bool // never updated once the row is created
+	Comment   string
+}
+
+// ModelMeta describes a generated model and the table behind it
+type ModelMeta struct {
+	Table      string
+	Model      string
+	Pk         string // empty if the table has no single column primary key
+	Columns    []ColumnMeta
+	SoftDelete bool // whether rows are deleted by setting is_deleted
+	ReadOnly   bool
+}
+
+// registry lists the models in foreign key order, see TablesInFKOrder
+var registry = []ModelMeta{
+{{range .}}	{
+		Table:      "{{.Name}}",
+		Model:      "{{.Name | camelCase}}",
+		Pk:         "{{.Pk}}",
+		SoftDelete: {{.IdDelete}},
+		ReadOnly:   {{.ReadOnly}},
+		Columns: []ColumnMeta{
+{{$pk := .Pk}}{{range .Columns}}			{Name: "{{.Tag.Column}}", Field: "{{.Name}}", Type: "{{.Type}}", Pk: {{eq .Tag.Column $pk}}, Null: {{.Tag.Null}}, Immutable: {{.Immutable}}, Comment: {{printf "%q" .Tag.Comment}}},
+{{end}}		},
+	},
+{{end}}}
+
+// Registry returns the metadata of every generated model, so that generic
+// tooling can iterate over the schema without reflection
+func Registry() []ModelMeta {
+	return registry
+}
+
+// TablesInFKOrder returns the tables of the generated models sorted by their
+// foreign keys, a table coming after the tables it references: fixtures are
+// loaded in this order and tables are truncated in the reverse order
+func TablesInFKOrder() []string {
+	tables := make([]string, len(registry))
+	for i, m := range registry {
+		tables[i] = m.Table
+	}
+	return tables
+}
+
+// LookupModel returns the metadata of the model generated for table
+func LookupModel(table string) (ModelMeta, bool) {
+	for _, m := range registry {
+		if m.Table == table {
+			return m, true
+		}
+	}
+	return ModelMeta{}, false
+}
 `
 
+	ModelsInitTPL = `package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// This file is generated once and never overwritten by "hee generate appcode",
+// it holds the initialization of the models which is up to the application.
+
+func init() {
+	openHooks = append(openHooks, func(db *gorm.DB) error {
+		{{if gormV2}}// e.g. sqlDB, err := db.DB(), then sqlDB.SetMaxOpenConns(100){{else}}// e.g. db.DB().SetMaxOpenConns(100){{end}}
+		return nil
+	})
+}
+`
 	ModelsTPL = `package models
 
 import (
+{{if gormV2}}	"context"
+{{end}}{{if or .Pgx (eq .Dialect "oracle") gormV2}}	"database/sql"
+{{end}}	"encoding/json"
 	"errors"
-	"strings"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+{{if .Pgx}}	"strconv"
+{{end}}	"strings"
 	"sync"
+	"time"
 
+	{{if eq .Dialect "mysql"}}"github.com/go-sql-driver/mysql"{{else if eq .Dialect "sqlite"}}"github.com/mattn/go-sqlite3"{{else if eq .Dialect "mssql"}}"github.com/denisenkom/go-mssqldb"{{else if eq .Dialect "oracle"}}"github.com/sijms/go-ora/v2/network"{{else if eq .Dialect "clickhouse"}}"github.com/ClickHouse/clickhouse-go/v2"{{else if .Pgx}}"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"{{else}}"github.com/lib/pq"{{end}}
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/{{.Dialect}}"
+{{if gormV2}}{{if eq .Dialect "mysql"}}	gormmysql "gorm.io/driver/mysql"
+{{else}}	"gorm.io/driver/postgres"
+{{end}}	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+{{else if not (or .Pgx (eq .Dialect "oracle") (eq .Dialect "clickhouse"))}}	_ "github.com/jinzhu/gorm/dialects/{{.Dialect}}"
+{{end}})
+
+// ErrNotFound is returned when the requested record doesn't exist, it wraps gorm.ErrRecordNotFound
+var ErrNotFound = fmt.Errorf("models: %w", gorm.ErrRecordNotFound)
+
+// IsNotFound reports whether err means that the requested record doesn't exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound){{if not gormV2}} || gorm.IsRecordNotFoundError(err){{end}}
+}
+
+// Kinds of constraint violations, see ConstraintError
+var (
+	ErrDuplicateKey = errors.New("models: duplicate key")
+	ErrForeignKey   = errors.New("models: foreign key violation")
+	ErrCheck        = errors.New("models: check constraint violation")
+)
+
+// ConstraintError is the violation of a constraint of the database, errors.Is
+// matching its Kind
+type ConstraintError struct {
+	Kind       error  // ErrDuplicateKey, ErrForeignKey or ErrCheck
+	Constraint string // name of the violated constraint, empty when the database doesn't report it
+	Err        error  // error of the driver
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// ConstraintViolation returns the constraint violated by err, or nil when err
+// isn't a constraint violation
+func ConstraintViolation(err error) *ConstraintError {
+{{if eq .Dialect "mysql"}}	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return nil
+	}
+	switch myErr.Number {
+	case 1062:
+		// Duplicate entry '<value>' for key '<key>', the key being prefixed by
+		// the table name from MySQL 8.0
+		key := quotedAfter(myErr.Message, "for key '", "'")
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: key[strings.LastIndex(key, ".")+1:], Err: err}
+	case 1451, 1452:
+		// Cannot delete or update a parent row: a foreign key constraint fails
+		// (<table>, CONSTRAINT <name> FOREIGN KEY ...), 1452 for a child row
+		return &ConstraintError{Kind: ErrForeignKey, Constraint: quotedAfter(myErr.Message, "CONSTRAINT ` + "`" + `", "` + "`" + `"), Err: err}
+	case 3819:
+		// Check constraint '<name>' is violated.
+		return &ConstraintError{Kind: ErrCheck, Constraint: quotedAfter(myErr.Message, "Check constraint '", "'"), Err: err}
+	}
+	return nil
+}
+{{else if eq .Dialect "mssql"}}	var msErr mssql.Error
+	if !errors.As(err, &msErr) {
+		return nil
+	}
+	switch msErr.Number {
+	case 2627:
+		// Violation of UNIQUE KEY constraint '<name>'. Cannot insert duplicate key ...,
+		// or of PRIMARY KEY constraint
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: quotedAfter(msErr.Message, "constraint '", "'"), Err: err}
+	case 2601:
+		// Cannot insert duplicate key row in object '<table>' with unique index '<name>'
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: quotedAfter(msErr.Message, "unique index '", "'"), Err: err}
+	case 547:
+		// The INSERT statement conflicted with the FOREIGN KEY constraint "<name>", or
+		// with the CHECK constraint
+		kind := ErrForeignKey
+		if strings.Contains(msErr.Message, "CHECK constraint") {
+			kind = ErrCheck
+		}
+		return &ConstraintError{Kind: kind, Constraint: quotedAfter(msErr.Message, "constraint \"", "\""), Err: err}
+	}
+	return nil
+}
+{{else if eq .Dialect "oracle"}}	var oraErr *network.OracleError
+	if !errors.As(err, &oraErr) {
+		return nil
+	}
+	// the messages name the violated constraint as (<schema>.<name>)
+	constraint := quotedAfter(oraErr.ErrMsg, "(", ")")
+	constraint = strings.ToLower(constraint[strings.LastIndex(constraint, ".")+1:])
+	switch oraErr.ErrCode {
+	case 1:
+		// ORA-00001: unique constraint (<schema>.<name>) violated
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: constraint, Err: err}
+	case 2291, 2292:
+		// ORA-02291: integrity constraint (<schema>.<name>) violated - parent key not found,
+		// ORA-02292 - child record found
+		return &ConstraintError{Kind: ErrForeignKey, Constraint: constraint, Err: err}
+	case 2290:
+		// ORA-02290: check constraint (<schema>.<name>) violated
+		return &ConstraintError{Kind: ErrCheck, Constraint: constraint, Err: err}
+	}
+	return nil
+}
+{{else if eq .Dialect "clickhouse"}}	var chErr *clickhouse.Exception
+	if !errors.As(err, &chErr) {
+		return nil
+	}
+	// ClickHouse only has check constraints, code 469 (VIOLATED_CONSTRAINT):
+	// Constraint ` + "`" + `<name>` + "`" + ` for table ... is violated
+	if chErr.Code == 469 {
+		return &ConstraintError{Kind: ErrCheck, Constraint: quotedAfter(chErr.Message, "Constraint ` + "`" + `", "` + "`" + `"), Err: err}
+	}
+	return nil
+}
+{{else if eq .Dialect "sqlite"}}	var liteErr sqlite3.Error
+	if !errors.As(err, &liteErr) {
+		return nil
+	}
+	// the message names the columns of the violated constraint, e.g.
+	// UNIQUE constraint failed: users.email, or the name of a check constraint
+	var constraint string
+	if msg := liteErr.Error(); strings.Contains(msg, "failed: ") {
+		constraint = msg[strings.Index(msg, "failed: ")+len("failed: "):]
+	}
+	switch liteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: constraint, Err: err}
+	case sqlite3.ErrConstraintForeignKey:
+		return &ConstraintError{Kind: ErrForeignKey, Err: err}
+	case sqlite3.ErrConstraintCheck:
+		return &ConstraintError{Kind: ErrCheck, Constraint: constraint, Err: err}
+	}
+	return nil
+}
+{{else if .Pgx}}	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+	switch pgErr.Code {
+	case "23505": // unique_violation
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: pgErr.ConstraintName, Err: err}
+	case "23503": // foreign_key_violation
+		return &ConstraintError{Kind: ErrForeignKey, Constraint: pgErr.ConstraintName, Err: err}
+	case "23514": // check_violation
+		return &ConstraintError{Kind: ErrCheck, Constraint: pgErr.ConstraintName, Err: err}
+	}
+	return nil
+}
+{{else}}	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+	switch pqErr.Code {
+	case "23505": // unique_violation
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: pqErr.Constraint, Err: err}
+	case "23503": // foreign_key_violation
+		return &ConstraintError{Kind: ErrForeignKey, Constraint: pqErr.Constraint, Err: err}
+	case "23514": // check_violation
+		return &ConstraintError{Kind: ErrCheck, Constraint: pqErr.Constraint, Err: err}
+	}
+	return nil
+}
+{{end}}{{if or (eq .Dialect "mysql") (eq .Dialect "mssql") (eq .Dialect "oracle") (eq .Dialect "clickhouse")}}
+// quotedAfter returns the text of msg between prefix and the next quote
+func quotedAfter(msg, prefix, quote string) string {
+	i := strings.LastIndex(msg, prefix)
+	if i < 0 {
+		return ""
+	}
+	msg = msg[i+len(prefix):]
+	if j := strings.Index(msg, quote); j >= 0 {
+		msg = msg[:j]
+	}
+	return msg
+}
+{{end}}
+// violates reports whether err is a constraint violation of the kind
+func violates(err, kind error) bool {
+	v := ConstraintViolation(err)
+	return v != nil && v.Kind == kind
+}
+
+// IsDuplicateKey reports whether err is the violation of a unique constraint,
+// see DuplicateKeyConstraint for the name of the constraint
+func IsDuplicateKey(err error) bool {
+	return violates(err, ErrDuplicateKey)
+}
+
+// DuplicateKeyConstraint returns the name of the unique constraint violated by err,
+// or an empty string when err isn't a duplicate key error
+func DuplicateKeyConstraint(err error) string {
+	if v := ConstraintViolation(err); v != nil && v.Kind == ErrDuplicateKey {
+		return v.Constraint
+	}
+	return ""
+}
+
+// IsForeignKeyViolation reports whether err is the violation of a foreign key: the
+// referenced record is missing, or the deleted record is still referenced
+func IsForeignKeyViolation(err error) bool {
+	return violates(err, ErrForeignKey)
+}
+
+// IsCheckViolation reports whether err is the violation of a check constraint
+func IsCheckViolation(err error) bool {
+	return violates(err, ErrCheck)
+}
+
+// Change is the old and new values of a column, see the Diff functions of the models
+type Change struct {
+	Old interface{} ` + "`" + `json:"old"` + "`" + `
+	New interface{} ` + "`" + `json:"new"` + "`" + `
+}
+
+// valuesDiffer reports whether two values of a column differ, pointers being compared
+// by the values they point to and times as instants
+func valuesDiffer(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Ptr {
+		if va.IsNil() || vb.IsNil() {
+			return va.IsNil() != vb.IsNil()
+		}
+		va, vb = va.Elem(), vb.Elem()
+	}
+	// time.Time and the types embedding it
+	if ta, ok := va.Interface().(interface{ UTC() time.Time }); ok {
+		return !ta.UTC().Equal(vb.Interface().(interface{ UTC() time.Time }).UTC())
+	}
+	return !reflect.DeepEqual(va.Interface(), vb.Interface())
+}
+
+// notFound replaces the record not found error of gorm with ErrNotFound
+func notFound(err error) error {
+	if IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+const (
+	// DefaultPageSize is the number of records listed when no limit is requested
+	DefaultPageSize = {{.DefaultLimit}}
+	// MaxPageSize caps the number of records of a page requested by a client, 0 for no cap
+	MaxPageSize = {{.MaxLimit}}
 )
 
+// PageLimit applies MaxPageSize to the limit requested by a client, 0 standing for no limit.
+// The model functions list all the records when given no limit.
+func PageLimit(limit int64) int64 {
+	if MaxPageSize > 0 && (limit <= 0 || limit > MaxPageSize) {
+		return MaxPageSize
+	}
+	return limit
+}
+
 var once sync.Once // protects the following db to be initialized once
 var db *gorm.DB
 
+// openHooks run once the database is opened, they are registered in models_init.go
+var openHooks []func(db *gorm.DB) error
+{{if eq .Dialect "clickhouse"}}
+func init() {
+	// gorm has no ClickHouse dialect, the SQL of its common one is understood by ClickHouse
+	common, _ := gorm.GetDialect("common")
+	gorm.RegisterDialect("clickhouse", common)
+}
+{{end}}
 func Open(dialect, connStr string, logDetail bool) (err error) {
 	if db != nil {
 		return errors.New("db already opened")
 	}
+	logConfig := DefaultLogConfig
+	if logDetail {
+		logConfig.Level = "info"
+	}
 
 	once.Do(func() {
 		{{if eq .Dialect "mysql"}}// 对MySQL的特殊处理
@@ -1461,22 +3498,328 @@ func Open(dialect, connStr string, logDetail bool) (err error) {
 		}
 		if !strings.Contains(connStr, "charset") {
 			connStr += "&charset=utf8mb4"
+		}{{else if eq .Dialect "sqlite"}}// SQLite only checks the foreign keys when told so, per connection
+		if !strings.Contains(connStr, "_foreign_keys") && !strings.Contains(connStr, "_fk") {
+			if strings.Contains(connStr, "?") {
+				connStr += "&_foreign_keys=on"
+			} else {
+				connStr += "?_foreign_keys=on"
+			}
 		}{{end}}
-		db, err = gorm.Open("{{.Dialect}}", connStr)
+		{{if gormV2}}config := &gorm.Config{
+			PrepareStmt:            {{.PrepareStmt}},
+			SkipDefaultTransaction: {{.SkipDefaultTransaction}},
+			Logger:                 newQueryLogger(logConfig),
+		}
+		{{if .Pgx}}var sqlDB *sql.DB
+		if sqlDB, err = openPgx(connStr); err == nil {
+			db, err = gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), config)
+		}{{else if eq .Dialect "mysql"}}db, err = gorm.Open(gormmysql.Open(connStr), config){{else}}db, err = gorm.Open(postgres.New(postgres.Config{DriverName: "postgres", DSN: connStr}), config){{end}}{{else if .Pgx}}var sqlDB *sql.DB
+		if sqlDB, err = openPgx(connStr); err == nil {
+			db, err = gorm.Open("postgres", sqlDB)
+		}{{else if eq .Dialect "oracle"}}var sqlDB *sql.DB
+		if sqlDB, err = openOracle(connStr); err == nil {
+			db, err = gorm.Open("oracle", sqlDB)
+		}{{else if eq .Dialect "sqlite"}}db, err = gorm.Open("sqlite3", connStr){{else}}db, err = gorm.Open("{{.Dialect}}", connStr){{end}}
 	})
-    db.LogMode(logDetail)
+	if err != nil {
+		return
+	}
+{{if not gormV2}}	SetLogger(logConfig)
+{{end}}	for _, hook := range openHooks {
+		if err = hook(db); err != nil {
+			return
+		}
+	}
 	return
 }
 
-func DB() *gorm.DB {
+{{if .Pgx}}// openPgx opens connStr with the pgx driver. The pool of the connections is set by
+// the pool_max_conns, pool_min_conns, pool_max_conn_lifetime and pool_max_conn_idle_time
+// parameters of connStr, named after those of pgxpool.
+func openPgx(connStr string) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	// pgx sends the parameters it doesn't know to the server, the pool ones are taken out
+	pool := make(map[string]string)
+	for name, value := range config.RuntimeParams {
+		if strings.HasPrefix(name, "pool_") {
+			pool[name] = value
+			delete(config.RuntimeParams, name)
+		}
+	}
+	sqlDB := stdlib.OpenDB(*config)
+	for name, value := range pool {
+		switch name {
+		case "pool_max_conns", "pool_min_conns":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				sqlDB.Close()
+				return nil, fmt.Errorf("invalid %s '%s'", name, value)
+			}
+			if name == "pool_max_conns" {
+				sqlDB.SetMaxOpenConns(n)
+			} else {
+				sqlDB.SetMaxIdleConns(n)
+			}
+		case "pool_max_conn_lifetime", "pool_max_conn_idle_time":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				sqlDB.Close()
+				return nil, fmt.Errorf("invalid %s '%s'", name, value)
+			}
+			if name == "pool_max_conn_lifetime" {
+				sqlDB.SetConnMaxLifetime(d)
+			} else {
+				sqlDB.SetConnMaxIdleTime(d)
+			}
+		default:
+			sqlDB.Close()
+			return nil, fmt.Errorf("unknown pool parameter '%s'", name)
+		}
+	}
+	return sqlDB, nil
+}
+
+{{end}}func DB() *gorm.DB {
 	if db == nil {
 		return nil
 	}
 
-	return db.New()
+	{{if gormV2}}return db.Session(&gorm.Session{NewDB: true}){{else}}return db.New(){{end}}
+}
+{{if gormV2}}
+// WithContext returns DB() bound to ctx, which cancels its queries and reaches the logger
+func WithContext(ctx context.Context) *gorm.DB {
+	if db == nil {
+		return nil
+	}
+	return DB().WithContext(ctx)
+}
+{{end}}
+// dialectName returns the name of the dialect of db, e.g. postgres
+func dialectName(db *gorm.DB) string {
+	{{if gormV2}}return db.Dialector.Name(){{else}}return db.Dialect().GetName(){{end}}
+}
+
+// unscopedSetting is the gorm setting disabling the default scopes of the tables
+const unscopedSetting = "models:unscoped"
+
+// Unscoped returns tx, or DB() when nil, whose queries ignore the default scopes of the
+// tables, e.g. GetOrdersById(Unscoped(nil), id). Unlike the Unscoped method of gorm, it
+// keeps the soft deleted records out.
+func Unscoped(tx *gorm.DB) *gorm.DB {
+	if tx == nil {
+		tx = DB()
+	}
+	return tx.Set(unscopedSetting, true)
+}
+
+// scopeDefault restricts db to the rows matching cond, the default scope of a table,
+// unless db is Unscoped
+func scopeDefault(db *gorm.DB, cond string) *gorm.DB {
+	if unscoped, ok := db.Get(unscopedSetting); ok && unscoped == true {
+		return db
+	}
+	return db.Where(cond)
+}
+
+// LogConfig describes how the SQL statements and the errors of gorm are logged
+type LogConfig struct {
+	// Level is either silent, error, warn or info: errors are logged from the error level,
+	// slow queries from the warn level and every query at the info level
+	Level string
+	// SlowThreshold is the duration from which a query is slow, 0 disables it
+	SlowThreshold time.Duration
+	// JSON writes one JSON object per line instead of the text format of gorm
+	JSON bool
+	// Output defaults to os.Stdout
+	Output io.Writer
+	// SlowLog also records the queries from SlowThreshold whatever the Level, e.g. a
+	// RotatingFile or a SlowQueryFunc
+	SlowLog SlowQueryLogger
+}
+
+// DefaultLogConfig is the logging set up by Open
+var DefaultLogConfig = LogConfig{Level: "{{.LogLevel}}", SlowThreshold: {{.SlowThresholdMs}} * time.Millisecond, JSON: {{.LogJSON}}{{if .SlowLogFile}},
+	SlowLog: NewRotatingFile({{printf "%q" .SlowLogFile}}, {{.SlowLogMaxSizeMB}}<<20, {{.SlowLogMaxBackups}})}{{else}}}{{end}}
+
+var logLevels = map[string]int{"silent": 0, "error": 1, "warn": 2, "info": 3}
+
+// SetLogger replaces the logging of the opened database
+func SetLogger(c LogConfig) {
+	if db == nil {
+		return
+	}
+{{if gormV2}}	db.Logger = newQueryLogger(c)
+{{else}}	if c.Output == nil {
+		c.Output = os.Stdout
+	}
+	db.SetLogger(&queryLogger{LogConfig: c, level: logLevels[c.Level]})
+	// gorm only reports the queries in detailed mode, queryLogger filters them
+	db.LogMode(logLevels[c.Level] > 0 || c.SlowLog != nil)
+{{end}}}
+
+{{if gormV2}}// queryLogger implements the logger of gorm
+type queryLogger struct {
+	LogConfig
+	level int
 }
 
-func Close() (err error) {
+// newQueryLogger returns the logger of gorm logging as c tells
+func newQueryLogger(c LogConfig) *queryLogger {
+	if c.Output == nil {
+		c.Output = os.Stdout
+	}
+	return &queryLogger{LogConfig: c, level: logLevels[c.Level]}
+}
+
+// LogMode returns a copy of l logging from level, the levels of gorm starting at 1 for silent
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	c := *l
+	c.level = int(level) - 1
+	return &c
+}
+
+func (l *queryLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.print("info", msg, args...)
+}
+
+func (l *queryLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.print("warn", msg, args...)
+}
+
+func (l *queryLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.print("error", msg, args...)
+}
+
+func (l *queryLogger) print(level, msg string, args ...interface{}) {
+	if l.level < logLevels[level] {
+		return
+	}
+	if !l.JSON {
+		fmt.Fprintln(l.Output, "["+level+"]", utils.FileWithLineNum(), fmt.Sprintf(msg, args...))
+		return
+	}
+	l.write(map[string]interface{}{
+		"time":    time.Now().Format(time.RFC3339Nano),
+		"level":   level,
+		"source":  utils.FileWithLineNum(),
+		"message": fmt.Sprintf(msg, args...),
+	})
+}
+
+// Trace logs a query: at the error level when it fails, at the warn level when it is slow
+// and at the info level otherwise
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	duration := time.Since(begin)
+	slow := l.SlowThreshold > 0 && duration >= l.SlowThreshold
+	level := "info"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level = "error"
+	case slow:
+		level = "warn"
+	}
+	logged := l.level >= logLevels[level]
+	if !logged && !(slow && l.SlowLog != nil) {
+		return
+	}
+	query, rows := fc()
+	if slow {
+		l.logSlow(SlowQuery{Time: time.Now(), Caller: queryCaller(utils.FileWithLineNum()), Duration: duration, SQL: query, Rows: rows})
+	}
+	if !logged {
+		return
+	}
+	if !l.JSON {
+		line := fmt.Sprintf("[%s] %s [%.2fms] [rows:%d] %s", level, utils.FileWithLineNum(), float64(duration)/float64(time.Millisecond), rows, query)
+		if level == "error" {
+			line += " " + err.Error()
+		}
+		fmt.Fprintln(l.Output, line)
+		return
+	}
+	entry := map[string]interface{}{
+		"time":        time.Now().Format(time.RFC3339Nano),
+		"level":       level,
+		"source":      utils.FileWithLineNum(),
+		"duration_ms": float64(duration) / float64(time.Millisecond),
+		"sql":         query,
+		"rows":        rows,
+		"slow":        level == "warn",
+	}
+	if level == "error" {
+		entry["error"] = err.Error()
+	}
+	l.write(entry)
+}
+
+func (l *queryLogger) write(entry map[string]interface{}) {
+	if data, err := json.Marshal(entry); err == nil {
+		fmt.Fprintln(l.Output, string(data))
+	}
+}
+
+{{else}}// queryLogger implements the logger of gorm
+type queryLogger struct {
+	LogConfig
+	level int
+}
+
+func (l *queryLogger) Print(values ...interface{}) {
+	if len(values) < 2 {
+		return
+	}
+	level := "error"
+	var duration time.Duration
+	if values[0] == "sql" && len(values) >= 6 {
+		duration, _ = values[2].(time.Duration)
+		slow := l.SlowThreshold > 0 && duration >= l.SlowThreshold
+		if slow {
+			query, _ := values[3].(string)
+			vars, _ := values[4].([]interface{})
+			rows, _ := values[5].(int64)
+			l.logSlow(SlowQuery{Time: time.Now(), Caller: queryCaller(fmt.Sprint(values[1])), Duration: duration, SQL: query, Vars: vars, Rows: rows})
+		}
+		switch {
+		case slow && l.level >= logLevels["warn"]:
+			level = "warn"
+		case l.level >= logLevels["info"]:
+			level = "info"
+		default:
+			return
+		}
+	} else if l.level < logLevels["error"] {
+		return
+	}
+
+	if !l.JSON {
+		fmt.Fprintln(l.Output, append([]interface{}{"[" + level + "]"}, gorm.LogFormatter(values...)...)...)
+		return
+	}
+	entry := map[string]interface{}{
+		"time":   time.Now().Format(time.RFC3339Nano),
+		"level":  level,
+		"source": values[1],
+	}
+	if values[0] == "sql" && len(values) >= 6 {
+		entry["duration_ms"] = float64(duration) / float64(time.Millisecond)
+		entry["sql"] = values[3]
+		entry["vars"] = values[4]
+		entry["rows"] = values[5]
+		entry["slow"] = level == "warn"
+	} else {
+		entry["message"] = fmt.Sprint(values[2:]...)
+	}
+	if data, err := json.Marshal(entry); err == nil {
+		fmt.Fprintln(l.Output, string(data))
+	}
+}
+
+{{end}}func Close() (err error) {
 	if db != nil {
 		defer func() {
 			if err == nil {
@@ -1484,11 +3827,92 @@ func Close() (err error) {
 				db = nil
 			}
 		}()
-		return db.Close()
+		{{if gormV2}}var sqlDB *sql.DB
+		if sqlDB, err = db.DB(); err != nil {
+			return
+		}
+		return sqlDB.Close(){{else}}return db.Close(){{end}}
 	}
 
 	// omit if db is not in open
 	return nil
 }
+
+// ParamError is an invalid parameter of a list request, its Key and Args identifying
+// the message which the generated controllers and handlers localize
+type ParamError struct {
+	Key  string // e.g. invalid_order
+	Args []interface{}
+}
+
+// paramMessages holds the messages of the ParamErrors by key
+var paramMessages = map[string]string{
+	"invalid_page":      "invalid offset %d or limit %d",
+	"invalid_query_key": "invalid query key %s",
+	"unknown_column":    "unknown column '%s' of %s",
+	"unused_order":      "unused 'order' fields",
+	"order_mismatch":    "'sortby', 'order' sizes mismatch or 'order' size is not 1",
+	"invalid_order":     "invalid order, must be either asc or desc",
+}
+
+func (e *ParamError) Error() string {
+	return "Error: " + fmt.Sprintf(paramMessages[e.Key], e.Args...)
+}
+
+// queryCondition turns column/value pairs into a parameterized condition,
+// isColumn rejects the keys which are not columns of the queried table
+func queryCondition(query map[string]string, isColumn func(field string) bool) (cond string, args []interface{}, err error) {
+	var conds []string
+	for k, v := range query {
+		if !isColumn(k) {
+			return "", nil, &ParamError{Key: "invalid_query_key", Args: []interface{}{k}}
+		}
+		conds = append(conds, k+" = ?")
+		args = append(args, v)
+	}
+	return strings.Join(conds, " and "), args, nil
+}
+
+// OrderBy sorts a list by a column, which the Search functions check against the columns
+// of the listed table. Build it from the column constants, e.g. OrderBy{Column: UserColName, Desc: true}
+type OrderBy struct {
+	Column string
+	Desc   bool
+}
+
+func (o OrderBy) clause() string {
+	if o.Desc {
+		return o.Column + " desc"
+	}
+	return o.Column + " asc"
+}
+
+// parseOrder validates the sortby and order parameters of a list request and turns
+// them into the order of the Search functions
+func parseOrder(sortby, order []string) ([]OrderBy, error) {
+	if len(sortby) == 0 {
+		if len(order) != 0 {
+			return nil, &ParamError{Key: "unused_order"}
+		}
+		return nil, nil
+	}
+	if len(order) > 1 && len(order) != len(sortby) {
+		return nil, &ParamError{Key: "order_mismatch"}
+	}
+	orderBy := make([]OrderBy, 0, len(sortby))
+	for i, field := range sortby {
+		o := "asc"
+		if len(order) == 1 {
+			o = order[0]
+		} else if len(order) > 1 {
+			o = order[i]
+		}
+		if o != "asc" && o != "desc" {
+			return nil, &ParamError{Key: "invalid_order"}
+		}
+		orderBy = append(orderBy, OrderBy{Column: field, Desc: o == "desc"})
+	}
+	return orderBy, nil
+}
 `
 )
@@ -0,0 +1,338 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/skOak/hee/config"
+)
+
+// fixtureTables returns the tables of a small schema: users with a unique and a soft
+// delete column, orders referencing them and logs without primary key
+func fixtureTables() []*Table {
+	users := &Table{Name: "users", Pk: "id", PkType: "int64", Uk: []string{"email"}, Fk: map[string]*ForeignKey{}, ImportTimePkg: true, IdDelete: true}
+	users.Columns = []*Column{
+		{Name: "Id", Type: "int64", SQLType: "bigint", Tag: &OrmTag{Column: "id", Auto: true}},
+		{Name: "Name", Type: "string", SQLType: "varchar(64)", Tag: &OrmTag{Column: "name", Size: "64"}},
+		{Name: "Email", Type: "string", SQLType: "varchar(255)", Tag: &OrmTag{Column: "email", Size: "255", Unique: true}},
+		{Name: "Score", Type: "float64", SQLType: "double", Tag: &OrmTag{Column: "score", Null: true}},
+		{Name: "CreatedAt", Type: "time.Time", SQLType: "datetime", Tag: &OrmTag{Column: "created_at", Type: "datetime", AutoNowAdd: true}},
+		{Name: "IsDeleted", Type: "int8", SQLType: "tinyint", Tag: &OrmTag{Column: "is_deleted"}},
+	}
+	orders := &Table{Name: "orders", Pk: "id", PkType: "int", Fk: map[string]*ForeignKey{"user_id": {Name: "user_id", RefTable: "users", RefColumn: "id"}}}
+	orders.Columns = []*Column{
+		{Name: "Id", Type: "int", SQLType: "int", Tag: &OrmTag{Column: "id", Auto: true}},
+		{Name: "UserId", Type: "*Users", SQLType: "bigint", Tag: &OrmTag{Column: "user_id", RelFk: true, TableFk: "users"}},
+		{Name: "Status", Type: "string", SQLType: "varchar(16)", Tag: &OrmTag{Column: "status", Size: "16"}},
+	}
+	logs := &Table{Name: "logs", Fk: map[string]*ForeignKey{}}
+	logs.Columns = []*Column{
+		{Name: "Msg", Type: "string", SQLType: "text", Tag: &OrmTag{Column: "msg", Type: "text"}},
+	}
+	return []*Table{users, orders, logs}
+}
+
+// loadTestConfig overlays the JSON configuration conf onto the configuration
+func loadTestConfig(t *testing.T, conf string) {
+	file := filepath.Join(t.TempDir(), "hee.json")
+	if err := ioutil.WriteFile(file, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfigFile(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// generateApp writes the files of mode generated from tables for dbms into the
+// example.com/app package of a GOPATH of its own, which it returns
+func generateApp(t *testing.T, dbms string, tables []*Table, mode byte) string {
+	gopath := t.TempDir()
+	dir := filepath.Join(gopath, "src", "example.com", "app")
+	applyTableConfig(tables)
+	if gormV2() {
+		useGormV2(tables)
+	}
+	if sqlxMode() {
+		useSqlx(tables)
+	}
+	paths := &MvcPath{
+		ModelPath:      filepath.Join(dir, outputDir("models")),
+		ControllerPath: filepath.Join(dir, outputDir("controllers")),
+		RouterPath:     filepath.Join(dir, outputDir("routers")),
+		SqlcPath:       filepath.Join(dir, outputDir("queries")),
+		HandlersPath:   filepath.Join(dir, outputDir("handlers")),
+	}
+	setOutputImports("example.com/app")
+	defer func() { outputImports = nil }()
+	createPaths(mode, paths)
+	writeSourceFiles(dbms, "example.com/app", tables, mode, paths, nil)
+	return gopath
+}
+
+// testGeneratedPackage adds files to the package pkg of the app of gopath and runs its
+// tests, with the packages of the GOPATH of hee. It is skipped with -short, or when one
+// of imports, e.g. a database driver, isn't installed.
+func testGeneratedPackage(t *testing.T, gopath, pkg string, files map[string]string, imports ...string) {
+	if testing.Short() {
+		t.Skip("building the generated package is skipped with -short")
+	}
+	for _, p := range imports {
+		if _, err := build.Import(p, "", build.FindOnly); err != nil {
+			t.Skipf("%s isn't installed", p)
+		}
+	}
+	dir := filepath.Join(gopath, "src", "example.com", "app", pkg)
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "test", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOPATH="+gopath+string(filepath.ListSeparator)+build.Default.GOPATH, "GO111MODULE=off", "GOFLAGS=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+}
+
+// vetGeneratedApp type checks the packages of the app of gopath with go vet, with the
+// packages of the GOPATH of hee. It is skipped with -short, or when an imported package
+// isn't installed.
+func vetGeneratedApp(t *testing.T, gopath string) {
+	if testing.Short() {
+		t.Skip("type checking the generated packages is skipped with -short")
+	}
+	cmd := exec.Command("go", "vet", "./...")
+	cmd.Dir = filepath.Join(gopath, "src", "example.com", "app")
+	cmd.Env = append(os.Environ(), "GOPATH="+gopath+string(filepath.ListSeparator)+build.Default.GOPATH, "GO111MODULE=off", "GOFLAGS=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if strings.Contains(string(out), "cannot find package") {
+			t.Skipf("an import of the generated packages isn't installed:\n%s", out)
+		}
+		t.Fatalf("%s\n%s", err, out)
+	}
+}
+
+// TestGeneratedCodeBuilds renders the models, controllers and routers of the fixture
+// schema for the main variants of appcode, parses every generated Go file and type
+// checks the generated packages
+func TestGeneratedCodeBuilds(t *testing.T) {
+	variants := []struct {
+		name  string
+		setup func()
+		mode  byte
+	}{
+		{"default", func() {}, OModel | OController | ORouter},
+		{"gorm v2", func() { GormVersion.Set("v2") }, OModel | OController | ORouter},
+		{"sqlx", func() { ORM.Set(OrmSqlx) }, OModel | OSqlc},
+		{"servemux", func() { ServeMux = true }, OModel | OHandlers},
+	}
+	for _, v := range variants {
+		t.Run(v.name, func(t *testing.T) {
+			conf := config.Conf
+			defer func() {
+				config.Conf = conf
+				GormVersion.Set("")
+				ORM.Set("")
+				ServeMux = false
+			}()
+			v.setup()
+
+			gopath := generateApp(t, "mysql", fixtureTables(), v.mode)
+			var parsed int
+			err := filepath.Walk(gopath, func(p string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() || !strings.HasSuffix(p, ".go") {
+					return err
+				}
+				parsed++
+				if _, err := parser.ParseFile(token.NewFileSet(), p, nil, parser.AllErrors); err != nil {
+					t.Errorf("%s", err)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed == 0 {
+				t.Fatal("no Go file was generated")
+			}
+			if !t.Failed() {
+				vetGeneratedApp(t, gopath)
+			}
+		})
+	}
+}
+
+// TestMysqlStringAndBinaryTypes checks how the MySQL string and binary types are read:
+// the Go type, the size kept from the column type and the SQL type kept for the text
+// and blob families
+func TestMysqlStringAndBinaryTypes(t *testing.T) {
+	cases := []struct {
+		dataType, columnType string
+		str, text, binary    bool
+		size                 string
+	}{
+		{"char", "char(2)", true, false, false, "2"},
+		{"varchar", "varchar(255)", true, false, false, "255"},
+		{"tinytext", "tinytext", false, true, false, ""},
+		{"text", "text", false, true, false, ""},
+		{"mediumtext", "mediumtext", false, true, false, ""},
+		{"longtext", "longtext", false, true, false, ""},
+		{"enum", "enum('a','b')", false, false, false, ""},
+		{"set", "set('a','b')", false, false, false, ""},
+		{"binary", "binary(16)", false, false, true, "16"},
+		{"varbinary", "varbinary(64)", false, false, true, "64"},
+		{"tinyblob", "tinyblob", false, true, false, ""},
+		{"blob", "blob", false, true, false, ""},
+		{"mediumblob", "mediumblob", false, true, false, ""},
+		{"longblob", "longblob", false, true, false, ""},
+	}
+	for _, c := range cases {
+		if got := isSQLStringType(c.dataType); got != c.str {
+			t.Errorf("isSQLStringType(%q) = %v, want %v", c.dataType, got, c.str)
+		}
+		if got := isSQLTextType(c.dataType); got != c.text {
+			t.Errorf("isSQLTextType(%q) = %v, want %v", c.dataType, got, c.text)
+		}
+		if got := isSQLBinaryType(c.dataType); got != c.binary {
+			t.Errorf("isSQLBinaryType(%q) = %v, want %v", c.dataType, got, c.binary)
+		}
+		var size string
+		if c.str || c.binary {
+			size = extractColSize(c.columnType)
+		}
+		if size != c.size {
+			t.Errorf("size of %q = %q, want %q", c.columnType, size, c.size)
+		}
+		if goType, err := (*MysqlDB)(nil).GetGoDataType(c.dataType); err != nil || goType != "string" {
+			t.Errorf("Go type of %q = %q, %v, want string", c.dataType, goType, err)
+		}
+	}
+}
+
+// TestColumnDefaults checks the quoting of the column defaults and that the gorm tag
+// holding them stays a valid struct tag
+func TestColumnDefaults(t *testing.T) {
+	literals := []struct{ def, want string }{
+		{"active", "'active'"},
+		{"it's", "'it''s'"},
+		{`say "hi"`, `'say "hi"'`},
+		{"'quoted'", "'quoted'"},
+		{"0", "0"},
+		{"-1.5", "-1.5"},
+		{"b'101'", "b'101'"},
+		{"NULL", ""},
+		{"a;b", ""},
+		{"a`b", ""},
+	}
+	for _, c := range literals {
+		got := literalDefault("c", c.def)
+		if got != c.want {
+			t.Errorf("literalDefault(%q) = %q, want %q", c.def, got, c.want)
+			continue
+		}
+		if got == "" {
+			continue
+		}
+		tag := (&OrmTag{Column: "c", Null: true, Default: got}).String()
+		if strings.HasPrefix(tag, `"`) {
+			unquoted, err := strconv.Unquote(tag)
+			if err != nil {
+				t.Errorf("tag of %q: %s", c.def, err)
+				continue
+			}
+			tag = unquoted
+		} else {
+			tag = strings.Trim(tag, "`")
+		}
+		if gorm := reflect.StructTag(tag).Get("gorm"); gorm != "column:c;default:"+c.want {
+			t.Errorf("gorm tag of %q = %q, want %q", c.def, gorm, "column:c;default:"+c.want)
+		}
+	}
+
+	exprs := []struct {
+		def, extra string
+		want       bool
+	}{
+		{"uuid()", "DEFAULT_GENERATED", true},
+		{"(now() + interval 1 day)", "DEFAULT_GENERATED", true},
+		{"active", "", false},
+		{`concat("a", "b")`, "DEFAULT_GENERATED", false},
+		{"", "DEFAULT_GENERATED", false},
+	}
+	for _, c := range exprs {
+		if got := isDefaultExpr(c.def, c.extra); got != c.want {
+			t.Errorf("isDefaultExpr(%q, %q) = %v, want %v", c.def, c.extra, got, c.want)
+		}
+	}
+
+	pg := []struct{ def, literal, expr string }{
+		{"'active'::character varying", "'active'", ""},
+		{"'it''s'::text", "'it''s'", ""},
+		{"42", "42", ""},
+		{"true", "true", ""},
+		{"gen_random_uuid()", "", "gen_random_uuid()"},
+		{"nextval('users_id_seq'::regclass)", "", ""},
+		{"NULL::character varying", "", ""},
+	}
+	for _, c := range pg {
+		if literal, expr := pgDefault("c", c.def); literal != c.literal || expr != c.expr {
+			t.Errorf("pgDefault(%q) = %q, %q, want %q, %q", c.def, literal, expr, c.literal, c.expr)
+		}
+	}
+}
+
+// TestCurrentTimestampDefaults checks the column defaults read as the current time by
+// the transformers, which set auto_now_add
+func TestCurrentTimestampDefaults(t *testing.T) {
+	cases := []struct {
+		is   func(string) bool
+		def  string
+		want bool
+	}{
+		{isCurrentTimestamp, "CURRENT_TIMESTAMP", true},
+		{isCurrentTimestamp, "CURRENT_TIMESTAMP(3)", true},
+		{isCurrentTimestamp, "now()", true},
+		{isCurrentTimestamp, "now():::TIMESTAMPTZ", true},
+		{isCurrentTimestamp, "current_timestamp():::TIMESTAMP", true},
+		{isCurrentTimestamp, "('now'::text)::date", false},
+		{isCurrentTimestamp, "'2000-01-01 00:00:00'::timestamp without time zone", false},
+		{isSqliteCurrentTimestamp, "CURRENT_TIMESTAMP", true},
+		{isSqliteCurrentTimestamp, "datetime('now', 'localtime')", true},
+		{isSqliteCurrentTimestamp, "(strftime('%Y-%m-%d %H:%M:%f', 'now'))", true},
+		{isSqliteCurrentTimestamp, "'now'", false},
+		{isMssqlCurrentTimestamp, "getdate()", true},
+		{isOracleCurrentTimestamp, "SYSTIMESTAMP", true},
+		{isClickHouseCurrentTimestamp, "now64(3)", true},
+		{isClickHouseCurrentTimestamp, "now('UTC')", true},
+		{isClickHouseCurrentTimestamp, "toDateTime(0)", false},
+	}
+	for _, c := range cases {
+		if got := c.is(c.def); got != c.want {
+			t.Errorf("%s read as the current time: %v, want %v", c.def, got, c.want)
+		}
+	}
+}
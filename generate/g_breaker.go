@@ -0,0 +1,170 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"time"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// breakerEnabled reports whether the generated controllers call the models
+// through a circuit breaker
+func breakerEnabled() bool {
+	return config.Conf.Appcode.Breaker.Enabled
+}
+
+// writeBreakerFile generates breaker.go holding the circuit breakers of the tables
+func writeBreakerFile(dbms, mPath string) {
+	conf := config.Conf.Appcode.Breaker
+	data := struct {
+		Dialect                          string
+		MaxRequests, ConsecutiveFailures uint32
+		IntervalMs, TimeoutMs            int64
+	}{Dialect: dbms, MaxRequests: 1, ConsecutiveFailures: 5, IntervalMs: 60000, TimeoutMs: 30000}
+	if conf.MaxRequests > 0 {
+		data.MaxRequests = conf.MaxRequests
+	}
+	if conf.ConsecutiveFailures > 0 {
+		data.ConsecutiveFailures = conf.ConsecutiveFailures
+	}
+	for _, d := range []struct {
+		value string
+		ms    *int64
+	}{{conf.Interval, &data.IntervalMs}, {conf.Timeout, &data.TimeoutMs}} {
+		if d.value == "" {
+			continue
+		}
+		period, err := time.ParseDuration(d.value)
+		if err != nil {
+			beeLogger.Log.Fatalf("Invalid circuit breaker period '%s': %s", d.value, err)
+		}
+		*d.ms = int64(period / time.Millisecond)
+	}
+	writeGeneratedFile(path.Join(mPath, "breaker.go"), executeTemplate(BreakerTPL, data))
+}
+
+const BreakerTPL = `package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+{{if eq .Dialect "mysql"}}
+	"github.com/go-sql-driver/mysql"{{end}}
+	"github.com/sony/gobreaker"
+)
+
+// BreakerSettings are the settings of the circuit breakers, one per table.
+// Name, IsSuccessful and OnStateChange are set for each table.
+var BreakerSettings = gobreaker.Settings{
+	MaxRequests: {{.MaxRequests}},
+	Interval:    {{.IntervalMs}} * time.Millisecond,
+	Timeout:     {{.TimeoutMs}} * time.Millisecond,
+	ReadyToTrip: func(counts gobreaker.Counts) bool {
+		return counts.ConsecutiveFailures >= {{.ConsecutiveFailures}}
+	},
+}
+
+// OnBreakerStateChange is called whenever the circuit breaker of a table changes state,
+// e.g. to report it to the monitoring of the service
+var OnBreakerStateChange func(table string, from, to gobreaker.State)
+
+var breakersMu sync.Mutex
+var breakers = make(map[string]*gobreaker.CircuitBreaker)
+
+// breaker returns the circuit breaker of a table
+func breaker(table string) *gobreaker.CircuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	if cb, ok := breakers[table]; ok {
+		return cb
+	}
+	st := BreakerSettings
+	st.Name = table
+	st.IsSuccessful = func(err error) bool {
+		// missing records, constraint violations and other errors of the clients don't
+		// tell anything about the health of the database
+		return !isOutage(err)
+	}
+	st.OnStateChange = func(name string, from, to gobreaker.State) {
+		if OnBreakerStateChange != nil {
+			OnBreakerStateChange(name, from, to)
+		}
+	}
+	cb := gobreaker.NewCircuitBreaker(st)
+	breakers[table] = cb
+	return cb
+}
+
+// isOutage reports whether err tells that the database can't be reached: broken,
+// refused or reset connections and timeouts
+func isOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+{{if eq .Dialect "mysql"}}	if errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+{{end}}	// dial errors and network timeouts
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// guard runs fn through the circuit breaker of table, it fails with
+// gobreaker.ErrOpenState without calling fn while the breaker is open
+func guard(table string, fn func() error) error {
+	_, err := breaker(table).Execute(func() (interface{}, error) {
+		return nil, fn()
+	})
+	return err
+}
+
+// BreakerStates returns the state of the circuit breaker of each table called so far
+func BreakerStates() map[string]string {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	states := make(map[string]string, len(breakers))
+	for table, cb := range breakers {
+		states[table] = cb.State().String()
+	}
+	return states
+}
+
+// Healthy is the health hook of the data layer, it fails while the circuit breaker
+// of a table is open
+func Healthy() error {
+	for table, state := range BreakerStates() {
+		if state == gobreaker.StateOpen.String() {
+			return fmt.Errorf("models: circuit breaker of %s is open", table)
+		}
+	}
+	return nil
+}
+`
@@ -0,0 +1,139 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"time"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// applyCache caches the records of the table read by id in an in-process LRU cache
+// of size records, each one expiring ttl after it was read
+func applyCache(tb *Table, size int, ttl string) {
+	if size == 0 && ttl == "" {
+		return
+	}
+	if size <= 0 {
+		beeLogger.Log.Fatalf("Invalid cache size %d of table '%s'", size, tb.Name)
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 {
+		beeLogger.Log.Fatalf("Invalid cache ttl '%s' of table '%s'", ttl, tb.Name)
+	}
+	if tb.Pk == "" {
+		beeLogger.Log.Warnf("Table '%s' has no primary key, its cache is ignored", tb.Name)
+		return
+	}
+	tb.CacheSize, tb.CacheTTL = size, d
+}
+
+// CacheTTLLiteral returns the ttl of the cached records of the table as a Go expression
+func (tb *Table) CacheTTLLiteral() string {
+	return durationLiteral(tb.CacheTTL)
+}
+
+// writeCacheFile generates cache.go holding the LRU cache of the records read by id,
+// or nothing when no table is cached
+func writeCacheFile(tables []*Table, mPath string) {
+	for _, tb := range tables {
+		if tb.CacheSize > 0 {
+			writeGeneratedFile(path.Join(mPath, "cache.go"), CacheTPL)
+			return
+		}
+	}
+}
+
+const CacheTPL = `package models
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// recordCache is an LRU cache of the records of a table read by id, the records expiring
+// ttl after they were read. A record is removed once it is written through the models, the
+// writes made otherwise, or committed after the record is read again, being seen once it expires.
+type recordCache struct {
+	lru *lru.Cache
+	ttl time.Duration
+	mu  sync.Mutex
+	gen uint64 // incremented on each write, so that the reads started before aren't cached
+}
+
+// cacheEntry is a cached record
+type cacheEntry struct {
+	record  interface{}
+	expires time.Time
+}
+
+// newRecordCache returns a cache of size records expiring after ttl
+func newRecordCache(size int, ttl time.Duration) *recordCache {
+	c, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+	return &recordCache{lru: c, ttl: ttl}
+}
+
+// get returns the record of id, if cached and not expired
+func (c *recordCache) get(id interface{}) (interface{}, bool) {
+	v, ok := c.lru.Get(id)
+	if !ok {
+		return nil, false
+	}
+	e := v.(cacheEntry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(id)
+		return nil, false
+	}
+	return e.record, true
+}
+
+// generation returns the generation of the cache, to be passed to add once the record is read
+func (c *recordCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// add caches the record of id read at generation gen, unless it has been written since
+func (c *recordCache) add(id, record interface{}, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen == c.gen {
+		c.lru.Add(id, cacheEntry{record: record, expires: time.Now().Add(c.ttl)})
+	}
+}
+
+// remove drops the record of id, which has been written
+func (c *recordCache) remove(id interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.lru.Remove(id)
+}
+
+// purge drops every record, some of them having been written
+func (c *recordCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.lru.Purge()
+}
+`
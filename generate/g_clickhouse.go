@@ -0,0 +1,337 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// ClickHouseDB is the ClickHouse version of DbTransformer. ClickHouse having no primary,
+// unique nor foreign keys, the tables are generated as read models, see ClickHouseModelTPL.
+type ClickHouseDB struct {
+}
+
+// typeMappingClickHouse maps ClickHouse data types, without their parameters, to Go
+// types, Nullable, LowCardinality and Array being unwrapped by clickHouseGoType
+var typeMappingClickHouse = map[string]string{
+	"Int8":        "int8", // int
+	"Int16":       "int16",
+	"Int32":       "int32",
+	"Int64":       "int64",
+	"UInt8":       "uint8",
+	"UInt16":      "uint16",
+	"UInt32":      "uint32",
+	"UInt64":      "uint64",
+	"Bool":        "bool",   // bool
+	"String":      "string", // string
+	"FixedString": "string",
+	"Enum8":       "string",
+	"Enum16":      "string",
+	"UUID":        "string",
+	"Date":        "time.Time", // time
+	"Date32":      "time.Time",
+	"DateTime":    "time.Time",
+	"DateTime64":  "time.Time",
+	"Float32":     "float32", // float & decimal
+	"Float64":     "float64",
+	"Decimal":     "float64",
+	"Decimal32":   "float64",
+	"Decimal64":   "float64",
+	"Decimal128":  "float64",
+}
+
+// GetTableNames for ClickHouse, the tables and views of the current database but the
+// inner tables of the materialized views
+func (*ClickHouseDB) GetTableNames(db *sql.DB) (tables []string) {
+	rows, err := db.Query(`SELECT name FROM system.tables
+		WHERE database = currentDatabase() AND NOT is_temporary AND NOT startsWith(name, '.inner')
+		ORDER BY name`)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show tables: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			beeLogger.Log.Fatalf("Could not show tables: %s", err)
+		}
+		tables = append(tables, name)
+	}
+	return
+}
+
+// GetConstraints for ClickHouse does nothing: the primary key of a MergeTree table is
+// the prefix of its sorting key, which doesn't identify the rows
+func (*ClickHouseDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
+}
+
+// GetColumns for ClickHouse, from system.columns. The MATERIALIZED, ALIAS and EPHEMERAL
+// columns, which SELECT * leaves out, are skipped.
+func (chDB *ClickHouseDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+	table.ReadOnly = true
+	colDefRows, err := db.Query(
+		`SELECT
+			name, type, default_kind, default_expression, comment
+		FROM
+			system.columns
+		WHERE
+			database = currentDatabase() AND table = ?
+		ORDER BY
+			position`,
+		table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the columns of '%s': %s", table.Name, err)
+	}
+	defer colDefRows.Close()
+
+	for colDefRows.Next() {
+		var colName, columnType, defaultKind, columnDefault, columnComment string
+		if err := colDefRows.Scan(&colName, &columnType, &defaultKind, &columnDefault, &columnComment); err != nil {
+			beeLogger.Log.Fatalf("Could not read the columns of '%s': %s", table.Name, err)
+		}
+		if defaultKind == "MATERIALIZED" || defaultKind == "ALIAS" || defaultKind == "EPHEMERAL" {
+			beeLogger.Log.Infof("Skipping %s column '%s.%s'", strings.ToLower(defaultKind), table.Name, colName)
+			continue
+		}
+
+		// create a column
+		col := new(Column)
+		col.Name = utils.CamelCase(colName)
+		col.Type, err = chDB.GetGoDataType(columnType)
+		if err != nil {
+			beeLogger.Log.Fatalf("%s", err)
+		}
+		if colName == "id" {
+			col.Name = idFieldName
+		}
+		if colName == "is_deleted" {
+			// 如果存在该列，则会记录需要用这个字段来代表删除动作
+			table.IdDelete = true
+		}
+
+		// Tag info
+		tag := new(OrmTag)
+		tag.Column = colName
+		tag.Comment = columnComment
+		baseType := columnType
+		if strings.HasPrefix(baseType, "Nullable(") {
+			tag.Null = true
+			baseType = baseType[len("Nullable(") : len(baseType)-1]
+		}
+		if strings.Contains(columnType, "(") {
+			// the parameters, e.g. the time zone or the values of an enum, are kept
+			tag.Type = columnType
+		}
+		if strings.HasPrefix(baseType, "FixedString(") {
+			tag.Size = baseType[len("FixedString(") : len(baseType)-1]
+		}
+		if m := regexp.MustCompile(`^Decimal\(([0-9]+), *([0-9]+)\)$`).FindStringSubmatch(baseType); m != nil {
+			tag.Digits, tag.Decimals = m[1], m[2]
+		}
+		if strings.HasSuffix(col.Type, "time.Time") {
+			if defaultKind == "DEFAULT" && isClickHouseCurrentTimestamp(columnDefault) {
+				tag.AutoNowAdd = true
+			}
+			// need to import time package
+			table.ImportTimePkg = true
+		} else if defaultKind == "DEFAULT" && columnDefault != "" {
+			if strings.HasPrefix(columnDefault, "'") || regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`).MatchString(columnDefault) {
+				tag.Default = literalDefault(colName, columnDefault)
+			} else if !strings.ContainsAny(columnDefault, "\"`;") {
+				tag.DefaultExpr = columnDefault
+			}
+		}
+		col.SQLType = columnType
+		col.Tag = tag
+		table.Columns = append(table.Columns, col)
+	}
+}
+
+// isClickHouseCurrentTimestamp reports whether a column default is the current time,
+// e.g. now(), now('UTC') or now64(3)
+func isClickHouseCurrentTimestamp(def string) bool {
+	regex := regexp.MustCompile(`^(?i)(now|now64)\([^)]*\)$`)
+	return regex.MatchString(def) || isCurrentTimestamp(def)
+}
+
+// GetGoDataType maps a ClickHouse data type to a Go type, e.g. Array(LowCardinality(String))
+// to []string. The Nullable times are pointers, as the other transformers read them.
+func (chDB *ClickHouseDB) GetGoDataType(sqlType string) (string, error) {
+	switch {
+	case strings.HasPrefix(sqlType, "LowCardinality("):
+		return chDB.GetGoDataType(sqlType[len("LowCardinality(") : len(sqlType)-1])
+	case strings.HasPrefix(sqlType, "Nullable("):
+		goType, err := chDB.GetGoDataType(sqlType[len("Nullable(") : len(sqlType)-1])
+		if goType == "time.Time" {
+			goType = "*" + goType
+		}
+		return goType, err
+	case strings.HasPrefix(sqlType, "Array("):
+		goType, err := chDB.GetGoDataType(sqlType[len("Array(") : len(sqlType)-1])
+		return "[]" + goType, err
+	}
+	name := sqlType
+	if i := strings.Index(name, "("); i >= 0 {
+		name = name[:i]
+	}
+	if v, ok := typeMappingClickHouse[name]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("data type '%s' not found", sqlType)
+}
+
+// ClickHouseModelTPL is the model of a ClickHouse table, which is read only: the rows
+// are searched and counted, loading only the requested columns
+const ClickHouseModelTPL = `package models
+
+import (
+{{if .ImportTimePkg}}	"time"
+{{end}}
+	"github.com/jinzhu/gorm"
+)
+
+{{modelStruct}}
+
+func ({{modelName}}) TableName() string {
+	return "{{tableName}}"
+}
+
+// Column names of {{tableName}}, to be used when building queries
+const (
+{{range .Columns}}	{{modelName}}Col{{.Name}} = "{{.Tag.Column}}"
+{{end}})
+
+// is{{modelName}}Column reports whether field is a column of {{tableName}}
+func is{{modelName}}Column(field string) bool {
+	switch field {
+	case {{range $i, $c := .Columns}}{{if $i}}, {{end}}{{modelName}}Col{{$c.Name}}{{end}}:
+		return true
+	}
+	return false
+}
+
+// Order{{modelName}}By returns the OrderBy sorting {{modelName}}s by field,
+// it fails if field is not a column of {{tableName}}
+func Order{{modelName}}By(field string, desc bool) (OrderBy, error) {
+	if !is{{modelName}}Column(field) {
+		return OrderBy{}, &ParamError{Key: "unknown_column", Args: []interface{}{field, "{{tableName}}"}}
+	}
+	return OrderBy{Column: field, Desc: desc}, nil
+}
+
+// Search{{modelName}}s retrieves the {{modelName}}s matching query, fields being the columns
+// to load, all of them when empty, which ClickHouse reads column by column. order is built
+// from the column constants, e.g. OrderBy{Column: {{modelName}}Col{{(index .Columns 0).Name}}}, or
+// with Order{{modelName}}By from a field name, and limit is 0 for every matching row.
+func Search{{modelName}}s(tx *gorm.DB, fields []string, order []OrderBy, offset, limit uint64, query string, queryArgs ...interface{}) (ml []*{{modelName}}, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	for _, field := range fields {
+		if !is{{modelName}}Column(field) {
+			return nil, &ParamError{Key: "unknown_column", Args: []interface{}{field, "{{tableName}}"}}
+		}
+	}
+	if len(fields) > 0 {
+		db = db.Select(fields)
+	}
+	if query != "" {
+		db = db.Where(query, queryArgs...)
+	}
+	for _, o := range order {
+		if !is{{modelName}}Column(o.Column) {
+			return nil, &ParamError{Key: "unknown_column", Args: []interface{}{o.Column, "{{tableName}}"}}
+		}
+		db = db.Order(o.clause())
+	}
+	if offset > 0 {
+		db = db.Offset(offset)
+	}
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	ml = make([]*{{modelName}}, 0)
+	err = db.Find(&ml).Error
+	return
+}
+
+// Count{{modelName}}s counts the {{modelName}}s matching query
+func Count{{modelName}}s(tx *gorm.DB, query string, queryArgs ...interface{}) (count int64, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	db = db.Model(&{{modelName}}{})
+	if query != "" {
+		db = db.Where(query, queryArgs...)
+	}
+	err = db.Count(&count).Error
+	return
+}
+
+// Count{{modelName}}sEstimate returns the number of rows of {{tableName}} from system.tables,
+// which the MergeTree tables keep without reading their parts. It falls back on
+// Count{{modelName}}s for the other engines.
+func Count{{modelName}}sEstimate(tx *gorm.DB) (count int64, err error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var rows []int64
+	err = db.Raw("SELECT coalesce(toInt64(total_rows), -1) AS total_rows FROM system.tables WHERE database = currentDatabase() AND name = ?", "{{tableName}}").Pluck("total_rows", &rows).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 || rows[0] < 0 {
+		return Count{{modelName}}s(tx, "")
+	}
+	return rows[0], nil
+}
+
+// GetAll{{modelName}} retrieves {{modelName}}s as listed by a controller: query holds column/value
+// pairs, fields the columns to load (all when empty), sortby and order the sort columns and
+// their directions. total counts the matching records whatever offset and limit are.
+func GetAll{{modelName}}(tx *gorm.DB, query map[string]string, fields, sortby, order []string, offset, limit int64) (ml []*{{modelName}}, total int64, err error) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, &ParamError{Key: "invalid_page", Args: []interface{}{offset, limit}}
+	}
+	cond, args, err := queryCondition(query, is{{modelName}}Column)
+	if err != nil {
+		return nil, 0, err
+	}
+	orderBy, err := parseOrder(sortby, order)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cond == "" {
+		total, err = Count{{modelName}}sEstimate(tx)
+	} else {
+		total, err = Count{{modelName}}s(tx, cond, args...)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	ml, err = Search{{modelName}}s(tx, fields, orderBy, uint64(offset), uint64(limit), cond, args...)
+	return
+}
+`
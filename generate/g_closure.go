@@ -0,0 +1,91 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// closureSuffix ends the names of the closure tables, holding a row for each ancestor
+// of each node of another table, the node itself included at depth 0
+const closureSuffix = "_paths"
+
+// the names of the columns of a closure table
+var (
+	ancestorColumns   = []string{"ancestor_id", "ancestor"}
+	descendantColumns = []string{"descendant_id", "descendant"}
+	depthColumns      = []string{"depth", "path_length", "length"}
+)
+
+// closure is the closure table of a table
+type closure struct {
+	Table            string
+	AncestorColumn   string
+	DescendantColumn string
+	DepthColumn      string
+	ParentColumn     string // column of the table referencing the parent of a node, if any
+}
+
+// detectClosures links the tables to their <table>_paths closure table, so that the
+// closure rows get maintained along the nodes and the descendants and ancestors get
+// queried through them
+func detectClosures(db *sql.DB, trans DbTransformer, tables []*Table) {
+	byName := make(map[string]*Table)
+	for _, tb := range tables {
+		byName[tb.Name] = tb
+	}
+	allTables := make(map[string]bool)
+	for _, name := range trans.GetTableNames(db) {
+		allTables[name] = true
+	}
+	for _, tb := range tables {
+		name := tb.Name + closureSuffix
+		if tb.Pk == "" || !allTables[name] {
+			continue
+		}
+		paths, ok := byName[name]
+		if !ok {
+			// the closure table is maintained even when it is not selected
+			paths = getTableObjects([]string{name}, db, trans)[0]
+		}
+		tb.Closure = newClosure(tb, paths)
+	}
+}
+
+// newClosure returns the closure of tb by the columns of paths, or nil when paths
+// doesn't follow the pattern
+func newClosure(tb, paths *Table) *closure {
+	c := &closure{Table: paths.Name, ParentColumn: selfForeignKey(tb)}
+	c.AncestorColumn = firstColumn(paths, ancestorColumns)
+	c.DescendantColumn = firstColumn(paths, descendantColumns)
+	c.DepthColumn = firstColumn(paths, depthColumns)
+	if c.AncestorColumn == "" || c.DescendantColumn == "" || c.DepthColumn == "" {
+		beeLogger.Log.Warnf("Table '%s' has no ancestor, descendant or depth column, it is not used as the closure of '%s'", paths.Name, tb.Name)
+		return nil
+	}
+	return c
+}
+
+// firstColumn returns the first of names being a column of tb, or "" if none is
+func firstColumn(tb *Table, names []string) string {
+	for _, name := range names {
+		if tb.Column(name) != nil {
+			return name
+		}
+	}
+	return ""
+}
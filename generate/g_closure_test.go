@@ -0,0 +1,122 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/skOak/hee/config"
+)
+
+// closureTestFiles are added to the models to move subtrees of the closure table of the
+// categories on SQLite and read them back
+var closureTestFiles = map[string]string{
+	"export_test.go": treeTestFiles["export_test.go"],
+	"closure_test.go": `package models_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"example.com/app/models"
+)
+
+func TestMoveSubtree(t *testing.T) {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	models.SetDB(db)
+	for _, stmt := range []string{
+		"CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, parent_id INTEGER REFERENCES categories (id), name TEXT NOT NULL, is_deleted INTEGER NOT NULL DEFAULT 0)",
+		"CREATE TABLE categories_paths (ancestor_id INTEGER NOT NULL, descendant_id INTEGER NOT NULL, depth INTEGER NOT NULL)",
+		"INSERT INTO categories (id, parent_id, name) VALUES (1, NULL, 'root'), (2, 1, 'a'), (3, 1, 'b'), (4, 2, 'c')",
+		"INSERT INTO categories_paths VALUES (1, 1, 0), (2, 2, 0), (3, 3, 0), (4, 4, 0), (1, 2, 1), (1, 3, 1), (2, 4, 1), (1, 4, 2)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(ml []*models.Categories, err error) (ids []int64) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range ml {
+			ids = append(ids, m.Id)
+		}
+		return
+	}
+	parentOf := func(id int64) (parent *int64) {
+		if err := db.Table("categories").Where("id = ?", id).Select("parent_id").Row().Scan(&parent); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	parent := int64(3)
+	if err := models.MoveCategoriesSubtree(nil, 2, &parent); err != nil {
+		t.Fatal(err)
+	}
+	if p := parentOf(2); p == nil || *p != 3 {
+		t.Errorf("parent of 2 is %v after moving it under 3, want 3", p)
+	}
+	if got := ids(models.GetCategoriesAncestors(nil, 4)); !reflect.DeepEqual(got, []int64{1, 3, 2}) {
+		t.Errorf("ancestors of 4 are %v after moving 2 under 3, want [1 3 2]", got)
+	}
+	if got := ids(models.GetCategoriesDescendants(nil, 3, 0)); !reflect.DeepEqual(got, []int64{2, 4}) {
+		t.Errorf("descendants of 3 are %v after moving 2 under 3, want [2 4]", got)
+	}
+	parent = 4
+	if err := models.MoveCategoriesSubtree(nil, 3, &parent); err != models.ErrTreeCycle {
+		t.Errorf("moving 3 under 4 returned %v, want ErrTreeCycle", err)
+	}
+	if err := models.MoveCategoriesSubtree(nil, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if p := parentOf(2); p != nil {
+		t.Errorf("parent of 2 is %d after moving it to the roots, want NULL", *p)
+	}
+	if got := ids(models.GetCategoriesAncestors(nil, 4)); !reflect.DeepEqual(got, []int64{2}) {
+		t.Errorf("ancestors of 4 are %v after moving 2 to the roots, want [2]", got)
+	}
+	if err := models.MoveCategoriesSubtree(nil, 99, nil); !models.IsNotFound(err) {
+		t.Errorf("moving a missing node returned %v, want ErrNotFound", err)
+	}
+}
+`,
+}
+
+// TestClosureMoveSubtree moves the subtrees of a closure table on SQLite and reads
+// them back
+func TestClosureMoveSubtree(t *testing.T) {
+	conf := config.Conf
+	defer func() { config.Conf = conf }()
+
+	tables := treeTables()
+	paths := &Table{Name: "categories_paths", Fk: map[string]*ForeignKey{}}
+	paths.Columns = []*Column{
+		{Name: "AncestorId", Type: "int64", SQLType: "integer", Tag: &OrmTag{Column: "ancestor_id"}},
+		{Name: "DescendantId", Type: "int64", SQLType: "integer", Tag: &OrmTag{Column: "descendant_id"}},
+		{Name: "Depth", Type: "int", SQLType: "integer", Tag: &OrmTag{Column: "depth"}},
+	}
+	tables[0].Closure = newClosure(tables[0], paths)
+	gopath := generateApp(t, "sqlite", append(tables, paths), OModel)
+	testGeneratedPackage(t, gopath, "models", closureTestFiles, "github.com/jinzhu/gorm", "github.com/mattn/go-sqlite3")
+}
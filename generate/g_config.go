@@ -0,0 +1,471 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// applyTableConfig copies the per table options of the appcode configuration
+// onto the introspected tables
+func applyTableConfig(tables []*Table) {
+	for _, tb := range tables {
+		conf, ok := config.Conf.Appcode.Tables[tb.Name]
+		excludeColumns(tb, conf.Excluded)
+		applyTypes(tb, conf.Types)
+		renameFields(tb, conf.Rename)
+		applyTenant(tb, conf.Unscoped)
+		applyMoney(tb)
+		applySemantics(tb)
+		if !ok {
+			continue
+		}
+		// the tables of ClickHouse are read only whatever the configuration
+		tb.ReadOnly = tb.ReadOnly || conf.ReadOnly
+		tb.Large = conf.Large
+		tb.DefaultScope = strings.TrimSpace(conf.DefaultScope)
+		for _, name := range conf.Immutable {
+			if col := tb.Column(name); col != nil {
+				col.Immutable = true
+			} else {
+				beeLogger.Log.Warnf("Immutable column '%s' not found in table '%s'", name, tb.Name)
+			}
+		}
+		applyTree(tb, conf.Tree)
+		applyJobs(tb, conf.Jobs)
+		applyRetention(tb, conf.Retention, conf.RetentionColumn)
+		applyEncryption(tb, conf.Encrypted)
+		applyIntegrity(tb, conf.SignatureColumn, conf.Signed)
+		applyCache(tb, conf.Cache.Size, conf.Cache.TTL)
+		applyMasks(tb, conf.Sensitive)
+		if _, ok := levelMode(conf.Level); conf.Level != "" && !ok {
+			beeLogger.Log.Fatalf("Invalid level '%s' of table '%s'. Must be either \"1\", \"2\", or \"3\"", conf.Level, tb.Name)
+		}
+		for _, m := range conf.DisabledMethods {
+			if tb.DisabledMethods == nil {
+				tb.DisabledMethods = make(map[string]bool)
+			}
+			tb.DisabledMethods[strings.ToLower(m)] = true
+		}
+	}
+	applyProjections(tables)
+}
+
+// excludeColumns leaves the given columns out of the model of the table, the primary
+// key and the tenant, signature and tree parent columns can't be left out
+func excludeColumns(tb *Table, excluded []string) {
+	reserved := reservedColumns(tb)
+	for _, name := range excluded {
+		col := tb.Column(name)
+		if col == nil {
+			beeLogger.Log.Warnf("Excluded column '%s' not found in table '%s'", name, tb.Name)
+			continue
+		}
+		if name == tb.Pk {
+			beeLogger.Log.Fatalf("Primary key '%s' of table '%s' can't be excluded", name, tb.Name)
+		}
+		if role, ok := reserved[name]; ok {
+			beeLogger.Log.Fatalf("Column '%s' of table '%s' can't be excluded, it is the %s column", name, tb.Name, role)
+		}
+		if name == "is_deleted" {
+			tb.IdDelete = false
+		}
+		for i, c := range tb.Columns {
+			if c == col {
+				tb.Columns = append(tb.Columns[:i], tb.Columns[i+1:]...)
+				break
+			}
+		}
+		delete(tb.Fk, name)
+		for i, uk := range tb.Uk {
+			if uk == name {
+				tb.Uk = append(tb.Uk[:i], tb.Uk[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(excluded) > 0 {
+		tb.ImportTimePkg = usesTimePkg(tb)
+	}
+}
+
+// reservedColumns returns the columns of tb the generated code relies on through
+// the configuration, keyed by column name
+func reservedColumns(tb *Table) map[string]string {
+	reserved := make(map[string]string)
+	conf := config.Conf.Appcode.Tables[tb.Name]
+	if column := config.Conf.Appcode.Tenant.Column; column != "" && !conf.Unscoped {
+		reserved[column] = "tenant"
+	}
+	if conf.SignatureColumn != "" {
+		reserved[conf.SignatureColumn] = "signature"
+	} else if len(conf.Signed) > 0 {
+		for _, name := range signatureColumns {
+			reserved[name] = "signature"
+		}
+	}
+	if conf.Tree {
+		if parent := selfForeignKey(tb); parent != "" {
+			reserved[parent] = "tree parent"
+		}
+	}
+	return reserved
+}
+
+// applyTypes gives the columns of the table the Go types of the types map. A type
+// qualified by the import path of its package, e.g. github.com/shopspring/decimal.Decimal,
+// is referred to by the last element of the path, e.g. decimal.Decimal, the package
+// being imported by the model
+func applyTypes(tb *Table, types map[string]string) {
+	imports := make(map[string]bool)
+	for column, typ := range types {
+		col := tb.Column(column)
+		if col == nil {
+			beeLogger.Log.Warnf("Typed column '%s' not found in table '%s'", column, tb.Name)
+			continue
+		}
+		base := strings.TrimLeft(typ, "*[]")
+		prefix := typ[:len(typ)-len(base)]
+		if i := strings.LastIndex(base, "."); i > 0 {
+			pkgPath, name := base[:i], base[i+1:]
+			if !token.IsIdentifier(name) {
+				beeLogger.Log.Fatalf("Type '%s' of column '%s.%s' is not a Go type", typ, tb.Name, column)
+			}
+			if pkgPath != "time" && !imports[pkgPath] {
+				imports[pkgPath] = true
+				tb.CustomImports = append(tb.CustomImports, pkgPath)
+			}
+			typ = prefix + path.Base(pkgPath) + "." + name
+		} else if !token.IsIdentifier(base) {
+			beeLogger.Log.Fatalf("Type '%s' of column '%s.%s' is not a Go type", typ, tb.Name, column)
+		}
+		col.Type = typ
+	}
+	if len(types) > 0 {
+		sort.Strings(tb.CustomImports)
+		tb.ImportTimePkg = usesTimePkg(tb)
+	}
+}
+
+// usesTimePkg reports whether a field of the model of the table has a type of the time package
+func usesTimePkg(tb *Table) bool {
+	for _, col := range tb.Columns {
+		if strings.HasPrefix(strings.TrimLeft(col.Type, "*[]"), "time.") {
+			return true
+		}
+	}
+	return false
+}
+
+// idFieldName is the model field name of an id column which is not the primary key,
+// as the Id field is kept for the primary key
+const idFieldName = "IdField"
+
+// renameFields gives the columns of the table the field names of the rename map,
+// and warns about an id column left with the default name
+func renameFields(tb *Table, rename map[string]string) {
+	for column, field := range rename {
+		col := tb.Column(column)
+		if col == nil {
+			beeLogger.Log.Warnf("Renamed column '%s' not found in table '%s'", column, tb.Name)
+			continue
+		}
+		if !token.IsIdentifier(field) || !token.IsExported(field) {
+			beeLogger.Log.Fatalf("Field name '%s' of column '%s.%s' is not an exported Go identifier", field, tb.Name, column)
+		}
+		if column == "is_deleted" && tb.IdDelete {
+			// the soft delete of the templates sets the IsDeleted field
+			beeLogger.Log.Fatalf("Column '%s.%s' can't be renamed, it is the soft delete flag", tb.Name, column)
+		}
+		if column != tb.Pk && field == "Id" {
+			// gorm takes a field named Id for the primary key
+			beeLogger.Log.Fatalf("Column '%s.%s' can't be renamed to Id, the name is kept for the primary key", tb.Name, column)
+		}
+		col.Name = field
+		if column == tb.Pk && field != "Id" {
+			col.Tag.Pk = true
+		}
+	}
+	seen := make(map[string]string, len(tb.Columns))
+	for _, col := range tb.Columns {
+		if other, ok := seen[col.Name]; ok {
+			beeLogger.Log.Fatalf("Columns '%s' and '%s' of table '%s' both map to field %s, rename one of them", other, col.Tag.Column, tb.Name, col.Name)
+		}
+		seen[col.Name] = col.Tag.Column
+	}
+	if col := tb.Column("id"); col != nil && tb.Pk != "id" && col.Name == idFieldName {
+		if _, ok := rename["id"]; !ok {
+			beeLogger.Log.Warnf("Column 'id' of table '%s' is not the primary key, its field is named %s. "+
+				"Set appcode.tables.%s.rename.id to choose another name", tb.Name, idFieldName, tb.Name)
+		}
+	}
+}
+
+// tableMode returns the mode used for the table, restricted to the level
+// configured for the table if any, e.g. models only for reference tables.
+// A level only narrows the mode: a table of level 3 gets no routers when the
+// command generates models and controllers only
+func tableMode(tb *Table, mode byte) byte {
+	if level, ok := levelMode(config.Conf.Appcode.Tables[tb.Name].Level); ok {
+		// files which are not part of a level, e.g. sqlc queries, are kept
+		return mode & (level | ^(OModel | OController | ORouter))
+	}
+	return mode
+}
+
+// tablesWithMode returns the tables for which the given kind of file is generated
+func tablesWithMode(tables []*Table, kind, mode byte) []*Table {
+	var result []*Table
+	for _, tb := range tables {
+		if tableMode(tb, mode)&kind == kind {
+			result = append(result, tb)
+		}
+	}
+	return result
+}
+
+// Column returns the column of the table with the given database name, or nil
+func (tb *Table) Column(name string) *Column {
+	for _, col := range tb.Columns {
+		if col.Tag.Column == name {
+			return col
+		}
+	}
+	return nil
+}
+
+// PkField returns the name of the field holding the primary key in the model,
+// Id unless the original column name is kept
+func (tb *Table) PkField() string {
+	if col := tb.Column(tb.Pk); col != nil {
+		return col.Name
+	}
+	return "Id"
+}
+
+// ImmutableList returns the immutable columns of the table as a list of
+// quoted strings ready to be used in templates, e.g. "created_by", "order_no"
+func (tb *Table) ImmutableList() string {
+	var cols []string
+	for _, col := range tb.Columns {
+		if col.Immutable {
+			cols = append(cols, strconv.Quote(col.Tag.Column))
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// UpdatableColumns returns the columns which BatchUpdate can set: the primary key,
+// the immutable and signed columns, the relations and the soft delete flag are left out
+func (tb *Table) UpdatableColumns() (cols []*Column) {
+	signed := map[string]bool{tb.SignatureColumn: tb.SignatureColumn != ""}
+	for _, name := range tb.Signed {
+		signed[name] = true
+	}
+	for _, col := range tb.Columns {
+		if col.Tag.Column == tb.Pk || col.Immutable || signed[col.Tag.Column] || col.Tag.RelFk || col.Tag.Column == "is_deleted" {
+			continue
+		}
+		cols = append(cols, col)
+	}
+	return
+}
+
+// Allows reports whether the controller of the table should serve the HTTP method.
+// Read-only tables are served through GET only.
+func (tb *Table) Allows(method string) bool {
+	method = strings.ToLower(method)
+	if tb.ReadOnly && method != "get" {
+		return false
+	}
+	return !tb.DisabledMethods[method]
+}
+
+// versionPrefix returns the path every generated route is mounted on, empty
+// when the routes are mounted on the root. It defaults to /v1 when unset
+func versionPrefix() string {
+	prefix := strings.TrimRight(config.Conf.Appcode.Router.VersionPrefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+// resourcePath returns the route of a table relative to the version prefix,
+// e.g. user_account => /user_account, or /user-accounts when pluralizing
+func resourcePath(tableName string) string {
+	if config.Conf.Appcode.Router.Pluralize {
+		return "/" + utils.KebabCase(utils.Pluralize(tableName))
+	}
+	return "/" + tableName
+}
+
+// appcodeFileName returns the name, without extension, of the file generated for
+// a table, following the configured case and with suffix appended
+func appcodeFileName(tableName, suffix string) string {
+	name := tableName + suffix
+	switch strings.ToLower(config.Conf.Appcode.Files.Case) {
+	case "", "snake":
+	case "camel":
+		name = utils.CamelCase(name)
+		name = strings.ToLower(name[:1]) + name[1:]
+	default:
+		beeLogger.Log.Fatalf("Invalid file name case '%s'. Must be either \"snake\" or \"camel\"", config.Conf.Appcode.Files.Case)
+	}
+	return getFileName(name)
+}
+
+// modelFileName returns the name of the model file of a table, e.g. user_dao
+func modelFileName(tableName string) string {
+	return appcodeFileName(tableName, config.Conf.Appcode.Files.ModelSuffix)
+}
+
+// controllerFileName returns the name of the controller file of a table
+func controllerFileName(tableName string) string {
+	return appcodeFileName(tableName, config.Conf.Appcode.Files.ControllerSuffix)
+}
+
+// checkFileNames fails when two tables, or a table and a file shared by all the
+// tables such as models.go, would be generated into the same file
+func checkFileNames(tables []*Table, mode byte) {
+	check := func(kind byte, dir, ext string, reserved []string, fileName func(string) string, skip func(*Table) bool) {
+		owners := make(map[string]string)
+		for _, name := range reserved {
+			owners[name] = "the generated " + name + ext
+		}
+		for _, tb := range tablesWithMode(tables, kind, mode) {
+			if skip != nil && skip(tb) {
+				continue
+			}
+			name := fileName(tb.Name)
+			if owner, ok := owners[name]; ok {
+				beeLogger.Log.Fatalf("Table '%s' and %s would both be generated into %s/%s%s", tb.Name, owner, dir, name, ext)
+			}
+			owners[name] = "table '" + tb.Name + "'"
+		}
+	}
+	if (OModel & mode) == OModel {
+		check(OModel, "models", ".go", []string{"breaker", "cache", "call", "encryption", "idempotency", "import", "integrity", "keys", "mask", "models", "models_init", "money", "oracle", "projection", "registry", "retention", "retry", "slowlog", "tenant", "time", "tree", "truncate"}, modelFileName, nil)
+	}
+	if (OController & mode) == OController {
+		check(OController, "controllers", ".go", []string{"i18n", "idempotency", "pagination", "recycle", "tenant"}, controllerFileName, func(tb *Table) bool { return tb.Pk == "" })
+		// the custom controller files can't be the controller file of another table
+		for _, tb := range tablesWithMode(tables, OController, mode) {
+			for _, other := range tablesWithMode(tables, OController, mode) {
+				if tb.Pk != "" && other.Pk != "" && customFileName(tb.Name) == controllerFileName(other.Name) {
+					beeLogger.Log.Fatalf("The custom controller of table '%s' and the controller of table '%s' would both be generated into controllers/%s.go", tb.Name, other.Name, customFileName(tb.Name))
+				}
+			}
+		}
+	}
+	if (OJobs & mode) == OJobs {
+		check(OJobs, "jobs", ".go", []string{"jobs"}, jobsFileName, func(tb *Table) bool { return len(tb.Jobs) == 0 })
+	}
+	if (OHandlers & mode) == OHandlers {
+		check(OHandlers, "handlers", ".go", []string{"handlers", "i18n"}, handlersFileName, func(tb *Table) bool { return tb.Pk == "" })
+	}
+	if (ODomain & mode) == ODomain {
+		check(ODomain, "domain", ".go", []string{"errors"}, domainFileName, nil)
+		check(ODomain, "persistence", ".go", []string{"persistence"}, domainFileName, func(tb *Table) bool { return tb.Pk == "" })
+		check(ODomain, "persistence/mapper", ".go", []string{"mapper"}, domainFileName, nil)
+	}
+	if (OSqlc & mode) == OSqlc {
+		check(OSqlc, "queries", ".sql", nil, func(name string) string { return appcodeFileName(name, "") }, nil)
+	}
+}
+
+// modelsData holds the options of the generated models.go
+type modelsData struct {
+	Dialect string
+	Pgx     bool // the PostgreSQL driver is jackc/pgx
+	// defaults of the logger
+	LogLevel        string
+	SlowThresholdMs int64
+	LogJSON         bool
+	// rotating file of the slow queries, none when SlowLogFile is empty
+	SlowLogFile       string
+	SlowLogMaxSizeMB  int
+	SlowLogMaxBackups int
+	// options of gorm v2
+	PrepareStmt, SkipDefaultTransaction bool
+	// page sizes
+	DefaultLimit, MaxLimit int64
+}
+
+// newModelsData returns the options of the generated models.go for a database,
+// validating the logger configuration
+func newModelsData(dbms string) *modelsData {
+	conf := config.Conf.Appcode.Logger
+	data := &modelsData{Dialect: dbms, LogLevel: strings.ToLower(conf.Level), LogJSON: conf.JSON}
+	data.Pgx = dbms == "postgres" && pgxDriver()
+	switch data.LogLevel {
+	case "":
+		data.LogLevel = "warn"
+	case "silent", "error", "warn", "info":
+	default:
+		beeLogger.Log.Fatalf("Invalid logger level '%s'. Must be either \"silent\", \"error\", \"warn\" or \"info\"", conf.Level)
+	}
+	if conf.SlowThreshold != "" {
+		d, err := time.ParseDuration(conf.SlowThreshold)
+		if err != nil {
+			beeLogger.Log.Fatalf("Invalid slow query threshold '%s': %s", conf.SlowThreshold, err)
+		}
+		data.SlowThresholdMs = int64(d / time.Millisecond)
+	}
+	if slow := conf.SlowLog; slow.File != "" {
+		if data.SlowThresholdMs <= 0 {
+			beeLogger.Log.Fatal("The slow query log needs a slow_threshold")
+		}
+		if slow.MaxSizeMB < 0 || slow.MaxBackups < 0 {
+			beeLogger.Log.Fatalf("Invalid slow query log rotation, max_size_mb %d and max_backups %d can't be negative", slow.MaxSizeMB, slow.MaxBackups)
+		}
+		data.SlowLogFile, data.SlowLogMaxSizeMB, data.SlowLogMaxBackups = slow.File, 100, 3
+		if slow.MaxSizeMB > 0 {
+			data.SlowLogMaxSizeMB = slow.MaxSizeMB
+		}
+		if slow.MaxBackups > 0 {
+			data.SlowLogMaxBackups = slow.MaxBackups
+		}
+	}
+	gormConf := config.Conf.Appcode.Gorm
+	if gormV2() {
+		data.PrepareStmt, data.SkipDefaultTransaction = gormConf.PrepareStmt, gormConf.SkipDefaultTransaction
+	} else if gormConf.PrepareStmt || gormConf.SkipDefaultTransaction {
+		beeLogger.Log.Fatal("prepare_stmt and skip_default_transaction are only supported by gorm v2, generate with -gorm=v2")
+	}
+	data.DefaultLimit, data.MaxLimit = config.Conf.Appcode.Pagination.DefaultLimit, config.Conf.Appcode.Pagination.MaxLimit
+	if data.DefaultLimit <= 0 || data.MaxLimit < 0 || (data.MaxLimit > 0 && data.DefaultLimit > data.MaxLimit) {
+		beeLogger.Log.Fatalf("Invalid pagination, the default limit %d must be positive and not above the max limit %d",
+			data.DefaultLimit, data.MaxLimit)
+	}
+	return data
+}
+
+// routerModules returns the tables of each router module, keyed by module name
+func routerModules() map[string][]string {
+	return config.Conf.Appcode.Router.Modules
+}
@@ -0,0 +1,336 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// contractTable is a table exposed by the OpenAPI contract
+type contractTable struct {
+	Name   string // schema name, e.g. UserAccounts
+	Fields []*contractField
+	*Table
+}
+
+// contractField is a property of the schema of a table, typed as oapi-codegen
+// types it
+type contractField struct {
+	Name     string
+	Column   string
+	GoType   string
+	Required bool
+}
+
+// contractSchema returns the OpenAPI schema of a Go type of the models, and the type
+// oapi-codegen generates for it
+func contractSchema(goType string) (yaml.MapSlice, string) {
+	switch goType {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		if goType == "int" {
+			return yaml.MapSlice{{Key: "type", Value: "integer"}}, goType
+		}
+		return yaml.MapSlice{{Key: "type", Value: "integer"}, {Key: "format", Value: goType}}, goType
+	case "float32":
+		return yaml.MapSlice{{Key: "type", Value: "number"}, {Key: "format", Value: "float"}}, goType
+	case "float64", "pgtype.Numeric":
+		return yaml.MapSlice{{Key: "type", Value: "number"}, {Key: "format", Value: "double"}}, "float64"
+	case "bool":
+		return yaml.MapSlice{{Key: "type", Value: "boolean"}}, goType
+	case "time.Time", "Time", "gorm.DeletedAt":
+		return yaml.MapSlice{{Key: "type", Value: "string"}, {Key: "format", Value: "date-time"}}, "time.Time"
+	case "[]byte":
+		return yaml.MapSlice{{Key: "type", Value: "string"}, {Key: "format", Value: "byte"}}, goType
+	}
+	return yaml.MapSlice{{Key: "type", Value: "string"}}, "string"
+}
+
+// columnSchema returns the OpenAPI schema of a column and its oapi-codegen type,
+// the relations being typed as the primary key of the table they reference and the
+// columns of a semantic kind getting its format
+func columnSchema(col *Column, tables map[string]*Table) (yaml.MapSlice, string) {
+	goType := col.BaseType()
+	if col.Tag.RelFk {
+		goType = "int"
+		if ref, ok := tables[col.Tag.TableFk]; ok && ref.PkType != "" {
+			goType = ref.PkType
+		}
+	}
+	schema, goType := contractSchema(goType)
+	switch kind := col.Tag.Semantic; kind {
+	case "":
+	case "phone":
+		schema = append(schema, yaml.MapItem{Key: "pattern", Value: e164Pattern})
+	case "email":
+		// oapi-codegen types the emails as openapi_types.Email
+		schema = append(schema, yaml.MapItem{Key: "format", Value: semanticKinds[kind].Format})
+		goType = "openapi_types.Email"
+	default:
+		schema = append(schema, yaml.MapItem{Key: "format", Value: semanticKinds[kind].Format})
+	}
+	return schema, goType
+}
+
+// newContractTables returns the tables exposed by the contract, those having a
+// primary key
+func newContractTables(tables []*Table) (result []*contractTable) {
+	byName := make(map[string]*Table)
+	for _, tb := range tables {
+		byName[tb.Name] = tb
+	}
+	for _, tb := range tables {
+		if tb.Pk == "" {
+			continue
+		}
+		ct := &contractTable{Name: utils.CamelCase(tb.Name), Table: tb}
+		for _, col := range tb.Columns {
+			_, goType := columnSchema(col, byName)
+			ct.Fields = append(ct.Fields, &contractField{
+				Name:     utils.CamelCase(col.Tag.Column),
+				Column:   col.Tag.Column,
+				GoType:   goType,
+				Required: !col.Tag.Null,
+			})
+		}
+		result = append(result, ct)
+	}
+	return
+}
+
+// contractDocument returns the OpenAPI 3 contract of the REST API of the tables
+func contractDocument(tables []*Table) yaml.MapSlice {
+	byName := make(map[string]*Table)
+	for _, tb := range tables {
+		byName[tb.Name] = tb
+	}
+	ref := func(name string) yaml.MapSlice {
+		return yaml.MapSlice{{Key: "$ref", Value: "#/components/schemas/" + name}}
+	}
+	jsonContent := func(schema interface{}) yaml.MapSlice {
+		return yaml.MapSlice{{Key: "application/json", Value: yaml.MapSlice{{Key: "schema", Value: schema}}}}
+	}
+	response := func(description string, schema interface{}) yaml.MapSlice {
+		return yaml.MapSlice{{Key: "description", Value: description}, {Key: "content", Value: jsonContent(schema)}}
+	}
+	errorResponse := yaml.MapSlice{{Key: "$ref", Value: "#/components/responses/Error"}}
+	queryParam := func(name, description string, schema yaml.MapSlice) yaml.MapSlice {
+		return yaml.MapSlice{{Key: "name", Value: name}, {Key: "in", Value: "query"}, {Key: "description", Value: description}, {Key: "schema", Value: schema}}
+	}
+	int64Schema, _ := contractSchema("int64")
+	stringSchema, _ := contractSchema("string")
+
+	var paths, schemas yaml.MapSlice
+	for _, ct := range newContractTables(tables) {
+		identity := make(map[*Column]bool)
+		for _, col := range ct.IdentityColumns() {
+			identity[col] = true
+		}
+		var required []string
+		var properties yaml.MapSlice
+		for i, col := range ct.Columns {
+			schema, _ := columnSchema(col, byName)
+			if col.Tag.Null {
+				schema = append(schema, yaml.MapItem{Key: "nullable", Value: true})
+			}
+			if identity[col] {
+				// set by the database, only required in the responses
+				schema = append(schema, yaml.MapItem{Key: "readOnly", Value: true})
+			}
+			if col.Tag.Comment != "" {
+				schema = append(schema, yaml.MapItem{Key: "description", Value: col.Tag.Comment})
+			}
+			if ct.Fields[i].Required {
+				required = append(required, col.Tag.Column)
+			}
+			properties = append(properties, yaml.MapItem{Key: col.Tag.Column, Value: schema})
+		}
+		schema := yaml.MapSlice{{Key: "type", Value: "object"}}
+		if len(required) > 0 {
+			schema = append(schema, yaml.MapItem{Key: "required", Value: required})
+		}
+		schemas = append(schemas, yaml.MapItem{Key: ct.Name, Value: append(schema, yaml.MapItem{Key: "properties", Value: properties})})
+
+		tags := []string{ct.Table.Name}
+		var collection, item yaml.MapSlice
+		if ct.Allows("get") {
+			collection = append(collection, yaml.MapItem{Key: "get", Value: yaml.MapSlice{
+				{Key: "operationId", Value: "list" + ct.Name},
+				{Key: "tags", Value: tags},
+				{Key: "parameters", Value: []yaml.MapSlice{
+					queryParam("query", "Filter, e.g. col1:v1,col2:v2", stringSchema),
+					queryParam("sortby", "Sorted-by columns, e.g. col1,col2", stringSchema),
+					queryParam("order", "Order of each sortby column, e.g. desc,asc", stringSchema),
+					queryParam("limit", "Size of the page", int64Schema),
+					queryParam("offset", "Start of the page", int64Schema),
+				}},
+				{Key: "responses", Value: yaml.MapSlice{
+					{Key: "200", Value: append(response("The page of "+ct.Table.Name, yaml.MapSlice{{Key: "type", Value: "array"}, {Key: "items", Value: ref(ct.Name)}}),
+						yaml.MapItem{Key: "headers", Value: yaml.MapSlice{{Key: "X-Total-Count", Value: yaml.MapSlice{{Key: "schema", Value: int64Schema}}}}})},
+					{Key: "default", Value: errorResponse},
+				}},
+			}})
+		}
+		if ct.Allows("post") {
+			collection = append(collection, yaml.MapItem{Key: "post", Value: yaml.MapSlice{
+				{Key: "operationId", Value: "create" + ct.Name},
+				{Key: "tags", Value: tags},
+				{Key: "requestBody", Value: yaml.MapSlice{{Key: "required", Value: true}, {Key: "content", Value: jsonContent(ref(ct.Name))}}},
+				{Key: "responses", Value: yaml.MapSlice{
+					{Key: "201", Value: response("The created record", ref(ct.Name))},
+					{Key: "default", Value: errorResponse},
+				}},
+			}})
+		}
+		if ct.Allows("get") {
+			item = append(item, yaml.MapItem{Key: "get", Value: yaml.MapSlice{
+				{Key: "operationId", Value: "get" + ct.Name},
+				{Key: "tags", Value: tags},
+				{Key: "responses", Value: yaml.MapSlice{
+					{Key: "200", Value: response("The record", ref(ct.Name))},
+					{Key: "default", Value: errorResponse},
+				}},
+			}})
+		}
+		if ct.Allows("put") {
+			item = append(item, yaml.MapItem{Key: "put", Value: yaml.MapSlice{
+				{Key: "operationId", Value: "update" + ct.Name},
+				{Key: "tags", Value: tags},
+				{Key: "requestBody", Value: yaml.MapSlice{{Key: "required", Value: true}, {Key: "content", Value: jsonContent(ref(ct.Name))}}},
+				{Key: "responses", Value: yaml.MapSlice{
+					{Key: "200", Value: response("OK", stringSchema)},
+					{Key: "default", Value: errorResponse},
+				}},
+			}})
+		}
+		if ct.Allows("delete") {
+			item = append(item, yaml.MapItem{Key: "delete", Value: yaml.MapSlice{
+				{Key: "operationId", Value: "delete" + ct.Name},
+				{Key: "tags", Value: tags},
+				{Key: "responses", Value: yaml.MapSlice{
+					{Key: "200", Value: response("OK", stringSchema)},
+					{Key: "default", Value: errorResponse},
+				}},
+			}})
+		}
+		if len(collection) > 0 {
+			paths = append(paths, yaml.MapItem{Key: resourcePath(ct.Table.Name), Value: collection})
+		}
+		if len(item) > 0 {
+			pkSchema, _ := contractSchema(ct.PkType)
+			idParam := yaml.MapSlice{{Key: "name", Value: "id"}, {Key: "in", Value: "path"}, {Key: "required", Value: true}, {Key: "schema", Value: pkSchema}}
+			item = append(yaml.MapSlice{{Key: "parameters", Value: []yaml.MapSlice{idParam}}}, item...)
+			paths = append(paths, yaml.MapItem{Key: resourcePath(ct.Table.Name) + "/{id}", Value: item})
+		}
+	}
+
+	return yaml.MapSlice{
+		{Key: "openapi", Value: "3.0.3"},
+		{Key: "info", Value: yaml.MapSlice{{Key: "title", Value: "API"}, {Key: "version", Value: "1.0.0"}}},
+		{Key: "servers", Value: []yaml.MapSlice{{{Key: "url", Value: "/" + strings.TrimPrefix(versionPrefix(), "/")}}}},
+		{Key: "paths", Value: paths},
+		{Key: "components", Value: yaml.MapSlice{
+			{Key: "schemas", Value: schemas},
+			{Key: "responses", Value: yaml.MapSlice{
+				{Key: "Error", Value: response("The error message", stringSchema)},
+			}},
+		}},
+	}
+}
+
+// writeContractFiles generates the OpenAPI contract of the tables, the types
+// oapi-codegen would generate for it and the oapi-codegen configuration generating
+// the server interface around them
+func writeContractFiles(tables []*Table, aPath string) {
+	data, err := yaml.Marshal(contractDocument(tables))
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not encode the OpenAPI contract: %s", err)
+	}
+	writeGeneratedFile(path.Join(aPath, "openapi.yaml"), "# Code generated by hee from the database schema.\n"+string(data))
+
+	ctables := newContractTables(tables)
+	importTime, importTypes := false, false
+	for _, ct := range ctables {
+		for _, f := range ct.Fields {
+			importTime = importTime || f.GoType == "time.Time"
+			importTypes = importTypes || strings.HasPrefix(f.GoType, "openapi_types.")
+		}
+	}
+	writeGeneratedFile(path.Join(aPath, "types.go"), executeTemplate(ContractTypesTPL, map[string]interface{}{
+		"Tables":      ctables,
+		"ImportTime":  importTime,
+		"ImportTypes": importTypes,
+	}))
+	yamlStr := strings.Replace(OapiCodegenTPL, "{{dir}}", path.Base(aPath), -1)
+	writeGeneratedFile(path.Join(aPath, "oapi-codegen.yaml"), yamlStr)
+}
+
+const (
+	ContractTypesTPL = `// Code generated by hee from the database schema, DO NOT EDIT.
+
+// Package api holds the types oapi-codegen generates from openapi.yaml, the server
+// interface being generated with oapi-codegen.yaml.
+package api
+{{if or .ImportTime .ImportTypes}}
+import (
+{{if .ImportTime}}	"time"
+{{end}}{{if .ImportTypes}}
+	openapi_types "github.com/oapi-codegen/runtime/types"
+{{end}})
+{{end}}{{range .Tables}}
+// {{.Name}} defines model for {{.Name}}.
+type {{.Name}} struct {
+{{range .Fields}}{{if .Required}}	{{.Name}} {{.GoType}} ` + "`" + `json:"{{.Column}}"` + "`" + `
+{{else}}	{{.Name}} *{{.GoType}} ` + "`" + `json:"{{.Column}},omitempty"` + "`" + `
+{{end}}{{end}}}
+{{if .Allows "get"}}
+// List{{.Name}}Params defines parameters for List{{.Name}}.
+type List{{.Name}}Params struct {
+	// Query Filter, e.g. col1:v1,col2:v2
+	Query *string ` + "`" + `form:"query,omitempty" json:"query,omitempty"` + "`" + `
+
+	// Sortby Sorted-by columns, e.g. col1,col2
+	Sortby *string ` + "`" + `form:"sortby,omitempty" json:"sortby,omitempty"` + "`" + `
+
+	// Order Order of each sortby column, e.g. desc,asc
+	Order *string ` + "`" + `form:"order,omitempty" json:"order,omitempty"` + "`" + `
+
+	// Limit Size of the page
+	Limit *int64 ` + "`" + `form:"limit,omitempty" json:"limit,omitempty"` + "`" + `
+
+	// Offset Start of the page
+	Offset *int64 ` + "`" + `form:"offset,omitempty" json:"offset,omitempty"` + "`" + `
+}
+{{end}}{{if .Allows "post"}}
+// Create{{.Name}}JSONRequestBody defines body for Create{{.Name}} for application/json ContentType.
+type Create{{.Name}}JSONRequestBody = {{.Name}}
+{{end}}{{if .Allows "put"}}
+// Update{{.Name}}JSONRequestBody defines body for Update{{.Name}} for application/json ContentType.
+type Update{{.Name}}JSONRequestBody = {{.Name}}
+{{end}}{{end}}`
+	OapiCodegenTPL = `# Code generated by hee. Generates the server interface of openapi.yaml around the
+# types of types.go, from the application directory:
+#   go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -config {{dir}}/oapi-codegen.yaml {{dir}}/openapi.yaml
+package: api
+output: {{dir}}/server.gen.go
+generate:
+  models: false
+  std-http-server: true
+`
+)
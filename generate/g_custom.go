@@ -0,0 +1,72 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/skOak/hee/utils"
+)
+
+// customFileName returns the name of the controller file of a table holding the
+// endpoints written by hand, e.g. user_custom
+func customFileName(tableName string) string {
+	return appcodeFileName(tableName, "_custom")
+}
+
+// writeCustomCtrlFile creates the custom controller file of a table, once as it
+// belongs to the user afterwards
+func writeCustomCtrlFile(tb *Table, cPath string) {
+	fpath := path.Join(cPath, customFileName(tb.Name)+".go")
+	if utils.IsExist(fpath) {
+		return
+	}
+	fileStr := strings.Replace(CustomCtrlTPL, "{{ctrlName}}", utils.CamelCase(tb.Name), -1)
+	writeGeneratedFile(fpath, strings.Replace(fileStr, "{{tableName}}", tb.Name, -1))
+}
+
+// customRouted reports whether a table has a custom controller to be routed
+// with its generated controller
+func customRouted(table, rPath string) bool {
+	return utils.IsExist(filepath.Join(controllersDir(rPath), customFileName(table)+".go"))
+}
+
+const CustomCtrlTPL = `package controllers
+
+import (
+	"github.com/astaxie/beego"
+)
+
+// {{ctrlName}}CustomController serves the endpoints of {{tableName}} written by hand,
+// routed under the same namespace as {{ctrlName}}Controller with the same annotations.
+// This file is only created by generate appcode when missing, it survives regeneration.
+type {{ctrlName}}CustomController struct {
+	beego.Controller
+}
+
+// URLMapping ...
+func (c *{{ctrlName}}CustomController) URLMapping() {
+	// c.Mapping("Approve", c.Approve)
+}
+
+// Approve ...
+// @Title Approve
+// @Description an example of custom endpoint, served at POST <namespace>/:id/approve once uncommented
+// @router /:id/approve [post]
+// func (c *{{ctrlName}}CustomController) Approve() {
+// }
+`
@@ -0,0 +1,140 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+var (
+	debugDir     string // directory of the dumps, created by the first one
+	debugRenders int    // number of the last dump
+)
+
+// templateName names the template rendered by the caller of executeTemplate after
+// the function calling it, e.g. writeModelFiles
+func templateName() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "template"
+	}
+	name := runtime.FuncForPC(pc).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	return name[strings.Index(name, ".")+1:]
+}
+
+// debugTemplate dumps the data of a render of the template name, plus the template
+// and its partial output when err is set. The returned error quotes the lines of
+// the template err is about.
+func debugTemplate(name, tpl string, data interface{}, out string, err error) error {
+	base := debugFile(name)
+	if base == "" {
+		return err
+	}
+	if js, jerr := json.MarshalIndent(data, "", "  "); jerr != nil {
+		beeLogger.Log.Warnf("Could not dump the data of template %s: %s", name, jerr)
+	} else {
+		writeDebugFile(base+".json", js)
+	}
+	if err == nil {
+		return nil
+	}
+	writeDebugFile(base+".tpl", []byte(tpl))
+	writeDebugFile(base+".out", []byte(out))
+	beeLogger.Log.Errorf("Template %s failed, its data, source and partial output are in %s.*", name, base)
+	return fmt.Errorf("%s\n%s", err, excerpt(tpl, templateErrorLine(name, err)))
+}
+
+// debugSource dumps the generated source of fpath which isn't valid Go, the
+// returned error quoting the lines err is about
+func debugSource(fpath, content string, err error) error {
+	base := debugFile(path.Base(fpath))
+	if base == "" {
+		return err
+	}
+	writeDebugFile(base, []byte(content))
+	beeLogger.Log.Errorf("The source of '%s' isn't valid Go, it is in %s", fpath, base)
+	line := 0
+	if m := sourceErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ = strconv.Atoi(m[1])
+	}
+	return fmt.Errorf("%s\n%s", err, excerpt(content, line))
+}
+
+var sourceErrorLine = regexp.MustCompile(`^(\d+):\d+: `)
+
+// templateErrorLine returns the line of the template name err is about, 0 if unknown
+func templateErrorLine(name string, err error) int {
+	m := regexp.MustCompile(`template: ` + regexp.QuoteMeta(name) + `:(\d+)`).FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// excerpt returns the lines of src around line, numbered and pointing at line
+func excerpt(src string, line int) string {
+	if line <= 0 {
+		return ""
+	}
+	lines := strings.Split(src, "\n")
+	var b strings.Builder
+	for i := line - 3; i < line+2 && i < len(lines); i++ {
+		if i < 0 {
+			continue
+		}
+		mark := "  "
+		if i == line-1 {
+			mark = "> "
+		}
+		fmt.Fprintf(&b, "%s%5d | %s\n", mark, i+1, lines[i])
+	}
+	return b.String()
+}
+
+// debugFile returns the base path of the next dump, creating the temporary
+// directory of the dumps first. It returns an empty string unless DebugTemplates.
+func debugFile(name string) string {
+	if !DebugTemplates {
+		return ""
+	}
+	if debugDir == "" {
+		dir, err := ioutil.TempDir("", "hee-templates-")
+		if err != nil {
+			beeLogger.Log.Warnf("Could not create the directory of the template dumps: %s", err)
+			return ""
+		}
+		debugDir = dir
+		beeLogger.Log.Infof("Dumping the template data to '%s'", debugDir)
+	}
+	debugRenders++
+	return path.Join(debugDir, fmt.Sprintf("%04d-%s", debugRenders, name))
+}
+
+func writeDebugFile(fpath string, data []byte) {
+	if err := ioutil.WriteFile(fpath, data, 0644); err != nil {
+		beeLogger.Log.Warnf("Could not write '%s': %s", fpath, err)
+	}
+}
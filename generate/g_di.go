@@ -0,0 +1,152 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// Dependency injection frameworks of Appcode.DI
+const (
+	DIWire = "wire" // google/wire provider sets
+	DIFx   = "fx"   // uber/fx module
+)
+
+// diFramework returns the dependency injection framework of the generated application,
+// an empty string when the handlers read models.DB()
+func diFramework() string {
+	switch di := strings.ToLower(config.Conf.Appcode.DI); di {
+	case "", DIWire, DIFx:
+		return di
+	}
+	beeLogger.Log.Fatalf("Invalid dependency injection '%s'. Must be either \"wire\" or \"fx\"", config.Conf.Appcode.DI)
+	return ""
+}
+
+// diEnabled reports whether the database is injected into the handlers
+func diEnabled() bool {
+	return diFramework() != ""
+}
+
+// writeDIFile generates the di package next to the handlers, providing the database
+// and the handlers with the framework of Appcode.DI
+func writeDIFile(hPath, pkgPath string) {
+	dir := path.Join(path.Dir(hPath), "di")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		beeLogger.Log.Fatalf("Could not create directory '%s': %s", dir, err)
+	}
+	tpl := DIWireTPL
+	if diFramework() == DIFx {
+		tpl = DIFxTPL
+	}
+	writeGeneratedFile(path.Join(dir, "di.go"), strings.Replace(tpl, "{{pkgPath}}", pkgPath, -1))
+}
+
+const (
+	DIWireTPL = `package di
+
+import (
+	"net/http"
+
+	"{{pkgPath}}/handlers"
+	"{{pkgPath}}/models"
+
+	"github.com/google/wire"
+	"github.com/jinzhu/gorm"
+)
+
+// DBConfig is the connection to the database of the models
+type DBConfig struct {
+	Dialect   string // e.g. mysql
+	Conn      string
+	LogDetail bool
+}
+
+// ProviderSet provides the database, the handlers of the tables and the mux routing
+// the requests to them out of a DBConfig, e.g. to the injector of main:
+//
+//	func initMux(cfg di.DBConfig) (*http.ServeMux, func(), error) {
+//		wire.Build(di.ProviderSet)
+//		return nil, nil, nil
+//	}
+var ProviderSet = wire.NewSet(ProvideDB, handlers.NewHandlers, ProvideMux)
+
+// ProvideDB opens the database of the models, closed by the returned cleanup
+func ProvideDB(cfg DBConfig) (*gorm.DB, func(), error) {
+	if err := models.Open(cfg.Dialect, cfg.Conn, cfg.LogDetail); err != nil {
+		return nil, nil, err
+	}
+	db := models.DB()
+	return db, func() { models.Close() }, nil
+}
+
+// ProvideMux routes the requests to the handlers of the tables
+func ProvideMux(h *handlers.Handlers) *http.ServeMux {
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+`
+	DIFxTPL = `package di
+
+import (
+	"context"
+	"net/http"
+
+	"{{pkgPath}}/handlers"
+	"{{pkgPath}}/models"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/fx"
+)
+
+// DBConfig is the connection to the database of the models
+type DBConfig struct {
+	Dialect   string // e.g. mysql
+	Conn      string
+	LogDetail bool
+}
+
+// Module provides the database, the handlers of the tables and the mux routing the
+// requests to them out of a DBConfig, e.g.
+//
+//	fx.New(di.Module, fx.Supply(di.DBConfig{Dialect: "mysql", Conn: conn}), fx.Invoke(serve)).Run()
+var Module = fx.Module("di", fx.Provide(ProvideDB, handlers.NewHandlers, ProvideMux))
+
+// ProvideDB opens the database of the models, closed when the application stops
+func ProvideDB(lc fx.Lifecycle, cfg DBConfig) (*gorm.DB, error) {
+	if err := models.Open(cfg.Dialect, cfg.Conn, cfg.LogDetail); err != nil {
+		return nil, err
+	}
+	db := models.DB()
+	lc.Append(fx.Hook{OnStop: func(context.Context) error {
+		return models.Close()
+	}})
+	return db, nil
+}
+
+// ProvideMux routes the requests to the handlers of the tables
+func ProvideMux(h *handlers.Handlers) *http.ServeMux {
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return mux
+}
+`
+)
@@ -0,0 +1,135 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// writeDiagram writes the ER diagram of the tables to file, relative to apppath,
+// in the Graphviz dot format when its extension is .dot or .gv and in the
+// Mermaid format otherwise
+func writeDiagram(tables []*Table, file, apppath string) {
+	if !filepath.IsAbs(file) {
+		file = path.Join(apppath, file)
+	}
+	var content string
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".dot", ".gv":
+		content = dotDiagram(tables)
+	default:
+		content = mermaidDiagram(tables)
+	}
+	writeGeneratedFile(file, content)
+}
+
+// mermaidDiagram returns the erDiagram of the tables, a relationship per foreign key
+func mermaidDiagram(tables []*Table) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("erDiagram\n")
+	for _, tb := range tables {
+		fmt.Fprintf(buf, "    %s {\n", tb.Name)
+		for _, col := range tb.Columns {
+			var keys []string
+			if col.Tag.Column == tb.Pk {
+				keys = append(keys, "PK")
+			}
+			if _, ok := tb.Fk[col.Tag.Column]; ok {
+				keys = append(keys, "FK")
+			}
+			fmt.Fprintf(buf, "        %s\n", strings.TrimSpace(diagramType(col)+" "+col.Tag.Column+" "+strings.Join(keys, ",")))
+		}
+		buf.WriteString("    }\n")
+	}
+	for _, tb := range tables {
+		for _, column := range fkColumns(tb) {
+			fk := tb.Fk[column]
+			// a nullable foreign key column makes the referenced row optional
+			ref := "||"
+			if col := tb.Column(column); col != nil && col.Tag.Null {
+				ref = "|o"
+			}
+			fmt.Fprintf(buf, "    %s %s--o{ %s : %q\n", fk.RefTable, ref, tb.Name, column)
+		}
+	}
+	return buf.String()
+}
+
+// dotDiagram returns the digraph of the tables, a record node per table and an
+// edge per foreign key
+func dotDiagram(tables []*Table) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("digraph erd {\n")
+	buf.WriteString("    rankdir=LR;\n")
+	buf.WriteString("    node [shape=record, fontsize=10];\n")
+	for _, tb := range tables {
+		var fields []string
+		for _, col := range tb.Columns {
+			field := dotEscape(col.Tag.Column) + " : " + dotEscape(diagramType(col))
+			if col.Tag.Column == tb.Pk {
+				field += " (PK)"
+			}
+			fields = append(fields, field+`\l`)
+		}
+		fmt.Fprintf(buf, "    %q [label=\"{%s|%s}\"];\n", tb.Name, dotEscape(tb.Name), strings.Join(fields, ""))
+	}
+	for _, tb := range tables {
+		for _, column := range fkColumns(tb) {
+			fmt.Fprintf(buf, "    %q -> %q [label=%q];\n", tb.Name, tb.Fk[column].RefTable, column)
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// diagramType returns the type of the column in the database as a single word
+func diagramType(col *Column) string {
+	t := col.SQLType
+	if t == "" {
+		t = col.Type
+	}
+	if i := strings.Index(t, "("); i > 0 {
+		t = t[:i]
+	}
+	// both formats expect a word, e.g. double_precision or time_Time
+	word := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(t))
+	return strings.Trim(word, "_")
+}
+
+// dotEscape escapes the characters of the record labels of dot
+func dotEscape(s string) string {
+	return strings.NewReplacer(`{`, `\{`, `}`, `\}`, `|`, `\|`, `<`, `\<`, `>`, `\>`, `"`, `\"`).Replace(s)
+}
+
+// fkColumns returns the foreign key columns of the table, sorted
+func fkColumns(tb *Table) []string {
+	var columns []string
+	for column := range tb.Fk {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
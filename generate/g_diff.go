@@ -0,0 +1,131 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// restrictToTarget diffs the introspected tables against the schema of the target
+// database and keeps the tables and columns present in both, so that the generated
+// code works against either of them. Every mismatch is reported.
+func restrictToTarget(dbms, targetConn string, trans DbTransformer, tables []*Table) (kept []*Table) {
+	target, err := openSchemaCache(dbms, targetConn)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", dbms, config.RedactSecrets(targetConn), err)
+	}
+	defer target.Close()
+
+	targetNames := make(map[string]bool)
+	for _, name := range trans.GetTableNames(target) {
+		targetNames[name] = true
+	}
+	var names []string
+	for _, tb := range tables {
+		if targetNames[tb.Name] {
+			names = append(names, tb.Name)
+		} else {
+			beeLogger.Log.Warnf("Table '%s' is missing in the target database, skipping it", tb.Name)
+		}
+	}
+	targetTables := make(map[string]*Table)
+	for _, tb := range getTableObjects(names, target, trans) {
+		targetTables[tb.Name] = tb
+	}
+
+	dropped := make(map[string]*Table)
+	for _, tb := range tables {
+		ttb, ok := targetTables[tb.Name]
+		if !ok {
+			dropped[tb.Name] = tb
+			continue
+		}
+		if ttb.Pk != tb.Pk {
+			beeLogger.Log.Warnf("Table '%s' has primary key '%s' in the target database instead of '%s', skipping it", tb.Name, ttb.Pk, tb.Pk)
+			dropped[tb.Name] = tb
+			continue
+		}
+		restrictColumns(tb, ttb)
+		kept = append(kept, tb)
+	}
+	unlinkDropped(kept, dropped)
+	return
+}
+
+// unlinkDropped turns the foreign keys of the kept tables referencing a dropped
+// table into plain columns, the model of the referenced table not being generated
+func unlinkDropped(kept []*Table, dropped map[string]*Table) {
+	for _, tb := range kept {
+		for _, col := range tb.Columns {
+			ref, ok := dropped[col.Tag.TableFk]
+			if !col.Tag.RelFk || !ok {
+				continue
+			}
+			fk := tb.Fk[col.Tag.Column]
+			col.Type = ref.PkType
+			if fk != nil && fk.RefColumn != ref.Pk {
+				if refCol := ref.Column(fk.RefColumn); refCol != nil && !refCol.Tag.RelFk {
+					col.Type = refCol.Type
+				}
+			}
+			col.Tag.RelFk, col.Tag.TableFk = false, ""
+			col.Tag.Null, col.Tag.FkNull = col.Tag.FkNull, false
+			delete(tb.Fk, col.Tag.Column)
+			beeLogger.Log.Warnf("Column '%s.%s' references the skipped table '%s', generating it as a plain column", tb.Name, col.Tag.Column, ref.Name)
+		}
+	}
+}
+
+// restrictColumns removes the columns of tb missing in ttb, the same table
+// in the target database
+func restrictColumns(tb, ttb *Table) {
+	var columns []*Column
+	dropped := make(map[string]bool)
+	for _, col := range tb.Columns {
+		tcol := ttb.Column(col.Tag.Column)
+		if tcol == nil {
+			beeLogger.Log.Warnf("Column '%s.%s' is missing in the target database, skipping it", tb.Name, col.Tag.Column)
+			dropped[col.Tag.Column] = true
+			continue
+		}
+		if tcol.SQLType != col.SQLType {
+			beeLogger.Log.Warnf("Column '%s.%s' is %s in the target database instead of %s", tb.Name, col.Tag.Column, tcol.SQLType, col.SQLType)
+		}
+		columns = append(columns, col)
+	}
+	for _, tcol := range ttb.Columns {
+		if tb.Column(tcol.Tag.Column) == nil {
+			beeLogger.Log.Warnf("Column '%s.%s' only exists in the target database", tb.Name, tcol.Tag.Column)
+		}
+	}
+	tb.Columns = columns
+
+	if dropped["is_deleted"] {
+		tb.IdDelete = false
+	}
+	var uks []string
+	for _, uk := range tb.Uk {
+		if !dropped[uk] {
+			uks = append(uks, uk)
+		}
+	}
+	tb.Uk = uks
+	for name := range tb.Fk {
+		if dropped[name] {
+			delete(tb.Fk, name)
+		}
+	}
+}
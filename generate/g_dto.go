@@ -0,0 +1,219 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// dtoVersionName matches the versions of the API, which are the names of their packages
+var dtoVersionName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// dtoImports maps the packages of the model field types to their import paths
+var dtoImports = map[string]string{
+	"time":   "time",
+	"pgtype": "github.com/jackc/pgtype",
+	"mssql":  "github.com/denisenkom/go-mssqldb",
+	"gorm":   "gorm.io/gorm",
+}
+
+// apiVersioned reports whether DTOs are generated for former versions of the API
+func apiVersioned() bool {
+	return len(config.Conf.Appcode.ApiVersions) > 0
+}
+
+// dtoTable is the record of a table as served by a former version of the API
+type dtoTable struct {
+	Version  string
+	Previous string // version before Version, converted to and from
+	Snapshot string
+	PkgPath  string
+	Model    string
+	Table    string
+	Fields   []*dtoField
+	Added    []string // columns added since the snapshot, left out
+	Imports  []string
+}
+
+// dtoField is a column of a DTO
+type dtoField struct {
+	Name    string // field of the DTO
+	Column  string // column in the snapshot, the JSON key
+	Type    string
+	Field   string // field of the model
+	Renamed string // column of the model when renamed since the snapshot
+}
+
+// writeDtoFiles generates a package per version of ApiVersions, dto/<version>, holding
+// the records of the tables with the columns of the snapshot of the version, and their
+// conversions from and to the models and the DTOs of the previous version
+func writeDtoFiles(tables []*Table, pkgPath, apppath string) {
+	versions := make([]string, 0, len(config.Conf.Appcode.ApiVersions))
+	for version, conf := range config.Conf.Appcode.ApiVersions {
+		if !dtoVersionName.MatchString(version) {
+			beeLogger.Log.Fatalf("Invalid API version '%s', it must be a package name, e.g. v1", version)
+		}
+		if conf.Snapshot == "" {
+			beeLogger.Log.Fatalf("API version '%s' has no snapshot", version)
+		}
+		versions = append(versions, version)
+	}
+	// snapshot names are dated, the versions follow their snapshots
+	sort.Slice(versions, func(i, j int) bool {
+		si, sj := config.Conf.Appcode.ApiVersions[versions[i]].Snapshot, config.Conf.Appcode.ApiVersions[versions[j]].Snapshot
+		return si < sj || si == sj && versions[i] < versions[j]
+	})
+	inVersion := make(map[string]bool)
+	for i, version := range versions {
+		conf := config.Conf.Appcode.ApiVersions[version]
+		name := strings.TrimSuffix(conf.Snapshot, ".json") + ".json"
+		snapshot, err := readSnapshot(apppath, name)
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not read schema snapshot '%s' of API version '%s': %s", name, version, err)
+		}
+		dir := path.Join(apppath, "dto", version)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			beeLogger.Log.Fatalf("Could not create directory '%s': %s", dir, err)
+		}
+		for _, tb := range tables {
+			ts, ok := snapshot.Tables[tb.Name]
+			if !ok || tb.Pk == "" {
+				continue
+			}
+			dto := newDtoTable(tb, ts, version, conf.Renames[tb.Name])
+			dto.Snapshot, dto.PkgPath = strings.TrimSuffix(name, ".json"), pkgPath
+			if i > 0 && inVersion[versions[i-1]+"."+tb.Name] {
+				dto.Previous = versions[i-1]
+			}
+			inVersion[version+"."+tb.Name] = true
+			writeGeneratedFile(path.Join(dir, appcodeFileName(tb.Name, "")+".go"), executeTemplate(DtoTPL, dto))
+		}
+	}
+}
+
+// newDtoTable maps the columns of the snapshot of a table to the fields of its model,
+// renames holding the columns renamed since the snapshot
+func newDtoTable(tb *Table, ts *tableSnapshot, version string, renames map[string]string) *dtoTable {
+	dto := &dtoTable{Version: version, Model: utils.CamelCase(tb.Name), Table: tb.Name}
+	for old := range renames {
+		if ts.column(old) == nil {
+			beeLogger.Log.Fatalf("Column '%s' renamed in API version '%s' isn't a column of table '%s' in its snapshot", old, version, tb.Name)
+		}
+	}
+	kept := make(map[string]bool)
+	names := make(map[string]bool)
+	imports := make(map[string]bool)
+	for _, sc := range ts.Columns {
+		column := sc.Name
+		if renamed, ok := renames[sc.Name]; ok {
+			column = renamed
+		}
+		col := tb.Column(column)
+		if col == nil {
+			beeLogger.Log.Warnf("Column '%s' of table '%s' in API version '%s' has been dropped, it is left out of its DTO", sc.Name, tb.Name, version)
+			continue
+		}
+		kept[column] = true
+		f := &dtoField{Name: col.Name, Column: sc.Name, Type: dtoType(col.Type), Field: col.Name}
+		if column != sc.Name {
+			f.Name, f.Renamed = utils.CamelCase(sc.Name), column
+		}
+		if names[f.Name] {
+			beeLogger.Log.Fatalf("Two columns of table '%s' in API version '%s' would both be field %s of its DTO", tb.Name, version, f.Name)
+		}
+		names[f.Name] = true
+		if i := strings.Index(f.Type, "."); i >= 0 {
+			if pkg := strings.TrimLeft(f.Type[:i], "*[]"); pkg != "models" {
+				imports[dtoImports[pkg]] = true
+			}
+		}
+		dto.Fields = append(dto.Fields, f)
+	}
+	for _, col := range tb.Columns {
+		if !kept[col.Tag.Column] {
+			dto.Added = append(dto.Added, col.Tag.Column)
+		}
+	}
+	for imp := range imports {
+		dto.Imports = append(dto.Imports, imp)
+	}
+	sort.Strings(dto.Imports)
+	return dto
+}
+
+// dtoType qualifies the types of the models package used by a model field,
+// e.g. *UserAccounts => *models.UserAccounts
+func dtoType(t string) string {
+	base := strings.TrimLeft(t, "*[]")
+	if strings.Contains(base, ".") || base == "" || base[0] < 'A' || base[0] > 'Z' {
+		return t
+	}
+	return t[:len(t)-len(base)] + "models." + base
+}
+
+const DtoTPL = `package {{.Version}}
+
+import (
+{{range .Imports}}	"{{.}}"
+{{end}}
+	"{{.PkgPath}}/models"{{if .Previous}}
+	"{{.PkgPath}}/dto/{{.Previous}}"{{end}}
+)
+
+// {{.Model}} is the record of {{.Table}} as served by the {{.Version}} API, made of the columns
+// of schema snapshot {{.Snapshot}}{{if .Added}}. The columns added since then are left out:
+// {{join .Added ", "}}{{end}}
+type {{.Model}} struct {
+{{range .Fields}}	{{.Name}} {{.Type}} ` + "`" + `json:"{{.Column}}"` + "`" + `{{if .Renamed}} // renamed {{.Renamed}} after {{$.Version}}{{end}}
+{{end}}}
+
+// From{{.Model}} returns m as served by the {{.Version}} API
+func From{{.Model}}(m *models.{{.Model}}) *{{.Model}} {
+	return &{{.Model}}{
+{{range .Fields}}		{{.Name}}: m.{{.Field}},
+{{end}}	}
+}
+
+// ApplyTo copies the columns held by d to m, the columns added since {{.Version}} keeping
+// the values of m, e.g. to update a record read before
+func (d *{{.Model}}) ApplyTo(m *models.{{.Model}}) {
+{{range .Fields}}	m.{{.Field}} = d.{{.Name}}
+{{end}}}
+
+// To{{.Model}} returns the model of d, the columns added since {{.Version}} being zero
+func (d *{{.Model}}) To{{.Model}}() *models.{{.Model}} {
+	m := new(models.{{.Model}})
+	d.ApplyTo(m)
+	return m
+}
+{{if .Previous}}
+// From{{camelCase .Previous}}{{.Model}} converts the {{.Previous}} record p to {{.Version}}
+func From{{camelCase .Previous}}{{.Model}}(p *{{.Previous}}.{{.Model}}) *{{.Model}} {
+	return From{{.Model}}(p.To{{.Model}}())
+}
+
+// To{{camelCase .Previous}} converts d to a {{.Previous}} record
+func (d *{{.Model}}) To{{camelCase .Previous}}() *{{.Previous}}.{{.Model}} {
+	return {{.Previous}}.From{{.Model}}(d.To{{.Model}}())
+}
+{{end}}`
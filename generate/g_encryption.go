@@ -0,0 +1,210 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// encryptedType is the generated type of the encrypted string columns
+const encryptedType = "EncryptedString"
+
+// applyEncryption switches the encrypted columns of the table from string to the
+// generated models.EncryptedString, encrypting them as they are written
+func applyEncryption(tb *Table, encrypted []string) {
+	for _, name := range encrypted {
+		col := tb.Column(name)
+		if col == nil {
+			beeLogger.Log.Warnf("Encrypted column '%s' not found in table '%s'", name, tb.Name)
+			continue
+		}
+		if col.BaseType() != "string" || name == tb.Pk || name == tb.TenantColumn {
+			beeLogger.Log.Fatalf("Column '%s.%s' can't be encrypted, only string columns which are neither the primary key nor the tenant column can", tb.Name, name)
+		}
+		if size, err := strconv.Atoi(col.Tag.Size); err == nil {
+			if max := maxEncryptedValueSize(size); max < 0 {
+				beeLogger.Log.Warnf("Column '%s.%s' of size %d can't hold any encrypted value, which takes at least %d characters", tb.Name, name, size, encryptedSize(0))
+			} else {
+				beeLogger.Log.Infof("Column '%s.%s' of size %d holds the encrypted values of up to %d bytes", tb.Name, name, size, max)
+			}
+		}
+		col.Type = strings.Replace(col.Type, "string", encryptedType, 1)
+		col.Encrypted = true
+	}
+}
+
+// maxKeyIdSize is the length of the longest key id assumed when sizing the encrypted columns
+const maxKeyIdSize = 16
+
+// encryptedSize returns the length of the stored encrypted value of a string of size bytes:
+// the key id and its separator, then the base64 of the nonce, the value and the tag of AES-GCM
+func encryptedSize(size int) int {
+	return maxKeyIdSize + 1 + (12+size+16+2)/3*4
+}
+
+// maxEncryptedValueSize returns the length of the longest string whose encrypted value fits
+// in a column of size characters, -1 when none does
+func maxEncryptedValueSize(size int) int {
+	max := (size-maxKeyIdSize-1)/4*3 - 12 - 16
+	if max < 0 || size < encryptedSize(0) {
+		return -1
+	}
+	return max
+}
+
+// writeKeyFiles generates encryption.go holding models.EncryptedString when a column is
+// encrypted, integrity.go signing the records when a table is signed, and keys.go
+// holding the KeyProvider interface they share
+func writeKeyFiles(tables []*Table, mPath string) {
+	var encrypted, signed bool
+	for _, tb := range tables {
+		signed = signed || tb.SignatureColumn != ""
+		for _, col := range tb.Columns {
+			encrypted = encrypted || col.Encrypted
+		}
+	}
+	if encrypted {
+		writeGeneratedFile(path.Join(mPath, "encryption.go"), EncryptionTPL)
+	}
+	if signed {
+		writeGeneratedFile(path.Join(mPath, "integrity.go"), IntegrityTPL)
+	}
+	if encrypted || signed {
+		writeGeneratedFile(path.Join(mPath, "keys.go"), KeysTPL)
+	}
+}
+
+const KeysTPL = `package models
+
+// KeyProvider provides the keys of the encrypted columns or of the signed records.
+// The id of the key encrypting or signing a value is stored with it, so that keys
+// can be rotated.
+type KeyProvider interface {
+	// CurrentKey returns the key of the values being written and its id, which
+	// can't contain a colon
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of id, decrypting or verifying the values read
+	Key(id string) ([]byte, error)
+}
+`
+
+const EncryptionTPL = `package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNoKeyProvider is returned when reading or writing an encrypted column before SetKeyProvider
+var ErrNoKeyProvider = errors.New("no key provider of the encrypted columns")
+
+var keyProvider KeyProvider
+
+// SetKeyProvider sets the provider of the AES keys, 16, 24 or 32 bytes long, of the
+// encrypted columns, to be called before the models are used
+func SetKeyProvider(p KeyProvider) {
+	keyProvider = p
+}
+
+// EncryptedString is a string stored encrypted with AES-GCM as <key id>:<base64 of the nonce
+// and the sealed value>, which takes about (len + 28) * 4 / 3 bytes plus the key id. It is read and
+// written in clear by the models, but can't be compared in queries as its encryption varies.
+type EncryptedString string
+
+// Value implements driver.Valuer, encrypting s with the current key
+func (s EncryptedString) Value() (driver.Value, error) {
+	if keyProvider == nil {
+		return nil, ErrNoKeyProvider
+	}
+	id, key, err := keyProvider.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(s), nil)
+	return id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Scan implements sql.Scanner, decrypting the stored value with the key it was encrypted with
+func (s *EncryptedString) Scan(src interface{}) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case []byte:
+		stored = string(v)
+	case string:
+		stored = v
+	default:
+		return fmt.Errorf("can't scan %T into EncryptedString", src)
+	}
+	if keyProvider == nil {
+		return ErrNoKeyProvider
+	}
+	i := strings.Index(stored, ":")
+	if i < 0 {
+		return errors.New("encrypted value without key id")
+	}
+	key, err := keyProvider.Key(stored[:i])
+	if err != nil {
+		return err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(stored[i+1:])
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return errors.New("encrypted value too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// newGCM returns the AES-GCM cipher of key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+`
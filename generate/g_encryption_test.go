@@ -0,0 +1,34 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import "testing"
+
+// TestMaxEncryptedValueSize checks that the longest value of a column is the longest
+// whose encrypted value fits in it
+func TestMaxEncryptedValueSize(t *testing.T) {
+	for size := 0; size <= 512; size++ {
+		max := maxEncryptedValueSize(size)
+		if max < 0 && encryptedSize(0) <= size {
+			t.Errorf("size %d holds the empty value, encrypted in %d characters", size, encryptedSize(0))
+		}
+		if max >= 0 && (encryptedSize(max) > size || encryptedSize(max+1) <= size) {
+			t.Errorf("size %d holds values of up to %d bytes, encrypted in %d characters", size, max, encryptedSize(max))
+		}
+	}
+	if max := maxEncryptedValueSize(255); max != 149 {
+		t.Errorf("varchar(255) holds values of up to %d bytes, want 149", max)
+	}
+}
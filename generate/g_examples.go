@@ -0,0 +1,160 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// exampleRows is the number of rows sampled per table for the examples
+const exampleRows = 5
+
+// loremWords replace the words of the sampled texts
+var loremWords = strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor")
+
+// sampleExamples reads a few rows of each table and sets the anonymized values of their
+// columns as the examples of the model fields, which the generated API docs show
+func sampleExamples(dbms string, db *sql.DB, tables []*Table) {
+	quote := func(name string) string {
+		if dbms == "postgres" {
+			return `"` + name + `"`
+		} else if dbms == "mssql" {
+			return "[" + name + "]"
+		} else if dbms == "oracle" {
+			return `"` + strings.ToUpper(name) + `"`
+		}
+		return "`" + name + "`"
+	}
+	for _, tb := range tables {
+		if len(tb.Columns) == 0 {
+			continue
+		}
+		cols := make([]string, len(tb.Columns))
+		for i, col := range tb.Columns {
+			cols[i] = quote(col.Tag.Column)
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s LIMIT %d", strings.Join(cols, ", "), quote(tb.Name), exampleRows)
+		if dbms == "mssql" {
+			query = fmt.Sprintf("SELECT TOP %d %s FROM %s", exampleRows, strings.Join(cols, ", "), quote(tb.Name))
+		} else if dbms == "oracle" {
+			query = fmt.Sprintf("SELECT %s FROM %s FETCH FIRST %d ROWS ONLY", strings.Join(cols, ", "), quote(tb.Name), exampleRows)
+		}
+		rows, err := db.Query(query)
+		if err != nil {
+			beeLogger.Log.Warnf("Could not sample the rows of table '%s': %s", tb.Name, err)
+			continue
+		}
+		values := make([]sql.NullString, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				beeLogger.Log.Warnf("Could not sample the rows of table '%s': %s", tb.Name, err)
+				break
+			}
+			for i, col := range tb.Columns {
+				if values[i].Valid && col.Tag.Example == "" {
+					col.Tag.Example = anonymize(col, values[i].String)
+				}
+			}
+		}
+		rows.Close()
+	}
+}
+
+// anonymize returns the example of a column out of the sampled value v: the sensitive
+// columns are masked, the email addresses, numbers such as phone numbers, times and
+// texts are replaced, and the values which can't be shown are left out
+func anonymize(col *Column, v string) string {
+	sqlType := strings.ToLower(col.SQLType)
+	switch t := col.BaseType(); {
+	case col.Encrypted || t == "[]byte":
+		return ""
+	case col.Mask != "":
+		return maskExample(col.Mask, v)
+	case t == "bool":
+		return v
+	case t == "time.Time" || strings.HasPrefix(sqlType, "date") || strings.HasPrefix(sqlType, "time"):
+		// birth dates and the like: the digits are those of a fixed date, the layout kept
+		return replaceDigits(v, "20010203040506070809")
+	case t != "string":
+		// identifiers, phone or card numbers stored as numbers
+		return replaceDigits(v, "1234567890")
+	}
+	digits := 0
+	for _, r := range v {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	switch {
+	case strings.Contains(v, "@"):
+		return "user@example.com"
+	case len(v) >= 6 && digits*10 >= len(v)*7:
+		// identifiers, phone or card numbers: the digits are replaced, the separators kept
+		return replaceDigits(v, "1234567890")
+	case strings.ContainsAny(v, " \t\n") || len(v) > 20:
+		// free texts and names
+		words := len(strings.Fields(v))
+		if words > len(loremWords) {
+			words = len(loremWords)
+		}
+		return strings.Join(loremWords[:words], " ")
+	}
+	// short codes such as statuses are kept
+	return v
+}
+
+// replaceDigits replaces the digits of v by the digits of seq in turn, the other
+// characters being kept
+func replaceDigits(v, seq string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range v {
+		if unicode.IsDigit(r) {
+			r = rune(seq[n%len(seq)])
+			n++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// maskExample masks v as the generated models mask the sensitive columns of the kind
+func maskExample(kind, v string) string {
+	keep := func(s string, head, tail int) string {
+		r := []rune(s)
+		if len(r) <= head+tail {
+			return strings.Repeat("*", len(r))
+		}
+		return string(r[:head]) + strings.Repeat("*", len(r)-head-tail) + string(r[len(r)-tail:])
+	}
+	switch kind {
+	case "phone":
+		return keep(v, 3, 4)
+	case "id_card":
+		return keep(v, 6, 4)
+	case "email":
+		return "u***@example.com"
+	}
+	return "****"
+}
@@ -0,0 +1,40 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import "testing"
+
+func TestAnonymize(t *testing.T) {
+	cases := []struct {
+		col     *Column
+		v, want string
+	}{
+		{&Column{Type: "string", SQLType: "varchar(32)"}, "+86 138-0013-8000", "+12 345-6789-0123"},
+		{&Column{Type: "string", SQLType: "varchar(255)"}, "ann@example.com", "user@example.com"},
+		{&Column{Type: "string", SQLType: "varchar(16)"}, "paid", "paid"},
+		{&Column{Type: "int64", SQLType: "bigint"}, "13800138000", "12345678901"},
+		{&Column{Type: "*float64", SQLType: "double"}, "-42.5", "-12.3"},
+		{&Column{Type: "bool", SQLType: "tinyint(1)"}, "1", "1"},
+		{&Column{Type: "time.Time", SQLType: "date"}, "1990-05-17", "2001-02-03"},
+		{&Column{Type: "*time.Time", SQLType: "datetime"}, "1990-05-17 08:30:00", "2001-02-03 04:05:06"},
+		{&Column{Type: "string", SQLType: "varchar(32)", Mask: "phone"}, "13800138000", "138****8000"},
+		{&Column{Type: "[]byte", SQLType: "blob"}, "secret", ""},
+	}
+	for _, c := range cases {
+		if got := anonymize(c.col, c.v); got != c.want {
+			t.Errorf("anonymize(%s %s, %q) = %q, want %q", c.col.Type, c.col.SQLType, c.v, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// Features of the generated code toggled by Appcode.Features
+const (
+	FeatureSoftDeleteAPI = "soft-delete-api" // recycle bins serving and restoring the soft deleted records
+	FeatureExport        = "export"          // export jobs of the records
+	FeatureAudit         = "audit"           // queries of the past rows of the versioned tables
+	FeatureImport        = "import"          // creation of the records from CSV or xlsx files
+	FeatureSqlc          = "sqlc"            // same as -sqlc
+	FeatureSoftUnique    = "soft-unique"     // same as -softunique
+	FeatureTimeWrapper   = "time-wrapper"    // same as -timewrapper
+	FeatureExamples      = "examples"        // same as -examples
+	FeatureIdempotency   = "idempotency"     // replay of the POST requests retried with the same Idempotency-Key
+)
+
+// defaultFeatures are the features enabled when Appcode.Features is not set,
+// the other ones being enabled by their flag
+var defaultFeatures = []string{FeatureSoftDeleteAPI, FeatureExport, FeatureAudit}
+
+// featureEnabled reports whether the optional part of the generated code is enabled
+func featureEnabled(feature string) bool {
+	features := config.Conf.Appcode.Features
+	if features == nil {
+		features = defaultFeatures
+	}
+	for _, f := range features {
+		if strings.ToLower(f) == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFeatures checks the configured features and enables the options of the
+// features also having a flag
+func applyFeatures() {
+	known := map[string]bool{}
+	for _, f := range []string{FeatureSoftDeleteAPI, FeatureExport, FeatureAudit, FeatureImport, FeatureSqlc, FeatureSoftUnique, FeatureTimeWrapper, FeatureExamples, FeatureIdempotency} {
+		known[f] = true
+	}
+	for _, f := range config.Conf.Appcode.Features {
+		if !known[strings.ToLower(f)] {
+			var names []string
+			for name := range known {
+				names = append(names, `"`+name+`"`)
+			}
+			sort.Strings(names)
+			beeLogger.Log.Fatalf("Unknown feature '%s'. Must be one of %s", f, strings.Join(names, ", "))
+		}
+	}
+	Sqlc = Sqlc || featureEnabled(FeatureSqlc)
+	SoftUnique = SoftUnique || featureEnabled(FeatureSoftUnique)
+	TimeWrapper = TimeWrapper || featureEnabled(FeatureTimeWrapper)
+	Examples = Examples || featureEnabled(FeatureExamples)
+}
@@ -0,0 +1,103 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// databaseFingerprint identifies the database the code was generated from. It holds
+// no credentials, the manifest being usually committed.
+type databaseFingerprint struct {
+	Driver     string `json:"driver"`
+	Host       string `json:"host"`
+	Schema     string `json:"schema"`
+	SchemaHash string `json:"schema_hash,omitempty"`
+}
+
+// identity returns the server and schema of the fingerprint
+func (fp *databaseFingerprint) identity() string {
+	return fmt.Sprintf("%s://%s/%s", fp.Driver, fp.Host, fp.Schema)
+}
+
+// fingerprintDatabase asks the database of db for its server and schema, the hash of
+// the schema of tables being set when they are all of the tables. It returns nil when
+// the database can't tell.
+func fingerprintDatabase(dbms string, db *sql.DB, tables []*Table, allTables bool) *databaseFingerprint {
+	var query string
+	switch dbms {
+	case "mysql":
+		query = "SELECT @@hostname, @@port, DATABASE()"
+	case "postgres":
+		query = "SELECT COALESCE(HOST(inet_server_addr()), 'localhost'), COALESCE(inet_server_port(), 5432), current_database() || '.' || current_schema()"
+	case "mssql":
+		query = "SELECT CAST(SERVERPROPERTY('MachineName') AS nvarchar(128)), COALESCE(CAST(CONNECTIONPROPERTY('local_tcp_port') AS int), 1433), DB_NAME() + '.' + SCHEMA_NAME()"
+	case "clickhouse":
+		query = "SELECT hostName(), tcpPort(), currentDatabase()"
+	case "oracle":
+		query = "SELECT SYS_CONTEXT('USERENV', 'SERVER_HOST'), 1521, SYS_CONTEXT('USERENV', 'DB_NAME') || '.' || SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') FROM DUAL"
+	default:
+		return nil
+	}
+	var host, schema sql.NullString
+	var port int
+	if err := db.QueryRow(query).Scan(&host, &port, &schema); err != nil {
+		beeLogger.Log.Warnf("Could not fingerprint the database: %s", err)
+		return nil
+	}
+	fp := &databaseFingerprint{Driver: dbms, Host: fmt.Sprintf("%s:%d", host.String, port), Schema: schema.String}
+	if allTables {
+		// the tables of the snapshot are a map, encoded with sorted keys
+		data, err := json.Marshal(newSchemaSnapshot(tables))
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not encode the schema: %s", err)
+		}
+		sum := sha256.Sum256(data)
+		fp.SchemaHash = hex.EncodeToString(sum[:])
+	}
+	return fp
+}
+
+// checkDatabaseFingerprint warns and asks for confirmation when the manifest of
+// apppath was written for another database than fp, as the generated files would
+// then be overwritten with the code of an unrelated schema
+func checkDatabaseFingerprint(fp *databaseFingerprint, apppath string) {
+	previous := readManifest(apppath).Database
+	if fp == nil || previous == nil || previous.identity() == fp.identity() {
+		return
+	}
+	beeLogger.Log.Warn("**************************************************************")
+	beeLogger.Log.Warnf("The code was generated from %s", previous.identity())
+	beeLogger.Log.Warnf("but this generation reads %s", fp.identity())
+	switch {
+	case previous.SchemaHash == "" || fp.SchemaHash == "":
+	case previous.SchemaHash == fp.SchemaHash:
+		beeLogger.Log.Warn("Both databases have the same schema")
+	default:
+		beeLogger.Log.Warn("The schemas of the databases differ")
+	}
+	beeLogger.Log.Warn("**************************************************************")
+	beeLogger.Log.Warnf("Do you want to overwrite the generated files anyway? [Yes|No] ")
+	if !utils.AskForConfirmation() {
+		beeLogger.Log.Fatal("Generation aborted")
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// GormShimDir is the directory of the gorm v1 shim in the models directory, see -gormshim
+const GormShimDir = "gormv1"
+
+// checkGormShim fails unless the models the shim wraps are generated for gorm v2
+func checkGormShim() {
+	if GormShim && (!gormV2() || sqlxMode()) {
+		beeLogger.Log.Fatal("-gormshim wraps the gorm v2 models, it needs -gorm=v2 and the gorm ORM")
+	}
+}
+
+// writeGormShim generates the models/gormv1 package wrapping the gorm v2 models behind
+// the signatures of the gorm v1 ones: the functions taking a *gorm.DB take the one of
+// github.com/jinzhu/gorm, and the types, constants and errors are forwarded. The package
+// is also named models, so the callers are migrated one file at a time by importing
+// models/gormv1 until they are ported to gorm v2.
+func writeGormShim(mPath, pkgPath string) {
+	files, err := ioutil.ReadDir(mPath)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not read the models directory: %s", err)
+	}
+	modelsPath := pkgPath + "/" + outputDir("models")
+	sPath := path.Join(mPath, GormShimDir)
+	if err := os.MkdirAll(sPath, 0755); err != nil {
+		beeLogger.Log.Fatalf("Could not create directory '%s': %s", sPath, err)
+	}
+	// the shim imports both versions of gorm, its imports are left as they are written
+	saved := outputImports
+	outputImports = nil
+	defer func() { outputImports = saved }()
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == GormShimDir+".go" {
+			continue
+		}
+		src, err := ioutil.ReadFile(path.Join(mPath, name))
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not read '%s': %s", name, err)
+		}
+		if content, ok := shimSource(name, src, modelsPath); ok {
+			writeGeneratedFile(path.Join(sPath, name), content)
+		}
+	}
+	writeGeneratedFile(path.Join(sPath, GormShimDir+".go"), strings.Replace(GormShimTPL, "{{modelsPath}}", modelsPath, -1))
+}
+
+// shimSource returns the shim of a file of the models package, false when nothing of it
+// is forwarded
+func shimSource(name string, src []byte, modelsPath string) (string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, src, 0)
+	if err != nil {
+		beeLogger.Log.Warnf("Could not parse '%s', it is left out of the gorm v1 shim: %s", name, err)
+		return "", false
+	}
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		pkg := path.Base(p)
+		if spec.Name != nil {
+			pkg = spec.Name.Name
+		}
+		imports[pkg] = p
+	}
+
+	var decls []string
+	used := map[string]bool{"v2": true}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			var values []string
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() && s.TypeParams == nil {
+						decls = append(decls, fmt.Sprintf("type %s = v2.%[1]s", s.Name.Name))
+					}
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						// the errors are shared for errors.Is, the other variables are left to models
+						if n.IsExported() && (d.Tok == token.CONST || strings.HasPrefix(n.Name, "Err")) {
+							values = append(values, fmt.Sprintf("%s = v2.%[1]s", n.Name))
+						}
+					}
+				}
+			}
+			if len(values) == 1 {
+				decls = append(decls, d.Tok.String()+" "+values[0])
+			} else if len(values) > 1 {
+				decls = append(decls, d.Tok.String()+" (\n\t"+strings.Join(values, "\n\t")+"\n)")
+			}
+		case *ast.FuncDecl:
+			if wrapper, ok := shimFunc(fset, d, imports, used); ok {
+				decls = append(decls, wrapper)
+			}
+		}
+	}
+	if len(decls) == 0 {
+		return "", false
+	}
+
+	// the standard packages come first, then the others
+	paths := map[string]string{"v2": modelsPath, "gormv1": "github.com/jinzhu/gorm"}
+	var std, others []string
+	for pkg := range used {
+		p, ok := paths[pkg]
+		if !ok {
+			p = imports[pkg]
+		}
+		spec := strconv.Quote(p)
+		if path.Base(p) != pkg {
+			spec = pkg + " " + spec
+		}
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			others = append(others, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	var buf bytes.Buffer
+	buf.WriteString("package models\n\nimport (\n")
+	for _, spec := range std {
+		buf.WriteString("\t" + spec + "\n")
+	}
+	if len(std) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, spec := range others {
+		buf.WriteString("\t" + spec + "\n")
+	}
+	buf.WriteString(")\n")
+	for _, d := range decls {
+		buf.WriteString("\n" + d + "\n")
+	}
+	return buf.String(), true
+}
+
+// shimFunc returns the wrapper of an exported function of the models, its *gorm.DB first
+// parameter taking the one of gorm v1. Functions with gorm v2 types elsewhere in their
+// signature, or unexported types, are not wrapped.
+func shimFunc(fset *token.FileSet, fd *ast.FuncDecl, imports map[string]string, used map[string]bool) (string, bool) {
+	if fd.Recv != nil || !fd.Name.IsExported() || fd.Type.TypeParams != nil {
+		return "", false
+	}
+	var params, args []string
+	pkgs := make(map[string]bool)
+	for i, field := range fd.Type.Params.List {
+		names := make([]string, 0, len(field.Names))
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			names = []string{fmt.Sprintf("p%d", i)}
+		}
+		typ := field.Type
+		if i == 0 && len(names) == 1 && isGormDB(typ) {
+			params = append(params, names[0]+" *gormv1.DB")
+			args = append(args, "FromV1("+names[0]+")")
+			pkgs["gormv1"] = true
+			continue
+		}
+		if !shimmable(typ, imports, pkgs) {
+			return "", false
+		}
+		params = append(params, strings.Join(names, ", ")+" "+nodeString(fset, typ))
+		for _, n := range names {
+			if _, ok := typ.(*ast.Ellipsis); ok {
+				n += "..."
+			}
+			args = append(args, n)
+		}
+	}
+	var results string
+	if fd.Type.Results != nil {
+		for _, field := range fd.Type.Results.List {
+			if !shimmable(field.Type, imports, pkgs) {
+				return "", false
+			}
+		}
+		var list []string
+		named := false
+		for _, field := range fd.Type.Results.List {
+			names := make([]string, 0, len(field.Names))
+			for _, n := range field.Names {
+				names = append(names, n.Name)
+			}
+			if len(names) == 0 {
+				list = append(list, nodeString(fset, field.Type))
+			} else {
+				named = true
+				list = append(list, strings.Join(names, ", ")+" "+nodeString(fset, field.Type))
+			}
+		}
+		results = " " + strings.Join(list, ", ")
+		if named || len(list) > 1 {
+			results = " (" + strings.Join(list, ", ") + ")"
+		}
+	}
+	for pkg := range pkgs {
+		used[pkg] = true
+	}
+
+	call := fmt.Sprintf("v2.%s(%s)", fd.Name.Name, strings.Join(args, ", "))
+	if results != "" {
+		call = "return " + call
+	}
+	return fmt.Sprintf("// %s calls models.%[1]s\nfunc %[1]s(%s)%s {\n\t%s\n}", fd.Name.Name, strings.Join(params, ", "), results, call), true
+}
+
+// isGormDB reports whether typ is *gorm.DB
+func isGormDB(typ ast.Expr) bool {
+	star, ok := typ.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "gorm" && sel.Sel.Name == "DB"
+}
+
+// shimmable reports whether typ can be written in the shim: it refers to the exported
+// types of the models, forwarded by the shim, to the predeclared types and to the
+// packages other than gorm, which are added to pkgs
+func shimmable(typ ast.Expr, imports map[string]string, pkgs map[string]bool) bool {
+	ok := true
+	ast.Inspect(typ, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			pkg, isIdent := x.X.(*ast.Ident)
+			if !isIdent || imports[pkg.Name] == "" || pkg.Name == "gorm" {
+				ok = false
+			} else {
+				pkgs[pkg.Name] = true
+			}
+			return false
+		case *ast.Ident:
+			if !x.IsExported() && types.Universe.Lookup(x.Name) == nil {
+				ok = false
+			}
+		case *ast.InterfaceType:
+			ok = len(x.Methods.List) == 0
+		case *ast.FuncType, *ast.StructType:
+			// their parameters and fields are not checked
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// nodeString returns the source of node
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		beeLogger.Log.Fatalf("Could not print the gorm v1 shim: %s", err)
+	}
+	return buf.String()
+}
+
+const GormShimTPL = `// Package models wraps the gorm v2 models behind the signatures of the gorm v1 ones,
+// the callers being migrated one file at a time by importing this package instead of
+// the models. The records are the ones of gorm v2: the relations are the values of
+// their foreign keys.
+package models
+
+import (
+	"context"
+	"errors"
+
+	gormv1 "github.com/jinzhu/gorm"
+	"gorm.io/gorm"
+
+	v2 "{{modelsPath}}"
+)
+
+// FromV1 returns the gorm v2 handle running on the connection, or the transaction, of a
+// gorm v1 handle, its conditions left out. A nil handle gives nil, the models using
+// their own database.
+func FromV1(tx *gormv1.DB) *gorm.DB {
+	if tx == nil {
+		return nil
+	}
+	// a session with a context has its own statement, the connection of which is replaced
+	db := v2.DB().Session(&gorm.Session{NewDB: true, Context: context.Background()})
+	pool, ok := tx.CommonDB().(gorm.ConnPool)
+	if !ok {
+		db.AddError(errors.New("models: the connection of the gorm v1 handle can't be used by gorm v2"))
+		return db
+	}
+	db.Statement.ConnPool = pool
+	return db
+}
+`
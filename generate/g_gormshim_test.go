@@ -0,0 +1,130 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/skOak/hee/config"
+)
+
+// gormShimTestFiles are added to the models to run them on SQLite through the shim: the
+// users of the fixture schema get a hook recording their creation in audits
+var gormShimTestFiles = map[string]string{
+	"export_test.go": `package models
+
+import "gorm.io/gorm"
+
+func SetDB(d *gorm.DB) { db = d }
+
+func (m *Users) AfterCreate(tx *gorm.DB) error {
+	return tx.Exec("INSERT INTO audits (user_id) VALUES (?)", m.Id).Error
+}
+`,
+	"gormv1_test.go": `package models_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	gormv1 "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"example.com/app/models"
+	shim "example.com/app/models/gormv1"
+)
+
+func TestFromV1(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.db")
+	v1, err := gormv1.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v1.Close()
+	v2, err := gorm.Open(sqlite.Open(file), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	models.SetDB(v2)
+	for _, ddl := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email TEXT NOT NULL, score REAL, created_at DATETIME, is_deleted INTEGER NOT NULL DEFAULT 0)",
+		"CREATE TABLE audits (user_id INTEGER)",
+	} {
+		if err := v1.Exec(ddl).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(db *gormv1.DB, table string) (n int) {
+		if err := db.Table(table).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	tx := v1.Begin()
+	if _, err := shim.AddUsers(tx, &shim.Users{Name: "ann", Email: "ann@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(tx, "audits"); n != 1 {
+		t.Errorf("the hook of the creation recorded %d audits in the transaction, want 1", n)
+	}
+	tx.Rollback()
+	if n := count(v1, "users") + count(v1, "audits"); n != 0 {
+		t.Errorf("%d rows were kept by the rolled back transaction", n)
+	}
+
+	tx = v1.Begin()
+	id, err := shim.AddUsers(tx, &shim.Users{Name: "bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	v, err := shim.GetUsersById(v1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "bob" {
+		t.Errorf("read %q back, want bob", v.Name)
+	}
+	if n := count(v1, "audits"); n != 1 {
+		t.Errorf("the committed transaction kept %d audits, want 1", n)
+	}
+	if _, err := shim.GetUsersById(nil, id+1); !shim.IsNotFound(err) {
+		t.Errorf("reading a missing user returned %v, want ErrNotFound", err)
+	}
+}
+`,
+}
+
+// TestGormShimFromV1 runs the gorm v2 models through the gorm v1 shim on SQLite, in
+// the transactions of gorm v1 with the hooks of the models
+func TestGormShimFromV1(t *testing.T) {
+	conf := config.Conf
+	defer func() {
+		config.Conf = conf
+		GormVersion.Set("")
+		GormShim = false
+	}()
+	GormVersion.Set("v2")
+	GormShim = true
+
+	gopath := generateApp(t, "mysql", fixtureTables(), OModel)
+	testGeneratedPackage(t, gopath, "models", gormShimTestFiles,
+		"github.com/jinzhu/gorm", "gorm.io/gorm", "gorm.io/driver/sqlite", "github.com/mattn/go-sqlite3")
+}
@@ -0,0 +1,106 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// Versions of gorm the generated code is written for, see -gorm
+const (
+	GormV1 = "v1"
+	GormV2 = "v2"
+)
+
+// gormV2 reports whether the generated code uses gorm.io/gorm instead of
+// github.com/jinzhu/gorm, the flag overriding the configuration
+func gormV2() bool {
+	version := GormVersion.String()
+	if version == "" {
+		version = config.Conf.Appcode.Gorm.Version
+	}
+	switch strings.ToLower(version) {
+	case "", GormV1:
+		return false
+	case GormV2:
+		return true
+	}
+	beeLogger.Log.Fatalf("Invalid gorm version '%s'. Must be either \"v1\" or \"v2\"", version)
+	return false
+}
+
+// checkGormV2 fails unless gorm v2 has a driver package for the dialect
+func checkGormV2(dbms string) {
+	if !gormV2() {
+		return
+	}
+	switch dbms {
+	case "mysql", "postgres":
+		return
+	}
+	beeLogger.Log.Fatalf("Gorm v2 is only generated for mysql and postgres, not for %s", dbms)
+}
+
+// useGormV2 adapts the columns of the tables to gorm v2: the deleted_at times become
+// gorm.DeletedAt, soft deleting the records, and the relations become the plain
+// values of their foreign keys, gorm v2 telling the relations from the columns
+func useGormV2(tables []*Table) {
+	relationKeys(tables)
+	for _, tb := range tables {
+		for _, col := range tb.Columns {
+			if col.Tag.Column == "deleted_at" && col.Type == "*time.Time" {
+				col.Type = "gorm.DeletedAt"
+			}
+		}
+		tb.ImportTimePkg = usesTimePkg(tb)
+	}
+}
+
+// relationKeys makes the relation columns of the tables the plain values of their
+// foreign keys, of the type of the primary key of the related table
+func relationKeys(tables []*Table) {
+	byName := make(map[string]*Table, len(tables))
+	for _, tb := range tables {
+		byName[tb.Name] = tb
+	}
+	for _, tb := range tables {
+		for _, col := range tb.Columns {
+			if !col.Tag.RelFk {
+				continue
+			}
+			col.Type = "int"
+			if ref, ok := byName[col.Tag.TableFk]; ok && ref.PkType != "" {
+				col.Type = ref.PkType
+			}
+			if col.Tag.FkNull {
+				col.Type = "*" + col.Type
+			}
+			col.Tag.RelFk, col.Tag.Null = false, col.Tag.FkNull
+		}
+	}
+}
+
+// ImportGorm reports whether the struct of the model has columns of the types of gorm
+func (tb *Table) ImportGorm() bool {
+	for _, col := range tb.Columns {
+		if strings.HasPrefix(col.BaseType(), "gorm.") {
+			return true
+		}
+	}
+	return false
+}
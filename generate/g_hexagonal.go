@@ -0,0 +1,380 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// domainTable is a table as seen by the domain package: an entity free of
+// any persistence concern, and the repository storing it
+type domainTable struct {
+	*Table
+	Entity  string // name of the entity, the one of the model
+	PkgPath string
+	Imports []string // packages of the domain file
+	Fields  []*domainField
+}
+
+// domainField is a field of an entity, with the conversions from and to the
+// field of the model
+type domainField struct {
+	Name string
+	Type string // type of the field in the domain package
+	// ToDomain and FromDomain convert the field of m to the one of e and back,
+	// either as expressions or, for the deferred fields, as statements
+	ToDomain   string
+	FromDomain string
+	Deferred   bool
+}
+
+// domainFileName returns the name of the domain and persistence files of a table
+func domainFileName(tableName string) string {
+	return appcodeFileName(tableName, "")
+}
+
+// checkHexagonal fails when the hexagonal mode can't be used with the database
+func checkHexagonal(dbms string) {
+	if Hexagonal && dbms == "clickhouse" {
+		beeLogger.Log.Fatal("The models of the ClickHouse tables have no repository, the hexagonal mode can't be used")
+	}
+}
+
+// writeDomainFiles generates the entities and the repository interfaces of the
+// domain package, their implementations on top of the models, and the mappers
+// between the models and the entities
+func writeDomainFiles(tables []*Table, dPath, iPath, pkgPath string) {
+	mPath := path.Join(iPath, "mapper")
+	if err := os.MkdirAll(mPath, 0755); err != nil {
+		beeLogger.Log.Fatalf("Could not create directory '%s': %s", mPath, err)
+	}
+	for _, tb := range tables {
+		dt := newDomainTable(tb, pkgPath)
+		name := domainFileName(tb.Name) + ".go"
+		writeGeneratedFile(path.Join(dPath, name), executeTemplate(DomainTPL, dt))
+		writeGeneratedFile(path.Join(mPath, name), executeTemplate(MapperTPL, dt))
+		if tb.Pk != "" {
+			writeGeneratedFile(path.Join(iPath, name), executeTemplate(PersistenceTPL, dt))
+		}
+	}
+	writeGeneratedFile(path.Join(dPath, "errors.go"), DomainErrorsTPL)
+	writeGeneratedFile(path.Join(iPath, "persistence.go"), executeTemplate(PersistenceErrorsTPL, pkgPath))
+	writeGeneratedFile(path.Join(mPath, "mapper.go"), MapperBaseTPL)
+}
+
+// newDomainTable describes the entity of a table, the relations of the model
+// becoming references to the entities of the related tables
+func newDomainTable(tb *Table, pkgPath string) *domainTable {
+	dt := &domainTable{Table: tb, Entity: utils.CamelCase(tb.Name), PkgPath: pkgPath}
+	imports := make(map[string]bool)
+	if tb.Pk != "" {
+		imports["context"] = true
+	}
+	for _, col := range tb.Columns {
+		f := &domainField{Name: col.Name, Type: col.Type, ToDomain: "m." + col.Name, FromDomain: "e." + col.Name}
+		base := col.BaseType()
+		ptr := base != col.Type
+		switch {
+		case col.Tag.RelFk:
+			// the related records are mapped as well, as a graph
+			f.Deferred = true
+			f.ToDomain = "e." + col.Name + " = mp." + base + "ToDomain(m." + col.Name + ")"
+			f.FromDomain = "m." + col.Name + " = mp." + base + "FromDomain(e." + col.Name + ")"
+		case base == "Time":
+			f.Type = strings.Replace(col.Type, "Time", "time.Time", 1)
+			if ptr {
+				f.Deferred = true
+				f.ToDomain = "if m." + col.Name + " != nil {\n\t\te." + col.Name + " = &m." + col.Name + ".Time\n\t}"
+				f.FromDomain = "if e." + col.Name + " != nil {\n\t\tm." + col.Name + " = &models.Time{Time: *e." + col.Name + "}\n\t}"
+			} else {
+				f.ToDomain = "m." + col.Name + ".Time"
+				f.FromDomain = "models.Time{Time: e." + col.Name + "}"
+			}
+		case base == "gorm.DeletedAt":
+			// the soft deletion time of gorm v2, NULL while the record isn't deleted
+			f.Type = "*time.Time"
+			f.Deferred = true
+			f.ToDomain = "if m." + col.Name + ".Valid {\n\t\te." + col.Name + " = &m." + col.Name + ".Time\n\t}"
+			f.FromDomain = "if e." + col.Name + " != nil {\n\t\tm." + col.Name + ".Time, m." + col.Name + ".Valid = *e." + col.Name + ", true\n\t}"
+		case base == encryptedType:
+			// models.EncryptedString is a string encrypted as it is written
+			f.Type = strings.Replace(col.Type, encryptedType, "string", 1)
+			if ptr {
+				f.ToDomain = "(*string)(m." + col.Name + ")"
+				f.FromDomain = "(*models." + encryptedType + ")(e." + col.Name + ")"
+			} else {
+				f.ToDomain = "string(m." + col.Name + ")"
+				f.FromDomain = "models." + encryptedType + "(e." + col.Name + ")"
+			}
+		}
+		if i := strings.Index(strings.TrimLeft(f.Type, "*[]"), "."); i >= 0 {
+			imports[fieldImport(tb, strings.TrimLeft(f.Type, "*[]")[:i])] = true
+		}
+		dt.Fields = append(dt.Fields, f)
+	}
+	for imp := range imports {
+		dt.Imports = append(dt.Imports, imp)
+	}
+	sort.Strings(dt.Imports)
+	return dt
+}
+
+// fieldImport returns the import path of the package pkg of the type of a field of
+// the model of the table, e.g. pgtype or one of a custom type
+func fieldImport(tb *Table, pkg string) string {
+	if imp, ok := dtoImports[pkg]; ok {
+		return imp
+	}
+	for _, imp := range tb.CustomImports {
+		if path.Base(imp) == pkg {
+			return imp
+		}
+	}
+	return pkg
+}
+
+const (
+	DomainTPL = `package domain
+{{with .Imports}}
+import (
+{{range .}}	"{{.}}"
+{{end}})
+{{end}}
+// {{.Entity}} is a record of {{.Name}}
+type {{.Entity}} struct {
+{{range .Fields}}	{{.Name}} {{.Type}}
+{{end}}}
+{{if .Pk}}
+// {{.Entity}}Repository stores the {{.Entity}} entities
+type {{.Entity}}Repository interface {
+	// Get returns the entity of id, or ErrNotFound
+	Get(ctx context.Context, id {{.PkType}}) (*{{.Entity}}, error)
+	// List returns at most limit entities from offset, 0 for the default page size
+	List(ctx context.Context, offset, limit uint64) ([]*{{.Entity}}, error)
+	// Count returns the number of entities
+	Count(ctx context.Context) (int64, error)
+{{if not .ReadOnly}}	// Create stores e, returning its id
+	Create(ctx context.Context, e *{{.Entity}}) ({{.PkType}}, error)
+	// Update stores the changes of e, or returns ErrNotFound
+	Update(ctx context.Context, e *{{.Entity}}) error
+	// Delete removes the entity of id, or returns ErrNotFound
+	Delete(ctx context.Context, id {{.PkType}}) error
+{{end}}}
+{{end}}`
+
+	DomainErrorsTPL = `package domain
+
+import "errors"
+
+// ErrNotFound is returned by the repositories when the entity doesn't exist
+var ErrNotFound = errors.New("not found")
+`
+
+	PersistenceTPL = `package persistence
+
+import (
+	"context"
+
+	"{{.PkgPath}}/domain"
+	"{{.PkgPath}}/infrastructure/persistence/mapper"
+	"{{.PkgPath}}/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// {{.Entity}}Repository implements domain.{{.Entity}}Repository with the models
+type {{.Entity}}Repository struct {
+	db *gorm.DB
+}
+
+var _ domain.{{.Entity}}Repository = (*{{.Entity}}Repository)(nil)
+
+// New{{.Entity}}Repository returns the repository of the entities stored in db,
+// models.DB() when nil
+func New{{.Entity}}Repository(db *gorm.DB) *{{.Entity}}Repository {
+	return &{{.Entity}}Repository{db: db}
+}
+
+func (r *{{.Entity}}Repository) Get(ctx context.Context, id {{.PkType}}) (*domain.{{.Entity}}, error) {
+	m, err := models.Get{{.Entity}}ById({{template "db"}}, id)
+	if err != nil {
+		return nil, domainError(err)
+	}
+	return mapper.{{.Entity}}ToDomain(m), nil
+}
+
+func (r *{{.Entity}}Repository) List(ctx context.Context, offset, limit uint64) ([]*domain.{{.Entity}}, error) {
+	ml, err := models.Search{{.Entity}}s({{template "db"}}, nil, offset, limit, "")
+	if err != nil {
+		return nil, err
+	}
+	return mapper.{{.Entity}}sToDomain(ml), nil
+}
+
+func (r *{{.Entity}}Repository) Count(ctx context.Context) (int64, error) {
+	return models.Count{{.Entity}}s({{template "db"}}, "")
+}
+{{if not .ReadOnly}}
+func (r *{{.Entity}}Repository) Create(ctx context.Context, e *domain.{{.Entity}}) ({{.PkType}}, error) {
+	m := mapper.{{.Entity}}FromDomain(e)
+	id, err := models.Add{{.Entity}}({{template "db"}}, m)
+	if err != nil {
+		return id, err
+	}
+	e.{{.PkField}} = m.{{.PkField}}
+	return id, nil
+}
+
+func (r *{{.Entity}}Repository) Update(ctx context.Context, e *domain.{{.Entity}}) error {
+	return domainError(models.Update{{.Entity}}ById({{template "db"}}, mapper.{{.Entity}}FromDomain(e)))
+}
+
+func (r *{{.Entity}}Repository) Delete(ctx context.Context, id {{.PkType}}) error {
+	return domainError(models.Delete{{.Entity}}({{template "db"}}, id))
+}
+{{end}}{{if gormV2}}
+// session returns the database of the repository bound to ctx
+func (r *{{.Entity}}Repository) session(ctx context.Context) *gorm.DB {
+	if r.db == nil {
+		return models.WithContext(ctx)
+	}
+	return r.db.WithContext(ctx)
+}
+{{end}}{{define "db"}}{{if gormV2}}r.session(ctx){{else}}r.db{{end}}{{end}}`
+
+	MapperTPL = `package mapper
+
+import (
+	"{{.PkgPath}}/domain"
+	"{{.PkgPath}}/models"
+)
+
+// {{.Entity}}ToDomain returns the entity of the model m, the records it relates to included
+func {{.Entity}}ToDomain(m *models.{{.Entity}}) *domain.{{.Entity}} {
+	return New().{{.Entity}}ToDomain(m)
+}
+
+// {{.Entity}}FromDomain returns the model of the entity e, the records it relates to included
+func {{.Entity}}FromDomain(e *domain.{{.Entity}}) *models.{{.Entity}} {
+	return New().{{.Entity}}FromDomain(e)
+}
+
+// {{.Entity}}sToDomain returns the entities of the models ml, the records they relate to included
+func {{.Entity}}sToDomain(ml []*models.{{.Entity}}) []*domain.{{.Entity}} {
+	return New().{{.Entity}}sToDomain(ml)
+}
+
+// {{.Entity}}sFromDomain returns the models of the entities es, the records they relate to included
+func {{.Entity}}sFromDomain(es []*domain.{{.Entity}}) []*models.{{.Entity}} {
+	return New().{{.Entity}}sFromDomain(es)
+}
+
+// {{.Entity}}ToDomain returns the entity of the model m, mapped once per graph
+func (mp *Mapper) {{.Entity}}ToDomain(m *models.{{.Entity}}) *domain.{{.Entity}} {
+	if m == nil {
+		return nil
+	}
+	if e, ok := mp.mapped[m]; ok {
+		return e.(*domain.{{.Entity}})
+	}
+	e := &domain.{{.Entity}}{
+{{range .Fields}}{{if not .Deferred}}		{{.Name}}: {{.ToDomain}},
+{{end}}{{end}}	}
+	mp.mapped[m] = e
+{{range .Fields}}{{if .Deferred}}	{{.ToDomain}}
+{{end}}{{end}}	return e
+}
+
+// {{.Entity}}FromDomain returns the model of the entity e, mapped once per graph
+func (mp *Mapper) {{.Entity}}FromDomain(e *domain.{{.Entity}}) *models.{{.Entity}} {
+	if e == nil {
+		return nil
+	}
+	if m, ok := mp.mapped[e]; ok {
+		return m.(*models.{{.Entity}})
+	}
+	m := &models.{{.Entity}}{
+{{range .Fields}}{{if not .Deferred}}		{{.Name}}: {{.FromDomain}},
+{{end}}{{end}}	}
+	mp.mapped[e] = m
+{{range .Fields}}{{if .Deferred}}	{{.FromDomain}}
+{{end}}{{end}}	return m
+}
+
+// {{.Entity}}sToDomain returns the entities of the models ml, nil for nil
+func (mp *Mapper) {{.Entity}}sToDomain(ml []*models.{{.Entity}}) []*domain.{{.Entity}} {
+	if ml == nil {
+		return nil
+	}
+	es := make([]*domain.{{.Entity}}, len(ml))
+	for i, m := range ml {
+		es[i] = mp.{{.Entity}}ToDomain(m)
+	}
+	return es
+}
+
+// {{.Entity}}sFromDomain returns the models of the entities es, nil for nil
+func (mp *Mapper) {{.Entity}}sFromDomain(es []*domain.{{.Entity}}) []*models.{{.Entity}} {
+	if es == nil {
+		return nil
+	}
+	ml := make([]*models.{{.Entity}}, len(es))
+	for i, e := range es {
+		ml[i] = mp.{{.Entity}}FromDomain(e)
+	}
+	return ml
+}
+`
+
+	MapperBaseTPL = `package mapper
+
+// Mapper maps a graph of models to a graph of entities, or back. Each record is
+// mapped once: the records related to by several ones, and the cycles of the
+// tables relating to themselves, are kept as they are by the mapped graph.
+// A Mapper isn't safe for concurrent use.
+type Mapper struct {
+	mapped map[interface{}]interface{} // mapped records keyed by their source
+}
+
+// New returns a Mapper of a new graph
+func New() *Mapper {
+	return &Mapper{mapped: make(map[interface{}]interface{})}
+}
+`
+
+	PersistenceErrorsTPL = `package persistence
+
+import (
+	"errors"
+
+	"{{.}}/domain"
+	"{{.}}/models"
+)
+
+// domainError replaces the errors of the models with the ones of the domain
+func domainError(err error) error {
+	if errors.Is(err, models.ErrNotFound) {
+		return domain.ErrNotFound
+	}
+	return err
+}
+`
+)
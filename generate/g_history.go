@@ -0,0 +1,134 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+const (
+	// VersioningSystem marks a system-versioned table (MariaDB WITH SYSTEM VERSIONING)
+	VersioningSystem = "system"
+	// VersioningHistory marks a table whose past rows are kept in a <table>_history table
+	VersioningHistory = "history"
+)
+
+// historyPeriods lists the column pairs recognized as the validity period
+// of the rows of a history table
+var historyPeriods = [][2]string{
+	{"valid_from", "valid_to"},
+	{"row_start", "row_end"},
+}
+
+// detectVersioning marks the tables keeping their past rows, so that point-in-time
+// query helpers get generated for them. System versioning is only detected on MariaDB:
+// the temporal tables of the other databases (e.g. SQL Server) are left unmarked, only
+// their <table>_history tables being recognized, with any dbms
+func detectVersioning(dbms string, db *sql.DB, trans DbTransformer, tables []*Table) {
+	system := make(map[string]bool)
+	if dbms == "mysql" {
+		// MariaDB reports system-versioned tables with their own table type
+		rows, err := db.Query(`SELECT table_name FROM information_schema.tables
+			WHERE table_schema = database() AND table_type = 'SYSTEM VERSIONED'`)
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not query the database: %s", err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				beeLogger.Log.Fatalf("Could not scan the versioned table names: %s", err)
+			}
+			system[name] = true
+		}
+		rows.Close()
+	}
+
+	allTables := make(map[string]bool)
+	for _, name := range trans.GetTableNames(db) {
+		allTables[name] = true
+	}
+	for _, tb := range tables {
+		if tb.Pk == "" {
+			continue
+		}
+		if system[tb.Name] {
+			tb.Versioning = VersioningSystem
+		} else if hist := tb.Name + "_history"; allTables[hist] {
+			from, to := historyPeriod(dbms, db, hist)
+			if from == "" {
+				beeLogger.Log.Warnf("History table '%s' has no validity period columns, skipping it", hist)
+				continue
+			}
+			tb.Versioning = VersioningHistory
+			tb.HistoryTable, tb.HistoryFrom, tb.HistoryTo = hist, from, to
+		} else {
+			continue
+		}
+		// the helpers take the point in time as a time.Time
+		tb.ImportTimePkg = true
+		beeLogger.Log.Infof("Table '%s' is versioned (%s)", tb.Name, tb.Versioning)
+	}
+}
+
+// CreatedField returns the field holding the creation time of the rows, or an empty
+// string if the table has none
+func (tb *Table) CreatedField() string {
+	for _, col := range tb.Columns {
+		if col.Tag.AutoNowAdd && col.Type == "time.Time" {
+			return col.Name
+		}
+	}
+	return ""
+}
+
+// historyPeriod returns the columns of a history table holding the validity
+// period of its rows, or empty strings if there are none
+func historyPeriod(dbms string, db *sql.DB, table string) (from, to string) {
+	query := `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = database() AND table_name = ?`
+	if dbms == "postgres" {
+		query = `SELECT column_name FROM information_schema.columns
+			WHERE table_catalog = current_database() AND table_schema NOT IN ('pg_catalog', 'information_schema')
+			AND table_name = $1`
+	} else if dbms == "mssql" {
+		query = `SELECT column_name FROM information_schema.columns
+			WHERE table_schema = SCHEMA_NAME() AND table_name = @p1`
+	} else if dbms == "oracle" {
+		query = `SELECT LOWER(column_name) FROM user_tab_columns WHERE table_name = UPPER(:1)`
+	} else if dbms == "sqlite" {
+		query = `SELECT name FROM pragma_table_info(?)`
+	}
+	rows, err := db.Query(query, table)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the database: %s", err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			beeLogger.Log.Fatalf("Could not scan the columns of '%s': %s", table, err)
+		}
+		columns[name] = true
+	}
+	for _, period := range historyPeriods {
+		if columns[period[0]] && columns[period[1]] {
+			return period[0], period[1]
+		}
+	}
+	return "", ""
+}
@@ -19,15 +19,13 @@ package generate
 
 import (
 	"database/sql"
-	"fmt"
-	"os"
 	"path"
 	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	"github.com/skOak/hee/config"
 	beeLogger "github.com/skOak/hee/logger"
-	"github.com/skOak/hee/logger/colors"
 	"github.com/skOak/hee/utils"
 )
 
@@ -308,7 +306,7 @@ func GenerateHproseAppcode(driver, connStr, level, tables, currpath string) {
 func genHprose(dbms, connStr string, mode byte, selectedTableNames map[string]bool, currpath string) {
 	db, err := sql.Open(dbms, connStr)
 	if err != nil {
-		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", dbms, connStr, err)
+		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", dbms, config.RedactSecrets(connStr), err)
 	}
 	defer db.Close()
 	if trans, ok := dbDriver[dbms]; ok {
@@ -337,8 +335,6 @@ func writeHproseSourceFiles(pkgPath string, tables []*Table, mode byte, paths *M
 
 // writeHproseModelFiles generates model files
 func writeHproseModelFiles(tables []*Table, mPath string, selectedTables map[string]bool) {
-	w := colors.NewColorWriter(os.Stdout)
-
 	for _, tb := range tables {
 		// if selectedTables map is not nil and this table is not selected, ignore it
 		if selectedTables != nil {
@@ -346,29 +342,7 @@ func writeHproseModelFiles(tables []*Table, mPath string, selectedTables map[str
 				continue
 			}
 		}
-		filename := getFileName(tb.Name)
-		fpath := path.Join(mPath, filename+".go")
-		var f *os.File
-		var err error
-		if utils.IsExist(fpath) {
-			beeLogger.Log.Warnf("'%s' already exists. Do you want to overwrite it? [Yes|No] ", fpath)
-			if utils.AskForConfirmation() {
-				f, err = os.OpenFile(fpath, os.O_RDWR|os.O_TRUNC, 0666)
-				if err != nil {
-					beeLogger.Log.Warnf("%s", err)
-					continue
-				}
-			} else {
-				beeLogger.Log.Warnf("Skipped create file '%s'", fpath)
-				continue
-			}
-		} else {
-			f, err = os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0666)
-			if err != nil {
-				beeLogger.Log.Warnf("%s", err)
-				continue
-			}
-		}
+		fpath := path.Join(mPath, getFileName(tb.Name)+".go")
 		var template string
 		if tb.Pk == "" {
 			template = HproseStructModelTPL
@@ -387,12 +361,7 @@ func writeHproseModelFiles(tables []*Table, mPath string, selectedTables map[str
 		}
 		fileStr = strings.Replace(fileStr, "{{timePkg}}", timePkg, -1)
 		fileStr = strings.Replace(fileStr, "{{importTimePkg}}", importTimePkg, -1)
-		if _, err := f.WriteString(fileStr); err != nil {
-			beeLogger.Log.Fatalf("Could not write model file to '%s'", fpath)
-		}
-		utils.CloseFile(f)
-		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
-		utils.FormatSourceCode(fpath)
+		writeGeneratedFile(fpath, fileStr)
 	}
 }
 
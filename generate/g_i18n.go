@@ -0,0 +1,221 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// builtinMessages holds the messages of the generated controllers in the supported languages
+var builtinMessages = map[string]map[string]string{
+	"en": {
+		"not_found":     "record not found",
+		"invalid_id":    "invalid id",
+		"invalid_body":  "invalid request body",
+		"invalid_query": "invalid query key/value pair",
+		"conflict":      "%s already exists",
+		"duplicate_key": "duplicate value violating %s",
+		"foreign_key":   "reference violating %s",
+		"check":         "value violating %s",
+
+		"idempotency_mismatch":    "idempotency key already used by another request",
+		"idempotency_in_progress": "request with the same idempotency key in progress",
+
+		"invalid_page":      "invalid offset %d or limit %d",
+		"invalid_query_key": "invalid query key %s",
+		"unknown_column":    "unknown column '%s' of %s",
+		"unused_order":      "unused 'order' fields",
+		"order_mismatch":    "'sortby', 'order' sizes mismatch or 'order' size is not 1",
+		"invalid_order":     "invalid order, must be either asc or desc",
+	},
+	"zh": {
+		"not_found":     "记录不存在",
+		"invalid_id":    "无效的ID",
+		"invalid_body":  "无效的请求体",
+		"invalid_query": "无效的查询键值对",
+		"conflict":      "%s 已存在",
+		"duplicate_key": "重复的值违反了 %s",
+		"foreign_key":   "引用违反了 %s",
+		"check":         "值违反了 %s",
+
+		"idempotency_mismatch":    "幂等键已被其他请求使用",
+		"idempotency_in_progress": "相同幂等键的请求正在处理中",
+
+		"invalid_page":      "无效的偏移量 %d 或数量 %d",
+		"invalid_query_key": "无效的查询键 %s",
+		"unknown_column":    "%[2]s 没有列 '%[1]s'",
+		"unused_order":      "未使用的 'order' 字段",
+		"order_mismatch":    "'sortby' 与 'order' 的数量不匹配，或 'order' 的数量不为 1",
+		"invalid_order":     "无效的排序，只能是 asc 或 desc",
+	},
+}
+
+// i18nEnabled reports whether the generated controllers and handlers localize their error messages
+func i18nEnabled() bool {
+	return len(config.Conf.Appcode.I18n.Languages) > 0
+}
+
+// i18nCatalog is a language of the generated message catalog
+type i18nCatalog struct {
+	Language string
+	Messages []i18nMessage
+}
+
+type i18nMessage struct {
+	Key, Text string
+}
+
+// i18nData is the data of the generated i18n.go
+type i18nData struct {
+	Catalogs []i18nCatalog
+	Handlers bool // net/http handlers rather than beego controllers
+}
+
+// writeI18nFile generates i18n.go holding the message catalog of the controllers, or of
+// the handlers, and the negotiation of the language, the first configured language being
+// the default
+func writeI18nFile(dir, pkgPath string, handlers bool) {
+	var catalogs []i18nCatalog
+	for _, lang := range config.Conf.Appcode.I18n.Languages {
+		lang = strings.ToLower(lang)
+		messages, ok := builtinMessages[lang]
+		if !ok {
+			beeLogger.Log.Warnf("No messages in '%s', the english ones are generated to be translated", lang)
+			messages = builtinMessages["en"]
+		}
+		catalog := i18nCatalog{Language: lang}
+		for key, text := range messages {
+			catalog.Messages = append(catalog.Messages, i18nMessage{key, text})
+		}
+		sort.Slice(catalog.Messages, func(i, j int) bool { return catalog.Messages[i].Key < catalog.Messages[j].Key })
+		catalogs = append(catalogs, catalog)
+	}
+	content := strings.Replace(I18nTPL, "{{pkgPath}}", pkgPath, -1)
+	writeGeneratedFile(path.Join(dir, "i18n.go"), executeTemplate(content, i18nData{catalogs, handlers}))
+}
+
+const I18nTPL = `package {{if .Handlers}}handlers{{else}}controllers{{end}}
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+{{if .Handlers}}	"net/http"
+{{end}}	"sort"
+	"strconv"
+	"strings"
+
+	"{{pkgPath}}/models"
+{{if not .Handlers}}
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+{{end}})
+
+// messages holds the error messages of the {{if .Handlers}}handlers{{else}}controllers{{end}} by language, then by key
+var messages = map[string]map[string]string{
+{{range .Catalogs}}	"{{.Language}}": {
+{{range .Messages}}		"{{.Key}}": {{printf "%q" .Text}},
+{{end}}	},
+{{end}}}
+
+// defaultLanguage is used when none of the accepted languages is supported
+const defaultLanguage = "{{(index .Catalogs 0).Language}}"
+{{if not .Handlers}}
+func init() {
+	beego.InsertFilter("*", beego.BeforeRouter, LanguageFilter)
+}
+
+// LanguageFilter negotiates the language of the messages from the Accept-Language header
+func LanguageFilter(ctx *context.Context) {
+	ctx.Input.SetData("lang", negotiateLanguage(ctx.Input.Header("Accept-Language")))
+}
+{{end}}
+// negotiateLanguage returns the supported language with the highest quality in an
+// Accept-Language header, e.g. zh-CN,zh;q=0.9,en;q=0.8, matching the primary subtags
+func negotiateLanguage(header string) string {
+	type accepted struct {
+		lang string
+		q    float64
+	}
+	var langs []accepted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.SplitN(strings.TrimSpace(fields[0]), "-", 2)[0])
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if _, ok := messages[lang]; ok && q > 0 {
+			langs = append(langs, accepted{lang, q})
+		}
+	}
+	if len(langs) == 0 {
+		return defaultLanguage
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	return langs[0].lang
+}
+
+// tr returns the message of key in the language negotiated for the request
+func tr({{template "req" .}}, key string, args ...interface{}) string {
+	{{if .Handlers}}lang := negotiateLanguage(r.Header.Get("Accept-Language")){{else}}lang, _ := ctx.Input.GetData("lang").(string){{end}}
+	msg, ok := messages[lang][key]
+	if !ok {
+		msg = messages[defaultLanguage][key]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// errorMessage localizes the errors of the {{if .Handlers}}handlers{{else}}controllers{{end}} and models which are known,
+// the others are returned as is
+func errorMessage({{template "req" .}}, err error) string {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return tr({{template "r" .}}, "invalid_body") + ": " + err.Error()
+	case *strconv.NumError:
+		return tr({{template "r" .}}, "invalid_id")
+	}
+	var pe *models.ParamError
+	if errors.As(err, &pe) {
+		return tr({{template "r" .}}, pe.Key, pe.Args...)
+	}
+	if models.IsNotFound(err) {
+		return tr({{template "r" .}}, "not_found")
+	}
+	if v := models.ConstraintViolation(err); v != nil {
+		switch v.Kind {
+		case models.ErrDuplicateKey:
+			return tr({{template "r" .}}, "duplicate_key", v.Constraint)
+		case models.ErrForeignKey:
+			return tr({{template "r" .}}, "foreign_key", v.Constraint)
+		case models.ErrCheck:
+			return tr({{template "r" .}}, "check", v.Constraint)
+		}
+	}
+	return err.Error()
+}
+{{define "req"}}{{if .Handlers}}r *http.Request{{else}}ctx *context.Context{{end}}{{end}}{{define "r"}}{{if .Handlers}}r{{else}}ctx{{end}}{{end}}`
@@ -0,0 +1,282 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// idempotencyEnabled reports whether the POST requests retried with the same
+// Idempotency-Key get the response of the first one
+func idempotencyEnabled() bool {
+	return featureEnabled(FeatureIdempotency)
+}
+
+// idempotencyColumnTypes holds the text, integer, binary and time types of the
+// idempotency_keys table by dialect
+var idempotencyColumnTypes = map[string][4]string{
+	"mysql":    {"VARCHAR(255)", "INT", "LONGBLOB", "DATETIME"},
+	"postgres": {"VARCHAR(255)", "INTEGER", "BYTEA", "TIMESTAMP"},
+	"sqlite":   {"VARCHAR(255)", "INTEGER", "BLOB", "DATETIME"},
+	"mssql":    {"NVARCHAR(255)", "INT", "VARBINARY(MAX)", "DATETIME2"},
+	"oracle":   {"VARCHAR2(255)", "NUMBER(10)", "BLOB", "TIMESTAMP"},
+}
+
+// writeIdempotencyMigration generates the migration creating the idempotency_keys table,
+// unless an earlier run already generated it
+func writeIdempotencyMigration(dbms, curpath string) {
+	types, ok := idempotencyColumnTypes[dbms]
+	if !ok {
+		return
+	}
+	if matches, _ := filepath.Glob(path.Join(curpath, DBPath, MPath, "*_create_idempotency_keys.go")); len(matches) > 0 {
+		return
+	}
+	// Oracle stores empty strings as NULL, so the text columns which can be empty are nullable
+	up := fmt.Sprintf(`m.SQL("CREATE TABLE idempotency_keys (idempotency_key %[1]s NOT NULL PRIMARY KEY, method %[1]s NOT NULL, path %[1]s NOT NULL, request_hash %[1]s NOT NULL, status %[2]s NOT NULL, content_type %[1]s, body %[3]s, created_at %[4]s NOT NULL)")`,
+		types[0], types[1], types[2], types[3])
+	GenerateMigration("create_idempotency_keys", up, `m.SQL("DROP TABLE idempotency_keys")`, curpath)
+}
+
+// writeIdempotencyFile generates idempotency.go holding the model of the idempotency_keys table
+func writeIdempotencyFile(mPath string) {
+	writeGeneratedFile(path.Join(mPath, "idempotency.go"), IdempotencyTPL)
+}
+
+// writeCtrlIdempotencyFile generates the filters of the controllers replaying the
+// responses of the POST requests retried with the same Idempotency-Key, the keys
+// being namespaced by tenant when a table is tenant scoped
+func writeCtrlIdempotencyFile(tables []*Table, cPath, pkgPath string) {
+	content := strings.Replace(CtrlIdempotencyTPL, "{{pkgPath}}", pkgPath, -1)
+	writeGeneratedFile(path.Join(cPath, "idempotency.go"), executeTemplate(content, tenantScoped(tables)))
+}
+
+// checkIdempotency fails when the idempotency feature is enabled for a database
+// whose tables can't be written
+func checkIdempotency(dbms string) {
+	if idempotencyEnabled() && dbms == "clickhouse" {
+		beeLogger.Log.Fatal("The ClickHouse tables are read only, the idempotency feature can't be enabled")
+	}
+}
+
+const (
+	IdempotencyTPL = `package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// IdempotencyKey is a request sent with an Idempotency-Key header and its response,
+// replayed when the request is retried with the same key
+type IdempotencyKey struct {
+	Key         string    ` + "`gorm:\"column:idempotency_key;primary_key\"`" + ` // SHA-256 of the Idempotency-Key and of the client and endpoint of its request
+	Method      string    ` + "`gorm:\"column:method\"`" + `
+	Path        string    ` + "`gorm:\"column:path\"`" + `
+	RequestHash string    ` + "`gorm:\"column:request_hash\"`" + ` // SHA-256 of the method, URL and body
+	Status      int       ` + "`gorm:\"column:status\"`" + `       // 0 while the request is processed
+	ContentType string    ` + "`gorm:\"column:content_type\"`" + `
+	Body        []byte    ` + "`gorm:\"column:body\"`" + `
+	CreatedAt   time.Time ` + "`gorm:\"column:created_at\"`" + `
+}
+
+func (*IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// ClaimIdempotencyKey inserts k before its request is processed, IsDuplicateKey
+// reporting whether the key has been claimed by an earlier request
+func ClaimIdempotencyKey(tx *gorm.DB, k *IdempotencyKey) error {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	k.Status = 0
+	return db.Create(k).Error
+}
+
+// GetIdempotencyKey retrieves the IdempotencyKey of key, ErrNotFound when it doesn't exist
+func GetIdempotencyKey(tx *gorm.DB, key string) (*IdempotencyKey, error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	var k IdempotencyKey
+	if err := db.Where("idempotency_key = ?", key).First(&k).Error; err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &k, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request of key
+func CompleteIdempotencyKey(tx *gorm.DB, key string, status int, contentType string, body []byte) error {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	return db.Model(&IdempotencyKey{}).Where("idempotency_key = ?", key).Updates(map[string]interface{}{
+		"status":       status,
+		"content_type": contentType,
+		"body":         body,
+	}).Error
+}
+
+// ReleaseIdempotencyKey deletes key, so that its request can be processed again
+func ReleaseIdempotencyKey(tx *gorm.DB, key string) error {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	return db.Where("idempotency_key = ?", key).Delete(&IdempotencyKey{}).Error
+}
+
+// PurgeIdempotencyKeysOlderThan deletes the keys claimed before now minus d, after
+// which their requests are processed again when retried
+func PurgeIdempotencyKeysOlderThan(tx *gorm.DB, d time.Duration) (int64, error) {
+	db := tx
+	if db == nil {
+		db = DB()
+	}
+	res := db.Where("created_at < ?", time.Now().Add(-d)).Delete(&IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
+`
+	CtrlIdempotencyTPL = `package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"{{pkgPath}}/models"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+)
+
+// IdempotencyHeader is the header making the retries of a POST request safe: the
+// response of the first request sent with a key is replayed to the retries
+const IdempotencyHeader = "Idempotency-Key"
+
+// PrincipalKey is the key of the context data holding the authenticated principal of a
+// request, e.g. its user id, set by an authentication filter: the same Idempotency-Key
+// sent by different principals claims different keys
+const PrincipalKey = "principal"
+
+func init() {
+	beego.InsertFilter("*", beego.BeforeExec, IdempotencyFilter)
+	// run once the response is written
+	beego.InsertFilter("*", beego.AfterExec, storeIdempotentResponse, false)
+}
+
+// idempotentResponse records the response of the request claiming key
+type idempotentResponse struct {
+	http.ResponseWriter
+	key    string
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotentResponse) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotentResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotencyKey namespaces the Idempotency-Key of a request by the {{if .}}tenant, the {{end}}principal, the
+// method and the path of the request, so that clients and endpoints can't replay each other's responses
+func idempotencyKey(ctx *context.Context) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("{{if .}}%v\n{{end}}%v\n%s %s\n%s", {{if .}}ctx.Input.GetData(TenantKey), {{end}}ctx.Input.GetData(PrincipalKey),
+		ctx.Input.Method(), ctx.Input.URL(), ctx.Input.Header(IdempotencyHeader))))
+	return hex.EncodeToString(sum[:])
+}
+
+// IdempotencyFilter claims the Idempotency-Key of a POST request before it is processed,
+// or replays the response of the request which claimed it. A key reused for another
+// request is rejected with 422, a key whose request is still processed with 409.
+func IdempotencyFilter(ctx *context.Context) {
+	if ctx.Input.Header(IdempotencyHeader) == "" || ctx.Input.Method() != http.MethodPost {
+		return
+	}
+	key := idempotencyKey(ctx)
+	sum := sha256.Sum256(append([]byte(ctx.Input.Method()+" "+ctx.Input.URL()+"\n"), ctx.Input.RequestBody...))
+	hash := hex.EncodeToString(sum[:])
+	err := models.ClaimIdempotencyKey(nil, &models.IdempotencyKey{Key: key, Method: ctx.Input.Method(), Path: ctx.Input.URL(), RequestHash: hash})
+	if err == nil {
+		ctx.ResponseWriter.ResponseWriter = &idempotentResponse{ResponseWriter: ctx.ResponseWriter.ResponseWriter, key: key}
+		return
+	}
+	var k *models.IdempotencyKey
+	if models.IsDuplicateKey(err) {
+		k, err = models.GetIdempotencyKey(nil, key)
+	}
+	switch {
+	case err != nil:
+		ctx.Output.SetStatus(http.StatusInternalServerError)
+		ctx.Output.JSON({{if i18n}}errorMessage(ctx, err){{else}}err.Error(){{end}}, false, false)
+	case k.RequestHash != hash:
+		ctx.Output.SetStatus(http.StatusUnprocessableEntity)
+		ctx.Output.JSON({{if i18n}}tr(ctx, "idempotency_mismatch"){{else}}"idempotency key already used by another request"{{end}}, false, false)
+	case k.Status == 0:
+		ctx.Output.SetStatus(http.StatusConflict)
+		ctx.Output.JSON({{if i18n}}tr(ctx, "idempotency_in_progress"){{else}}"request with the same idempotency key in progress"{{end}}, false, false)
+	default:
+		if k.ContentType != "" {
+			ctx.Output.Header("Content-Type", k.ContentType)
+		}
+		ctx.Output.Header("Idempotent-Replayed", "true")
+		ctx.Output.SetStatus(k.Status)
+		ctx.Output.Body(k.Body)
+	}
+}
+
+// storeIdempotentResponse stores the response of the request which claimed its key.
+// The key of a failed request is released, so that the request can be retried.
+func storeIdempotentResponse(ctx *context.Context) {
+	r, ok := ctx.ResponseWriter.ResponseWriter.(*idempotentResponse)
+	if !ok {
+		return
+	}
+	ctx.ResponseWriter.ResponseWriter = r.ResponseWriter
+	if r.status == 0 || r.status >= http.StatusInternalServerError {
+		if err := models.ReleaseIdempotencyKey(nil, r.key); err != nil {
+			beego.Error("Could not release idempotency key", r.key, err)
+		}
+		return
+	}
+	if err := models.CompleteIdempotencyKey(nil, r.key, r.status, r.Header().Get("Content-Type"), r.body.Bytes()); err != nil {
+		beego.Error("Could not store the response of idempotency key", r.key, err)
+	}
+}
+`
+)
@@ -0,0 +1,257 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import "path"
+
+// Importable reports whether records of the table can be created from CSV or xlsx
+// files, which is the case of the tables accepting posts with the import feature
+func (tb *Table) Importable() bool {
+	return featureEnabled(FeatureImport) && tb.Pk != "" && tb.Allows("post")
+}
+
+// ImportColumns returns the columns which can be read from an imported file, the
+// identity columns, the relations and the tenant column being left out
+func (tb *Table) ImportColumns() (cols []*Column) {
+	identity := make(map[*Column]bool)
+	for _, col := range tb.IdentityColumns() {
+		identity[col] = true
+	}
+	for _, col := range tb.Columns {
+		if identity[col] || col.Tag.RelFk || col.Tag.Column == tb.TenantColumn {
+			continue
+		}
+		cols = append(cols, col)
+	}
+	return
+}
+
+// Required reports whether an imported file must give a value to the column:
+// it is not null, without default and not set by the database
+func (col *Column) Required() bool {
+	return !col.Tag.Null && col.Tag.Default == "" && col.Tag.DefaultExpr == "" && !col.Tag.Auto && !col.Tag.AutoNow && !col.Tag.AutoNowAdd
+}
+
+// writeImportFile generates import.go reading the imported files, or nothing when
+// no table can be imported
+func writeImportFile(tables []*Table, mPath string) {
+	for _, tb := range tables {
+		if tb.Importable() {
+			writeGeneratedFile(path.Join(mPath, "import.go"), ImportTPL)
+			return
+		}
+	}
+}
+
+const ImportTPL = `package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ErrInvalidImport is wrapped by the errors of the imported files which can't be read,
+// or whose header row doesn't match the columns of the model
+var ErrInvalidImport = errors.New("models: invalid import file")
+
+// IsInvalidImport reports whether err is due to the imported file
+func IsInvalidImport(err error) bool {
+	return errors.Is(err, ErrInvalidImport)
+}
+
+// ImportRowError is a value of an imported file which can't be read
+type ImportRowError struct {
+	Row     int    ` + "`" + `json:"row"` + "`" + ` // line of the file, the header row being 1
+	Column  string ` + "`" + `json:"column"` + "`" + `
+	Message string ` + "`" + `json:"message"` + "`" + `
+}
+
+// ImportResult is the outcome of the import of a file, the records being inserted
+// only when there are no errors and it isn't a dry run
+type ImportResult struct {
+	Records int              ` + "`" + `json:"records"` + "`" + `
+	DryRun  bool             ` + "`" + `json:"dry_run"` + "`" + `
+	Errors  []ImportRowError ` + "`" + `json:"errors,omitempty"` + "`" + `
+}
+
+// importer is implemented by the models which can be imported
+type importer interface {
+	// importField returns a pointer to the field of column, or nil when the
+	// column can't be imported
+	importField(column string) interface{}
+}
+
+// readImportRows reads the rows of a CSV or xlsx file, the format being told by
+// the extension of name
+func readImportRows(r io.Reader, name string) ([][]string, error) {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".csv":
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		// the CSV files saved by Excel start with a byte order mark
+		cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		cr.FieldsPerRecord = -1
+		rows, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		return rows, nil
+	case ".xlsx":
+		f, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		defer f.Close()
+		// the first sheet is imported
+		rows, err := f.GetRows(f.GetSheetName(0))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported format '%s', must be either .csv or .xlsx", ErrInvalidImport, ext)
+	}
+}
+
+// parseImportRows maps the rows following the header row to the records returned by
+// newRecord, the header row holding column names. Blank rows are skipped.
+func parseImportRows(rows [][]string, required []string, newRecord func() importer) (records []importer, rowErrs []ImportRowError, err error) {
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("%w: no header row", ErrInvalidImport)
+	}
+	header := make([]string, len(rows[0]))
+	present := make(map[string]bool)
+	probe := newRecord()
+	for i, column := range rows[0] {
+		header[i] = strings.TrimSpace(column)
+		if probe.importField(header[i]) == nil {
+			return nil, nil, fmt.Errorf("%w: column '%s' can't be imported", ErrInvalidImport, header[i])
+		}
+		present[header[i]] = true
+	}
+	isRequired := make(map[string]bool)
+	for _, column := range required {
+		if !present[column] {
+			return nil, nil, fmt.Errorf("%w: required column '%s' is missing", ErrInvalidImport, column)
+		}
+		isRequired[column] = true
+	}
+	for i, row := range rows[1:] {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		record := newRecord()
+		for j, column := range header {
+			var cell string
+			if j < len(row) {
+				cell = strings.TrimSpace(row[j])
+			}
+			if cell == "" {
+				// the column keeps its zero value, or gets its default
+				if isRequired[column] {
+					rowErrs = append(rowErrs, ImportRowError{Row: i + 2, Column: column, Message: "value required"})
+				}
+				continue
+			}
+			if err := setImportValue(record.importField(column), cell); err != nil {
+				rowErrs = append(rowErrs, ImportRowError{Row: i + 2, Column: column, Message: err.Error()})
+			}
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// importTimeLayouts are the layouts of the times of the imported files
+var importTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// setImportValue parses s into the field pointed by ptr
+func setImportValue(ptr interface{}, s string) error {
+	v := reflect.ValueOf(ptr).Elem()
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct && v.Type() != timeType && v.NumField() > 0 && v.Type().Field(0).Anonymous {
+		// types embedding time.Time, e.g. Time
+		v = v.Field(0)
+	}
+	if v.Type() == timeType {
+		for _, layout := range importTimeLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid time '%s'", s)
+	}
+	if scanner, ok := v.Addr().Interface().(sql.Scanner); ok && (v.Kind() == reflect.Struct || v.Kind() == reflect.Array) {
+		// e.g. pgtype.Numeric or mssql.UniqueIdentifier
+		return scanner.Scan(s)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer '%s'", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer '%s'", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number '%s'", s)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean '%s'", s)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+`
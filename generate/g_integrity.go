@@ -0,0 +1,177 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"strconv"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// signatureColumns are the names of the columns holding the signature of a signed
+// table when its signature_column isn't set
+var signatureColumns = []string{"signature", "checksum", "hmac"}
+
+// applyIntegrity signs the records of the table with an HMAC of the primary key and of the
+// signed columns held by the signature column, when either is configured. The signed
+// columns default to the ones written as they are by the models: neither the primary
+// key, the times nor the columns set by the database or never updated. The immutable
+// columns can't be signed, the models signing the values they don't write.
+func applyIntegrity(tb *Table, column string, signed []string) {
+	if column == "" && len(signed) == 0 {
+		return
+	}
+	if column == "" {
+		for _, name := range signatureColumns {
+			if tb.Column(name) != nil {
+				column = name
+				break
+			}
+		}
+	}
+	if col := tb.Column(column); col == nil || col.Type != "string" {
+		beeLogger.Log.Fatalf("Table '%s' has no signature column, a not null string column named signature, checksum or hmac, or set by signature_column", tb.Name)
+	}
+	if len(signed) == 0 {
+		for _, col := range tb.Columns {
+			t := col.BaseType()
+			if col.Tag.Column == tb.Pk || col.Tag.Column == column || col.Tag.Column == "is_deleted" || col.Tag.Auto ||
+				col.Tag.AutoNow || col.Tag.AutoNowAdd || col.Tag.RelFk || col.Immutable || t == "time.Time" || t == "Time" {
+				continue
+			}
+			signed = append(signed, col.Tag.Column)
+		}
+	}
+	for _, name := range signed {
+		if col := tb.Column(name); col == nil || col.Tag.RelFk || col.Immutable || name == column || name == tb.Pk {
+			beeLogger.Log.Fatalf("Column '%s.%s' can't be signed", tb.Name, name)
+		}
+	}
+	if len(signed) == 0 {
+		beeLogger.Log.Fatalf("Table '%s' has no column to sign, set its signed_columns", tb.Name)
+	}
+	tb.SignatureColumn, tb.Signed = column, signed
+}
+
+// SignatureField returns the model field of the signature column
+func (tb *Table) SignatureField() string {
+	return tb.Column(tb.SignatureColumn).Name
+}
+
+// SignedFields returns the model fields of the signed columns, e.g. "m.Name, m.Email"
+func (tb *Table) SignedFields(recv string) string {
+	fields := make([]string, len(tb.Signed))
+	for i, name := range tb.Signed {
+		fields[i] = recv + "." + tb.Column(name).Name
+	}
+	return strings.Join(fields, ", ")
+}
+
+// SignedList returns the signed columns and the signature column as a list of Go strings
+func (tb *Table) SignedList() string {
+	cols := make([]string, 0, len(tb.Signed)+1)
+	for _, name := range tb.Signed {
+		cols = append(cols, strconv.Quote(name))
+	}
+	return strings.Join(append(cols, strconv.Quote(tb.SignatureColumn)), ", ")
+}
+
+const IntegrityTPL = `package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNoSigningKeyProvider is returned when reading or writing a signed record before SetSigningKeyProvider
+	ErrNoSigningKeyProvider = errors.New("no key provider of the signed records")
+	// ErrBadSignature is returned when reading a record whose signature doesn't match its columns,
+	// the record having been written by something else than the models
+	ErrBadSignature = errors.New("bad signature")
+)
+
+var signingKeyProvider KeyProvider
+
+// partialSetting is the gorm setting of the queries reading some of the columns only,
+// the signature of whose records can't be verified
+const partialSetting = "models:partial"
+
+// SetSigningKeyProvider sets the provider of the HMAC keys of the signed records, to be
+// called before the models are used
+func SetSigningKeyProvider(p KeyProvider) {
+	signingKeyProvider = p
+}
+
+// sign returns the signature of the values with the current key, as <key id>:<hex of
+// the HMAC-SHA256 of the JSON array of the values>
+func sign(values ...interface{}) (string, error) {
+	if signingKeyProvider == nil {
+		return "", ErrNoSigningKeyProvider
+	}
+	id, key, err := signingKeyProvider.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	mac, err := hmacOf(key, values)
+	if err != nil {
+		return "", err
+	}
+	return id + ":" + hex.EncodeToString(mac), nil
+}
+
+// verify checks that signature, returned by sign, is the one of the values
+func verify(signature string, values ...interface{}) error {
+	if signingKeyProvider == nil {
+		return ErrNoSigningKeyProvider
+	}
+	i := strings.Index(signature, ":")
+	if i < 0 {
+		return ErrBadSignature
+	}
+	mac, err := hex.DecodeString(signature[i+1:])
+	if err != nil {
+		return ErrBadSignature
+	}
+	key, err := signingKeyProvider.Key(signature[:i])
+	if err != nil {
+		return err
+	}
+	expected, err := hmacOf(key, values)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, expected) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// hmacOf returns the HMAC-SHA256 of the JSON array of the values
+func hmacOf(key []byte, values []interface{}) ([]byte, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+`
@@ -0,0 +1,108 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/skOak/hee/config"
+)
+
+// integrityTestFiles are added to the models to sign users on SQLite and read them back
+var integrityTestFiles = map[string]string{
+	"export_test.go": `package models
+
+import "github.com/jinzhu/gorm"
+
+func SetDB(d *gorm.DB) { db = d }
+`,
+	"integrity_test.go": `package models_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"example.com/app/models"
+)
+
+type keys struct{}
+
+func (keys) CurrentKey() (string, []byte, error) { return "k1", []byte("secret"), nil }
+func (keys) Key(id string) ([]byte, error)       { return []byte("secret"), nil }
+
+func TestSignature(t *testing.T) {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	models.SetDB(db)
+	models.SetSigningKeyProvider(keys{})
+	err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email TEXT NOT NULL, score REAL, created_at DATETIME, is_deleted INTEGER NOT NULL DEFAULT 0, signature TEXT NOT NULL DEFAULT '')").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for i := 0; i < 2; i++ {
+		id, err := models.AddUsers(nil, &models.Users{Name: "ann", Email: "ann@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := models.GetUsersById(nil, ids[0]); err != nil {
+		t.Fatalf("reading a created user returned %v", err)
+	}
+	v, err := models.GetUsersById(nil, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Score = 4
+	if err := models.UpdateUsersById(nil, v); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := models.GetUsersById(nil, ids[1]); err != nil || v.Score != 4 {
+		t.Fatalf("reading an updated user returned %v, %v", v, err)
+	}
+
+	if err := db.Exec("UPDATE users SET signature = (SELECT signature FROM users WHERE id = ?), score = NULL WHERE id = ?", ids[0], ids[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.GetUsersById(nil, ids[1]); err != models.ErrBadSignature {
+		t.Errorf("reading a user holding the signature of another one returned %v, want ErrBadSignature", err)
+	}
+	ml, _, err := models.GetAllUsers(nil, nil, []string{"id", "name"}, nil, nil, 0, 10)
+	if err != nil || len(ml) != 2 {
+		t.Errorf("reading the names of the users returned %d users, %v", len(ml), err)
+	}
+}
+`,
+}
+
+// TestSignedRecords signs records on SQLite, reads them back and tampers with them
+func TestSignedRecords(t *testing.T) {
+	conf := config.Conf
+	defer func() { config.Conf = conf }()
+	loadTestConfig(t, `{"appcode": {"tables": {"users": {"signature_column": "signature"}}}}`)
+
+	tables := fixtureTables()
+	users := tables[0]
+	users.Columns = append(users.Columns, &Column{Name: "Signature", Type: "string", SQLType: "text", Tag: &OrmTag{Column: "signature", Type: "text"}})
+	gopath := generateApp(t, "sqlite", tables, OModel)
+	testGeneratedPackage(t, gopath, "models", integrityTestFiles, "github.com/jinzhu/gorm", "github.com/mattn/go-sqlite3")
+}
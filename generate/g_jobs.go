@@ -0,0 +1,263 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// Background jobs which can be generated for a table, see the jobs option of the tables
+const (
+	JobImport = "import" // bulk insertion of records in a transaction
+	JobExport = "export" // export of the records matching a filter as JSON lines
+	JobPurge  = "purge"  // hard deletion of the soft deleted records
+)
+
+// jobsConfigured reports whether a table of the appcode configuration has background jobs
+func jobsConfigured() bool {
+	for _, conf := range config.Conf.Appcode.Tables {
+		for _, job := range conf.Jobs {
+			if !strings.EqualFold(job, JobExport) || featureEnabled(FeatureExport) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyJobs sets the background jobs configured for a table, checking they
+// can be generated for it
+func applyJobs(tb *Table, jobs []string) {
+	for _, job := range jobs {
+		switch job = strings.ToLower(job); job {
+		case JobImport:
+			if tb.ReadOnly {
+				beeLogger.Log.Fatalf("Table '%s' is read only, it can't have an import job", tb.Name)
+			}
+		case JobExport:
+			if !featureEnabled(FeatureExport) {
+				beeLogger.Log.Warnf("The export feature is disabled, the export job of table '%s' is skipped", tb.Name)
+				continue
+			}
+		case JobPurge:
+			if !tb.IdDelete {
+				beeLogger.Log.Fatalf("Table '%s' has no is_deleted column, it can't have a purge job", tb.Name)
+			}
+		default:
+			beeLogger.Log.Fatalf("Unknown job '%s' of table '%s'. Must be either \"import\", \"export\" or \"purge\"", job, tb.Name)
+		}
+		tb.Jobs = append(tb.Jobs, job)
+	}
+}
+
+// HasJob reports whether the job is generated for the table
+func (tb *Table) HasJob(job string) bool {
+	for _, j := range tb.Jobs {
+		if j == job {
+			return true
+		}
+	}
+	return false
+}
+
+// KeysetPk reports whether the records of the table can be paged by their primary
+// key, an integer, through the range of the primary key of the filter
+func (tb *Table) KeysetPk() bool {
+	col := tb.Column(tb.Pk)
+	if col == nil || !col.Filterable() {
+		return false
+	}
+	t := col.BaseType()
+	return strings.HasPrefix(t, "int") || strings.HasPrefix(t, "uint")
+}
+
+// jobsFileName returns the name of the jobs file of a table, e.g. user_jobs
+func jobsFileName(tableName string) string {
+	return appcodeFileName(tableName, "_jobs")
+}
+
+// writeJobFiles generates the asynq worker of the jobs package and the tasks
+// and enqueue helpers of the tables having background jobs
+func writeJobFiles(tables []*Table, jPath, pkgPath string) {
+	for _, tb := range tables {
+		if len(tb.Jobs) == 0 {
+			continue
+		}
+		content := strings.Replace(JobsTableTPL, "{{modelName}}", utils.CamelCase(tb.Name), -1)
+		content = strings.Replace(content, "{{tableName}}", tb.Name, -1)
+		content = strings.Replace(content, "{{pkgPath}}", pkgPath, -1)
+		writeGeneratedFile(path.Join(jPath, jobsFileName(tb.Name)+".go"), executeTemplate(content, tb))
+	}
+	writeGeneratedFile(path.Join(jPath, "jobs.go"), JobsTPL)
+}
+
+const (
+	JobsTPL = `package jobs
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hibiken/asynq"
+)
+
+// handlers holds the handlers of the tasks, keyed by task type
+var handlers = make(map[string]asynq.HandlerFunc)
+
+// register is used by the table files to declare the handler of a task type
+func register(taskType string, handler asynq.HandlerFunc) bool {
+	handlers[taskType] = handler
+	return true
+}
+
+var client *asynq.Client
+
+// Init connects the enqueue helpers to redis, it must be called before enqueueing tasks
+func Init(redis asynq.RedisConnOpt) {
+	client = asynq.NewClient(redis)
+}
+
+// Run processes the tasks of every table until the worker is stopped
+func Run(redis asynq.RedisConnOpt, cfg asynq.Config) error {
+	mux := asynq.NewServeMux()
+	for taskType, handler := range handlers {
+		mux.HandleFunc(taskType, handler)
+	}
+	return asynq.NewServer(redis, cfg).Run(mux)
+}
+
+func enqueue(taskType string, payload interface{}, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	if client == nil {
+		return nil, errors.New("jobs: Init has not been called")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return client.Enqueue(asynq.NewTask(taskType, data), opts...)
+}
+`
+	JobsTableTPL = `package jobs
+
+import (
+	"context"
+{{if or (.HasJob "import") (.HasJob "export")}}	"encoding/json"
+	"fmt"
+{{end}}{{if .HasJob "export"}}	"os"
+{{end}}
+	"{{pkgPath}}/models"
+
+	"github.com/hibiken/asynq"
+)
+
+// Task types of {{tableName}}
+const (
+{{if .HasJob "import"}}	Type{{modelName}}Import = "{{tableName}}:import"
+{{end}}{{if .HasJob "export"}}	Type{{modelName}}Export = "{{tableName}}:export"
+{{end}}{{if .HasJob "purge"}}	Type{{modelName}}Purge = "{{tableName}}:purge"
+{{end}})
+{{if .HasJob "import"}}
+var _ = register(Type{{modelName}}Import, handle{{modelName}}Import)
+
+// {{modelName}}ImportPayload is the payload of Type{{modelName}}Import
+type {{modelName}}ImportPayload struct {
+	Rows []*models.{{modelName}}
+}
+
+// Enqueue{{modelName}}Import enqueues the insertion of rows, all of them or none
+func Enqueue{{modelName}}Import(rows []*models.{{modelName}}, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	return enqueue(Type{{modelName}}Import, {{modelName}}ImportPayload{Rows: rows}, opts...)
+}
+
+func handle{{modelName}}Import(ctx context.Context, t *asynq.Task) error {
+	var p {{modelName}}ImportPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	return models.BulkAdd{{modelName}}s(nil, p.Rows)
+}
+{{end}}{{if .HasJob "export"}}
+var _ = register(Type{{modelName}}Export, handle{{modelName}}Export)
+
+// {{modelName}}ExportPayload is the payload of Type{{modelName}}Export
+type {{modelName}}ExportPayload struct {
+	Path   string // file written by the worker
+	Filter *models.{{modelName}}Filter
+}
+
+// Enqueue{{modelName}}Export enqueues the export of the records matching filter to
+// the file at path of the worker, one JSON object per line
+func Enqueue{{modelName}}Export(path string, filter *models.{{modelName}}Filter, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	return enqueue(Type{{modelName}}Export, {{modelName}}ExportPayload{Path: path, Filter: filter}, opts...)
+}
+
+func handle{{modelName}}Export(ctx context.Context, t *asynq.Task) error {
+	var p {{modelName}}ExportPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	f, err := os.Create(p.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	// the records are read by pages in the order of {{.Pk}}{{if .KeysetPk}}, each page starting
+	// after the last record of the former one{{end}}
+	const limit = 1000
+	byPk := models.OrderBy{Column: models.{{modelName}}Col{{.PkField}}}
+{{if .KeysetPk}}	var filter models.{{modelName}}Filter
+	if p.Filter != nil {
+		filter = *p.Filter
+	}
+	for {
+{{else}}	for offset := uint64(0); ; offset += limit {
+{{end}}		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ml, err := models.Search{{modelName}}sByFilter(nil, {{if .KeysetPk}}&filter{{else}}p.Filter{{end}}, []models.OrderBy{byPk}, {{if .KeysetPk}}0{{else}}offset{{end}}, limit)
+		if err != nil {
+			return err
+		}
+		for _, m := range ml {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+		if len(ml) < limit {
+			return f.Sync()
+		}
+{{if .KeysetPk}}		next := ml[len(ml)-1].{{.PkField}} + 1
+		filter.{{.PkField}}From = &next
+{{end}}	}
+}
+{{end}}{{if .HasJob "purge"}}
+var _ = register(Type{{modelName}}Purge, handle{{modelName}}Purge)
+
+// Enqueue{{modelName}}Purge enqueues the hard deletion of the soft deleted {{modelName}}s
+func Enqueue{{modelName}}Purge(opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	return enqueue(Type{{modelName}}Purge, struct{}{}, opts...)
+}
+
+func handle{{modelName}}Purge(ctx context.Context, t *asynq.Task) error {
+	return models.DB().Where("is_deleted = ?", 1).Delete(&models.{{modelName}}{}).Error
+}
+{{end}}`
+)
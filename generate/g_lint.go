@@ -0,0 +1,106 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"fmt"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// lintSchema reports the smells of the schema noticed while generating the code:
+// tables without primary key, foreign keys without index, varchar(255) used
+// by default and nullable booleans
+func lintSchema(dbms string, db *sql.DB, tables []*Table) {
+	indexed := indexedColumns(dbms, db)
+	var findings []string
+	var strings, defaultSized int
+	for _, tb := range tables {
+		if tb.Pk == "" && dbms != "clickhouse" {
+			findings = append(findings, fmt.Sprintf("table '%s' has no single column primary key, neither controller nor routes are generated for it", tb.Name))
+		}
+		for _, column := range fkColumns(tb) {
+			if !indexed[tb.Name][column] {
+				findings = append(findings, fmt.Sprintf("foreign key column '%s.%s' has no index, the joins and the deletions of '%s' scan '%s'", tb.Name, column, tb.Fk[column].RefTable, tb.Name))
+			}
+		}
+		for _, col := range tb.Columns {
+			if col.BaseType() == "string" && col.Tag.Type == "" && col.Tag.Size != "" {
+				strings++
+				if col.Tag.Size == "255" {
+					defaultSized++
+				}
+			}
+			if col.Tag.Null && (col.BaseType() == "bool" || col.SQLType == "tinyint(1)") {
+				findings = append(findings, fmt.Sprintf("boolean column '%s.%s' is nullable, NULL being a third state", tb.Name, col.Tag.Column))
+			}
+		}
+	}
+	if defaultSized >= 3 && defaultSized*2 > strings {
+		findings = append(findings, fmt.Sprintf("%d of the %d varchar columns are varchar(255), their sizes don't seem to be chosen", defaultSized, strings))
+	}
+	if len(findings) == 0 {
+		return
+	}
+	beeLogger.Log.Infof("Schema lint report, %d finding(s):", len(findings))
+	for _, finding := range findings {
+		beeLogger.Log.Warnf("%s", finding)
+	}
+}
+
+// indexedColumns returns the columns leading an index, keyed by table name
+func indexedColumns(dbms string, db *sql.DB) map[string]map[string]bool {
+	query := `SELECT table_name, column_name FROM information_schema.statistics
+		WHERE table_schema = database() AND seq_in_index = 1`
+	if dbms == "postgres" {
+		query = `SELECT t.relname, a.attname FROM pg_index i
+			JOIN pg_class t ON t.oid = i.indrelid
+			JOIN pg_namespace n ON n.oid = t.relnamespace
+			JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = i.indkey[0]
+		WHERE n.nspname = current_schema()`
+	} else if dbms == "mssql" {
+		query = `SELECT t.name, c.name FROM sys.index_columns ic
+			JOIN sys.tables t ON t.object_id = ic.object_id
+			JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+		WHERE ic.key_ordinal = 1 AND t.schema_id = SCHEMA_ID()`
+	} else if dbms == "clickhouse" {
+		query = `SELECT table, name FROM system.columns WHERE database = currentDatabase() AND is_in_sorting_key`
+	} else if dbms == "oracle" {
+		query = `SELECT LOWER(table_name), LOWER(column_name) FROM user_ind_columns WHERE column_position = 1`
+	} else if dbms == "sqlite" {
+		query = `SELECT m.name, i.name FROM sqlite_master m, pragma_index_list(m.name) l, pragma_index_info(l.name) i
+		WHERE m.type = 'table' AND i.seqno = 0`
+	}
+	indexed := make(map[string]map[string]bool)
+	rows, err := db.Query(query)
+	if err != nil {
+		beeLogger.Log.Warnf("Could not query the indexes: %s", err)
+		return indexed
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			beeLogger.Log.Warnf("Could not scan the indexes: %s", err)
+			return indexed
+		}
+		if indexed[table] == nil {
+			indexed[table] = make(map[string]bool)
+		}
+		indexed[table][column] = true
+	}
+	return indexed
+}
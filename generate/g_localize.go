@@ -0,0 +1,126 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// localizationSuffix ends the names of the tables holding the translations of the
+// columns of another table, one row per record and locale
+const localizationSuffix = "_i18n"
+
+// localeColumns are the names of the column holding the locale of a translation
+var localeColumns = []string{"locale", "lang", "language"}
+
+// localization is the translation table of a table
+type localization struct {
+	Table        string
+	FkColumn     string // column of Table referencing the translated record
+	LocaleColumn string
+	Columns      []*localizedColumn
+}
+
+// localizedColumn is a translated column
+type localizedColumn struct {
+	Column string
+	Name   string  // field name
+	Type   string  // Go type, without pointer
+	Base   *Column // column of the translated table, nil when only the translations have it
+}
+
+// detectLocalizations links the tables to their <table>_i18n translation table, made
+// of a foreign key to the table, a locale and the translated columns, so that the
+// localized getters get generated
+func detectLocalizations(db *sql.DB, trans DbTransformer, tables []*Table) {
+	byName := make(map[string]*Table)
+	for _, tb := range tables {
+		byName[tb.Name] = tb
+	}
+	allTables := make(map[string]bool)
+	for _, name := range trans.GetTableNames(db) {
+		allTables[name] = true
+	}
+	for _, tb := range tables {
+		name := tb.Name + localizationSuffix
+		if tb.Pk == "" || !allTables[name] {
+			continue
+		}
+		i18n, ok := byName[name]
+		if !ok {
+			// the translations are read even when their table is not selected
+			i18n = getTableObjects([]string{name}, db, trans)[0]
+			if TimeWrapper {
+				useTimeWrapper([]*Table{i18n})
+			}
+		}
+		tb.Localization = newLocalization(tb, i18n)
+	}
+}
+
+// newLocalization returns the localization of tb by the columns of i18n, or nil
+// when i18n doesn't follow the pattern
+func newLocalization(tb, i18n *Table) *localization {
+	l := &localization{Table: i18n.Name}
+	for column, fk := range i18n.Fk {
+		if fk.RefTable == tb.Name && fk.RefColumn == tb.Pk {
+			l.FkColumn = column
+		}
+	}
+	for _, name := range localeColumns {
+		if i18n.Column(name) != nil {
+			l.LocaleColumn = name
+			break
+		}
+	}
+	if l.FkColumn == "" || l.LocaleColumn == "" {
+		beeLogger.Log.Warnf("Table '%s' has no foreign key to '%s' or no locale column, it is not used as its translations", i18n.Name, tb.Name)
+		return nil
+	}
+	for _, col := range i18n.Columns {
+		switch name := col.Tag.Column; {
+		case name == i18n.Pk, name == l.FkColumn, name == l.LocaleColumn, col.Tag.RelFk,
+			col.Tag.AutoNow, col.Tag.AutoNowAdd, name == "is_deleted", strings.HasSuffix(name, "_at"):
+			continue
+		}
+		lc := &localizedColumn{Column: col.Tag.Column, Name: col.Name, Type: col.BaseType()}
+		if base := tb.Column(col.Tag.Column); base != nil && !base.Tag.RelFk {
+			lc.Name, lc.Type, lc.Base = base.Name, base.BaseType(), base
+		} else if lc.Type == "time.Time" {
+			tb.ImportTimePkg = true
+		}
+		l.Columns = append(l.Columns, lc)
+	}
+	if len(l.Columns) == 0 {
+		beeLogger.Log.Warnf("Table '%s' has no translated column, it is not used as the translations of '%s'", i18n.Name, tb.Name)
+		return nil
+	}
+	return l
+}
+
+// LocalizedSelect returns the columns read by the localized getter of the table:
+// those of the table, then the locale and the translated columns of the translation
+// table aliased with an i18n_ prefix
+func (tb *Table) LocalizedSelect() string {
+	l := tb.Localization
+	cols := []string{tb.Name + ".*", l.Table + "." + l.LocaleColumn + " AS i18n_" + l.LocaleColumn}
+	for _, col := range l.Columns {
+		cols = append(cols, l.Table+"."+col.Column+" AS i18n_"+col.Column)
+	}
+	return strings.Join(cols, ", ")
+}
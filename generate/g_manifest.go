@@ -0,0 +1,168 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// ManifestFile is the file, relative to the application path, listing
+// the files generated by appcode for each table
+const ManifestFile = ".appcode_manifest.json"
+
+// manifest records the files generated for each table, paths being
+// relative to the application path, and the database they were generated from
+type manifest struct {
+	Database *databaseFingerprint `json:"database,omitempty"`
+	Tables   map[string][]string  `json:"tables"`
+}
+
+// tableFiles returns the files generated for a table with the given mode
+// which exist under apppath
+func tableFiles(tb *Table, mode byte, apppath string) (files []string) {
+	var candidates []string
+	if (OModel & mode) == OModel {
+		candidates = append(candidates, path.Join(outputDir("models"), modelFileName(tb.Name)+".go"))
+	}
+	if (OController&mode) == OController && tb.Pk != "" {
+		candidates = append(candidates, path.Join(outputDir("controllers"), controllerFileName(tb.Name)+".go"))
+	}
+	if (ORouter&mode) == ORouter && tb.Pk != "" {
+		candidates = append(candidates, path.Join(outputDir("routers"), utils.SnakeString(tb.Name)+"_routes.go"))
+	}
+	if (OSqlc & mode) == OSqlc {
+		candidates = append(candidates, path.Join(outputDir("queries"), appcodeFileName(tb.Name, "")+".sql"))
+	}
+	if (OJobs&mode) == OJobs && len(tb.Jobs) > 0 {
+		candidates = append(candidates, path.Join(outputDir("jobs"), jobsFileName(tb.Name)+".go"))
+	}
+	if (OHandlers&mode) == OHandlers && tb.Pk != "" {
+		candidates = append(candidates, path.Join(outputDir("handlers"), handlersFileName(tb.Name)+".go"))
+	}
+	if (ODomain & mode) == ODomain {
+		candidates = append(candidates, path.Join(outputDir("domain"), domainFileName(tb.Name)+".go"))
+		candidates = append(candidates, path.Join(outputDir("persistence"), "mapper", domainFileName(tb.Name)+".go"))
+		if tb.Pk != "" {
+			candidates = append(candidates, path.Join(outputDir("persistence"), domainFileName(tb.Name)+".go"))
+		}
+	}
+	for _, f := range candidates {
+		if utils.IsExist(path.Join(apppath, f)) {
+			files = append(files, f)
+		}
+	}
+	return
+}
+
+// readManifest returns the manifest of apppath, empty when there is none
+func readManifest(apppath string) manifest {
+	fpath := path.Join(apppath, ManifestFile)
+	m := manifest{Tables: map[string][]string{}}
+	if utils.IsExist(fpath) {
+		if data, err := ioutil.ReadFile(fpath); err != nil {
+			beeLogger.Log.Warnf("Could not read the appcode manifest: %s", err)
+		} else if err := json.Unmarshal(data, &m); err != nil {
+			beeLogger.Log.Warnf("Could not parse the appcode manifest: %s", err)
+		}
+	}
+	if m.Tables == nil {
+		m.Tables = map[string][]string{}
+	}
+	return m
+}
+
+// updateManifest records the files generated for tables in the manifest of apppath.
+// Files listed by the previous manifest for tables which were dropped or not selected
+// this time are stale: they get deleted once confirmed, or stay listed otherwise.
+// The database is recorded by fp, the previous one being kept when fp is nil.
+func updateManifest(tables []*Table, mode byte, fp *databaseFingerprint, apppath string) {
+	fpath := path.Join(apppath, ManifestFile)
+	previous := readManifest(apppath)
+
+	current := manifest{Database: fp, Tables: make(map[string][]string)}
+	if fp == nil {
+		current.Database = previous.Database
+	} else if fp.SchemaHash == "" && previous.Database != nil && previous.Database.identity() == fp.identity() {
+		// only some tables were introspected, the hash of the schema is unknown
+		current.Database.SchemaHash = previous.Database.SchemaHash
+	}
+	owned := make(map[string]bool)
+	for _, tb := range tables {
+		files := tableFiles(tb, tableMode(tb, mode), apppath)
+		for _, f := range files {
+			owned[f] = true
+		}
+		// keep the files of the kinds excluded this time, see -only and -skip
+		skipped := make(map[string]bool)
+		for _, f := range tableFiles(tb, ^mode, apppath) {
+			skipped[f] = true
+		}
+		for _, f := range previous.Tables[tb.Name] {
+			if !owned[f] && skipped[f] {
+				files = append(files, f)
+				owned[f] = true
+			}
+		}
+		current.Tables[tb.Name] = files
+	}
+
+	var staleTables, staleFiles []string
+	for name, files := range previous.Tables {
+		if _, ok := current.Tables[name]; ok {
+			continue
+		}
+		staleTables = append(staleTables, name)
+		for _, f := range files {
+			if !owned[f] && utils.IsExist(path.Join(apppath, f)) {
+				staleFiles = append(staleFiles, f)
+			}
+		}
+	}
+	sort.Strings(staleFiles)
+	if len(staleFiles) > 0 {
+		for _, f := range staleFiles {
+			beeLogger.Log.Warnf("Stale generated file '%s'", f)
+		}
+		beeLogger.Log.Warnf("The files above were generated for tables which no longer exist or were not selected. Do you want to delete them? [Yes|No] ")
+		if utils.AskForConfirmation() {
+			for _, f := range staleFiles {
+				if err := os.Remove(filepath.Join(apppath, f)); err != nil {
+					beeLogger.Log.Warnf("%s", err)
+				}
+			}
+		} else {
+			// keep the stale tables listed, to offer the cleanup again next time
+			for _, name := range staleTables {
+				current.Tables[name] = previous.Tables[name]
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not encode the appcode manifest: %s", err)
+	}
+	if err := utils.WriteFileAtomic(fpath, append(data, '\n'), 0644); err != nil {
+		beeLogger.Log.Warnf("Could not write the appcode manifest: %s", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"fmt"
+	"path"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// maskFuncs maps the kinds of sensitive columns to the generated function masking them
+var maskFuncs = map[string]string{
+	"phone":   "maskPhone",
+	"id_card": "maskIdCard",
+	"email":   "maskEmail",
+	"full":    "maskFull",
+}
+
+// applyMasks marks the sensitive columns of the table, keyed by column name,
+// with the kind of masking applied to them in the responses
+func applyMasks(tb *Table, sensitive map[string]string) {
+	for name, kind := range sensitive {
+		col := tb.Column(name)
+		if col == nil {
+			beeLogger.Log.Warnf("Sensitive column '%s' not found in table '%s'", name, tb.Name)
+			continue
+		}
+		if _, ok := maskFuncs[kind]; !ok {
+			beeLogger.Log.Fatalf("Invalid masking '%s' of column '%s.%s'. Must be either phone, id_card, email or full", kind, tb.Name, name)
+		}
+		if col.BaseType() != "string" && !col.Encrypted {
+			beeLogger.Log.Fatalf("Sensitive column '%s.%s' is not a string, it can't be masked", tb.Name, name)
+		}
+		col.Mask = kind
+	}
+}
+
+// MaskExpr returns the expression masking v, a value of the sensitive column
+func (col *Column) MaskExpr(v string) string {
+	if col.Encrypted {
+		return fmt.Sprintf("%s(%s(string(%s)))", encryptedType, maskFuncs[col.Mask], v)
+	}
+	return fmt.Sprintf("%s(%s)", maskFuncs[col.Mask], v)
+}
+
+// MaskedColumns returns the sensitive columns of the table
+func (tb *Table) MaskedColumns() (cols []*Column) {
+	for _, col := range tb.Columns {
+		if col.Mask != "" {
+			cols = append(cols, col)
+		}
+	}
+	return
+}
+
+// writeMaskFile generates mask.go holding the masking functions, or nothing
+// when no table has a sensitive column
+func writeMaskFile(tables []*Table, mPath string) {
+	for _, tb := range tables {
+		if len(tb.MaskedColumns()) > 0 {
+			writeGeneratedFile(path.Join(mPath, "mask.go"), MaskTPL)
+			return
+		}
+	}
+}
+
+const MaskTPL = `package models
+
+import "strings"
+
+// maskKeep masks s but its first head and last tail characters, or masks it
+// fully when it is too short to keep them
+func maskKeep(s string, head, tail int) string {
+	r := []rune(s)
+	if len(r) <= head+tail {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:head]) + strings.Repeat("*", len(r)-head-tail) + string(r[len(r)-tail:])
+}
+
+// maskPhone masks a phone number but its first 3 and last 4 digits, e.g. 138****1234
+func maskPhone(s string) string {
+	return maskKeep(s, 3, 4)
+}
+
+// maskIdCard masks an identity card number but its first 6 and last 4 characters,
+// e.g. 110101********123X
+func maskIdCard(s string) string {
+	return maskKeep(s, 6, 4)
+}
+
+// maskEmail masks the local part of an email address but its first character,
+// e.g. j***@example.com
+func maskEmail(s string) string {
+	i := strings.LastIndex(s, "@")
+	if i < 0 {
+		return maskKeep(s, 1, 0)
+	}
+	return maskKeep(s[:i], 1, 0) + s[i:]
+}
+
+// maskFull masks s whatever its length, e.g. ****
+func maskFull(s string) string {
+	if s == "" {
+		return s
+	}
+	return "****"
+}
+`
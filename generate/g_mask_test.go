@@ -0,0 +1,91 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/skOak/hee/config"
+)
+
+// maskTestFiles are added to the models to send masked users back on SQLite
+var maskTestFiles = map[string]string{
+	"export_test.go": `package models
+
+import "github.com/jinzhu/gorm"
+
+func SetDB(d *gorm.DB) { db = d }
+`,
+	"mask_test.go": `package models_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"example.com/app/models"
+)
+
+func TestUpdateMasked(t *testing.T) {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	models.SetDB(db)
+	err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email TEXT NOT NULL, score REAL, created_at DATETIME, is_deleted INTEGER NOT NULL DEFAULT 0)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := models.AddUsers(nil, &models.Users{Name: "ann", Email: "ann@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := models.GetUsersById(nil, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.Masked()
+	m.Score = 4
+	if err := models.UpdateUsersById(nil, m); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := models.GetUsersById(nil, id); err != nil || v.Name != "ann" || v.Email != "ann@example.com" || v.Score != 4 {
+		t.Fatalf("updating a masked user stored %+v, %v", v, err)
+	}
+
+	m.Email = "bob@example.com"
+	if err := models.UpdateUsersById(nil, m); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := models.GetUsersById(nil, id); err != nil || v.Name != "ann" || v.Email != "bob@example.com" {
+		t.Fatalf("updating the email of a masked user stored %+v, %v", v, err)
+	}
+}
+`,
+}
+
+// TestMaskedRoundTrip sends the masked users back to UpdateUsersById on SQLite, the
+// masked values keeping the stored ones
+func TestMaskedRoundTrip(t *testing.T) {
+	conf := config.Conf
+	defer func() { config.Conf = conf }()
+	loadTestConfig(t, `{"appcode": {"tables": {"users": {"sensitive": {"name": "full", "email": "email"}}}}}`)
+
+	gopath := generateApp(t, "sqlite", fixtureTables(), OModel)
+	testGeneratedPackage(t, gopath, "models", maskTestFiles, "github.com/jinzhu/gorm", "github.com/mattn/go-sqlite3")
+}
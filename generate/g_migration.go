@@ -91,6 +91,9 @@ func (m mysqlDriver) getSQLType(ktype string) (tp, tag string) {
 	case "pk":
 		return "int(11) NOT NULL", "PRIMARY KEY (%s)"
 	case "datetime":
+		if len(kv) == 2 {
+			return "datetime(" + kv[1] + ") NOT NULL", ""
+		}
 		return "datetime NOT NULL", ""
 	case "int", "int8", "int16", "int32", "int64":
 		fallthrough
@@ -161,6 +164,9 @@ func (m postgresqlDriver) getSQLType(ktype string) (tp, tag string) {
 	case "auto", "pk":
 		return "serial primary key", ""
 	case "datetime":
+		if len(kv) == 2 {
+			return "TIMESTAMP(" + kv[1] + ") WITHOUT TIME ZONE NOT NULL", ""
+		}
 		return "TIMESTAMP WITHOUT TIME ZONE NOT NULL", ""
 	case "int", "int8", "int16", "int32", "int64":
 		fallthrough
@@ -186,6 +192,71 @@ func NewDBDriver() DBDriver {
 	}
 }
 
+// writeSoftUniqueMigrations generates one migration per soft deleted table with
+// unique keys, so that uniqueness only applies to the rows that are not deleted.
+// PostgreSQL and SQLite get partial unique indexes, SQL Server filtered unique
+// indexes, Oracle unique function-based indexes leaving the deleted rows out, MySQL
+// gets unique generated columns which are NULL for deleted rows. The original single
+// column unique keys are dropped, and restored by the down migration.
+func writeSoftUniqueMigrations(dbms string, tables []*Table, curpath string) {
+	for _, tb := range tables {
+		if !tb.IdDelete || len(tb.UniqueColumns()) == 0 {
+			continue
+		}
+		var ups, downs, kept []string
+		for _, col := range tb.UniqueColumns() {
+			key := fmt.Sprintf("%s_%s_live_key", tb.Name, col.Tag.Column)
+			uk, named := tb.UkNames[col.Tag.Column]
+			if !named {
+				kept = append(kept, col.Tag.Column)
+			}
+			if dbms == "postgres" || dbms == "sqlite" {
+				ups = append(ups, fmt.Sprintf(`m.SQL("CREATE UNIQUE INDEX \"%s\" ON \"%s\" (\"%s\") WHERE is_deleted = 0")`, key, tb.Name, col.Tag.Column))
+				if named && dbms == "postgres" {
+					ups = append(ups, fmt.Sprintf(`m.SQL("ALTER TABLE \"%s\" DROP CONSTRAINT \"%s\"")`, tb.Name, uk))
+					downs = append(downs, fmt.Sprintf(`m.SQL("ALTER TABLE \"%s\" ADD CONSTRAINT \"%s\" UNIQUE (\"%s\")")`, tb.Name, uk, col.Tag.Column))
+				} else if named {
+					ups = append(ups, fmt.Sprintf(`m.SQL("DROP INDEX \"%s\"")`, uk))
+					downs = append(downs, fmt.Sprintf(`m.SQL("CREATE UNIQUE INDEX \"%s\" ON \"%s\" (\"%s\")")`, uk, tb.Name, col.Tag.Column))
+				}
+				downs = append(downs, fmt.Sprintf(`m.SQL("DROP INDEX \"%s\"")`, key))
+				continue
+			}
+			if dbms == "mssql" {
+				ups = append(ups, fmt.Sprintf(`m.SQL("CREATE UNIQUE INDEX [%s] ON [%s] ([%s]) WHERE is_deleted = 0")`, key, tb.Name, col.Tag.Column))
+				if named {
+					ups = append(ups, fmt.Sprintf(`m.SQL("ALTER TABLE [%s] DROP CONSTRAINT [%s]")`, tb.Name, uk))
+					downs = append(downs, fmt.Sprintf(`m.SQL("ALTER TABLE [%s] ADD CONSTRAINT [%s] UNIQUE ([%s])")`, tb.Name, uk, col.Tag.Column))
+				}
+				downs = append(downs, fmt.Sprintf(`m.SQL("DROP INDEX [%s] ON [%s]")`, key, tb.Name))
+				continue
+			}
+			if dbms == "oracle" {
+				// the rows whose expression is NULL are not indexed
+				ups = append(ups, fmt.Sprintf(`m.SQL("CREATE UNIQUE INDEX %s ON %s (CASE WHEN is_deleted = 0 THEN %s END)")`, key, tb.Name, col.Tag.Column))
+				if named {
+					ups = append(ups, fmt.Sprintf(`m.SQL("ALTER TABLE %s DROP CONSTRAINT %s")`, tb.Name, uk))
+					downs = append(downs, fmt.Sprintf(`m.SQL("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)")`, tb.Name, uk, col.Tag.Column))
+				}
+				downs = append(downs, fmt.Sprintf(`m.SQL("DROP INDEX %s")`, key))
+				continue
+			}
+			var drop, restore string
+			if named {
+				drop = fmt.Sprintf(", DROP INDEX `%s`", uk)
+				restore = fmt.Sprintf("ADD UNIQUE KEY `%s` (`%s`), ", uk, col.Tag.Column)
+			}
+			ups = append(ups, fmt.Sprintf("m.SQL(\"ALTER TABLE `%s` ADD COLUMN `%s` %s GENERATED ALWAYS AS (IF(is_deleted = 0, `%s`, NULL)) VIRTUAL, ADD UNIQUE KEY `%s` (`%s`)%s\")",
+				tb.Name, key, col.SQLType, col.Tag.Column, key, key, drop))
+			downs = append(downs, fmt.Sprintf("m.SQL(\"ALTER TABLE `%s` %sDROP INDEX `%s`, DROP COLUMN `%s`\")", tb.Name, restore, key, key))
+		}
+		if len(kept) > 0 {
+			ups = append(ups, fmt.Sprintf("// the plain unique keys of %s can be dropped once this migration is applied", strings.Join(kept, ", ")))
+		}
+		GenerateMigration("soft_unique_"+tb.Name, strings.Join(ups, "\n"), strings.Join(downs, "\n"), curpath)
+	}
+}
+
 // generateMigration generates migration file template for database schema update.
 // The generated file template consists of an up() method for updating schema and
 // a down() method for reverting the update.
@@ -0,0 +1,59 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSoftUniqueMigrations(t *testing.T) {
+	users := &Table{Name: "users", Pk: "id", Uk: []string{"email", "login"}, UkNames: map[string]string{"email": "users_email_key"}, IdDelete: true}
+	users.Columns = []*Column{
+		{Name: "Id", Type: "int64", SQLType: "integer", Tag: &OrmTag{Column: "id", Auto: true}},
+		{Name: "Email", Type: "string", SQLType: "varchar(255)", Tag: &OrmTag{Column: "email"}},
+		{Name: "Login", Type: "string", SQLType: "varchar(64)", Tag: &OrmTag{Column: "login"}},
+		{Name: "IsDeleted", Type: "int8", SQLType: "integer", Tag: &OrmTag{Column: "is_deleted"}},
+	}
+	for dbms, want := range map[string][]string{
+		"postgres": {
+			`ALTER TABLE \"users\" DROP CONSTRAINT \"users_email_key\"`,
+			`ALTER TABLE \"users\" ADD CONSTRAINT \"users_email_key\" UNIQUE (\"email\")`,
+			"the plain unique keys of login can be dropped",
+		},
+		"mysql": {
+			"ADD UNIQUE KEY `users_email_live_key` (`users_email_live_key`), DROP INDEX `users_email_key`",
+			"ALTER TABLE `users` ADD UNIQUE KEY `users_email_key` (`email`), DROP INDEX `users_email_live_key`",
+		},
+	} {
+		dir := t.TempDir()
+		writeSoftUniqueMigrations(dbms, []*Table{users}, dir)
+		files, _ := filepath.Glob(filepath.Join(dir, DBPath, MPath, "*_soft_unique_users.go"))
+		if len(files) != 1 {
+			t.Fatalf("%s: got migrations %v", dbms, files)
+		}
+		data, err := ioutil.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s: migration misses %s:\n%s", dbms, s, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// moneySuffixes end the names of the integer columns holding an amount in minor
+// units, unless the configuration lists its own
+var moneySuffixes = []string{"_cents", "_amount"}
+
+// moneyColumn is an amount in minor units, with the column of its currency
+type moneyColumn struct {
+	Name     string  // name of the Money accessors, e.g. Total for total_cents
+	Amount   *Column // integer column of the minor units
+	Currency *Column // string column of the currency, nil for the default currency
+}
+
+// applyMoney gives the amount columns of the table, named by the money suffixes,
+// accessors reading and writing them as a Money. The currency of an amount is the
+// <amount>_currency or currency column, or the default currency when there is none
+func applyMoney(tb *Table) {
+	conf := config.Conf.Appcode.Money
+	if !conf.Enabled {
+		return
+	}
+	suffixes := conf.Suffixes
+	if len(suffixes) == 0 {
+		suffixes = moneySuffixes
+	}
+	for _, col := range tb.Columns {
+		name := col.Tag.Column
+		if name == tb.Pk || col.Tag.RelFk {
+			continue
+		}
+		for _, suffix := range suffixes {
+			base := strings.TrimSuffix(name, suffix)
+			if base == name || base == "" {
+				continue
+			}
+			if col.Type != "int64" && col.Type != "int" && col.Type != "int32" {
+				beeLogger.Log.Warnf("Column '%s.%s' is not an integer, it is not read as money", tb.Name, name)
+				break
+			}
+			m := &moneyColumn{Name: utils.CamelCase(base), Amount: col}
+			for _, currency := range []string{base + "_currency", "currency"} {
+				if c := tb.Column(currency); c != nil && c.Type == "string" {
+					m.Currency = c
+					break
+				}
+			}
+			if m.Currency == nil && conf.Currency == "" {
+				beeLogger.Log.Fatalf("Column '%s.%s' has no currency column, the default money currency must be set", tb.Name, name)
+			}
+			tb.Money = append(tb.Money, m)
+			break
+		}
+	}
+}
+
+// writeMoneyFile generates money.go holding the Money type, or nothing when no
+// table has an amount column
+func writeMoneyFile(tables []*Table, mPath string) {
+	for _, tb := range tables {
+		if len(tb.Money) > 0 {
+			writeGeneratedFile(path.Join(mPath, "money.go"), executeTemplate(MoneyTPL, struct{ Currency string }{config.Conf.Appcode.Money.Currency}))
+			return
+		}
+	}
+}
+
+const MoneyTPL = `package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of the amounts without a currency column
+const DefaultCurrency = {{printf "%q" .Currency}}
+
+// ErrCurrencyMismatch is returned by the operations on amounts of different currencies
+var ErrCurrencyMismatch = errors.New("models: currencies don't match")
+
+// currencyExponents are the numbers of decimals of the currencies, 2 for the others
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Money is an amount in the minor units of its currency, e.g. cents, so that the
+// amounts are never rounded as floats would be
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// NewMoney returns the Money of minor units of currency
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// ParseMoney returns the Money of a decimal amount of currency, e.g. "12.34", failing
+// when the amount has more decimals than the currency
+func ParseMoney(amount, currency string) (Money, error) {
+	exp := currencyExponent(currency)
+	s := strings.TrimSpace(amount)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	units, decimals := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		units, decimals = s[:i], s[i+1:]
+	}
+	if len(decimals) > exp || units == "" && decimals == "" {
+		return Money{}, fmt.Errorf("models: invalid amount %q of %s", amount, currency)
+	}
+	minor, err := strconv.ParseInt(units+decimals+strings.Repeat("0", exp-len(decimals)), 10, 64)
+	if err != nil || strings.ContainsAny(units+decimals, "+-") {
+		return Money{}, fmt.Errorf("models: invalid amount %q of %s", amount, currency)
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// currencyExponent returns the number of decimals of currency
+func currencyExponent(currency string) int {
+	if exp, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Minor: m.Minor + o.Minor, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Minor: m.Minor - o.Minor, Currency: m.Currency}, nil
+}
+
+// Mul returns m times n
+func (m Money) Mul(n int64) Money {
+	return Money{Minor: m.Minor * n, Currency: m.Currency}
+}
+
+// Allocate splits m in parts amounts differing by one minor unit at most, the first
+// ones getting the remainder, so that they sum up to m
+func (m Money) Allocate(parts int) []Money {
+	if parts <= 0 {
+		return nil
+	}
+	share, remainder := m.Minor/int64(parts), m.Minor%int64(parts)
+	ms := make([]Money, parts)
+	for i := range ms {
+		ms[i] = Money{Minor: share, Currency: m.Currency}
+		if remainder > 0 {
+			ms[i].Minor++
+			remainder--
+		} else if remainder < 0 {
+			ms[i].Minor--
+			remainder++
+		}
+	}
+	return ms
+}
+
+// Cmp compares m and o, returning -1, 0 or +1
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.Minor < o.Minor:
+		return -1, nil
+	case m.Minor > o.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// IsZero reports whether m is a zero amount
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Amount returns the decimal amount of m, e.g. "12.34" for 1234 cents
+func (m Money) Amount() string {
+	exp := currencyExponent(m.Currency)
+	minor, sign := m.Minor, ""
+	if minor < 0 {
+		minor, sign = -minor, "-"
+	}
+	s := strconv.FormatUint(uint64(minor), 10)
+	if exp == 0 {
+		return sign + s
+	}
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp-len(s)+1) + s
+	}
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+// String returns the amount and the currency of m, e.g. "12.34 USD"
+func (m Money) String() string {
+	return m.Amount() + " " + m.Currency
+}
+
+// moneyJSON is the JSON encoding of a Money, the amount being a string to keep
+// its decimals exact
+type moneyJSON struct {
+	Amount   string ` + "`" + `json:"amount"` + "`" + `
+	Minor    *int64 ` + "`" + `json:"minor,omitempty"` + "`" + `
+	Currency string ` + "`" + `json:"currency"` + "`" + `
+}
+
+// MarshalJSON encodes m as its decimal amount, minor units and currency,
+// e.g. {"amount":"12.34","minor":1234,"currency":"USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	minor := m.Minor
+	return json.Marshal(moneyJSON{Amount: m.Amount(), Minor: &minor, Currency: m.Currency})
+}
+
+// UnmarshalJSON decodes the encoding of MarshalJSON, the minor units being read
+// from the amount when they are missing
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Minor != nil {
+		*m = Money{Minor: *v.Minor, Currency: v.Currency}
+		return nil
+	}
+	parsed, err := ParseMoney(v.Amount, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+`
@@ -0,0 +1,346 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// MssqlDB is the SQL Server version of DbTransformer
+type MssqlDB struct {
+}
+
+// typeMappingMssql maps T-SQL data types to Go types
+var typeMappingMssql = map[string]string{
+	"tinyint":          "uint8", // int
+	"smallint":         "int16",
+	"int":              "int",
+	"bigint":           "int64",
+	"bit":              "bool",   // bool
+	"char":             "string", // string & text
+	"varchar":          "string",
+	"nchar":            "string",
+	"nvarchar":         "string",
+	"text":             "string",
+	"ntext":            "string",
+	"xml":              "string",
+	"sysname":          "string",
+	"date":             "time.Time", // time
+	"time":             "time.Time",
+	"datetime":         "time.Time",
+	"datetime2":        "time.Time",
+	"smalldatetime":    "time.Time",
+	"datetimeoffset":   "time.Time",
+	"real":             "float32", // float & decimal
+	"float":            "float64",
+	"decimal":          "float64",
+	"numeric":          "float64",
+	"money":            "float64", // money
+	"smallmoney":       "float64",
+	"binary":           "string", // binary
+	"varbinary":        "string",
+	"image":            "string",
+	"uniqueidentifier": "mssql.UniqueIdentifier", // uuid, stored in mixed-endian order
+}
+
+// GetTableNames for SQL Server, the tables of the default schema of the user
+func (*MssqlDB) GetTableNames(db *sql.DB) (tables []string) {
+	rows, err := db.Query(`SELECT name FROM sys.tables WHERE is_ms_shipped = 0 AND schema_id = SCHEMA_ID() ORDER BY name`)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show tables: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			beeLogger.Log.Fatalf("Could not show tables: %s", err)
+		}
+		tables = append(tables, name)
+	}
+	return
+}
+
+// GetConstraints for SQL Server, the primary and unique keys from information_schema
+// and the foreign keys from sys.foreign_key_columns
+func (*MssqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
+	rows, err := db.Query(
+		`SELECT
+			c.constraint_type, c.constraint_name, u.column_name, u.ordinal_position, col.data_type
+		FROM
+			information_schema.table_constraints c
+		INNER JOIN
+			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name AND c.table_schema = u.table_schema
+		INNER JOIN
+			information_schema.columns col ON col.table_schema = u.table_schema AND col.table_name = u.table_name AND col.column_name = u.column_name
+		WHERE
+			c.table_schema = SCHEMA_NAME() AND c.table_name = @p1 AND c.constraint_type IN ('PRIMARY KEY', 'UNIQUE')`,
+		table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query INFORMATION_SCHEMA for PK/UK information: %s", err)
+	}
+	uks := make(map[string][]string)
+	for rows.Next() {
+		var constraintType, constraintName, columnName, dataType string
+		var ordinalPos int
+		if err := rows.Scan(&constraintType, &constraintName, &columnName, &ordinalPos, &dataType); err != nil {
+			beeLogger.Log.Fatalf("Could not read INFORMATION_SCHEMA for PK/UK information: %s", err)
+		}
+		if constraintType == "PRIMARY KEY" {
+			if dataType == "uniqueidentifier" {
+				// the generated controllers parse integer or string ids only
+				beeLogger.Log.Warnf("Table '%s' has a uniqueidentifier primary key, it is generated without primary key", table.Name)
+			}
+			if ordinalPos == 1 && dataType != "uniqueidentifier" && !blackList[table.Name] {
+				table.Pk = columnName
+			} else {
+				table.Pk = ""
+				// add table to blacklist so that other struct will not reference it, because we are not
+				// registering blacklisted tables
+				blackList[table.Name] = true
+			}
+		} else {
+			table.Uk = append(table.Uk, columnName)
+			uks[constraintName] = append(uks[constraintName], columnName)
+		}
+	}
+	rows.Close()
+	table.nameUniqueKeys(uks)
+
+	rows, err = db.Query(
+		`SELECT
+			COL_NAME(parent_object_id, parent_column_id),
+			OBJECT_SCHEMA_NAME(referenced_object_id),
+			OBJECT_NAME(referenced_object_id),
+			COL_NAME(referenced_object_id, referenced_column_id)
+		FROM
+			sys.foreign_key_columns
+		WHERE
+			parent_object_id = OBJECT_ID(QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(@p1))`,
+		table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the foreign keys of '%s': %s", table.Name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		fk := new(ForeignKey)
+		if err := rows.Scan(&fk.Name, &fk.RefSchema, &fk.RefTable, &fk.RefColumn); err != nil {
+			beeLogger.Log.Fatalf("Could not read the foreign keys of '%s': %s", table.Name, err)
+		}
+		table.Fk[fk.Name] = fk
+	}
+}
+
+// GetColumns for SQL Server, from sys.columns. The comments are the MS_Description
+// extended properties
+func (mssqlDB *MssqlDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+	colDefRows, err := db.Query(
+		`SELECT
+			c.name, t.name, c.max_length, c.precision, c.scale, c.is_nullable, c.is_identity, c.is_computed,
+			COALESCE(OBJECT_DEFINITION(c.default_object_id), ''),
+			COALESCE(CAST(p.value AS nvarchar(4000)), '')
+		FROM
+			sys.columns c
+		INNER JOIN
+			sys.types t ON t.user_type_id = c.user_type_id
+		LEFT JOIN
+			sys.extended_properties p ON p.major_id = c.object_id AND p.minor_id = c.column_id AND p.class = 1 AND p.name = 'MS_Description'
+		WHERE
+			c.object_id = OBJECT_ID(QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(@p1))
+		ORDER BY
+			c.column_id`,
+		table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the columns of '%s': %s", table.Name, err)
+	}
+	defer colDefRows.Close()
+
+	for colDefRows.Next() {
+		var colName, dataType, columnDefault, columnComment string
+		var maxLength, precision, scale int
+		var isNullable, isIdentity, isComputed bool
+		if err := colDefRows.Scan(&colName, &dataType, &maxLength, &precision, &scale, &isNullable, &isIdentity, &isComputed, &columnDefault, &columnComment); err != nil {
+			beeLogger.Log.Fatalf("Could not read the columns of '%s': %s", table.Name, err)
+		}
+		// computed and rowversion columns are written by SQL Server only
+		if isComputed || dataType == "timestamp" || dataType == "rowversion" {
+			beeLogger.Log.Infof("Skipping read-only column '%s.%s'", table.Name, colName)
+			continue
+		}
+		columnType := mssqlColumnType(dataType, maxLength, precision, scale)
+
+		// create a column
+		col := new(Column)
+		col.Name = utils.CamelCase(colName)
+		col.Type, err = mssqlDB.GetGoDataType(dataType)
+		if err != nil {
+			beeLogger.Log.Fatalf("%s", err)
+		}
+		if colName == "is_deleted" {
+			// 如果存在该列，则会记录需要用这个字段来代表删除动作
+			table.IdDelete = true
+		}
+
+		// Tag info
+		tag := new(OrmTag)
+		tag.Column = colName
+		tag.Comment = columnComment
+		if table.Pk == colName {
+			if KeepPkName {
+				// gorm only guesses the primary key of a field named Id
+				tag.Pk = true
+			} else {
+				col.Name = "Id"
+			}
+			table.PkType = col.Type
+			if isIdentity {
+				tag.Auto = true
+			} else {
+				tag.Pk = true
+			}
+		} else {
+			fkCol, isFk := table.Fk[colName]
+			isBl := false
+			if isFk {
+				_, isBl = blackList[fkCol.RefTable]
+			}
+			// check if the current column is a foreign key
+			if isFk && !isBl {
+				tag.RelFk = true
+				refStructName := fkCol.RefTable
+				tag.TableFk = refStructName
+				col.Name = utils.CamelCase(colName)
+				col.Type = "*" + utils.CamelCase(refStructName)
+			} else {
+				// if the name of column is Id, and it's not primary key
+				if colName == "id" {
+					col.Name = idFieldName
+				}
+				if isNullable {
+					tag.Null = true
+				}
+				if strings.HasSuffix(dataType, "char") || strings.HasSuffix(dataType, "binary") {
+					tag.Size = extractColSize(columnType)
+				}
+				if dataType == "text" || dataType == "ntext" || dataType == "xml" || dataType == "uniqueidentifier" {
+					tag.Type = dataType
+				}
+				def := mssqlDefault(columnDefault)
+				if typeMappingMssql[dataType] == "time.Time" {
+					tag.Type = columnType
+					if isMssqlCurrentTimestamp(def) {
+						tag.AutoNowAdd = true
+					}
+					// NULL must not be read as the zero time, use a pointer instead
+					if tag.Null {
+						col.Type = "*" + col.Type
+					}
+					// need to import time package
+					table.ImportTimePkg = true
+				}
+				if !tag.AutoNowAdd && def != "" && def != "NULL" {
+					if strings.HasPrefix(def, "N'") {
+						def = def[1:]
+					}
+					if strings.HasPrefix(def, "'") || regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`).MatchString(def) {
+						tag.Default = literalDefault(colName, def)
+					} else if !strings.ContainsAny(def, "\"`;") {
+						tag.DefaultExpr = def
+					}
+				}
+				if dataType == "decimal" || dataType == "numeric" {
+					tag.Digits, tag.Decimals = fmt.Sprint(precision), fmt.Sprint(scale)
+				}
+			}
+		}
+		col.SQLType = columnType
+		col.Tag = tag
+		table.Columns = append(table.Columns, col)
+	}
+}
+
+// mssqlColumnType returns the full type of a column, e.g. nvarchar(64), nvarchar(max)
+// or decimal(10,2), max_length counting bytes, two per character of the n types
+func mssqlColumnType(dataType string, maxLength, precision, scale int) string {
+	switch dataType {
+	case "char", "varchar", "binary", "varbinary", "nchar", "nvarchar":
+		if maxLength == -1 {
+			return dataType + "(max)"
+		}
+		if strings.HasPrefix(dataType, "n") {
+			maxLength /= 2
+		}
+		return fmt.Sprintf("%s(%d)", dataType, maxLength)
+	case "decimal", "numeric":
+		return fmt.Sprintf("%s(%d,%d)", dataType, precision, scale)
+	case "datetime2", "time", "datetimeoffset":
+		if scale != 7 {
+			return fmt.Sprintf("%s(%d)", dataType, scale)
+		}
+	}
+	return dataType
+}
+
+// mssqlDefault returns the expression of a default constraint without the
+// parentheses SQL Server wraps it in, e.g. ((0)) => 0, (getdate()) => getdate()
+func mssqlDefault(def string) string {
+	for strings.HasPrefix(def, "(") {
+		// the first parenthesis must be closed by the last character
+		depth := 0
+		for i, c := range def {
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+			if depth == 0 && i < len(def)-1 {
+				return def
+			}
+		}
+		def = def[1 : len(def)-1]
+	}
+	return def
+}
+
+// isMssqlCurrentTimestamp reports whether a column default is the current time
+func isMssqlCurrentTimestamp(def string) bool {
+	regex := regexp.MustCompile(`^(?i)(getdate|getutcdate|sysdatetime|sysutcdatetime|sysdatetimeoffset)\(\)$`)
+	return regex.MatchString(def) || isCurrentTimestamp(def)
+}
+
+// ImportMssql reports whether the model of the table has a column of a type of
+// github.com/denisenkom/go-mssqldb
+func (tb *Table) ImportMssql() bool {
+	for _, col := range tb.Columns {
+		if strings.HasPrefix(col.BaseType(), "mssql.") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetGoDataType maps a T-SQL data type to a Go type
+func (*MssqlDB) GetGoDataType(sqlType string) (string, error) {
+	if v, ok := typeMappingMssql[sqlType]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("data type '%s' not found", sqlType)
+}
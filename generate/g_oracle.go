@@ -0,0 +1,581 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// OracleDB is the Oracle version of DbTransformer. The names of the tables and of the
+// columns are read in lower case, the quoted names in mixed case are not supported.
+type OracleDB struct {
+}
+
+// typeMappingOracle maps Oracle data types to Go types, NUMBER being mapped by
+// oracleNumberType after its precision and scale
+var typeMappingOracle = map[string]string{
+	"number":                         "float64", // number
+	"float":                          "float64",
+	"binary_float":                   "float32",
+	"binary_double":                  "float64",
+	"char":                           "string", // string & text
+	"nchar":                          "string",
+	"varchar2":                       "string",
+	"nvarchar2":                      "string",
+	"clob":                           "string",
+	"nclob":                          "string",
+	"long":                           "string",
+	"rowid":                          "string",
+	"date":                           "time.Time", // time
+	"timestamp":                      "time.Time",
+	"timestamp with time zone":       "time.Time",
+	"timestamp with local time zone": "time.Time",
+	"raw":                            "string", // binary
+	"long raw":                       "string",
+	"blob":                           "string",
+}
+
+// GetTableNames for Oracle, the tables of the current schema but those of the recycle bin
+func (*OracleDB) GetTableNames(db *sql.DB) (tables []string) {
+	rows, err := db.Query(`SELECT table_name FROM all_tables
+		WHERE owner = SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') AND dropped = 'NO' AND nested = 'NO' AND secondary = 'N'
+		ORDER BY table_name`)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show tables: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			beeLogger.Log.Fatalf("Could not show tables: %s", err)
+		}
+		if name != strings.ToUpper(name) {
+			beeLogger.Log.Warnf("Skipping table '%s', its name is case sensitive", name)
+			continue
+		}
+		tables = append(tables, strings.ToLower(name))
+	}
+	return
+}
+
+// GetConstraints for Oracle, the enabled primary, unique and foreign keys from
+// all_constraints, the referenced columns of a foreign key being those of the same
+// position in the referenced key
+func (*OracleDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
+	rows, err := db.Query(
+		`SELECT
+			c.constraint_type, c.constraint_name, LOWER(cc.column_name), cc.position, col.data_type, col.data_scale,
+			LOWER(rc.owner), LOWER(rc.table_name), LOWER(rc.column_name)
+		FROM
+			all_constraints c
+		INNER JOIN
+			all_cons_columns cc ON cc.owner = c.owner AND cc.constraint_name = c.constraint_name
+		INNER JOIN
+			all_tab_columns col ON col.owner = cc.owner AND col.table_name = cc.table_name AND col.column_name = cc.column_name
+		LEFT JOIN
+			all_cons_columns rc ON rc.owner = c.r_owner AND rc.constraint_name = c.r_constraint_name AND rc.position = cc.position
+		WHERE
+			c.owner = SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') AND c.table_name = UPPER(:1)
+			AND c.constraint_type IN ('P', 'U', 'R') AND c.status = 'ENABLED'
+		ORDER BY
+			c.constraint_type, c.constraint_name, cc.position`,
+		table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query ALL_CONSTRAINTS for PK/UK/FK information: %s", err)
+	}
+	defer rows.Close()
+	uks := make(map[string][]string)
+	for rows.Next() {
+		var constraintType, constraintName, columnName, dataType string
+		var ordinalPos int
+		var scale sql.NullInt64
+		// Oracle reads empty strings as NULL
+		var refSchema, refTable, refColumn sql.NullString
+		if err := rows.Scan(&constraintType, &constraintName, &columnName, &ordinalPos, &dataType, &scale, &refSchema, &refTable, &refColumn); err != nil {
+			beeLogger.Log.Fatalf("Could not read ALL_CONSTRAINTS for PK/UK/FK information: %s", err)
+		}
+		switch constraintType {
+		case "P":
+			// the generated controllers parse integer or string ids only
+			isNumber := dataType == "NUMBER" && (!scale.Valid || scale.Int64 == 0)
+			if !isNumber && !strings.Contains(dataType, "CHAR") {
+				beeLogger.Log.Warnf("Table '%s' has a %s primary key, it is generated without primary key", table.Name, dataType)
+			}
+			if ordinalPos == 1 && (isNumber || strings.Contains(dataType, "CHAR")) && !blackList[table.Name] {
+				table.Pk = columnName
+			} else {
+				table.Pk = ""
+				// add table to blacklist so that other struct will not reference it, because we are not
+				// registering blacklisted tables
+				blackList[table.Name] = true
+			}
+		case "U":
+			table.Uk = append(table.Uk, columnName)
+			uks[constraintName] = append(uks[constraintName], columnName)
+		case "R":
+			table.Fk[columnName] = &ForeignKey{
+				Name:      columnName,
+				RefSchema: refSchema.String,
+				RefTable:  refTable.String,
+				RefColumn: refColumn.String,
+			}
+		}
+	}
+	table.nameUniqueKeys(uks)
+}
+
+// GetColumns for Oracle, from all_tab_columns with their comments and, for the identity
+// columns, the sequences generating their values
+func (oracleDB *OracleDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+	colDefRows, err := db.Query(
+		`SELECT
+			LOWER(c.column_name), LOWER(c.data_type), c.char_length, c.data_precision, c.data_scale,
+			c.nullable, c.data_default, m.comments, i.generation_type, i.sequence_name
+		FROM
+			all_tab_columns c
+		LEFT JOIN
+			all_col_comments m ON m.owner = c.owner AND m.table_name = c.table_name AND m.column_name = c.column_name
+		LEFT JOIN
+			all_tab_identity_cols i ON i.owner = c.owner AND i.table_name = c.table_name AND i.column_name = c.column_name
+		WHERE
+			c.owner = SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') AND c.table_name = UPPER(:1)
+		ORDER BY
+			c.column_id`,
+		table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the columns of '%s': %s", table.Name, err)
+	}
+	defer colDefRows.Close()
+
+	for colDefRows.Next() {
+		var colName, dataType, nullable string
+		var charLength int
+		var precision, scale sql.NullInt64
+		var columnDefault, columnComment, generation, sequence sql.NullString
+		if err := colDefRows.Scan(&colName, &dataType, &charLength, &precision, &scale, &nullable, &columnDefault, &columnComment, &generation, &sequence); err != nil {
+			beeLogger.Log.Fatalf("Could not read the columns of '%s': %s", table.Name, err)
+		}
+		// TIMESTAMP(6) WITH TIME ZONE => timestamp with time zone
+		baseType := regexp.MustCompile(`\([0-9]+\)`).ReplaceAllString(dataType, "")
+		columnType := oracleColumnType(dataType, charLength, precision, scale)
+
+		// create a column
+		col := new(Column)
+		col.Name = utils.CamelCase(colName)
+		col.Type, err = oracleDB.GetGoDataType(baseType)
+		if err != nil {
+			beeLogger.Log.Fatalf("%s", err)
+		}
+		if baseType == "number" {
+			col.Type = oracleNumberType(precision, scale)
+		}
+		if colName == "is_deleted" {
+			// 如果存在该列，则会记录需要用这个字段来代表删除动作
+			table.IdDelete = true
+		}
+
+		// Tag info
+		tag := new(OrmTag)
+		tag.Column = colName
+		tag.Comment = columnComment.String
+		if table.Pk == colName {
+			if KeepPkName {
+				// gorm only guesses the primary key of a field named Id
+				tag.Pk = true
+			} else {
+				col.Name = "Id"
+			}
+			table.PkType = col.Type
+			if generation.String == "ALWAYS" {
+				beeLogger.Log.Warnf("The identity column '%s.%s' is generated always, the ids of the created records can't be read back", table.Name, colName)
+				tag.Auto = true
+			} else if sequence.Valid {
+				tag.Auto = true
+				table.Sequence = sequence.String
+			} else if baseType == "number" {
+				// a sequence named after the table is read by a trigger filling in the NULL ids
+				table.Sequence = oracleTableSequence(db, table.Name)
+				tag.Auto = table.Sequence != ""
+				tag.Pk = !tag.Auto
+			} else {
+				tag.Pk = true
+			}
+		} else {
+			fkCol, isFk := table.Fk[colName]
+			isBl := false
+			if isFk {
+				_, isBl = blackList[fkCol.RefTable]
+			}
+			// check if the current column is a foreign key
+			if isFk && !isBl {
+				tag.RelFk = true
+				refStructName := fkCol.RefTable
+				tag.TableFk = refStructName
+				col.Name = utils.CamelCase(colName)
+				col.Type = "*" + utils.CamelCase(refStructName)
+			} else {
+				// if the name of column is Id, and it's not primary key
+				if colName == "id" {
+					col.Name = idFieldName
+				}
+				if nullable == "Y" {
+					tag.Null = true
+				}
+				if strings.HasSuffix(baseType, "char") || strings.HasSuffix(baseType, "char2") || baseType == "raw" {
+					tag.Size = extractColSize(columnType)
+				}
+				if strings.HasSuffix(baseType, "clob") || strings.HasPrefix(baseType, "long") || baseType == "blob" {
+					tag.Type = baseType
+				}
+				def := strings.TrimSpace(columnDefault.String)
+				if typeMappingOracle[baseType] == "time.Time" {
+					tag.Type = columnType
+					if isOracleCurrentTimestamp(def) {
+						tag.AutoNowAdd = true
+					}
+					// NULL must not be read as the zero time, use a pointer instead
+					if tag.Null {
+						col.Type = "*" + col.Type
+					}
+					// need to import time package
+					table.ImportTimePkg = true
+				}
+				if !tag.AutoNowAdd && def != "" && !strings.EqualFold(def, "NULL") {
+					if strings.HasPrefix(def, "'") || regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`).MatchString(def) {
+						tag.Default = literalDefault(colName, def)
+					} else if !strings.ContainsAny(def, "\"`;") {
+						tag.DefaultExpr = def
+					}
+				}
+				if baseType == "number" && scale.Int64 > 0 {
+					tag.Digits, tag.Decimals = fmt.Sprint(precision.Int64), fmt.Sprint(scale.Int64)
+				}
+			}
+		}
+		col.SQLType = columnType
+		col.Tag = tag
+		table.Columns = append(table.Columns, col)
+	}
+}
+
+// oracleColumnType returns the full type of a column, e.g. varchar2(64), number(10,2)
+// or timestamp(6), char_length counting characters
+func oracleColumnType(dataType string, charLength int, precision, scale sql.NullInt64) string {
+	switch dataType {
+	case "char", "nchar", "varchar2", "nvarchar2":
+		return fmt.Sprintf("%s(%d)", dataType, charLength)
+	case "number":
+		if !precision.Valid {
+			if scale.Valid && scale.Int64 == 0 {
+				// NUMBER(*,0), e.g. INTEGER
+				return "number(38)"
+			}
+			return dataType
+		}
+		if scale.Int64 == 0 {
+			return fmt.Sprintf("number(%d)", precision.Int64)
+		}
+		return fmt.Sprintf("number(%d,%d)", precision.Int64, scale.Int64)
+	}
+	return dataType
+}
+
+// oracleNumberType maps a NUMBER column to the smallest Go integer holding its
+// precision, or to float64 when it has decimals or no precision
+func oracleNumberType(precision, scale sql.NullInt64) string {
+	if !scale.Valid || scale.Int64 != 0 {
+		return "float64"
+	}
+	if !precision.Valid {
+		// NUMBER(*,0), e.g. INTEGER
+		return "int64"
+	}
+	switch {
+	case precision.Int64 <= 4:
+		return "int16"
+	case precision.Int64 <= 9:
+		return "int"
+	}
+	return "int64"
+}
+
+// oracleTableSequence returns the sequence named after a table, <table>_seq, which
+// the triggers of the tables without identity columns usually read the ids from,
+// or an empty string if there is none
+func oracleTableSequence(db *sql.DB, table string) string {
+	var name string
+	err := db.QueryRow(`SELECT sequence_name FROM all_sequences
+		WHERE sequence_owner = SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') AND sequence_name = UPPER(:1)`,
+		table+"_seq").Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		beeLogger.Log.Fatalf("Could not query the sequence of '%s': %s", table, err)
+	}
+	return name
+}
+
+// isOracleCurrentTimestamp reports whether a column default is the current time
+func isOracleCurrentTimestamp(def string) bool {
+	regex := regexp.MustCompile(`^(?i)(sysdate|systimestamp|current_date)$`)
+	return regex.MatchString(def) || isCurrentTimestamp(def)
+}
+
+// GetGoDataType maps an Oracle data type to a Go type
+func (*OracleDB) GetGoDataType(sqlType string) (string, error) {
+	if v, ok := typeMappingOracle[sqlType]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("data type '%s' not found", sqlType)
+}
+
+// writeOracleFile generates oracle.go holding the gorm dialect of Oracle and the
+// driver of the models, gorm having none
+func writeOracleFile(dbms, mPath string) {
+	if dbms == "oracle" {
+		writeGeneratedFile(path.Join(mPath, "oracle.go"), OracleTPL)
+	}
+}
+
+const OracleTPL = `package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/sijms/go-ora/v2"
+)
+
+func init() {
+	gorm.RegisterDialect("oracle", &oracleDialect{})
+}
+
+// openOracle opens connStr with the go-ora driver, the connections reporting the
+// column names in lower case so that gorm matches them with the fields
+func openOracle(connStr string) (*sql.DB, error) {
+	ora, err := sql.Open("oracle", connStr)
+	if err != nil {
+		return nil, err
+	}
+	// only the driver of ora is used, it has no connection yet
+	defer ora.Close()
+	return sql.OpenDB(oracleConnector{ora.Driver(), connStr}), nil
+}
+
+// oracleConnector opens the connections of the go-ora driver
+type oracleConnector struct {
+	driver  driver.Driver
+	connStr string
+}
+
+func (c oracleConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.connStr)
+	if err != nil {
+		return nil, err
+	}
+	return oracleConn{conn}, nil
+}
+
+func (c oracleConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type oracleConn struct{ driver.Conn }
+
+func (c oracleConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return oracleStmt{stmt}, nil
+}
+
+type oracleStmt struct{ driver.Stmt }
+
+func (s oracleStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.Stmt.Query(args)
+	if err != nil {
+		return nil, err
+	}
+	return oracleRows{rows}, nil
+}
+
+// oracleRows lowers the column names, which Oracle reports in upper case
+type oracleRows struct{ driver.Rows }
+
+func (r oracleRows) Columns() []string {
+	columns := r.Rows.Columns()
+	for i, column := range columns {
+		columns[i] = strings.ToLower(column)
+	}
+	return columns
+}
+
+// oracleDialect is the gorm dialect of Oracle 12c and later
+type oracleDialect struct {
+	db gorm.SQLCommon
+	gorm.DefaultForeignKeyNamer
+}
+
+func (oracleDialect) GetName() string {
+	return "oracle"
+}
+
+func (d *oracleDialect) SetDB(db gorm.SQLCommon) {
+	d.db = db
+}
+
+func (oracleDialect) BindVar(i int) string {
+	return fmt.Sprintf(":%d", i)
+}
+
+// Quote quotes the names in upper case, as Oracle stores the unquoted ones
+func (oracleDialect) Quote(key string) string {
+	return ` + "`" + `"` + "`" + ` + strings.ToUpper(key) + ` + "`" + `"` + "`" + `
+}
+
+func (d *oracleDialect) DataTypeOf(field *gorm.StructField) string {
+	fieldValue, sqlType, size, additionalType := gorm.ParseFieldStructForDialect(field, d)
+	if sqlType == "" {
+		_, autoIncrement := field.TagSettingsGet("AUTO_INCREMENT")
+		switch fieldValue.Kind() {
+		case reflect.Bool:
+			sqlType = "NUMBER(1)"
+		case reflect.Int8, reflect.Int16, reflect.Uint8, reflect.Uint16:
+			sqlType = "NUMBER(5)"
+		case reflect.Int, reflect.Int32, reflect.Uint32:
+			sqlType = "NUMBER(10)"
+		case reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			sqlType = "NUMBER(19)"
+		case reflect.Float32:
+			sqlType = "BINARY_FLOAT"
+		case reflect.Float64:
+			sqlType = "BINARY_DOUBLE"
+		case reflect.String:
+			if size > 0 && size <= 4000 {
+				sqlType = fmt.Sprintf("VARCHAR2(%d CHAR)", size)
+			} else {
+				sqlType = "CLOB"
+			}
+		case reflect.Struct:
+			if _, ok := fieldValue.Interface().(time.Time); ok {
+				sqlType = "TIMESTAMP"
+			}
+		default:
+			if _, ok := fieldValue.Interface().([]byte); ok {
+				sqlType = "BLOB"
+			}
+		}
+		if autoIncrement && strings.HasPrefix(sqlType, "NUMBER") {
+			sqlType += " GENERATED BY DEFAULT ON NULL AS IDENTITY"
+		}
+	}
+	if sqlType == "" {
+		panic(fmt.Sprintf("invalid sql type %s (%s) for oracle", fieldValue.Type().Name(), fieldValue.Kind().String()))
+	}
+	if strings.TrimSpace(additionalType) == "" {
+		return sqlType
+	}
+	return sqlType + " " + additionalType
+}
+
+// exists reports whether the query of the dictionary counts rows
+func (d oracleDialect) exists(query string, args ...interface{}) bool {
+	var count int
+	d.db.QueryRow(query, args...).Scan(&count)
+	return count > 0
+}
+
+func (d oracleDialect) HasIndex(tableName string, indexName string) bool {
+	return d.exists("SELECT COUNT(*) FROM user_indexes WHERE table_name = :1 AND index_name = :2", strings.ToUpper(tableName), strings.ToUpper(indexName))
+}
+
+func (d oracleDialect) HasForeignKey(tableName string, foreignKeyName string) bool {
+	return d.exists("SELECT COUNT(*) FROM user_constraints WHERE constraint_type = 'R' AND table_name = :1 AND constraint_name = :2", strings.ToUpper(tableName), strings.ToUpper(foreignKeyName))
+}
+
+func (d oracleDialect) RemoveIndex(tableName string, indexName string) error {
+	_, err := d.db.Exec("DROP INDEX " + d.Quote(indexName))
+	return err
+}
+
+func (d oracleDialect) HasTable(tableName string) bool {
+	return d.exists("SELECT COUNT(*) FROM user_tables WHERE table_name = :1", strings.ToUpper(tableName))
+}
+
+func (d oracleDialect) HasColumn(tableName string, columnName string) bool {
+	return d.exists("SELECT COUNT(*) FROM user_tab_columns WHERE table_name = :1 AND column_name = :2", strings.ToUpper(tableName), strings.ToUpper(columnName))
+}
+
+func (d oracleDialect) ModifyColumn(tableName string, columnName string, typ string) error {
+	_, err := d.db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY (%s %s)", d.Quote(tableName), d.Quote(columnName), typ))
+	return err
+}
+
+// LimitAndOffsetSQL uses the row limiting clause of Oracle 12c
+func (oracleDialect) LimitAndOffsetSQL(limit, offset interface{}) (sql string, err error) {
+	if offset != nil {
+		if n, err := strconv.ParseInt(fmt.Sprint(offset), 0, 0); err == nil && n >= 0 {
+			sql += fmt.Sprintf(" OFFSET %d ROWS", n)
+		}
+	}
+	if limit != nil {
+		if n, err := strconv.ParseInt(fmt.Sprint(limit), 0, 0); err == nil && n >= 0 {
+			sql += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", n)
+		}
+	}
+	return
+}
+
+func (oracleDialect) SelectFromDummyTable() string {
+	return "FROM DUAL"
+}
+
+func (oracleDialect) LastInsertIDOutputInterstitial(tableName, columnName string, columns []string) string {
+	return ""
+}
+
+// LastInsertIDReturningSuffix returns nothing, the models read the ids of the new
+// rows from their sequences before creating them
+func (oracleDialect) LastInsertIDReturningSuffix(tableName, columnName string) string {
+	return ""
+}
+
+func (oracleDialect) DefaultValueStr() string {
+	return "DEFAULT VALUES"
+}
+
+func (oracleDialect) NormalizeIndexAndColumn(indexName, columnName string) (string, string) {
+	return indexName, columnName
+}
+
+func (d oracleDialect) CurrentDatabase() (name string) {
+	d.db.QueryRow("SELECT SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') FROM DUAL").Scan(&name)
+	return
+}
+`
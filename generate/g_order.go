@@ -0,0 +1,62 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// tablesInFKOrder returns the tables sorted by their foreign keys, a table coming
+// after the tables it references: rows are inserted in this order and deleted
+// or truncated in the reverse order. Tables keep their relative order otherwise,
+// self references and references to tables not given are ignored and the cycles
+// are broken at their first table
+func tablesInFKOrder(tables []*Table) []*Table {
+	given := make(map[string]bool, len(tables))
+	for _, tb := range tables {
+		given[tb.Name] = true
+	}
+	placed := make(map[string]bool, len(tables))
+	ready := func(tb *Table) bool {
+		for _, fk := range tb.Fk {
+			if fk.RefTable != tb.Name && given[fk.RefTable] && !placed[fk.RefTable] {
+				return false
+			}
+		}
+		return true
+	}
+	ordered := make([]*Table, 0, len(tables))
+	for len(ordered) < len(tables) {
+		var next *Table
+		for _, tb := range tables {
+			if !placed[tb.Name] && ready(tb) {
+				next = tb
+				break
+			}
+		}
+		if next == nil {
+			for _, tb := range tables {
+				if !placed[tb.Name] {
+					next = tb
+					break
+				}
+			}
+			beeLogger.Log.Warnf("The foreign keys of table '%s' are part of a cycle, it is ordered before some of the tables it references", next.Name)
+		}
+		placed[next.Name] = true
+		ordered = append(ordered, next)
+	}
+	return ordered
+}
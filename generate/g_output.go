@@ -0,0 +1,98 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// outputImports rewrites the import paths of the generated packages moved
+// by the output configuration, nil when every package is at its default path
+var outputImports *strings.Replacer
+
+// outputDir returns the directory of the generated package named pkg, e.g. models,
+// relative to the application path
+func outputDir(pkg string) string {
+	out := config.Conf.Appcode.Output
+	dirs := map[string]string{
+		"models":      out.Models,
+		"controllers": out.Controllers,
+		"routers":     out.Routers,
+		"handlers":    out.Handlers,
+		"queries":     out.Queries,
+		"jobs":        out.Jobs,
+		"api":         out.Api,
+		"domain":      out.Domain,
+		"persistence": out.Persistence,
+	}
+	dir := path.Clean(strings.Trim(strings.Replace(dirs[pkg], "\\", "/", -1), "/"))
+	if dir == "." {
+		return defaultOutputDir(pkg)
+	}
+	if dir == ".." || strings.HasPrefix(dir, "../") {
+		beeLogger.Log.Fatalf("Output directory '%s' of %s is outside of the application path", dirs[pkg], pkg)
+	}
+	return dir
+}
+
+// defaultOutputDir returns the directory of the generated package named pkg
+// when the output configuration doesn't set it
+func defaultOutputDir(pkg string) string {
+	if pkg == "persistence" {
+		return "infrastructure/persistence"
+	}
+	return pkg
+}
+
+// setOutputImports prepares the rewriting of the imports of the generated
+// packages which are not at their default path, and of their subpackages,
+// as well as the one of gorm when the code is generated for gorm v2
+func setOutputImports(pkgPath string) {
+	var oldnew []string
+	for _, pkg := range []string{"models", "controllers", "routers", "handlers", "api", "domain", "persistence"} {
+		if dir := outputDir(pkg); dir != defaultOutputDir(pkg) {
+			old := `"` + pkgPath + "/" + defaultOutputDir(pkg)
+			oldnew = append(oldnew, old+`"`, `"`+pkgPath+"/"+dir+`"`, old+"/", `"`+pkgPath+"/"+dir+"/")
+		}
+	}
+	if gormV2() {
+		oldnew = append(oldnew, `"github.com/jinzhu/gorm"`, `"gorm.io/gorm"`)
+	}
+	outputImports = nil
+	if len(oldnew) > 0 {
+		outputImports = strings.NewReplacer(oldnew...)
+	}
+}
+
+// rewriteImports moves the imports of the generated packages in src to their output directories,
+// and the one of gorm to gorm v2
+func rewriteImports(src string) string {
+	if outputImports == nil {
+		return src
+	}
+	return outputImports.Replace(src)
+}
+
+// controllersDir returns the directory of the generated controllers
+// from the one of the generated routers
+func controllersDir(rPath string) string {
+	apppath := strings.TrimSuffix(filepath.ToSlash(rPath), "/"+outputDir("routers"))
+	return filepath.Join(filepath.FromSlash(apppath), filepath.FromSlash(outputDir("controllers")))
+}
@@ -0,0 +1,51 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// Drivers of the generated PostgreSQL code, see -pg-driver
+const (
+	PgDriverPq  = "pq"
+	PgDriverPgx = "pgx"
+)
+
+// pgxDriver reports whether the generated PostgreSQL code uses jackc/pgx instead of
+// lib/pq, which is in maintenance mode
+func pgxDriver() bool {
+	switch strings.ToLower(PgDriver.String()) {
+	case "", PgDriverPq:
+		return false
+	case PgDriverPgx:
+		return true
+	}
+	beeLogger.Log.Fatalf("Invalid PostgreSQL driver '%s'. Must be either \"pq\" or \"pgx\"", PgDriver)
+	return false
+}
+
+// ImportPgtype reports whether the model of the table has columns of the native
+// types of pgx, e.g. pgtype.Numeric
+func (tb *Table) ImportPgtype() bool {
+	for _, col := range tb.Columns {
+		if strings.HasPrefix(col.BaseType(), "pgtype.") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// ViewChild is a table referencing the root of an aggregate, its records being
+// part of the read model of the aggregate
+type ViewChild struct {
+	Table  string
+	Model  string
+	Column string // foreign key column referencing the root
+	Masked bool   // the records have sensitive columns
+}
+
+// applyProjections gives the tables whose read_model is set a read model, made of
+// the records of the table and of the records of the tables referencing it
+func applyProjections(tables []*Table) {
+	for _, tb := range tables {
+		if !config.Conf.Appcode.Tables[tb.Name].ReadModel {
+			continue
+		}
+		if tb.Pk == "" || tb.TenantColumn != "" {
+			beeLogger.Log.Fatalf("Table '%s' can't have a read model, only tables with a primary key which aren't scoped to a tenant can", tb.Name)
+		}
+		tb.ReadModel = true
+		for _, child := range tables {
+			if child == tb || child.Pk == "" {
+				continue
+			}
+			for _, col := range child.Columns {
+				if fk, ok := child.Fk[col.Tag.Column]; ok && fk.RefTable == tb.Name {
+					tb.Children = append(tb.Children, &ViewChild{
+						Table:  child.Name,
+						Model:  utils.CamelCase(child.Name),
+						Column: col.Tag.Column,
+						Masked: len(child.MaskedColumns()) > 0,
+					})
+				}
+			}
+		}
+		if len(tb.Children) == 0 {
+			beeLogger.Log.Warnf("No table references table '%s', its read model only holds its records", tb.Name)
+		}
+	}
+}
+
+// ViewMasked reports whether the read model of the table holds sensitive columns
+func (tb *Table) ViewMasked() bool {
+	masked := len(tb.MaskedColumns()) > 0
+	for _, child := range tb.Children {
+		masked = masked || child.Masked
+	}
+	return masked
+}
+
+// writeProjectionFile generates projection.go emitting the change events of the
+// records and holding the read models, or nothing when no table has a read model
+func writeProjectionFile(tables []*Table, mPath string) {
+	for _, tb := range tables {
+		if tb.ReadModel {
+			writeGeneratedFile(path.Join(mPath, "projection.go"), executeTemplate(ProjectionTPL, nil))
+			return
+		}
+	}
+}
+
+const ProjectionTPL = `package models
+
+import (
+{{if gormV2}}	"reflect"
+{{end}}	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ChangeEvent is a change of the records of a table written through the models,
+// emitted once it is executed, whether its transaction is committed or not
+type ChangeEvent struct {
+	Table  string
+	Op     string      // create, update or delete
+	Record interface{} // the written model, e.g. *Orders, or nil when several records may have changed
+}
+
+var changeHandlers = make(map[string][]func(ChangeEvent))
+
+// OnChange registers fn to be called on the changes of the records of table, it must be
+// called before the database is opened
+func OnChange(table string, fn func(ChangeEvent)) {
+	changeHandlers[table] = append(changeHandlers[table], fn)
+}
+
+func init() {
+	openHooks = append(openHooks, registerChangeEvents)
+}
+
+// registerChangeEvents emits the change events from the callbacks of gorm
+func registerChangeEvents(db *gorm.DB) error {
+{{if gormV2}}	emit := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if tx.Error != nil {
+				return
+			}
+			e := ChangeEvent{Table: tx.Statement.Table, Op: op}
+			if s, rv := tx.Statement.Schema, tx.Statement.ReflectValue; s != nil && s.PrioritizedPrimaryField != nil && rv.Kind() == reflect.Struct {
+				if _, zero := s.PrioritizedPrimaryField.ValueOf(tx.Statement.Context, rv); !zero {
+					e.Record = tx.Statement.Model
+				}
+			}
+			for _, fn := range changeHandlers[e.Table] {
+				fn(e)
+			}
+		}
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("models:change_create", emit("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("models:change_update", emit("update")); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("models:change_delete", emit("delete"))
+{{else}}	emit := func(op string) func(*gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			if scope.HasError() {
+				return
+			}
+			e := ChangeEvent{Table: scope.TableName(), Op: op}
+			if !scope.PrimaryKeyZero() {
+				e.Record = scope.Value
+			}
+			for _, fn := range changeHandlers[e.Table] {
+				fn(e)
+			}
+		}
+	}
+	db.Callback().Create().After("gorm:create").Register("models:change_create", emit("create"))
+	db.Callback().Update().After("gorm:update").Register("models:change_update", emit("update"))
+	db.Callback().Delete().After("gorm:delete").Register("models:change_delete", emit("delete"))
+	return nil
+{{end}}}
+
+// projection holds the read models of an aggregate keyed by id. They are built when
+// first read, and dropped on the change events of the records they are made of.
+type projection struct {
+	mu    sync.Mutex
+	views map[interface{}]interface{}
+	gen   uint64 // incremented on each change, so that the views read before aren't kept
+}
+
+// newProjection returns an empty projection
+func newProjection() *projection {
+	return &projection{views: make(map[interface{}]interface{})}
+}
+
+// get returns the read model of id, if built
+func (p *projection) get(id interface{}) (interface{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.views[id]
+	return v, ok
+}
+
+// generation returns the generation of the projection, to be passed to add once the read model is built
+func (p *projection) generation() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.gen
+}
+
+// add keeps the read model of id built at generation gen, unless a change happened since
+func (p *projection) add(id, view interface{}, gen uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if gen == p.gen {
+		p.views[id] = view
+	}
+}
+
+// drop removes the read model of id, which has changed
+func (p *projection) drop(id interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gen++
+	delete(p.views, id)
+}
+
+// reset removes every read model, some of them having changed
+func (p *projection) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gen++
+	p.views = make(map[interface{}]interface{})
+}
+`
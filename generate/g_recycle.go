@@ -0,0 +1,78 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/skOak/hee/utils"
+)
+
+// Recyclable reports whether the deleted records of the table are served by a
+// recycle bin, which is the case of the soft deleted tables whose records can be deleted
+// unless the soft-delete-api feature is disabled
+func (tb *Table) Recyclable() bool {
+	return tb.IdDelete && tb.Pk != "" && tb.Allows("delete") && featureEnabled(FeatureSoftDeleteAPI)
+}
+
+// recycleRouted reports whether the controller of a table, generated by this run or
+// by a previous one, has a recycle bin to be routed
+func recycleRouted(table string, tables []*Table, rPath string) bool {
+	for _, tb := range tables {
+		if tb.Name == table {
+			return tb.Recyclable()
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(controllersDir(rPath), controllerFileName(table)+".go"))
+	return err == nil && strings.Contains(string(data), utils.CamelCase(table)+"RecycleController struct")
+}
+
+// writeRecycleFile generates recycle.go restricting the recycle bins, or nothing
+// when no table has one
+func writeRecycleFile(tables []*Table, cPath string) {
+	for _, tb := range tables {
+		if tb.Recyclable() {
+			writeGeneratedFile(path.Join(cPath, "recycle.go"), RecycleTPL)
+			return
+		}
+	}
+}
+
+const RecycleTPL = `package controllers
+
+import (
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+)
+
+// RecycleAllowed restricts the recycle bins, listing and restoring the deleted records,
+// e.g. to the administrators, usually by checking what the authentication filter set on
+// ctx. The recycle bins are closed until it is set.
+var RecycleAllowed func(ctx *context.Context) bool
+
+// checkRecycleAllowed stops the requests not allowed by RecycleAllowed with a 403
+func checkRecycleAllowed(c *beego.Controller) {
+	if RecycleAllowed != nil && RecycleAllowed(c.Ctx) {
+		return
+	}
+	c.Ctx.Output.SetStatus(403)
+	c.Data["json"] = "Forbidden"
+	c.ServeJSON()
+	c.StopRun()
+}
+`
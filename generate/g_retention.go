@@ -0,0 +1,115 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// applyRetention sets the retention of the soft deleted rows of a table, the time of
+// deletion being read from column, or else from the column updated on each write
+func applyRetention(tb *Table, retention, column string) {
+	if retention == "" {
+		return
+	}
+	d, err := time.ParseDuration(retention)
+	if err != nil || d <= 0 {
+		beeLogger.Log.Fatalf("Invalid retention '%s' of table '%s'", retention, tb.Name)
+	}
+	if !tb.IdDelete {
+		beeLogger.Log.Fatalf("Table '%s' has no is_deleted column, it can't have a retention", tb.Name)
+	}
+	if column == "" {
+		for _, col := range tb.Columns {
+			if col.Tag.AutoNow {
+				column = col.Tag.Column
+				break
+			}
+		}
+	}
+	if column == "" {
+		for _, name := range []string{"deleted_at", "updated_at", "update_time", "modified_at"} {
+			if tb.Column(name) != nil {
+				column = name
+				break
+			}
+		}
+	}
+	if col := tb.Column(column); col == nil || !strings.Contains(col.Type, "Time") {
+		beeLogger.Log.Warnf("No time of deletion in table '%s', set its retention_column. The retention is ignored", tb.Name)
+		return
+	}
+	tb.Retention, tb.RetentionColumn = d, column
+}
+
+// RetentionLiteral returns the retention of the table as a Go expression, e.g. 720 * time.Hour
+func (tb *Table) RetentionLiteral() string {
+	return durationLiteral(tb.Retention)
+}
+
+// durationLiteral returns d as a Go expression in the largest unit dividing it
+func durationLiteral(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d * time.Hour", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d * time.Minute", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%d * time.Second", d/time.Second)
+	}
+	return fmt.Sprintf("%d * time.Millisecond", d/time.Millisecond)
+}
+
+// writeRetentionFile generates retention.go registering a toolbox task per table
+// with a retention, or nothing when no table has one
+func writeRetentionFile(tables []*Table, mPath string) {
+	var retained []*Table
+	for _, tb := range tables {
+		if tb.RetentionColumn != "" {
+			retained = append(retained, tb)
+		}
+	}
+	if len(retained) == 0 {
+		return
+	}
+	writeGeneratedFile(path.Join(mPath, "retention.go"), executeTemplate(RetentionTPL, retained))
+}
+
+const RetentionTPL = `package models
+
+import (
+	"time"
+
+	"github.com/astaxie/beego/toolbox"
+)
+
+// RetentionSchedule is the default schedule of the retention tasks, every day at 3am
+const RetentionSchedule = "0 0 3 * * *"
+
+// RegisterRetentionTasks registers a toolbox task per table purging the rows soft deleted
+// for longer than the retention of the table, run on the cron-style spec, e.g. RetentionSchedule.
+// The tasks run once toolbox.StartTask is called.
+func RegisterRetentionTasks(spec string) {
+{{range .}}	toolbox.AddTask("purge_deleted_{{.Name}}", toolbox.NewTask("purge_deleted_{{.Name}}", spec, func() error {
+		_, err := PurgeDeleted{{camelCase .Name}}sOlderThan(nil, {{.RetentionLiteral}})
+		return err
+	}))
+{{end}}}
+`
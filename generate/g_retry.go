@@ -0,0 +1,202 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"time"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// retryEnabled reports whether the generated controllers retry the model calls
+// failing with a transient error, i.e. more than one attempt is configured
+func retryEnabled() bool {
+	return config.Conf.Appcode.Retry.MaxAttempts > 1
+}
+
+// wrapCalls reports whether the generated controllers make the model calls through models.Call
+func wrapCalls() bool {
+	return retryEnabled() || breakerEnabled()
+}
+
+// writeRetryFile generates retry.go holding models.Retry
+func writeRetryFile(dbms, mPath string) {
+	conf := config.Conf.Appcode.Retry
+	data := struct {
+		Dialect                 string
+		Pgx                     bool
+		MaxAttempts             int
+		BaseDelayMs, MaxDelayMs int64
+	}{Dialect: dbms, Pgx: pgxDriver(), MaxAttempts: conf.MaxAttempts, BaseDelayMs: 50, MaxDelayMs: 1000}
+	for _, d := range []struct {
+		value string
+		ms    *int64
+	}{{conf.BaseDelay, &data.BaseDelayMs}, {conf.MaxDelay, &data.MaxDelayMs}} {
+		if d.value == "" {
+			continue
+		}
+		delay, err := time.ParseDuration(d.value)
+		if err != nil {
+			beeLogger.Log.Fatalf("Invalid retry delay '%s': %s", d.value, err)
+		}
+		*d.ms = int64(delay / time.Millisecond)
+	}
+	if data.MaxDelayMs < data.BaseDelayMs {
+		data.MaxDelayMs = data.BaseDelayMs
+	}
+	writeGeneratedFile(path.Join(mPath, "retry.go"), executeTemplate(RetryTPL, data))
+}
+
+const CallTPL = `package models
+
+// Call runs a model call of the controllers on table{{if .Breaker}} through the circuit breaker
+// of the table{{end}}{{if .Retry}}, retried on transient errors{{end}}
+func Call(table string, fn func() error) error {
+{{if and .Retry .Breaker}}	return guard(table, func() error { return Retry(fn) })
+{{else if .Breaker}}	return guard(table, fn)
+{{else}}	return Retry(fn)
+{{end}}}
+
+// CallWrite runs a write of the controllers on table like Call{{if .Retry}}, retried only
+// on the errors raised before the row could be written{{end}}
+func CallWrite(table string, fn func() error) error {
+{{if and .Retry .Breaker}}	return guard(table, func() error { return RetryWrite(fn) })
+{{else if .Breaker}}	return guard(table, fn)
+{{else}}	return RetryWrite(fn)
+{{end}}}
+`
+
+const RetryTPL = `package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"syscall"
+	"time"
+
+	{{if eq .Dialect "mysql"}}"github.com/go-sql-driver/mysql"{{else if eq .Dialect "sqlite"}}"github.com/mattn/go-sqlite3"{{else if eq .Dialect "mssql"}}"github.com/denisenkom/go-mssqldb"{{else if eq .Dialect "oracle"}}"github.com/sijms/go-ora/v2/network"{{else if eq .Dialect "clickhouse"}}"github.com/ClickHouse/clickhouse-go/v2"{{else if .Pgx}}"github.com/jackc/pgconn"{{else}}"github.com/lib/pq"{{end}}
+)
+
+// RetryConfig describes how Retry retries the calls failing with a transient error
+var RetryConfig = struct {
+	MaxAttempts int           // attempts, the first one included
+	BaseDelay   time.Duration // delay before the first retry, doubled at each attempt
+	MaxDelay    time.Duration // upper bound of the delay
+}{
+	MaxAttempts: {{.MaxAttempts}},
+	BaseDelay:   {{.BaseDelayMs}} * time.Millisecond,
+	MaxDelay:    {{.MaxDelayMs}} * time.Millisecond,
+}
+
+// IsTransient reports whether err is worth a retry: deadlocks, lock wait timeouts,
+// serialization failures and connection resets. Only reads may be retried on the latter,
+// see IsTransientWrite
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsTransientWrite(err) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+{{if eq .Dialect "mysql"}}	return errors.Is(err, mysql.ErrInvalidConn)
+{{else}}	return false
+{{end}}}
+
+// IsTransientWrite reports whether a failed write is worth a retry: deadlocks, lock wait
+// timeouts, serialization failures and connections found broken before sending the query.
+// A connection reset may come after the server wrote the row, which a retry would duplicate.
+func IsTransientWrite(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+{{if eq .Dialect "mysql"}}	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		// 1213: deadlock found, 1205: lock wait timeout exceeded
+		return myErr.Number == 1213 || myErr.Number == 1205
+	}
+	return false
+{{else if eq .Dialect "mssql"}}	var msErr mssql.Error
+	if errors.As(err, &msErr) {
+		// 1205: chosen as deadlock victim, 1222: lock request time out
+		return msErr.Number == 1205 || msErr.Number == 1222
+	}
+	return false
+{{else if eq .Dialect "oracle"}}	var oraErr *network.OracleError
+	if errors.As(err, &oraErr) {
+		// ORA-00060: deadlock detected, ORA-08177: can't serialize access,
+		// ORA-30006: resource busy, WAIT timeout expired
+		return oraErr.ErrCode == 60 || oraErr.ErrCode == 8177 || oraErr.ErrCode == 30006
+	}
+	return false
+{{else if eq .Dialect "clickhouse"}}	var chErr *clickhouse.Exception
+	if errors.As(err, &chErr) {
+		// 202: too many simultaneous queries, 252: too many parts, waiting for the merges
+		return chErr.Code == 202 || chErr.Code == 252
+	}
+	return false
+{{else if eq .Dialect "sqlite"}}	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) {
+		// the database is locked by another connection
+		return liteErr.Code == sqlite3.ErrBusy || liteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+{{else if .Pgx}}	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 40001: serialization_failure, 40P01: deadlock_detected
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+{{else}}	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// 40001: serialization_failure, 40P01: deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+{{end}}}
+
+// Retry calls fn until it succeeds, fails with an error which isn't transient or
+// RetryConfig.MaxAttempts is reached, sleeping between the attempts with an exponential
+// backoff and full jitter. fn must not run within a transaction of the caller, which
+// a deadlock rolls back as a whole.
+func Retry(fn func() error) error {
+	return retry(fn, IsTransient)
+}
+
+// RetryWrite is Retry for the writes, which aren't idempotent, retried only on the
+// errors of IsTransientWrite
+func RetryWrite(fn func() error) error {
+	return retry(fn, IsTransientWrite)
+}
+
+func retry(fn func() error, transient func(error) bool) (err error) {
+	delay := RetryConfig.BaseDelay
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= RetryConfig.MaxAttempts || !transient(err) {
+			return
+		}
+		time.Sleep(time.Duration(rand.Int63n(int64(delay) + 1)))
+		if delay *= 2; delay > RetryConfig.MaxDelay {
+			delay = RetryConfig.MaxDelay
+		}
+	}
+}
+`
@@ -0,0 +1,187 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// routeFragment is a routes file registering the namespaces of a table, or of
+// all the tables of a module
+type routeFragment struct {
+	Name       string // table or module name
+	PkgPath    string
+	Namespaces string
+}
+
+// writeRouteFragments writes routers/<table>_routes.go for each table which doesn't
+// belong to a module, routers/<module>_routes.go for each module, and the registry
+// the fragments register their namespaces into.
+func writeRouteFragments(tables []*Table, rPath, pkgPath string) {
+	owners := make(map[string]string)
+	var modules []string
+	for name, moduleTables := range routerModules() {
+		modules = append(modules, name)
+		for _, table := range moduleTables {
+			if owner, ok := owners[table]; ok {
+				beeLogger.Log.Fatalf("Table '%s' belongs to both modules '%s' and '%s'", table, owner, name)
+			}
+			owners[table] = name
+		}
+	}
+	sort.Strings(modules)
+
+	files := make(map[string]string)
+	write := func(fragment *routeFragment) {
+		fileName := utils.SnakeString(fragment.Name) + "_routes.go"
+		if owner, ok := files[fileName]; ok {
+			beeLogger.Log.Fatalf("'%s' and '%s' would both be routed in %s", owner, fragment.Name, fileName)
+		}
+		files[fileName] = fragment.Name
+		writeGeneratedFile(filepath.Join(rPath, fileName), executeTemplate(RoutesTPL, fragment))
+	}
+	for _, tb := range tables {
+		if _, ok := owners[tb.Name]; ok || tb.Pk == "" {
+			continue
+		}
+		write(&routeFragment{Name: tb.Name, PkgPath: pkgPath, Namespaces: tableNamespace(tb.Name, tb.Recyclable(), customRouted(tb.Name, rPath))})
+	}
+	selected := make(map[string]bool)
+	for _, tb := range tables {
+		selected[tb.Name] = tb.Pk != ""
+	}
+	for _, name := range modules {
+		// a module file lists every table of the module having a controller,
+		// not only the selected ones
+		fragment := &routeFragment{Name: name, PkgPath: pkgPath}
+		regenerate := false
+		for _, table := range routerModules()[name] {
+			regenerate = regenerate || selected[table]
+			if tableMode(&Table{Name: table}, ORouter) == 0 {
+				// the level of the table excludes routers
+				continue
+			}
+			if selected[table] || utils.IsExist(filepath.Join(controllersDir(rPath), controllerFileName(table)+".go")) {
+				fragment.Namespaces += tableNamespace(table, recycleRouted(table, tables, rPath), customRouted(table, rPath))
+			}
+		}
+		if regenerate {
+			write(fragment)
+		}
+	}
+
+	fpath := filepath.Join(rPath, "routes_registry.go")
+	if !utils.IsExist(fpath) {
+		writeGeneratedFile(fpath, RoutesRegistryTPL)
+	}
+}
+
+// tableNamespace returns the namespace routing to the controller of a table and to
+// its custom controller, and the one routing /recycle/<table> to its recycle bin
+func tableNamespace(table string, recycle, custom bool) string {
+	include := ""
+	if custom {
+		include = CustomIncludeTPL
+	}
+	tpl := strings.Replace(NamespaceTPL, "{{customInclude}}", include, 1)
+	if recycle {
+		tpl += RecycleNamespaceTPL
+	}
+	ns := strings.Replace(tpl, "{{nameSpace}}", resourcePath(table), -1)
+	return strings.Replace(ns, "{{ctrlName}}", utils.CamelCase(table), -1)
+}
+
+// executeTemplate renders a text/template named after its caller, failing on errors
+func executeTemplate(tpl string, data interface{}) string {
+	name := templateName()
+	var buf bytes.Buffer
+	t, err := template.New(name).Funcs(templateFuncs).Parse(tpl)
+	if err == nil {
+		err = t.Execute(&buf, data)
+	}
+	if err = debugTemplate(name, tpl, data, buf.String(), err); err != nil {
+		beeLogger.Log.Fatalf("Could not render template: %s", err)
+	}
+	return buf.String()
+}
+
+const (
+	NamespaceTPL = `
+	beego.NSNamespace("{{nameSpace}}",
+		beego.NSInclude(
+			&controllers.{{ctrlName}}Controller{},{{customInclude}}
+		),
+	),
+`
+	CustomIncludeTPL = `
+			&controllers.{{ctrlName}}CustomController{},`
+	RecycleNamespaceTPL = `	beego.NSNamespace("/recycle{{nameSpace}}",
+		beego.NSInclude(
+			&controllers.{{ctrlName}}RecycleController{},
+		),
+	),
+`
+	RoutesTPL = `package routers
+
+import (
+	"{{.PkgPath}}/controllers"
+
+	"github.com/astaxie/beego"
+)
+
+// routes of {{.Name}}, generated by generate appcode
+var _ = registerRoutes("{{.Name}}",{{.Namespaces}})
+`
+	RoutesRegistryTPL = `package routers
+
+import (
+	"sort"
+
+	"github.com/astaxie/beego"
+)
+
+// generatedRoutes holds the namespaces registered by the generated *_routes.go files
+var generatedRoutes = make(map[string][]beego.LinkNamespace)
+
+// registerRoutes is called by the generated *_routes.go files while the package
+// variables are initialized, before any init function runs
+func registerRoutes(name string, namespaces ...beego.LinkNamespace) bool {
+	generatedRoutes[name] = append(generatedRoutes[name], namespaces...)
+	return true
+}
+
+// generatedNamespaces returns the namespaces of all the generated routes,
+// sorted by table or module name
+func generatedNamespaces() []beego.LinkNamespace {
+	var names []string
+	for name := range generatedRoutes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var namespaces []beego.LinkNamespace
+	for _, name := range names {
+		namespaces = append(namespaces, generatedRoutes[name]...)
+	}
+	return namespaces
+}
+`
+)
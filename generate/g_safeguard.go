@@ -0,0 +1,84 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"reflect"
+	"sort"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// defaultMaxOverwrites is the number of existing files of the tables whose schema
+// changed a generation may overwrite without -force-major, see Appcode.MaxOverwrites
+const defaultMaxOverwrites = 20
+
+// checkMajorChange stops the generation, unless -force-major is given, when it would
+// overwrite more existing files of tables whose schema changed since the latest
+// snapshot than allowed, or when the manifest lists the files of tables missing from
+// the database. Such changes usually mean the code is generated against the wrong
+// database. tables are the introspected tables, all of them when allTables.
+func checkMajorChange(tables []*Table, allTables bool, mode byte, apppath string) {
+	if ForceMajor {
+		return
+	}
+	max := config.Conf.Appcode.MaxOverwrites
+	if max <= 0 {
+		max = defaultMaxOverwrites
+	}
+	var overwritten int
+	if previous, _ := latestSnapshot(apppath); previous != nil {
+		current := newSchemaSnapshot(tables)
+		for _, tb := range tables {
+			if ts, ok := previous.Tables[tb.Name]; ok && !reflect.DeepEqual(ts, current.Tables[tb.Name]) {
+				overwritten += len(tableFiles(tb, tableMode(tb, mode), apppath))
+			}
+		}
+	}
+
+	var missing []string
+	if allTables {
+		existing := make(map[string]bool)
+		for _, tb := range tables {
+			existing[tb.Name] = true
+		}
+		for name, files := range readManifest(apppath).Tables {
+			if existing[name] {
+				continue
+			}
+			for _, f := range files {
+				if utils.IsExist(path.Join(apppath, f)) {
+					missing = append(missing, name)
+					break
+				}
+			}
+		}
+		sort.Strings(missing)
+	}
+
+	if overwritten <= max && len(missing) == 0 {
+		return
+	}
+	if overwritten > max {
+		beeLogger.Log.Errorf("The schema changes would overwrite %d existing files, more than %d", overwritten, max)
+	}
+	for _, name := range missing {
+		beeLogger.Log.Errorf("Table '%s' is missing from the database, its generated files would be deleted", name)
+	}
+	beeLogger.Log.Fatal("Is it the right database? Pass -force-major to generate anyway")
+}
@@ -0,0 +1,368 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// SchemaCachePath is the directory, relative to the home directory, caching the
+// results of the introspection queries of appcode
+const SchemaCachePath = ".hee/cache"
+
+// schemaCacheMaxAge is the age of the cache files left by the former runs after
+// which they are removed, whatever their database
+const schemaCacheMaxAge = 30 * 24 * time.Hour
+
+// schemaVersionQueries read a cheap version of the schema keyed by DBMS: its version
+// or the DDL timestamps of its tables when the DBMS keeps them, else a checksum of
+// the catalog rows of its tables, which change with their DDL. The cache is keyed by
+// the hash of their results, the changes they miss, like new comments, needing -refresh.
+var schemaVersionQueries = map[string][]string{
+	"mysql": {
+		"SELECT table_name, create_time FROM information_schema.tables WHERE table_schema = DATABASE() ORDER BY table_name",
+	},
+	"postgres": {
+		"SELECT c.relname, c.xmin::text, (SELECT string_agg(a.xmin::text, ',' ORDER BY a.attnum) FROM pg_attribute a WHERE a.attrelid = c.oid AND a.attnum > 0) FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'v', 'p') ORDER BY 1",
+	},
+	"sqlite": {"PRAGMA schema_version"},
+	"mssql": {
+		"SELECT name, modify_date FROM sys.objects WHERE type IN ('U', 'V') ORDER BY name",
+	},
+	"oracle": {
+		"SELECT object_name, last_ddl_time FROM user_objects WHERE object_type IN ('TABLE', 'VIEW') ORDER BY object_name",
+	},
+	"clickhouse": {
+		"SELECT name, metadata_modification_time FROM system.tables WHERE database = currentDatabase() ORDER BY name",
+	},
+}
+
+// unversionedSchema is the version of the schemas whose version can't be read, their
+// cache being kept until -refresh
+const unversionedSchema = "unversioned"
+
+// schemaCache is the connector of a database whose query results are cached in
+// file: a query already run is answered from the cache, the database being only
+// connected to for the other ones.
+type schemaCache struct {
+	file string
+	db   *sql.DB
+
+	mu      sync.Mutex
+	Queries map[string]*cachedResult `json:"queries"`
+	dirty   bool
+}
+
+type cachedResult struct {
+	Columns []string        `json:"columns,omitempty"`
+	Rows    [][]cachedValue `json:"rows,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// cachedValue is a driver.Value of a cached row, the kind being empty for NULL
+type cachedValue struct {
+	Kind  string          `json:"kind,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// openSchemaCache opens the database of connStr through the schema cache of the
+// connection string and of the version of its schema. Closing the returned database
+// saves the results of the queries run against the database.
+func openSchemaCache(dbms, connStr string) (*sql.DB, error) {
+	db, err := sql.Open(sqlDriverName(dbms), connStr)
+	if err != nil {
+		return nil, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		beeLogger.Log.Warnf("Could not cache the schema: %s", err)
+		return db, nil
+	}
+	version, err := schemaVersion(dbms, db)
+	if err != nil {
+		beeLogger.Log.Warnf("Could not read the version of the schema, its cache is kept until -refresh: %s", err)
+		version = unversionedSchema
+	}
+	sum := sha256.Sum256([]byte(dbms + "\n" + connStr))
+	c := &schemaCache{
+		file:    path.Join(home, SchemaCachePath, hex.EncodeToString(sum[:16])+"-"+version+".json"),
+		db:      db,
+		Queries: make(map[string]*cachedResult),
+	}
+	if !Refresh {
+		if data, err := ioutil.ReadFile(c.file); err == nil {
+			if err := json.Unmarshal(data, c); err != nil {
+				beeLogger.Log.Warnf("Ignoring the invalid schema cache '%s': %s", c.file, err)
+				c.Queries = make(map[string]*cachedResult)
+			} else {
+				beeLogger.Log.Infof("Using the schema cached in '%s', -refresh queries the database again", c.file)
+				// the age of a cache is the time since it was last used
+				now := time.Now()
+				os.Chtimes(c.file, now, now)
+			}
+		}
+	}
+	return sql.OpenDB(c), nil
+}
+
+// schemaVersion returns the hash of the results of the schema version queries of dbms
+func schemaVersion(dbms string, db *sql.DB) (string, error) {
+	queries, ok := schemaVersionQueries[dbms]
+	if !ok {
+		return "", fmt.Errorf("no schema version query for %s", dbms)
+	}
+	h := sha256.New()
+	for _, query := range queries {
+		res, err := runQuery(context.Background(), db, query, nil)
+		if err != nil {
+			return "", err
+		}
+		if err := json.NewEncoder(h).Encode(res); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+func (c *schemaCache) Connect(context.Context) (driver.Conn, error) {
+	return schemaCacheConn{c}, nil
+}
+
+func (c *schemaCache) Driver() driver.Driver {
+	return schemaCacheDriver{}
+}
+
+// Close saves the new query results and removes the caches of the former schema
+// versions of the database, and the caches of any database unused for schemaCacheMaxAge
+func (c *schemaCache) Close() error {
+	defer c.db.Close()
+	if c.dirty {
+		data, err := json.Marshal(c)
+		if err == nil {
+			err = os.MkdirAll(path.Dir(c.file), 0700)
+		}
+		if err == nil {
+			err = utils.WriteFileAtomic(c.file, data, 0600)
+		}
+		if err != nil {
+			beeLogger.Log.Warnf("Could not cache the schema: %s", err)
+			return nil
+		}
+	}
+	prefix := strings.SplitN(path.Base(c.file), "-", 2)[0] + "-"
+	files, _ := ioutil.ReadDir(path.Dir(c.file))
+	for _, f := range files {
+		if f.Name() != path.Base(c.file) && (strings.HasPrefix(f.Name(), prefix) || time.Since(f.ModTime()) > schemaCacheMaxAge) {
+			os.Remove(path.Join(path.Dir(c.file), f.Name()))
+		}
+	}
+	return nil
+}
+
+// query returns the cached result of query, running it against the database first
+// if needed. An error is only cached when the database is still reachable.
+func (c *schemaCache) query(ctx context.Context, query string, args []driver.NamedValue) (*cachedResult, error) {
+	values := make([]interface{}, len(args))
+	key := make([]cachedValue, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+		key[i] = newCachedValue(arg.Value)
+	}
+	k, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	k = append([]byte(query+"\n"), k...)
+
+	c.mu.Lock()
+	res, ok := c.Queries[string(k)]
+	c.mu.Unlock()
+	if ok {
+		return res, nil
+	}
+
+	res, err = runQuery(ctx, c.db, query, values)
+	if err != nil {
+		if perr := c.db.PingContext(ctx); perr != nil {
+			return nil, err
+		}
+		res = &cachedResult{Error: err.Error()}
+	}
+	c.mu.Lock()
+	c.Queries[string(k)] = res
+	c.dirty = true
+	c.mu.Unlock()
+	return res, nil
+}
+
+func runQuery(ctx context.Context, db *sql.DB, query string, args []interface{}) (*cachedResult, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := new(cachedResult)
+	if res.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(res.Columns))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]cachedValue, len(values))
+		for i, v := range values {
+			row[i] = newCachedValue(v)
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res, rows.Err()
+}
+
+func newCachedValue(v interface{}) cachedValue {
+	var kind string
+	switch t := v.(type) {
+	case nil:
+		return cachedValue{}
+	case int64:
+		kind = "int"
+	case float64:
+		kind = "float"
+	case bool:
+		kind = "bool"
+	case []byte:
+		kind = "bytes"
+	case string:
+		kind = "string"
+	case time.Time:
+		kind = "time"
+	default:
+		// values of other types are scanned as strings, as the drivers send them
+		kind, v = "string", fmt.Sprint(t)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		kind = "string"
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return cachedValue{Kind: kind, Value: data}
+}
+
+func (cv cachedValue) value() (driver.Value, error) {
+	var v interface{}
+	switch cv.Kind {
+	case "":
+		return nil, nil
+	case "int":
+		v = new(int64)
+	case "float":
+		v = new(float64)
+	case "bool":
+		v = new(bool)
+	case "bytes":
+		v = new([]byte)
+	case "string":
+		v = new(string)
+	case "time":
+		v = new(time.Time)
+	default:
+		return nil, fmt.Errorf("unknown kind '%s' of cached value", cv.Kind)
+	}
+	if err := json.Unmarshal(cv.Value, v); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
+
+// schemaCacheDriver is only the driver of the connector, the connections being
+// opened by schemaCache
+type schemaCacheDriver struct{}
+
+func (schemaCacheDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("the schema cache is opened by openSchemaCache")
+}
+
+type schemaCacheConn struct{ cache *schemaCache }
+
+func (c schemaCacheConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.cache.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, errors.New(res.Error)
+	}
+	return &cachedRows{res: res}, nil
+}
+
+func (schemaCacheConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("the schema cache only runs queries")
+}
+
+func (schemaCacheConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("the schema cache only runs queries")
+}
+
+func (schemaCacheConn) Close() error {
+	return nil
+}
+
+type cachedRows struct {
+	res  *cachedResult
+	next int
+}
+
+func (r *cachedRows) Columns() []string {
+	return r.res.Columns
+}
+
+func (r *cachedRows) Close() error {
+	return nil
+}
+
+func (r *cachedRows) Next(dest []driver.Value) (err error) {
+	if r.next == len(r.res.Rows) {
+		return io.EOF
+	}
+	for i, cv := range r.res.Rows[r.next] {
+		if dest[i], err = cv.value(); err != nil {
+			return err
+		}
+	}
+	r.next++
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// semanticKinds maps the kinds of values detected by applySemantics to the validator
+// of the validate tag and to the OpenAPI format of the columns holding them
+var semanticKinds = map[string]struct{ Validator, Format string }{
+	"email": {"email", "email"},
+	"phone": {"e164", ""}, // OpenAPI has no phone format, the contract gets a pattern
+	"url":   {"url", "uri"},
+}
+
+// e164Pattern is the pattern of the phone numbers in the contract
+const e164Pattern = `^\+[1-9][0-9]{1,14}$`
+
+// defaultSemanticPatterns match the names and the comments of the columns of each
+// kind, unless replaced by the semantic_patterns of the appcode configuration
+var defaultSemanticPatterns = map[string]string{
+	"email": `(?i)(^|[_ ])e_?mail([_ ]addr(ess)?)?$|邮箱`,
+	"phone": `(?i)(^|[_ ])(phone|mobile|tel|telephone)([_ ](no|num|number))?$|手机|电话`,
+	"url":   `(?i)(^|[_ ])(url|link|website|homepage)$|网址|链接`,
+}
+
+// semanticRegexps holds the compiled patterns, see semanticPatterns
+var semanticRegexps map[string]*regexp.Regexp
+
+// semanticPatterns returns the patterns of the kinds, the configured ones replacing
+// the defaults, the kinds whose pattern is empty being left out
+func semanticPatterns() map[string]*regexp.Regexp {
+	if semanticRegexps != nil {
+		return semanticRegexps
+	}
+	patterns := make(map[string]string, len(defaultSemanticPatterns))
+	for kind, pattern := range defaultSemanticPatterns {
+		patterns[kind] = pattern
+	}
+	for kind, pattern := range config.Conf.Appcode.SemanticPatterns {
+		if _, ok := semanticKinds[kind]; !ok {
+			beeLogger.Log.Fatalf("Invalid semantic pattern kind '%s'. Must be either email, phone or url", kind)
+		}
+		patterns[kind] = pattern
+	}
+	semanticRegexps = make(map[string]*regexp.Regexp, len(patterns))
+	for kind, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			beeLogger.Log.Fatalf("Invalid %s semantic pattern: %s", kind, err)
+		}
+		semanticRegexps[kind] = re
+	}
+	return semanticRegexps
+}
+
+// applySemantics sets the kind of the values of the string columns whose name, or
+// else comment, matches the pattern of a kind
+func applySemantics(tb *Table) {
+	patterns := semanticPatterns()
+	kinds := make([]string, 0, len(patterns))
+	for kind := range patterns {
+		kinds = append(kinds, kind)
+	}
+	// a column matching several kinds gets the first one
+	sort.Strings(kinds)
+	for _, col := range tb.Columns {
+		if col.Tag.RelFk || col.BaseType() != "string" {
+			continue
+		}
+		for _, text := range []string{col.Tag.Column, strings.TrimSpace(col.Tag.Comment)} {
+			for _, kind := range kinds {
+				if text != "" && patterns[kind].MatchString(text) {
+					col.Tag.Semantic = kind
+					break
+				}
+			}
+			if col.Tag.Semantic != "" {
+				beeLogger.Log.Infof("Column '%s.%s' holds values of kind %s", tb.Name, col.Tag.Column, col.Tag.Semantic)
+				break
+			}
+		}
+	}
+}
+
+// semanticValidation returns the options of the validate tag of the column, the
+// empty values of the nullable columns being valid
+func (tag *OrmTag) semanticValidation() []string {
+	if tag.Semantic == "" {
+		return nil
+	}
+	validator := semanticKinds[tag.Semantic].Validator
+	if tag.Null {
+		return []string{"omitempty", validator}
+	}
+	return []string{validator}
+}
@@ -0,0 +1,344 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strings"
+
+	"github.com/skOak/hee/utils"
+)
+
+// handlersData is the data of the generated handlers.go
+type handlersData struct {
+	PkgPath string
+	Tenant  bool // a table is owned by tenants
+	DI      bool // the database is injected into Handlers, see diEnabled
+}
+
+// handlersFileName returns the name of the handlers file of a table
+func handlersFileName(tableName string) string {
+	return appcodeFileName(tableName, "")
+}
+
+// writeHandlerFiles generates the net/http handlers of the tables, routed by the
+// pattern-based http.ServeMux of Go 1.22, and handlers.go registering them. allTables
+// tell whether handlers.go scopes the requests to tenants.
+func writeHandlerFiles(tables, allTables []*Table, hPath, pkgPath string) {
+	data := &handlersData{PkgPath: pkgPath, DI: diEnabled()}
+	for _, tb := range allTables {
+		data.Tenant = data.Tenant || tb.TenantColumn != ""
+	}
+	for _, tb := range tables {
+		if tb.Pk == "" {
+			continue
+		}
+		content := strings.Replace(HandlerTPL, "{{modelName}}", utils.CamelCase(tb.Name), -1)
+		content = strings.Replace(content, "{{tableName}}", tb.Name, -1)
+		content = strings.Replace(content, "{{nameSpace}}", resourcePath(tb.Name), -1)
+		content = strings.Replace(content, "{{pkField}}", tb.PkField(), -1)
+		content = strings.Replace(content, "{{pkgPath}}", pkgPath, -1)
+		writeGeneratedFile(path.Join(hPath, handlersFileName(tb.Name)+".go"), executeTemplate(content, tb))
+	}
+	writeGeneratedFile(path.Join(hPath, "handlers.go"), executeTemplate(HandlersTPL, data))
+	if i18nEnabled() {
+		writeI18nFile(hPath, pkgPath, true)
+	}
+	if data.DI {
+		writeDIFile(hPath, pkgPath)
+	}
+}
+
+const (
+	HandlersTPL = `package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"{{.PkgPath}}/models"
+{{if or .Tenant .DI}}
+	"github.com/jinzhu/gorm"
+{{end}})
+
+// The handlers route requests with the method and wildcard patterns of http.ServeMux,
+// they need Go 1.22 or later.
+{{if .DI}}
+// Handlers serves the tables out of the database it is given
+type Handlers struct {
+	db *gorm.DB
+}
+
+// NewHandlers returns the handlers of the tables reading and writing db
+func NewHandlers(db *gorm.DB) *Handlers {
+	return &Handlers{db: db}
+}
+
+// routes holds the functions registering the handlers of each table, appended by
+// the generated table files
+var routes []func(h *Handlers, mux *http.ServeMux)
+
+func register(f func(h *Handlers, mux *http.ServeMux)) bool {
+	routes = append(routes, f)
+	return true
+}
+
+// RegisterRoutes registers the handlers of every table on mux, e.g.
+//
+//	mux := http.NewServeMux()
+//	handlers.NewHandlers(db).RegisterRoutes(mux)
+//	http.ListenAndServe(":8080", mux)
+func (h *Handlers) RegisterRoutes(mux *http.ServeMux) {
+	for _, f := range routes {
+		f(h, mux)
+	}
+}
+{{else}}
+// routes holds the functions registering the handlers of each table, appended by
+// the generated table files
+var routes []func(mux *http.ServeMux)
+
+func register(f func(mux *http.ServeMux)) bool {
+	routes = append(routes, f)
+	return true
+}
+
+// RegisterRoutes registers the handlers of every table on mux, e.g.
+//
+//	mux := http.NewServeMux()
+//	handlers.RegisterRoutes(mux)
+//	http.ListenAndServe(":8080", mux)
+func RegisterRoutes(mux *http.ServeMux) {
+	for _, f := range routes {
+		f(mux)
+	}
+}
+{{end}}{{if .Tenant}}
+type contextKey string
+
+// TenantKey is the key of the request context value holding the tenant of a request,
+// set by an authentication middleware, e.g.
+// r.WithContext(context.WithValue(r.Context(), handlers.TenantKey, claims.TenantId))
+const TenantKey contextKey = "tenant"
+
+// tenantDB returns the database of the request scoped to its tenant, a request
+// without tenant finding no row
+func {{if .DI}}(h *Handlers) {{end}}tenantDB(r *http.Request) *gorm.DB {
+	return models.ForTenant({{if gormV2}}{{if .DI}}h.db.WithContext(r.Context()){{else}}models.WithContext(r.Context()){{end}}{{else if .DI}}h.db{{else}}nil{{end}}, r.Context().Value(TenantKey))
+}
+{{end}}
+// writeJSON writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the message of err with the status matching it: 404 for missing
+// records, 409 for duplicate keys, 400 for the other constraint violations and 500
+// otherwise
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case models.IsNotFound(err):
+		status = http.StatusNotFound
+	case models.IsDuplicateKey(err):
+		status = http.StatusConflict
+	case models.IsForeignKeyViolation(err), models.IsCheckViolation(err):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, {{if i18n}}errorMessage(r, err){{else}}err.Error(){{end}})
+}
+
+// pageParams returns the offset and limit parameters of r, the limit defaulting to
+// models.DefaultPageSize and capped to models.MaxPageSize
+func pageParams(r *http.Request) (offset, limit int64) {
+	limit = models.DefaultPageSize
+	if v, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil {
+		limit = v
+	}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64); err == nil && v > 0 {
+		offset = v
+	}
+	return offset, models.PageLimit(limit)
+}
+
+// setPaginationHeaders exposes the total number of records as X-Total-Count, the applied
+// offset and limit as X-Offset and X-Limit, and links to the first, previous, next and
+// last pages as an RFC 5988 Link header
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, total, offset, limit int64) {
+	h := w.Header()
+	h.Set("X-Total-Count", strconv.FormatInt(total, 10))
+	h.Set("X-Offset", strconv.FormatInt(offset, 10))
+	h.Set("X-Limit", strconv.FormatInt(limit, 10))
+	h.Set("Access-Control-Expose-Headers", "X-Total-Count, X-Offset, X-Limit, Link")
+	if limit <= 0 {
+		return
+	}
+
+	page := func(offset int64, rel string) string {
+		q := r.URL.Query()
+		q.Set("offset", strconv.FormatInt(offset, 10))
+		q.Set("limit", strconv.FormatInt(limit, 10))
+		return fmt.Sprintf("<%s>; rel=\"%s\"", (&url.URL{Path: r.URL.Path, RawQuery: q.Encode()}).String(), rel)
+	}
+	last := int64(0)
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+	links := []string{page(0, "first")}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, page(prev, "prev"))
+	}
+	if offset+limit < total {
+		links = append(links, page(offset+limit, "next"))
+	}
+	links = append(links, page(last, "last"))
+	h.Set("Link", strings.Join(links, ", "))
+}
+`
+	HandlerTPL = `package handlers
+
+import (
+{{if or (.Allows "post") (.Allows "put")}}	"encoding/json"
+{{end}}	"net/http"
+{{if and (ne .PkType "string") (or (.Allows "get") (.Allows "put") (.Allows "delete"))}}	"strconv"
+{{end}}{{if .Allows "get"}}	"strings"
+{{end}}
+	"{{pkgPath}}/models"
+)
+
+var _ = register({{if di}}(*Handlers).{{end}}Register{{modelName}}Routes)
+
+// Register{{modelName}}Routes registers the handlers of {{tableName}} on mux
+func {{template "recv"}}Register{{modelName}}Routes(mux *http.ServeMux) {
+{{if .Allows "get"}}	mux.HandleFunc("GET {{nameSpace}}", {{template "h"}}getAll{{modelName}})
+	mux.HandleFunc("GET {{nameSpace}}/{id}", {{template "h"}}get{{modelName}})
+{{end}}{{if .Allows "post"}}	mux.HandleFunc("POST {{nameSpace}}", {{template "h"}}post{{modelName}})
+{{end}}{{if .Allows "put"}}	mux.HandleFunc("PUT {{nameSpace}}/{id}", {{template "h"}}put{{modelName}})
+{{end}}{{if .Allows "delete"}}	mux.HandleFunc("DELETE {{nameSpace}}/{id}", {{template "h"}}delete{{modelName}})
+{{end}}}
+{{if .Allows "post"}}
+// post{{modelName}} creates the {{modelName}} of the request body
+func {{template "recv"}}post{{modelName}}(w http.ResponseWriter, r *http.Request) {
+	var v models.{{modelName}}
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeJSON(w, http.StatusBadRequest, {{if i18n}}errorMessage(r, err){{else}}err.Error(){{end}})
+		return
+	}
+	if _, err := models.Add{{modelName}}({{template "db" .}}, &v); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, {{if .MaskedColumns}}v.Masked(){{else}}v{{end}})
+}
+{{end}}{{if .Allows "get"}}
+// get{{modelName}} serves the {{modelName}} of the id of the path
+func {{template "recv"}}get{{modelName}}(w http.ResponseWriter, r *http.Request) {
+{{template "parseId" .}}	v, err := models.Get{{modelName}}ById({{template "db" .}}, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v{{if .MaskedColumns}}.Masked(){{end}})
+}
+
+// getAll{{modelName}} serves the {{modelName}}s selected by the query, fields, sortby,
+// order, limit and offset parameters, those of the GetAll of the controllers
+func {{template "recv"}}getAll{{modelName}}(w http.ResponseWriter, r *http.Request) {
+	var fields, sortby, order []string
+	query := make(map[string]string)
+	params := r.URL.Query()
+	// fields: col1,col2
+	if v := params.Get("fields"); v != "" {
+		fields = strings.Split(v, ",")
+	}
+	// sortby: col1,col2
+	if v := params.Get("sortby"); v != "" {
+		sortby = strings.Split(v, ",")
+	}
+	// order: desc,asc
+	if v := params.Get("order"); v != "" {
+		order = strings.Split(v, ",")
+	}
+	// query: k:v,k:v
+	if v := params.Get("query"); v != "" {
+		for _, cond := range strings.Split(v, ",") {
+			kv := strings.SplitN(cond, ":", 2)
+			if len(kv) != 2 {
+				writeJSON(w, http.StatusBadRequest, {{if i18n}}tr(r, "invalid_query"){{else}}"Error: invalid query key/value pair"{{end}})
+				return
+			}
+			query[kv[0]] = kv[1]
+		}
+	}
+	offset, limit := pageParams(r)
+
+	l, total, err := models.GetAll{{modelName}}({{template "db" .}}, query, fields, sortby, order, offset, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	setPaginationHeaders(w, r, total, offset, limit)
+{{if .MaskedColumns}}	for i := range l {
+		l[i] = l[i].Masked()
+	}
+{{end}}	writeJSON(w, http.StatusOK, l)
+}
+{{end}}{{if .Allows "put"}}
+// put{{modelName}} updates the {{modelName}} of the id of the path with the request body
+func {{template "recv"}}put{{modelName}}(w http.ResponseWriter, r *http.Request) {
+{{template "parseId" .}}	v := models.{{modelName}}{{{pkField}}: id}
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeJSON(w, http.StatusBadRequest, {{if i18n}}errorMessage(r, err){{else}}err.Error(){{end}})
+		return
+	}
+	if err := models.Update{{modelName}}ById({{template "db" .}}, &v); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, "OK")
+}
+{{end}}{{if .Allows "delete"}}
+// delete{{modelName}} deletes the {{modelName}} of the id of the path
+func {{template "recv"}}delete{{modelName}}(w http.ResponseWriter, r *http.Request) {
+{{template "parseId" .}}	if err := models.Delete{{modelName}}({{template "db" .}}, id); err != nil {
+		if models.IsForeignKeyViolation(err) {
+			// the record is still referenced
+			writeJSON(w, http.StatusConflict, {{if i18n}}errorMessage(r, err){{else}}err.Error(){{end}})
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, "OK")
+}
+{{end}}{{define "db"}}{{if .TenantColumn}}{{template "h"}}tenantDB(r){{else if di}}h.db{{if gormV2}}.WithContext(r.Context()){{end}}{{else if gormV2}}models.WithContext(r.Context()){{else}}nil{{end}}{{end}}{{define "recv"}}{{if di}}(h *Handlers) {{end}}{{end}}{{define "h"}}{{if di}}h.{{end}}{{end}}{{define "parseId"}}{{if eq .PkType "string"}}	id := r.PathValue("id")
+{{else}}	pk, err := strconv.Parse{{if hasPrefix .PkType "uint"}}Uint{{else}}Int{{end}}(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, {{if i18n}}errorMessage(r, err){{else}}err.Error(){{end}})
+		return
+	}
+	id := {{.PkType}}(pk)
+{{end}}{{end}}`
+)
@@ -0,0 +1,195 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import "path"
+
+// writeSlowLogFile generates slowlog.go holding the recording of the slow queries
+func writeSlowLogFile(mPath string) {
+	writeGeneratedFile(path.Join(mPath, "slowlog.go"), SlowLogTPL)
+}
+
+const SlowLogTPL = `package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlowQuery is a query which took LogConfig.SlowThreshold or longer
+type SlowQuery struct {
+	Time     time.Time // end of the query
+	Caller   string    // file:line of the code calling the models
+	Duration time.Duration
+	SQL      string
+	Vars     []interface{} // values of the placeholders of SQL, nil when SQL holds them
+	Rows     int64         // rows affected or returned, -1 when unknown
+}
+
+// SlowQueryLogger records the slow queries, see LogConfig.SlowLog
+type SlowQueryLogger interface {
+	LogSlowQuery(q SlowQuery)
+}
+
+// SlowQueryFunc records the slow queries with a function, e.g. one passing them to
+// the logger of the application
+type SlowQueryFunc func(q SlowQuery)
+
+func (f SlowQueryFunc) LogSlowQuery(q SlowQuery) {
+	f(q)
+}
+
+// RotatingFile records the slow queries as JSON lines in Path. Once it would exceed
+// MaxSize bytes it is renamed Path.1, the former Path.1 becoming Path.2 and so on,
+// MaxBackups files being kept.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewRotatingFile returns the rotating file of path, opened by the first write
+func NewRotatingFile(path string, maxSize int64, maxBackups int) *RotatingFile {
+	return &RotatingFile{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+}
+
+// LogSlowQuery appends q to the file, the errors being reported on os.Stderr as the
+// query has run anyway
+func (r *RotatingFile) LogSlowQuery(q SlowQuery) {
+	entry := map[string]interface{}{
+		"time":        q.Time.Format(time.RFC3339Nano),
+		"caller":      q.Caller,
+		"duration_ms": float64(q.Duration) / float64(time.Millisecond),
+		"sql":         q.SQL,
+		"rows":        q.Rows,
+	}
+	if q.Vars != nil {
+		entry["vars"] = q.Vars
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		_, err = r.Write(append(data, '\n'))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "models: slow query log:", err)
+	}
+}
+
+// Write appends p to the file, rotating it first when p would take it over MaxSize
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the file, reopened by the next write
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts the backups, the oldest one being dropped, and starts a new file
+func (r *RotatingFile) rotate() error {
+	r.f.Close()
+	r.f = nil
+	if r.MaxBackups > 0 {
+		for i := r.MaxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.Path, i), fmt.Sprintf("%s.%d", r.Path, i+1))
+		}
+		if err := os.Rename(r.Path, r.Path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.Path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// modelsDir is the directory of the source files of the models
+var modelsDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return path.Dir(file)
+}()
+
+// queryCaller returns the file:line of the code calling the models, or gorm directly,
+// for a query logged by gorm, or source when it isn't found
+func queryCaller(source string) string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		inGorm := strings.Contains(frame.Function, "gorm.io/") || strings.Contains(frame.Function, "github.com/jinzhu/gorm.")
+		if !inGorm && path.Dir(frame.File) != modelsDir {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return source
+		}
+	}
+}
+
+// logSlow records q in SlowLog, if any
+func (c LogConfig) logSlow(q SlowQuery) {
+	if c.SlowLog != nil {
+		c.SlowLog.LogSlowQuery(q)
+	}
+}
+`
@@ -0,0 +1,231 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// SnapshotPath is the directory, relative to the application path, holding
+// the dated schema snapshots taken by appcode
+const SnapshotPath = ".hee/snapshots"
+
+// SchemaChangelog is the file, relative to the application path, recording
+// the schema changes found between two snapshots
+const SchemaChangelog = ".hee/CHANGELOG.md"
+
+type schemaSnapshot struct {
+	Tables map[string]*tableSnapshot `json:"tables"`
+}
+
+type tableSnapshot struct {
+	Pk      string            `json:"pk"`
+	Columns []*columnSnapshot `json:"columns"`
+}
+
+type columnSnapshot struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Null bool   `json:"null"`
+}
+
+func newSchemaSnapshot(tables []*Table) *schemaSnapshot {
+	s := &schemaSnapshot{Tables: make(map[string]*tableSnapshot)}
+	for _, tb := range tables {
+		ts := &tableSnapshot{Pk: tb.Pk}
+		for _, col := range tb.Columns {
+			ts.Columns = append(ts.Columns, &columnSnapshot{Name: col.Tag.Column, Type: col.SQLType, Null: col.Tag.Null})
+		}
+		s.Tables[tb.Name] = ts
+	}
+	return s
+}
+
+func (ts *tableSnapshot) column(name string) *columnSnapshot {
+	for _, col := range ts.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+// latestSnapshot returns the latest schema snapshot of apppath and its file name,
+// or nil when there is none
+func latestSnapshot(apppath string) (*schemaSnapshot, string) {
+	dir := path.Join(apppath, SnapshotPath)
+	var name string
+	if files, err := ioutil.ReadDir(dir); err == nil {
+		for _, f := range files {
+			// snapshot names are dated, the latest one sorts last
+			if strings.HasSuffix(f.Name(), ".json") {
+				name = f.Name()
+			}
+		}
+	}
+	if name == "" {
+		return nil, ""
+	}
+	snapshot, err := readSnapshot(apppath, name)
+	if err != nil {
+		beeLogger.Log.Warnf("Could not read schema snapshot '%s': %s", name, err)
+		return nil, name
+	}
+	return snapshot, name
+}
+
+// readSnapshot reads the schema snapshot of apppath named name, e.g. 20260102_150405.json
+func readSnapshot(apppath, name string) (*schemaSnapshot, error) {
+	snapshot := new(schemaSnapshot)
+	data, err := ioutil.ReadFile(path.Join(apppath, SnapshotPath, name))
+	if err == nil {
+		err = json.Unmarshal(data, snapshot)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// snapshotSchema stores a snapshot of the introspected tables under SnapshotPath when
+// the schema changed since the latest one, and records the changes in SchemaChangelog.
+// When only some of the tables were introspected, the others are kept as they were.
+func snapshotSchema(tables []*Table, allTables bool, apppath string) {
+	dir := path.Join(apppath, SnapshotPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		beeLogger.Log.Fatalf("Could not create directory '%s': %s", dir, err)
+	}
+	current := newSchemaSnapshot(tables)
+	previous, previousName := latestSnapshot(apppath)
+
+	if previous != nil && !allTables {
+		// keep the tables which were not introspected this time as they were
+		for name, ts := range previous.Tables {
+			if _, ok := current.Tables[name]; !ok {
+				current.Tables[name] = ts
+			}
+		}
+	}
+	var changes []string
+	if previous != nil {
+		changes = diffSnapshots(previous, current)
+		if len(changes) == 0 {
+			return
+		}
+	}
+
+	now := time.Now()
+	name := now.Format("20060102_150405") + ".json"
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not encode the schema snapshot: %s", err)
+	}
+	if err := utils.WriteFileAtomic(path.Join(dir, name), append(data, '\n'), 0644); err != nil {
+		beeLogger.Log.Fatalf("Could not write the schema snapshot: %s", err)
+	}
+	if previous == nil {
+		return
+	}
+
+	beeLogger.Log.Infof("Schema changed since snapshot '%s'", previousName)
+	entry := fmt.Sprintf("## %s\n\nChanges since snapshot %s:\n\n", now.Format("2006-01-02 15:04:05"), previousName)
+	for _, c := range changes {
+		entry += "- " + c + "\n"
+	}
+	fpath := path.Join(apppath, SchemaChangelog)
+	changelog := "# Schema changelog\n\n"
+	if utils.IsExist(fpath) {
+		old, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not read the schema changelog: %s", err)
+		}
+		changelog = string(old)
+	}
+	// newest entries first, right after the title
+	if i := strings.Index(changelog, "\n\n"); i >= 0 {
+		if rest := changelog[i+2:]; rest != "" {
+			entry += "\n" + rest
+		}
+		changelog = changelog[:i+2] + entry
+	} else {
+		changelog += "\n\n" + entry
+	}
+	if err := utils.WriteFileAtomic(fpath, []byte(changelog), 0644); err != nil {
+		beeLogger.Log.Fatalf("Could not write the schema changelog: %s", err)
+	}
+}
+
+// diffSnapshots lists the changes between two schema snapshots in a human-readable way
+func diffSnapshots(previous, current *schemaSnapshot) (changes []string) {
+	var names []string
+	for name := range current.Tables {
+		names = append(names, name)
+	}
+	for name := range previous.Tables {
+		if _, ok := current.Tables[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pt, ct := previous.Tables[name], current.Tables[name]
+		switch {
+		case pt == nil:
+			changes = append(changes, fmt.Sprintf("added table `%s`", name))
+			continue
+		case ct == nil:
+			changes = append(changes, fmt.Sprintf("dropped table `%s`", name))
+			continue
+		}
+		if pt.Pk != ct.Pk {
+			changes = append(changes, fmt.Sprintf("changed primary key of `%s` from `%s` to `%s`", name, pt.Pk, ct.Pk))
+		}
+		for _, col := range ct.Columns {
+			pcol := pt.column(col.Name)
+			switch {
+			case pcol == nil:
+				changes = append(changes, fmt.Sprintf("added column `%s.%s` %s", name, col.Name, col.Type))
+			case pcol.Type != col.Type:
+				changes = append(changes, fmt.Sprintf("changed type of `%s.%s` from %s to %s", name, col.Name, pcol.Type, col.Type))
+			case pcol.Null != col.Null:
+				changes = append(changes, fmt.Sprintf("changed `%s.%s` to %s", name, col.Name, nullability(col.Null)))
+			}
+		}
+		for _, pcol := range pt.Columns {
+			if ct.column(pcol.Name) == nil {
+				changes = append(changes, fmt.Sprintf("dropped column `%s.%s`", name, pcol.Name))
+			}
+		}
+	}
+	return
+}
+
+func nullability(null bool) string {
+	if null {
+		return "NULL"
+	}
+	return "NOT NULL"
+}
@@ -0,0 +1,282 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// sqlcQueries holds everything needed to render the sqlc query file of a table
+type sqlcQueries struct {
+	Name          string // CamelCase model name used in the query names
+	Table         string // quoted table name
+	Pk            string // quoted primary key column, empty if the table has none
+	PkParam       string
+	Columns       string // comma separated list of the quoted insertable columns
+	Params        string // placeholders matching Columns
+	Sets          string // "col = ?" assignments used by the update statement
+	UpdatePkParam string // placeholder of the primary key following Sets
+	Limit         string
+	SoftDelete    bool
+	NotDeleted    string
+	Deleted       string
+	Returning     bool // whether the dialect supports INSERT ... RETURNING
+	ReadOnly      bool
+}
+
+// writeSqlcFiles generates one sqlc annotated query file per table in qPath,
+// plus a sqlc.yaml and the schema.sql of the tables next to the queries directory
+func writeSqlcFiles(dbms string, tables []*Table, qPath string, selectedTables map[string]bool) {
+	if dbms == "mssql" || dbms == "oracle" || dbms == "clickhouse" {
+		beeLogger.Log.Warn("sqlc doesn't support SQL Server, Oracle nor ClickHouse, no query file is generated")
+		return
+	}
+	for _, tb := range tables {
+		// if selectedTables map is not nil and this table is not selected, ignore it
+		if selectedTables != nil {
+			if _, selected := selectedTables[tb.Name]; !selected {
+				continue
+			}
+		}
+		writeGeneratedFile(path.Join(qPath, appcodeFileName(tb.Name, "")+".sql"), executeTemplate(SqlcQueryTPL, newSqlcQueries(dbms, tb)))
+	}
+
+	engine := "mysql"
+	if dbms == "postgres" {
+		engine = "postgresql"
+	} else if dbms == "sqlite" {
+		engine = "sqlite"
+	}
+	yamlStr := strings.Replace(SqlcYamlTPL, "{{engine}}", engine, -1)
+	yamlStr = strings.Replace(yamlStr, "{{queries}}", filepath.Base(qPath), -1)
+	writeGeneratedFile(path.Join(filepath.Dir(qPath), "sqlc.yaml"), yamlStr)
+	// the schema describes every table, selected or not, as the queries may join them
+	writeSqlcSchema(dbms, tables, path.Join(filepath.Dir(qPath), "schema.sql"))
+}
+
+// writeSqlcSchema generates the CREATE TABLE statements of the tables read by sqlc,
+// in foreign key order
+func writeSqlcSchema(dbms string, tables []*Table, fpath string) {
+	var b strings.Builder
+	b.WriteString("-- Code generated by hee from the schema of the database, for sqlc.\n")
+	b.WriteString("-- The indexes, checks and triggers of the tables are left out.\n")
+	for _, tb := range tablesInFKOrder(tables) {
+		b.WriteString("\n" + sqlcCreateTable(dbms, tb))
+	}
+	writeGeneratedFile(fpath, b.String())
+}
+
+// sqlcCreateTable returns the CREATE TABLE statement of tb with its primary key,
+// unique and foreign key constraints
+func sqlcCreateTable(dbms string, tb *Table) string {
+	quote := func(name string) string { return "`" + name + "`" }
+	if dbms == "postgres" {
+		quote = func(name string) string { return `"` + name + `"` }
+	}
+	var defs []string
+	inlinePk := false
+	for _, col := range tb.Columns {
+		def := quote(col.Tag.Column) + " " + sqlcColumnType(dbms, col)
+		if col.Tag.Auto && dbms == "sqlite" && col.Tag.Column == tb.Pk {
+			// only an INTEGER PRIMARY KEY column is filled in by SQLite
+			defs, inlinePk = append(defs, quote(col.Tag.Column)+" INTEGER PRIMARY KEY AUTOINCREMENT"), true
+			continue
+		}
+		if col.Tag.Auto && dbms == "mysql" {
+			def += " AUTO_INCREMENT"
+		}
+		if !col.Tag.Null && !col.Tag.FkNull {
+			def += " NOT NULL"
+		}
+		switch {
+		case col.Tag.AutoNow || col.Tag.AutoNowAdd:
+			def += " DEFAULT CURRENT_TIMESTAMP"
+		case col.Tag.DefaultExpr != "" && dbms == "postgres":
+			def += " DEFAULT " + col.Tag.DefaultExpr
+		case col.Tag.DefaultExpr != "":
+			def += " DEFAULT (" + col.Tag.DefaultExpr + ")"
+		case col.Tag.Default != "":
+			def += " DEFAULT " + col.Tag.Default
+		}
+		defs = append(defs, def)
+	}
+	if tb.Pk != "" && !inlinePk {
+		defs = append(defs, "PRIMARY KEY ("+quote(tb.Pk)+")")
+	}
+	for _, col := range tb.UniqueColumns() {
+		defs = append(defs, "UNIQUE ("+quote(col.Tag.Column)+")")
+	}
+	columns := make([]string, 0, len(tb.Fk))
+	for column := range tb.Fk {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		fk := tb.Fk[column]
+		defs = append(defs, fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)", quote(column), quote(fk.RefTable), quote(fk.RefColumn)))
+	}
+	return "CREATE TABLE " + quote(tb.Name) + " (\n\t" + strings.Join(defs, ",\n\t") + "\n);\n"
+}
+
+// sqlcColumnType returns the SQL type of col in the schema read by sqlc, the auto
+// increment PostgreSQL columns becoming serials
+func sqlcColumnType(dbms string, col *Column) string {
+	t := col.SQLType
+	if dbms == "postgres" {
+		switch t {
+		case "ARRAY":
+			// information_schema doesn't tell the type of the elements
+			t = "text[]"
+		case "USER-DEFINED":
+			t = "text"
+		}
+		if col.Tag.Auto {
+			switch t {
+			case "smallint":
+				return "smallserial"
+			case "integer":
+				return "serial"
+			case "bigint":
+				return "bigserial"
+			}
+		}
+	}
+	if t != "" {
+		return t
+	}
+	// the column comes from the configuration of the tables, its type from the model
+	switch col.BaseType() {
+	case "int8", "int16", "uint8", "uint16":
+		return "smallint"
+	case "int", "int32", "uint", "uint32":
+		return "integer"
+	case "int64", "uint64":
+		return "bigint"
+	case "float32", "float64":
+		return "double precision"
+	case "bool":
+		return "boolean"
+	case "time.Time":
+		return "timestamp"
+	case "[]byte":
+		if dbms == "postgres" {
+			return "bytea"
+		}
+		return "blob"
+	}
+	return "text"
+}
+
+// newSqlcQueries prepares the column lists and placeholders of a table for the
+// dialect at hand: MySQL uses '?' while PostgreSQL uses numbered '$n' parameters
+func newSqlcQueries(dbms string, tb *Table) *sqlcQueries {
+	quote := func(name string) string { return "`" + name + "`" }
+	param := func(int) string { return "?" }
+	if dbms == "postgres" {
+		quote = func(name string) string { return `"` + name + `"` }
+		param = func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+
+	q := &sqlcQueries{
+		Name:       utils.CamelCase(tb.Name),
+		Table:      quote(tb.Name),
+		SoftDelete: tb.IdDelete,
+		Returning:  dbms == "postgres",
+		ReadOnly:   tb.ReadOnly,
+		NotDeleted: quote("is_deleted") + " = 0",
+		Deleted:    quote("is_deleted") + " = 1",
+	}
+	var cols, params, sets []string
+	for _, col := range tb.Columns {
+		if col.Tag.Column == tb.Pk && col.Tag.Auto {
+			continue
+		}
+		cols = append(cols, quote(col.Tag.Column))
+		params = append(params, param(len(params)+1))
+	}
+	for _, col := range tb.Columns {
+		if col.Tag.Column == tb.Pk || col.Immutable {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = %s", quote(col.Tag.Column), param(len(sets)+1)))
+	}
+	q.Columns = strings.Join(cols, ", ")
+	q.Params = strings.Join(params, ", ")
+	q.Sets = strings.Join(sets, ", ")
+	q.Limit = fmt.Sprintf("LIMIT %s OFFSET %s", param(1), param(2))
+	if tb.Pk != "" {
+		q.Pk = quote(tb.Pk)
+		q.PkParam = param(1)
+		q.UpdatePkParam = param(len(sets) + 1)
+	}
+	return q
+}
+
+const (
+	SqlcQueryTPL = `-- Code generated by hee. Queries follow the sqlc annotation format,
+-- see https://docs.sqlc.dev for details.
+{{if .Pk}}
+-- name: Get{{.Name}} :one
+SELECT * FROM {{.Table}}
+WHERE {{.Pk}} = {{.PkParam}}{{if .SoftDelete}} AND {{.NotDeleted}}{{end}} LIMIT 1;
+{{end}}
+-- name: List{{.Name}} :many
+SELECT * FROM {{.Table}}{{if .SoftDelete}}
+WHERE {{.NotDeleted}}{{end}}{{if .Pk}}
+ORDER BY {{.Pk}}{{end}}
+{{.Limit}};
+
+-- name: Count{{.Name}} :one
+SELECT count(*) FROM {{.Table}}{{if .SoftDelete}}
+WHERE {{.NotDeleted}}{{end}};
+{{if not .ReadOnly}}
+-- name: Create{{.Name}} {{if .Returning}}:one{{else}}:execresult{{end}}
+INSERT INTO {{.Table}} (
+	{{.Columns}}
+) VALUES (
+	{{.Params}}
+){{if .Returning}}
+RETURNING *{{end}};
+{{if .Pk}}
+-- name: Update{{.Name}} :exec
+UPDATE {{.Table}} SET {{.Sets}}
+WHERE {{.Pk}} = {{.UpdatePkParam}};
+
+-- name: Delete{{.Name}} :exec
+{{if .SoftDelete}}UPDATE {{.Table}} SET {{.Deleted}}{{else}}DELETE FROM {{.Table}}{{end}}
+WHERE {{.Pk}} = {{.PkParam}};
+{{end}}{{end}}`
+
+	SqlcYamlTPL = `# Code generated by hee.
+# schema.sql holds the tables of the database as introspected by hee, it can be replaced
+# by a full dump of the schema, e.g. the output of "mysqldump --no-data" or "pg_dump --schema-only".
+version: "2"
+sql:
+  - engine: "{{engine}}"
+    queries: "{{queries}}"
+    schema: "schema.sql"
+    gen:
+      go:
+        package: "db"
+        out: "db"
+`
+)
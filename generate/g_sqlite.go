@@ -0,0 +1,293 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// SqliteDB is the SQLite version of DbTransformer
+type SqliteDB struct {
+}
+
+// typeMappingSqlite maps the declared types of SQLite columns to Go types, the
+// others being mapped by their affinity
+var typeMappingSqlite = map[string]string{
+	"integer":   "int64", // int
+	"int":       "int64",
+	"tinyint":   "int8",
+	"smallint":  "int16",
+	"mediumint": "int32",
+	"bigint":    "int64",
+	"boolean":   "bool", // bool
+	"bool":      "bool",
+	"varchar":   "string", // string & text
+	"char":      "string",
+	"character": "string",
+	"nvarchar":  "string",
+	"nchar":     "string",
+	"text":      "string",
+	"clob":      "string",
+	"blob":      "string", // blob
+	"":          "string",
+	"date":      "time.Time", // time
+	"datetime":  "time.Time",
+	"timestamp": "time.Time",
+	"time":      "time.Time",
+	"real":      "float64", // float & decimal
+	"float":     "float64",
+	"double":    "float64",
+	"numeric":   "float64",
+	"decimal":   "float64",
+}
+
+// GetTableNames for SQLite
+func (*SqliteDB) GetTableNames(db *sql.DB) (tables []string) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show tables: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			beeLogger.Log.Fatalf("Could not show tables: %s", err)
+		}
+		tables = append(tables, name)
+	}
+	return
+}
+
+// sqlitePk returns the columns of the primary key of a table, in their order
+func sqlitePk(db *sql.DB, table string) (pk []string) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the primary key of '%s': %s", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			beeLogger.Log.Fatalf("Could not read the primary key of '%s': %s", table, err)
+		}
+		pk = append(pk, name)
+	}
+	return
+}
+
+// GetConstraints for SQLite, from the table_info, index_list and foreign_key_list pragmas
+func (*SqliteDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
+	if pk := sqlitePk(db, table.Name); len(pk) == 1 {
+		table.Pk = pk[0]
+	} else if len(pk) > 1 {
+		// add table to blacklist so that other struct will not reference it, because we are not
+		// registering blacklisted tables
+		blackList[table.Name] = true
+	}
+
+	rows, err := db.Query(
+		`SELECT l.name, l.origin, i.name FROM pragma_index_list(?) l, pragma_index_info(l.name) i
+		WHERE l."unique" = 1 AND l.origin <> 'pk'`, table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the unique keys of '%s': %s", table.Name, err)
+	}
+	uks := make(map[string][]string)
+	for rows.Next() {
+		var indexName, origin, columnName string
+		if err := rows.Scan(&indexName, &origin, &columnName); err != nil {
+			beeLogger.Log.Fatalf("Could not read the unique keys of '%s': %s", table.Name, err)
+		}
+		table.Uk = append(table.Uk, columnName)
+		// the indexes of the UNIQUE constraints can't be dropped
+		if origin == "c" {
+			uks[indexName] = append(uks[indexName], columnName)
+		}
+	}
+	rows.Close()
+	table.nameUniqueKeys(uks)
+
+	rows, err = db.Query(`SELECT "table", "from", "to" FROM pragma_foreign_key_list(?)`, table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the foreign keys of '%s': %s", table.Name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var refTableName, columnName string
+		var refColumnName sql.NullString
+		if err := rows.Scan(&refTableName, &columnName, &refColumnName); err != nil {
+			beeLogger.Log.Fatalf("Could not read the foreign keys of '%s': %s", table.Name, err)
+		}
+		fk := new(ForeignKey)
+		fk.Name = columnName
+		fk.RefSchema = "main"
+		fk.RefTable = refTableName
+		fk.RefColumn = refColumnName.String
+		table.Fk[columnName] = fk
+	}
+	rows.Close()
+	for _, fk := range table.Fk {
+		if fk.RefColumn == "" {
+			// REFERENCES <table> without a column references its primary key
+			if pk := sqlitePk(db, fk.RefTable); len(pk) == 1 {
+				fk.RefColumn = pk[0]
+			}
+		}
+	}
+}
+
+// GetColumns for SQLite, from the table_info pragma. SQLite has no column comment
+func (sqliteDB *SqliteDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+	colDefRows, err := db.Query(`SELECT name, type, "notnull", dflt_value FROM pragma_table_info(?) ORDER BY cid`, table.Name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query the columns of '%s': %s", table.Name, err)
+	}
+	defer colDefRows.Close()
+
+	for colDefRows.Next() {
+		var colName, columnType string
+		var notNull bool
+		var columnDefault sql.NullString
+		if err := colDefRows.Scan(&colName, &columnType, &notNull, &columnDefault); err != nil {
+			beeLogger.Log.Fatalf("Could not read the columns of '%s': %s", table.Name, err)
+		}
+		// the declared type is free text, e.g. VARCHAR(64) or UNSIGNED BIG INT
+		columnType = strings.ToLower(strings.TrimSpace(columnType))
+		dataType := sqliteDataType(columnType)
+
+		// create a column
+		col := new(Column)
+		col.Name = utils.CamelCase(colName)
+		col.Type, err = sqliteDB.GetGoDataType(dataType)
+		if err != nil {
+			beeLogger.Log.Fatalf("%s", err)
+		}
+		if colName == "is_deleted" {
+			// 如果存在该列，则会记录需要用这个字段来代表删除动作
+			table.IdDelete = true
+		}
+
+		// Tag info
+		tag := new(OrmTag)
+		tag.Column = colName
+		if table.Pk == colName {
+			if KeepPkName {
+				// gorm only guesses the primary key of a field named Id
+				tag.Pk = true
+			} else {
+				col.Name = "Id"
+			}
+			table.PkType = col.Type
+			if dataType == "integer" {
+				// an INTEGER PRIMARY KEY is the rowid, assigned by SQLite
+				tag.Auto = true
+			} else {
+				tag.Pk = true
+			}
+		} else {
+			fkCol, isFk := table.Fk[colName]
+			isBl := false
+			if isFk {
+				_, isBl = blackList[fkCol.RefTable]
+			}
+			// check if the current column is a foreign key
+			if isFk && !isBl {
+				tag.RelFk = true
+				refStructName := fkCol.RefTable
+				tag.TableFk = refStructName
+				col.Name = utils.CamelCase(colName)
+				col.Type = "*" + utils.CamelCase(refStructName)
+			} else {
+				// if the name of column is Id, and it's not primary key
+				if colName == "id" {
+					col.Name = idFieldName
+				}
+				if !notNull {
+					tag.Null = true
+				}
+				if isSQLStringType(dataType) {
+					tag.Size = extractColSize(columnType)
+				}
+				if isSQLTemporalType(dataType) {
+					tag.Type = dataType
+					if isSqliteCurrentTimestamp(columnDefault.String) {
+						tag.AutoNowAdd = true
+					}
+					// NULL must not be read as the zero time, use a pointer instead
+					if tag.Null {
+						col.Type = "*" + col.Type
+					}
+					// need to import time package
+					table.ImportTimePkg = true
+				}
+				if !tag.AutoNowAdd && columnDefault.Valid {
+					tag.Default = literalDefault(colName, columnDefault.String)
+				}
+				if isSQLDecimal(dataType) {
+					tag.Digits, tag.Decimals = extractDecimal(columnType)
+				}
+			}
+		}
+		col.SQLType = columnType
+		col.Tag = tag
+		table.Columns = append(table.Columns, col)
+	}
+}
+
+// sqliteDataType returns the data type of a declared type, without its size and
+// modifiers, e.g. varchar(64) => varchar, unsigned big int => bigint
+func sqliteDataType(columnType string) string {
+	dataType := regexp.MustCompile(`\(.*$`).ReplaceAllString(columnType, "")
+	dataType = strings.TrimSpace(strings.TrimPrefix(dataType, "unsigned"))
+	switch dataType {
+	case "big int":
+		return "bigint"
+	case "varying character", "native character":
+		return "varchar"
+	case "double precision":
+		return "double"
+	}
+	return dataType
+}
+
+// GetGoDataType maps a declared SQLite type to a Go type, by the rules of the type
+// affinity of SQLite when it is not in typeMappingSqlite
+func (*SqliteDB) GetGoDataType(sqlType string) (string, error) {
+	if v, ok := typeMappingSqlite[sqlType]; ok {
+		return v, nil
+	}
+	switch {
+	case strings.Contains(sqlType, "int"):
+		return "int64", nil
+	case strings.Contains(sqlType, "char"), strings.Contains(sqlType, "clob"), strings.Contains(sqlType, "text"):
+		return "string", nil
+	case strings.Contains(sqlType, "blob"):
+		return "string", nil
+	}
+	// real and numeric affinities
+	return "float64", nil
+}
+
+// isSqliteCurrentTimestamp reports whether a column default is the current time,
+// e.g. CURRENT_TIMESTAMP or (datetime('now', 'localtime'))
+func isSqliteCurrentTimestamp(def string) bool {
+	regex := regexp.MustCompile(`^(?i)\(?(datetime|strftime|julianday|unixepoch)\((.*,\s*)?'now'(\s*,.*)?\)\)?$`)
+	return regex.MatchString(def) || isCurrentTimestamp(def)
+}
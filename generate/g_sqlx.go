@@ -0,0 +1,414 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+	"github.com/skOak/hee/utils"
+)
+
+// ORMs of the generated models, see -orm
+const (
+	OrmGorm = "gorm"
+	OrmSqlx = "sqlx"
+)
+
+// sqlxMode reports whether the generated models are plain structs queried with
+// jmoiron/sqlx instead of gorm models, the flag overriding the configuration
+func sqlxMode() bool {
+	orm := ORM.String()
+	if orm == "" {
+		orm = config.Conf.Appcode.Orm
+	}
+	switch strings.ToLower(orm) {
+	case "", OrmGorm:
+		return false
+	case OrmSqlx:
+		return true
+	}
+	beeLogger.Log.Fatalf("Invalid ORM '%s'. Must be either \"gorm\" or \"sqlx\"", orm)
+	return false
+}
+
+// checkSqlx fails when the sqlx models can't be generated for the dialect or with
+// the options only implemented by the gorm models
+func checkSqlx(dbms string) {
+	if !sqlxMode() {
+		return
+	}
+	switch {
+	case dbms != "mysql" && dbms != "postgres" && dbms != "sqlite":
+		beeLogger.Log.Fatalf("The sqlx models are only generated for mysql, postgres and sqlite, not for %s", dbms)
+	case gormV2():
+		beeLogger.Log.Fatal("The sqlx models don't use gorm, -gorm can't be set with -orm=sqlx")
+	case Hexagonal:
+		beeLogger.Log.Fatal("The persistence of the hexagonal mode is built on the gorm models, it can't be used with -orm=sqlx")
+	case TimeWrapper:
+		beeLogger.Log.Fatal("models.Time is a gorm model type, -timewrapper can't be used with -orm=sqlx")
+	}
+}
+
+// useSqlx adapts the columns of the tables to sqlx, the relations becoming the
+// plain values of their foreign keys
+func useSqlx(tables []*Table) {
+	relationKeys(tables)
+	for _, tb := range tables {
+		if tb.SignatureColumn != "" {
+			beeLogger.Log.Fatalf("The signature of '%s' is computed by the hooks of the gorm models, it can't be used with -orm=sqlx", tb.Name)
+		}
+		tb.ImportTimePkg = usesTimePkg(tb)
+	}
+}
+
+// sqlxTable describes the model of a table and the SQL of its CRUD functions,
+// the SQL being Go string literals
+type sqlxTable struct {
+	*Table
+	Model       string
+	Dialect     string
+	Struct      string
+	PkColumn    *Column // nil when the table has no primary key
+	SelectSQL   string
+	ByPkSQL     string // where clause of the primary key
+	PageSQL     string // order and bounds of a page of Search
+	CountSQL    string
+	InsertSQL   string
+	UpdateSQL   string // empty when no column can be updated
+	DeleteSQL   string
+	CreateTimes []*Column // set to the current time by Add
+	UpdateTimes []*Column // set to the current time by Add and Update
+}
+
+func newSqlxTable(dbms string, tb *Table) *sqlxTable {
+	quote := func(name string) string {
+		if dbms == "mysql" {
+			return "`" + name + "`"
+		}
+		return `"` + name + `"`
+	}
+	st := &sqlxTable{Table: tb, Model: utils.CamelCase(tb.Name), Dialect: dbms, Struct: tb.String(), PkColumn: tb.Column(tb.Pk)}
+	var cols, inserted, values, set []string
+	for _, col := range tb.Columns {
+		name := col.Tag.Column
+		cols = append(cols, quote(name))
+		if !col.Tag.Auto {
+			inserted, values = append(inserted, quote(name)), append(values, ":"+name)
+		}
+		if name != tb.Pk && !col.Tag.Auto && !col.Tag.AutoNowAdd && !col.Immutable {
+			set = append(set, quote(name)+" = :"+name)
+		}
+		if (col.Tag.AutoNow || col.Tag.AutoNowAdd) && col.BaseType() == "time.Time" {
+			st.CreateTimes = append(st.CreateTimes, col)
+			if col.Tag.AutoNow {
+				st.UpdateTimes = append(st.UpdateTimes, col)
+			}
+		}
+	}
+	table := quote(tb.Name)
+	st.SelectSQL = strconv.Quote("SELECT " + strings.Join(cols, ", ") + " FROM " + table)
+	st.CountSQL = strconv.Quote("SELECT COUNT(*) FROM " + table)
+	insert := "INSERT INTO " + table + " (" + strings.Join(inserted, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
+	st.PageSQL = strconv.Quote(" LIMIT ? OFFSET ?")
+	if st.PkColumn != nil {
+		pk := quote(tb.Pk)
+		if dbms == "postgres" && st.PkColumn.Tag.Auto {
+			insert += " RETURNING " + pk
+		}
+		if len(set) > 0 {
+			st.UpdateSQL = strconv.Quote("UPDATE " + table + " SET " + strings.Join(set, ", ") + " WHERE " + pk + " = :" + tb.Pk)
+		}
+		st.DeleteSQL = strconv.Quote("DELETE FROM " + table + " WHERE " + pk + " = ?")
+		st.ByPkSQL = strconv.Quote(" WHERE " + pk + " = ?")
+		st.PageSQL = strconv.Quote(" ORDER BY " + pk + " LIMIT ? OFFSET ?")
+	}
+	st.InsertSQL = strconv.Quote(insert)
+	return st
+}
+
+// writeSqlxModelFiles generates the sqlx models of the tables and models.go
+// opening their database
+func writeSqlxModelFiles(dbms string, tables []*Table, mPath string, selectedTables map[string]bool) {
+	for _, tb := range selectTables(tables, selectedTables) {
+		fpath := path.Join(mPath, modelFileName(tb.Name)+".go")
+		writeGeneratedFile(fpath, executeTemplate(SqlxModelTPL, newSqlxTable(dbms, tb)))
+	}
+	writeKeyFiles(tables, mPath)
+	data := newModelsData(dbms)
+	writeGeneratedFile(path.Join(mPath, "models.go"), executeTemplate(SqlxModelsTPL, data))
+}
+
+const (
+	SqlxModelTPL = `package models
+
+import (
+	"math"
+{{if .ImportTimePkg}}	"time"
+{{end}}
+{{if .ImportPgtype}}	"github.com/jackc/pgtype"
+{{end}}{{if .ImportMssql}}	"github.com/denisenkom/go-mssqldb"
+{{end}}{{range .CustomImports}}	"{{.}}"
+{{end}}	"github.com/jmoiron/sqlx"
+)
+
+{{.Struct}}
+// Column names of {{.Name}}, to be used when building queries
+const (
+{{range .Columns}}	{{$.Model}}Col{{.Name}} = "{{.Tag.Column}}"
+{{end}})
+
+// SQL of the CRUD functions of {{.Model}}
+const (
+	select{{.Model}}SQL = {{.SelectSQL}}
+	count{{.Model}}SQL  = {{.CountSQL}}
+{{if .PkColumn}}{{if not .ReadOnly}}	insert{{.Model}}SQL = {{.InsertSQL}}
+{{if .UpdateSQL}}	update{{.Model}}SQL = {{.UpdateSQL}}
+{{end}}	delete{{.Model}}SQL = {{.DeleteSQL}}
+{{end}}{{end}})
+{{if .PkColumn}}{{if not .ReadOnly}}
+// Add{{.Model}} inserts a new {{.Model}} into database and returns its {{.Pk}} on success
+func Add{{.Model}}(tx sqlx.Ext, m *{{.Model}}) (id {{.PkType}}, err error) {
+	db := ext(tx)
+	{{if .CreateTimes}}now := time.Now()
+	{{range .CreateTimes}}m.{{.Name}} = {{if eq .Type "time.Time"}}now{{else}}&now{{end}}
+	{{end}}{{end}}{{if not .PkColumn.Tag.Auto}}if _, err = sqlx.NamedExec(db, insert{{.Model}}SQL, m); err != nil {
+		return
+	}
+	{{else if eq .Dialect "postgres"}}if err = namedGet(db, &m.{{.PkColumn.Name}}, insert{{.Model}}SQL, m); err != nil {
+		return
+	}
+	{{else}}res, err := sqlx.NamedExec(db, insert{{.Model}}SQL, m)
+	if err != nil {
+		return
+	}
+	var lastId int64
+	if lastId, err = res.LastInsertId(); err != nil {
+		return
+	}
+	m.{{.PkColumn.Name}} = {{.PkType}}(lastId)
+	{{end}}return m.{{.PkColumn.Name}}, nil
+}
+{{end}}
+// Get{{.Model}}ById retrieves {{.Model}} by {{.Pk}}. Returns ErrNotFound if it doesn't exist
+func Get{{.Model}}ById(tx sqlx.Ext, id {{.PkType}}) (v *{{.Model}}, err error) {
+	db := ext(tx)
+	v = new({{.Model}})
+	if err = sqlx.Get(db, v, db.Rebind(select{{.Model}}SQL+{{.ByPkSQL}}), id); err != nil {
+		return nil, notFound(err)
+	}
+	return v, nil
+}
+{{end}}
+// Search{{.Model}}s retrieves the {{.Model}}s matching the where clause of query{{if .PkColumn}}
+// in the order of {{.Pk}}{{end}}, at most limit of them unless it is 0. Returns empty list if no records exist
+func Search{{.Model}}s(tx sqlx.Ext, offset, limit uint64, query string, queryArgs ...interface{}) (ml []*{{.Model}}, err error) {
+	db := ext(tx)
+	q := select{{.Model}}SQL
+	if query != "" {
+		q += " WHERE " + query
+	}
+	n := int64(limit)
+	if n <= 0 {
+		n = math.MaxInt64
+	}
+	q += {{.PageSQL}}
+	err = sqlx.Select(db, &ml, db.Rebind(q), append(queryArgs, n, offset)...)
+	return
+}
+
+// Count{{.Model}}s counts the {{.Model}}s matching the where clause of query
+func Count{{.Model}}s(tx sqlx.Ext, query string, queryArgs ...interface{}) (count int64, err error) {
+	db := ext(tx)
+	q := count{{.Model}}SQL
+	if query != "" {
+		q += " WHERE " + query
+	}
+	err = sqlx.Get(db, &count, db.Rebind(q), queryArgs...)
+	return
+}
+{{if .PkColumn}}{{if not .ReadOnly}}{{if .UpdateSQL}}
+// Update{{.Model}}ById updates the columns of {{.Model}} by {{.Pk}} and returns ErrNotFound if
+// the record to be updated doesn't exist
+func Update{{.Model}}ById(tx sqlx.Ext, m *{{.Model}}) (err error) {
+	db := ext(tx)
+	{{if .UpdateTimes}}now := time.Now()
+	{{range .UpdateTimes}}m.{{.Name}} = {{if eq .Type "time.Time"}}now{{else}}&now{{end}}
+	{{end}}{{end}}res, err := sqlx.NamedExec(db, update{{.Model}}SQL, m)
+	if err != nil {
+		return
+	}
+	return affected(res)
+}
+{{end}}
+// Delete{{.Model}} deletes {{.Model}} by {{.Pk}} and returns ErrNotFound if the record to be
+// deleted doesn't exist
+func Delete{{.Model}}(tx sqlx.Ext, id {{.PkType}}) (err error) {
+	db := ext(tx)
+	res, err := db.Exec(db.Rebind(delete{{.Model}}SQL), id)
+	if err != nil {
+		return
+	}
+	return affected(res)
+}
+{{end}}{{end}}`
+
+	SqlxModelsTPL = `package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+{{if eq .Dialect "mysql" "sqlite"}}	"strings"
+{{end}}	"sync"
+
+{{if eq .Dialect "mysql"}}	_ "github.com/go-sql-driver/mysql"
+{{else if eq .Dialect "sqlite"}}	_ "github.com/mattn/go-sqlite3"
+{{else if .Pgx}}	_ "github.com/jackc/pgx/v4/stdlib"
+{{else}}	_ "github.com/lib/pq"
+{{end}}	"github.com/jmoiron/sqlx"
+)
+
+// ErrNotFound is returned when the requested record doesn't exist, it wraps sql.ErrNoRows
+var ErrNotFound = fmt.Errorf("models: %w", sql.ErrNoRows)
+
+// IsNotFound reports whether err means that the requested record doesn't exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// notFound returns ErrNotFound for the errors meaning that the record doesn't exist
+// and err otherwise
+func notFound(err error) error {
+	if IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// affected returns ErrNotFound when res changed no record
+func affected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+{{if eq .Dialect "postgres"}}
+// namedGet runs the named query with the fields of arg and scans its single row into dest
+func namedGet(db sqlx.Ext, dest interface{}, query string, arg interface{}) error {
+	rows, err := sqlx.NamedQuery(db, query, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	return rows.Scan(dest)
+}
+{{end}}
+const (
+	// DefaultPageSize is the number of records listed when no limit is requested
+	DefaultPageSize = {{.DefaultLimit}}
+	// MaxPageSize caps the number of records of a page requested by a client, 0 for no cap
+	MaxPageSize = {{.MaxLimit}}
+)
+
+// PageLimit applies MaxPageSize to the limit requested by a client, 0 standing for no limit.
+// The model functions list all the records when given no limit.
+func PageLimit(limit int64) int64 {
+	if MaxPageSize > 0 && (limit <= 0 || limit > MaxPageSize) {
+		return MaxPageSize
+	}
+	return limit
+}
+
+var once sync.Once // protects the following db to be initialized once
+var db *sqlx.DB
+
+// Open connects to the database of connStr with the {{if eq .Dialect "mysql"}}mysql{{else if eq .Dialect "sqlite"}}sqlite3{{else if .Pgx}}pgx{{else}}postgres{{end}} driver
+func Open(connStr string) (err error) {
+	if db != nil {
+		return errors.New("db already opened")
+	}
+	once.Do(func() {
+		{{if eq .Dialect "mysql"}}if !strings.Contains(connStr, "?") {
+			connStr += "?parseTime=True"
+		}
+		if !strings.Contains(connStr, "parseTime") {
+			connStr += "&parseTime=True"
+		}
+		if !strings.Contains(connStr, "loc") {
+			connStr += "&loc=Local"
+		}
+		if !strings.Contains(connStr, "charset") {
+			connStr += "&charset=utf8mb4"
+		}
+		// the records matched by an update are counted even when unchanged, see affected
+		if !strings.Contains(connStr, "clientFoundRows") {
+			connStr += "&clientFoundRows=true"
+		}
+		{{else if eq .Dialect "sqlite"}}// SQLite only checks the foreign keys when told so, per connection
+		if !strings.Contains(connStr, "_foreign_keys") && !strings.Contains(connStr, "_fk") {
+			if strings.Contains(connStr, "?") {
+				connStr += "&_foreign_keys=on"
+			} else {
+				connStr += "?_foreign_keys=on"
+			}
+		}
+		{{end}}var conn *sqlx.DB
+		if conn, err = sqlx.Connect("{{if eq .Dialect "mysql"}}mysql{{else if eq .Dialect "sqlite"}}sqlite3{{else if .Pgx}}pgx{{else}}postgres{{end}}", connStr); err == nil {
+			db = conn
+		}
+	})
+	return
+}
+
+// DB returns the database opened by Open
+func DB() *sqlx.DB {
+	return db
+}
+
+// ext returns tx, or DB() when tx is nil
+func ext(tx sqlx.Ext) sqlx.Ext {
+	if tx == nil {
+		return DB()
+	}
+	return tx
+}
+
+func Close() (err error) {
+	if db != nil {
+		defer func() {
+			if err == nil {
+				// if successfully closed, clear dangling pointer
+				db = nil
+			}
+		}()
+		return db.Close()
+	}
+
+	// omit if db is not in open
+	return nil
+}
+`
+)
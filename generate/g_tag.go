@@ -0,0 +1,112 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/skOak/hee/config"
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// StructTag builds the tag of a struct field out of namespaces,
+// e.g. `json:"id" gorm:"column:id;not null"`. Each namespace holds a list of options,
+// joined with the separator of its namespace.
+type StructTag struct {
+	keys    []string
+	options map[string][]string
+}
+
+// tagSeparators holds the option separator of the namespaces not separated by a comma
+var tagSeparators = map[string]string{
+	"gorm": ";",
+	"sql":  ";",
+}
+
+// Add appends options to a namespace, the namespaces being written in the order they are added.
+// Empty options are ignored.
+func (t *StructTag) Add(key string, options ...string) *StructTag {
+	if t.options == nil {
+		t.options = make(map[string][]string)
+	}
+	for _, opt := range options {
+		if opt == "" {
+			continue
+		}
+		if _, ok := t.options[key]; !ok {
+			t.keys = append(t.keys, key)
+		}
+		t.options[key] = append(t.options[key], opt)
+	}
+	return t
+}
+
+// String returns the tag as a raw string literal, or an interpreted one if it holds a backtick,
+// or an empty string for a tag without options
+func (t *StructTag) String() string {
+	if len(t.keys) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(t.keys))
+	for _, key := range t.keys {
+		sep, ok := tagSeparators[key]
+		if !ok {
+			sep = ","
+		}
+		// the values are quoted as defaults or comments may hold quotes or backslashes
+		parts = append(parts, key+":"+strconv.Quote(strings.Join(t.options[key], sep)))
+	}
+	tag := strings.Join(parts, " ")
+	if strings.Contains(tag, "`") {
+		// a raw string literal can't hold a backtick, e.g. in a comment
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// customTagTemplates holds the parsed templates of the custom tags, see addCustomTags
+var customTagTemplates map[string]*template.Template
+
+// addCustomTags adds the tags of the appcode configuration, whose values are templates
+// executed against the OrmTag of the column, e.g. "xml": "{{.Column}}" or
+// "validate": "{{if not .Null}}required{{end}}". Empty values are left out.
+func addCustomTags(t *StructTag, tag *OrmTag) {
+	if customTagTemplates == nil {
+		customTagTemplates = make(map[string]*template.Template, len(config.Conf.Appcode.Tags))
+		for key, value := range config.Conf.Appcode.Tags {
+			tpl, err := template.New(key).Parse(value)
+			if err != nil {
+				beeLogger.Log.Fatalf("Could not parse the '%s' tag: %s", key, err)
+			}
+			customTagTemplates[key] = tpl
+		}
+	}
+	keys := make([]string, 0, len(customTagTemplates))
+	for key := range customTagTemplates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var buf bytes.Buffer
+		if err := customTagTemplates[key].Execute(&buf, tag); err != nil {
+			beeLogger.Log.Fatalf("Could not render the '%s' tag of column '%s': %s", key, tag.Column, err)
+		}
+		t.Add(key, strings.TrimSpace(buf.String()))
+	}
+}
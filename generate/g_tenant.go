@@ -0,0 +1,135 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+
+	"github.com/skOak/hee/config"
+)
+
+// applyTenant scopes the queries of the table to the rows of a tenant when it has
+// the tenant column of the configuration, the column being immutable then
+func applyTenant(tb *Table, unscoped bool) {
+	column := config.Conf.Appcode.Tenant.Column
+	if column == "" || unscoped {
+		return
+	}
+	if col := tb.Column(column); col != nil {
+		tb.TenantColumn = column
+		col.Immutable = true
+	}
+}
+
+// tenantScoped reports whether a table is scoped to the rows of a tenant
+func tenantScoped(tables []*Table) bool {
+	for _, tb := range tables {
+		if tb.TenantColumn != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTenantFile generates tenant.go holding models.ForTenant
+func writeTenantFile(mPath string) {
+	writeGeneratedFile(path.Join(mPath, "tenant.go"), executeTemplate(TenantTPL, nil))
+}
+
+// writeCtrlTenantFile generates tenant.go reading the tenant of the requests
+func writeCtrlTenantFile(cPath, pkgPath string) {
+	writeGeneratedFile(path.Join(cPath, "tenant.go"), executeTemplate(CtrlTenantTPL, pkgPath))
+}
+
+const TenantTPL = `package models
+
+import (
+	"errors"
+{{if gormV2}}	"fmt"
+	"reflect"
+{{end}}
+	"github.com/jinzhu/gorm"
+)
+
+// tenantSetting is the gorm setting holding the tenant of the queries
+const tenantSetting = "models:tenant"
+
+// ErrNoTenant is returned when creating a record with a nil tenant
+var ErrNoTenant = errors.New("no tenant")
+
+// ForTenant returns db, or DB() when nil, scoping the queries of the tables owned by a tenant
+// to the rows of tenant: only they are found, updated and deleted, and the created records get
+// it. A nil tenant matches no row. The queries of a db not returned by ForTenant aren't scoped.
+func ForTenant(db *gorm.DB, tenant interface{}) *gorm.DB {
+	if db == nil {
+		db = DB()
+	}
+	return db.Set(tenantSetting, tenant)
+}
+
+// tenantOf returns the tenant set on db by ForTenant
+func tenantOf(db *gorm.DB) (interface{}, bool) {
+	return db.Get(tenantSetting)
+}
+
+// scopeTenant restricts db to the rows whose column holds the tenant of db, if any
+func scopeTenant(db *gorm.DB, column string) *gorm.DB {
+	if tenant, ok := tenantOf(db); ok {
+		return db.Where(column+" = ?", tenant)
+	}
+	return db
+}
+
+// setTenant sets the column of the record m to the tenant of db, if any
+func setTenant(db *gorm.DB, m interface{}, column string) error {
+	tenant, ok := tenantOf(db)
+	if !ok {
+		return nil
+	}
+	if tenant == nil {
+		return ErrNoTenant
+	}
+{{if gormV2}}	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(m); err != nil {
+		return err
+	}
+	field := stmt.Schema.LookUpField(column)
+	if field == nil {
+		return fmt.Errorf("models: unknown tenant column %s", column)
+	}
+	return field.Set(db.Statement.Context, reflect.ValueOf(m), tenant)
+{{else}}	return db.NewScope(m).SetColumn(column, tenant)
+{{end}}}
+`
+
+const CtrlTenantTPL = `package controllers
+
+import (
+	"{{.}}/models"
+
+	"github.com/astaxie/beego/context"
+	"github.com/jinzhu/gorm"
+)
+
+// TenantKey is the key of the context data holding the tenant of a request, set by
+// an authentication filter, e.g. ctx.Input.SetData(controllers.TenantKey, claims.TenantId)
+const TenantKey = "tenant"
+
+// tenantDB returns the database of the request scoped to its tenant, a request
+// without tenant finding no row
+func tenantDB(ctx *context.Context) *gorm.DB {
+	return models.ForTenant(nil, ctx.Input.GetData(TenantKey))
+}
+`
@@ -0,0 +1,78 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// tidbStorage describes how TiDB stores the rows of a table
+type tidbStorage struct {
+	AutoRandomBits string // bits of the AUTO_RANDOM primary key which are random, if any
+	ShardBits      string // SHARD_ROW_ID_BITS scattering the hidden row ids, if any
+	Clustered      bool   // the rows are clustered by their primary key, rather than by a hidden row id
+}
+
+var (
+	tidbAutoRandomBits = regexp.MustCompile(`PK_AUTO_RANDOM_BITS=([0-9]+)`)
+	tidbShardBits      = regexp.MustCompile(`SHARD_BITS=([0-9]+)`)
+)
+
+// tidbTableStorage reads the storage of a table from the TiDB columns of information_schema.tables
+func tidbTableStorage(db *sql.DB, table *Table) (s tidbStorage) {
+	var sharding, pkType string
+	err := db.QueryRow(
+		`SELECT COALESCE(tidb_row_id_sharding_info, ''), COALESCE(tidb_pk_type, '')
+		FROM information_schema.tables
+		WHERE table_schema = database() AND table_name = ?`,
+		table.Name).Scan(&sharding, &pkType)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not read the TiDB storage of table '%s': %s", table.Name, err)
+	}
+	if m := tidbAutoRandomBits.FindStringSubmatch(sharding); m != nil {
+		s.AutoRandomBits = m[1]
+	}
+	if m := tidbShardBits.FindStringSubmatch(sharding); m != nil {
+		s.ShardBits = m[1]
+	}
+	s.Clustered = pkType == "CLUSTERED"
+	return
+}
+
+// tidbNotes returns the notes written on the model of a TiDB table, telling how
+// its ids are generated and how its rows are stored
+func tidbNotes(s tidbStorage, auto bool) (notes []string) {
+	switch {
+	case s.AutoRandomBits != "":
+		notes = append(notes, fmt.Sprintf("The ids are generated by AUTO_RANDOM(%s): they are unique but not increasing,", s.AutoRandomBits),
+			"so sorting the records by id doesn't sort them by creation.")
+	case auto:
+		notes = append(notes, "The AUTO_INCREMENT ids are allocated in batches by each TiDB server: they are",
+			"unique but only increasing per server, unless the table has AUTO_ID_CACHE=1.")
+	}
+	if s.Clustered {
+		notes = append(notes, "The rows are clustered by their primary key.")
+	} else {
+		notes = append(notes, "The rows are stored by a hidden _tidb_rowid, the primary key being a secondary index.")
+		if s.ShardBits != "" {
+			notes = append(notes, fmt.Sprintf("The row ids are scattered by SHARD_ROW_ID_BITS=%s.", s.ShardBits))
+		}
+	}
+	return
+}
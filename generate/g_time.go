@@ -0,0 +1,156 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// useTimeWrapper switches the temporal columns of the tables from time.Time
+// to the generated models.Time
+func useTimeWrapper(tables []*Table) {
+	for _, tb := range tables {
+		for _, col := range tb.Columns {
+			if col.BaseType() == "time.Time" {
+				col.Type = strings.Replace(col.Type, "time.Time", "Time", 1)
+			}
+		}
+		// models.Time lives in the models package, time is not needed anymore
+		tb.ImportTimePkg = false
+	}
+}
+
+// writeTimeFile generates time.go holding the models.Time wrapper
+func writeTimeFile(mPath string) {
+	layout := TimeLayout.String()
+	if layout == "" {
+		layout = "2006-01-02T15:04:05Z07:00"
+	}
+	normalize := "t"
+	switch strings.ToLower(TimeZone.String()) {
+	case "":
+	case "utc":
+		normalize = "t.UTC()"
+	case "local":
+		normalize = "t.Local()"
+	default:
+		beeLogger.Log.Fatalf("Invalid timezone '%s'. Must be either \"utc\" or \"local\"", TimeZone)
+	}
+	fileStr := strings.Replace(TimeTPL, "{{timeLayout}}", strconv.Quote(layout), -1)
+	fileStr = strings.Replace(fileStr, "{{normalize}}", normalize, -1)
+	writeGeneratedFile(path.Join(mPath, "time.go"), fileStr)
+}
+
+const TimeTPL = `package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeLayout is the layout used to read and write Time values as JSON
+const TimeLayout = {{timeLayout}}
+
+// Time wraps time.Time so that every model serializes timestamps the same way,
+// whatever the parseTime and loc settings of the connection are
+type Time struct {
+	time.Time
+}
+
+// NewTime returns t as a Time
+func NewTime(t time.Time) Time {
+	return Time{normalizeTime(t)}
+}
+
+// Now returns the current time as a Time
+func Now() Time {
+	return NewTime(time.Now())
+}
+
+func normalizeTime(t time.Time) time.Time {
+	return {{normalize}}
+}
+
+// MarshalJSON implements json.Marshaler, the zero Time is written as null
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Quote(normalizeTime(t.Time).Format(TimeLayout))), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("models: invalid time %s", data)
+	}
+	v, err := time.Parse(TimeLayout, s)
+	if err != nil {
+		return err
+	}
+	t.Time = normalizeTime(v)
+	return nil
+}
+
+// Value implements driver.Valuer
+func (t Time) Value() (driver.Value, error) {
+	return normalizeTime(t.Time), nil
+}
+
+// Scan implements sql.Scanner
+func (t *Time) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = normalizeTime(v)
+	case []byte:
+		return t.Scan(string(v))
+	case string:
+		var err error
+		for _, layout := range scanLayouts {
+			var p time.Time
+			if p, err = time.ParseInLocation(layout, v, time.Local); err == nil {
+				t.Time = normalizeTime(p)
+				return nil
+			}
+		}
+		return err
+	default:
+		return fmt.Errorf("models: cannot scan %T into Time", value)
+	}
+	return nil
+}
+
+// scanLayouts lists the layouts of the temporal values read as text: datetimes,
+// with or without fractional seconds, dates and times of day
+var scanLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+`
@@ -0,0 +1,179 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"path"
+	"strings"
+
+	beeLogger "github.com/skOak/hee/logger"
+)
+
+// applyTree gives the table the tree helpers of an adjacency list, the parent of a row
+// being referenced by a foreign key to the table itself, preferably parent_id
+func applyTree(tb *Table, enabled bool) {
+	if !enabled {
+		return
+	}
+	if tb.Pk == "" {
+		beeLogger.Log.Fatalf("Table '%s' has no primary key, it can't be a tree", tb.Name)
+	}
+	if tb.TreeParent = selfForeignKey(tb); tb.TreeParent == "" {
+		beeLogger.Log.Fatalf("Table '%s' has no foreign key to itself, it can't be a tree", tb.Name)
+	}
+}
+
+// selfForeignKey returns the column of tb referencing its own primary key, preferably
+// parent_id, or "" if there is none
+func selfForeignKey(tb *Table) (parent string) {
+	for column, fk := range tb.Fk {
+		if fk.RefTable == tb.Name && fk.RefColumn == tb.Pk && (parent == "" || column == "parent_id") {
+			parent = column
+		}
+	}
+	return
+}
+
+// nodeParent returns the column referencing the parent of a node, of the tree or of the
+// closure table, or "" if there is none
+func (tb *Table) nodeParent() string {
+	if tb.TreeParent == "" && tb.Closure != nil {
+		return tb.Closure.ParentColumn
+	}
+	return tb.TreeParent
+}
+
+// NodeRelations reports whether the model has relations, which gorm v1 can't scan from
+// the columns of the nodes
+func (tb *Table) NodeRelations() bool {
+	for _, col := range tb.Columns {
+		if col.Tag.RelFk {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeSelect returns the columns read from the nodes of a tree with relations: the
+// columns of the model but the relations, and the parent as node_parent
+func (tb *Table) NodeSelect() string {
+	var columns []string
+	for _, col := range tb.Columns {
+		if !col.Tag.RelFk {
+			columns = append(columns, tb.Name+"."+col.Tag.Column)
+		}
+	}
+	if tb.NodeParentField() != "" {
+		columns = append(columns, tb.Name+"."+tb.nodeParent()+" AS node_parent")
+	}
+	return strings.Join(columns, ", ")
+}
+
+// NodeParentField returns the field of the relation to the parent of a node, or "" when
+// the parent is a plain column or there is none
+func (tb *Table) NodeParentField() string {
+	if col := tb.Column(tb.nodeParent()); col != nil && col.Tag.RelFk {
+		return col.Name
+	}
+	return ""
+}
+
+// writeTreeFile generates tree.go holding the queries of the trees and of the closure
+// tables, or nothing when no table is a tree
+func writeTreeFile(tables []*Table, mPath string) {
+	for _, tb := range tables {
+		if tb.TreeParent != "" || tb.Closure != nil {
+			writeGeneratedFile(path.Join(mPath, "tree.go"), TreeTPL)
+			return
+		}
+	}
+}
+
+const TreeTPL = `package models
+
+import (
+	"errors"
+)
+
+// ErrTreeCycle is returned when a subtree would be moved under one of its own nodes
+var ErrTreeCycle = errors.New("models: a subtree can't be moved under itself")
+
+// maxTreeDepth bounds the recursion of the tree queries, so that a cycle of parents
+// in the data can't make them run forever
+const maxTreeDepth = 1000
+
+// withRecursive returns the keyword of the recursive common table expressions of dialect,
+// SQL Server and Oracle not having the RECURSIVE one
+func withRecursive(dialect string) string {
+	if dialect == "mssql" || dialect == "oracle" {
+		return "WITH "
+	}
+	return "WITH RECURSIVE "
+}
+
+// subtreeSQL returns the recursive query of the ids of a node and of its descendants,
+// ordered by depth, which takes the id of the node and maxTreeDepth. The deleted nodes
+// and their descendants are left out when softDelete.
+func subtreeSQL(dialect, table, pk, parent string, softDelete bool) string {
+	notDeleted := ""
+	if softDelete {
+		notDeleted = " AND is_deleted = 0"
+	}
+	return withRecursive(dialect) + "subtree (id, depth) AS (" +
+		"SELECT " + pk + ", 0 FROM " + table + " WHERE " + pk + " = ?" + notDeleted +
+		" UNION ALL SELECT t." + pk + ", s.depth + 1 FROM " + table + " t JOIN subtree s ON t." + parent + " = s.id" +
+		" WHERE s.depth < ?" + notDeleted + ") SELECT id AS " + pk + " FROM subtree ORDER BY depth, id"
+}
+
+// pathSQL returns the recursive query of the ids of the ancestors of a node, from the
+// root to the node, which takes the id of the node and maxTreeDepth
+func pathSQL(dialect, table, pk, parent string) string {
+	return withRecursive(dialect) + "path (id, parent, depth) AS (" +
+		"SELECT " + pk + ", " + parent + ", 0 FROM " + table + " WHERE " + pk + " = ?" +
+		" UNION ALL SELECT t." + pk + ", t." + parent + ", p.depth + 1 FROM " + table + " t JOIN path p ON t." + pk + " = p.parent" +
+		" WHERE p.depth < ?) SELECT id AS " + pk + " FROM path ORDER BY depth DESC"
+}
+
+// closureInsertSQL returns the insertion of the closure rows of a new node: its own row,
+// taking the id of the node twice, preceded when the table has a parent column by the
+// rows of the ancestors of its parent one level deeper, taking the id twice more
+func closureInsertSQL(dialect, paths, ancestor, descendant, depth, table, pk, parent string) string {
+	insert := "INSERT INTO " + paths + " (" + ancestor + ", " + descendant + ", " + depth + ") "
+	if parent == "" {
+		return insert + "VALUES (?, ?, 0)"
+	}
+	self := "SELECT ?, ?, 0"
+	if dialect == "oracle" {
+		self += " FROM DUAL"
+	}
+	return insert + "SELECT " + ancestor + ", ?, " + depth + " + 1 FROM " + paths +
+		" WHERE " + descendant + " = (SELECT " + parent + " FROM " + table + " WHERE " + pk + " = ?) UNION ALL " + self
+}
+
+// closureDetachSQL returns the deletion of the closure rows linking a subtree to the
+// ancestors of its root, which takes the id of the root twice
+func closureDetachSQL(paths, ancestor, descendant string) string {
+	subtree := "SELECT sub.node FROM (SELECT " + descendant + " AS node FROM " + paths + " WHERE " + ancestor + " = ?) sub"
+	return "DELETE FROM " + paths + " WHERE " + descendant + " IN (" + subtree + ") AND " + ancestor + " NOT IN (" + subtree + ")"
+}
+
+// closureAttachSQL returns the insertion of the closure rows linking a subtree to a
+// parent and its ancestors, which takes the id of the parent and the id of the root
+func closureAttachSQL(paths, ancestor, descendant, depth string) string {
+	return "INSERT INTO " + paths + " (" + ancestor + ", " + descendant + ", " + depth + ") " +
+		"SELECT up." + ancestor + ", down." + descendant + ", up." + depth + " + down." + depth + " + 1" +
+		" FROM " + paths + " up CROSS JOIN " + paths + " down WHERE up." + descendant + " = ? AND down." + ancestor + " = ?"
+}
+`
@@ -0,0 +1,119 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/skOak/hee/config"
+)
+
+// treeTables returns a categories table referencing its parent by parent_id
+func treeTables() []*Table {
+	categories := &Table{Name: "categories", Pk: "id", PkType: "int64", Fk: map[string]*ForeignKey{"parent_id": {Name: "parent_id", RefTable: "categories", RefColumn: "id"}}, IdDelete: true}
+	categories.Columns = []*Column{
+		{Name: "Id", Type: "int64", SQLType: "integer", Tag: &OrmTag{Column: "id", Auto: true}},
+		{Name: "ParentId", Type: "*Categories", SQLType: "integer", Tag: &OrmTag{Column: "parent_id", RelFk: true, TableFk: "categories", Null: true}},
+		{Name: "Name", Type: "string", SQLType: "text", Tag: &OrmTag{Column: "name", Type: "text"}},
+		{Name: "IsDeleted", Type: "int8", SQLType: "integer", Tag: &OrmTag{Column: "is_deleted"}},
+	}
+	return []*Table{categories}
+}
+
+// treeTestFiles are added to the models to move subtrees on SQLite and read them back
+var treeTestFiles = map[string]string{
+	"export_test.go": `package models
+
+import "github.com/jinzhu/gorm"
+
+func SetDB(d *gorm.DB) { db = d }
+`,
+	"tree_test.go": `package models_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"example.com/app/models"
+)
+
+func TestMoveSubtree(t *testing.T) {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	models.SetDB(db)
+	for _, stmt := range []string{
+		"CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, parent_id INTEGER REFERENCES categories (id), name TEXT NOT NULL, is_deleted INTEGER NOT NULL DEFAULT 0)",
+		"INSERT INTO categories (id, parent_id, name) VALUES (1, NULL, 'root'), (2, 1, 'a'), (3, 1, 'b'), (4, 2, 'c')",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(ml []*models.Categories, err error) (ids []int64) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range ml {
+			ids = append(ids, m.Id)
+		}
+		return
+	}
+
+	if got := ids( models.GetCategoriesSubtree(nil, 1)); !reflect.DeepEqual(got, []int64{1, 2, 3, 4}) {
+		t.Errorf("subtree of 1 is %v, want [1 2 3 4]", got)
+	}
+	parent := int64(3)
+	if err := models.MoveCategoriesSubtree(nil, 2, &parent); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(models.GetCategoriesPath(nil, 4)); !reflect.DeepEqual(got, []int64{1, 3, 2, 4}) {
+		t.Errorf("path of 4 is %v after moving 2 under 3, want [1 3 2 4]", got)
+	}
+	if got := ids(models.GetCategoriesSubtree(nil, 3)); !reflect.DeepEqual(got, []int64{3, 2, 4}) {
+		t.Errorf("subtree of 3 is %v after moving 2 under 3, want [3 2 4]", got)
+	}
+	parent = 4
+	if err := models.MoveCategoriesSubtree(nil, 3, &parent); err != models.ErrTreeCycle {
+		t.Errorf("moving 3 under 4 returned %v, want ErrTreeCycle", err)
+	}
+	if err := models.MoveCategoriesSubtree(nil, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(models.GetCategoriesPath(nil, 4)); !reflect.DeepEqual(got, []int64{2, 4}) {
+		t.Errorf("path of 4 is %v after moving 2 to the roots, want [2 4]", got)
+	}
+	if err := models.MoveCategoriesSubtree(nil, 99, nil); !models.IsNotFound(err) {
+		t.Errorf("moving a missing node returned %v, want ErrNotFound", err)
+	}
+}
+`,
+}
+
+// TestTreeMoveSubtree moves the subtrees of a tree on SQLite and reads them back
+func TestTreeMoveSubtree(t *testing.T) {
+	conf := config.Conf
+	defer func() { config.Conf = conf }()
+	loadTestConfig(t, `{"appcode": {"tables": {"categories": {"tree": true}}}}`)
+
+	gopath := generateApp(t, "sqlite", treeTables(), OModel)
+	testGeneratedPackage(t, gopath, "models", treeTestFiles, "github.com/jinzhu/gorm", "github.com/mattn/go-sqlite3")
+}
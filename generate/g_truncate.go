@@ -0,0 +1,123 @@
+// Copyright 2013 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import "path"
+
+// writeTruncateFile generates truncate.go holding TruncateAll for the dialect
+func writeTruncateFile(dbms, mPath string) {
+	writeGeneratedFile(path.Join(mPath, "truncate.go"), executeTemplate(TruncateTPL, struct{ Dialect string }{dbms}))
+}
+
+const TruncateTPL = `package models
+
+import (
+	"errors"
+	"os"
+{{if eq .Dialect "postgres"}}	"strings"
+{{end}}
+	"github.com/jinzhu/gorm"
+)
+
+// TruncateEnv is the environment variable which must be "test" for TruncateAll
+// to run, it is also the run mode of beego
+const TruncateEnv = "BEEGO_RUNMODE"
+
+// ErrTruncateNotAllowed is returned by TruncateAll outside of the test environment
+var ErrTruncateNotAllowed = errors.New("models: truncating the tables requires " + TruncateEnv + "=test")
+
+// TruncateAll empties the tables of every generated model, for the cleanup of
+// integration tests, tx being a transaction or nil. It refuses to run unless
+// TruncateEnv is "test"
+func TruncateAll(tx *gorm.DB) (err error) {
+	if os.Getenv(TruncateEnv) != "test" {
+		return ErrTruncateNotAllowed
+	}
+	tables := TablesInFKOrder()
+	if len(tables) == 0 {
+		return nil
+	}
+{{if eq .Dialect "postgres"}}	db := tx
+	if db == nil {
+		db = DB()
+	}
+	// a single statement truncates the tables whatever their foreign keys
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = ` + "`" + `"` + "`" + ` + table + ` + "`" + `"` + "`" + `
+	}
+	return db.Exec("TRUNCATE TABLE " + strings.Join(quoted, ", ") + " RESTART IDENTITY CASCADE").Error
+{{else if eq .Dialect "clickhouse"}}	db := tx
+	if db == nil {
+		db = DB()
+	}
+	// ClickHouse has neither foreign keys nor transactions
+	for _, table := range tables {
+		if err = db.Exec("TRUNCATE TABLE " + table).Error; err != nil {
+			return
+		}
+	}
+	return
+{{else if or (eq .Dialect "sqlite") (eq .Dialect "mssql") (eq .Dialect "oracle")}}	db := tx
+	if db == nil {
+		if db = DB().Begin(); db.Error != nil {
+			return db.Error
+		}
+		defer func() {
+			if err != nil {
+				db.Rollback()
+				return
+			}
+			err = db.Commit().Error
+		}()
+	}
+	// SQLite has no TRUNCATE and SQL Server and Oracle don't truncate the referenced
+	// tables, the referencing tables are emptied first
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err = db.Exec({{if eq .Dialect "oracle"}}"DELETE FROM " + tables[i]{{else}}` + "`" + `DELETE FROM "` + "`" + ` + tables[i] + ` + "`" + `"` + "`" + `{{end}}).Error; err != nil {
+			return
+		}
+	}
+	return
+{{else}}	db := tx
+	if db == nil {
+		// the foreign key checks are disabled for the session, a transaction
+		// keeps the statements on the same connection
+		if db = DB().Begin(); db.Error != nil {
+			return db.Error
+		}
+		defer func() {
+			if cerr := db.Commit().Error; err == nil {
+				err = cerr
+			}
+		}()
+	}
+	// MySQL refuses to truncate a table referenced by a foreign key otherwise
+	if err = db.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+		return
+	}
+	defer func() {
+		if rerr := db.Exec("SET FOREIGN_KEY_CHECKS = 1").Error; err == nil {
+			err = rerr
+		}
+	}()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err = db.Exec("TRUNCATE TABLE ` + "`" + `" + tables[i] + "` + "`" + `").Error; err != nil {
+			return
+		}
+	}
+	return
+{{end}}}
+`
@@ -218,6 +218,28 @@ func CamelCase(in string) string {
 	return strings.Join(tokens, "")
 }
 
+// KebabCase converts a _ delimited string to kebab case
+// e.g. very_important_person => very-important-person
+func KebabCase(in string) string {
+	return strings.ToLower(strings.Replace(strings.Trim(in, "_ "), "_", "-", -1))
+}
+
+// Pluralize returns the english plural of the last word of a _ delimited string,
+// leaving words that already look plural untouched. e.g. user_category => user_categories
+func Pluralize(in string) string {
+	lower := strings.ToLower(in)
+	switch {
+	case strings.HasSuffix(lower, "ss"), strings.HasSuffix(lower, "sh"), strings.HasSuffix(lower, "ch"),
+		strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"):
+		return in + "es"
+	case strings.HasSuffix(lower, "s"):
+		return in
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return in[:len(in)-1] + "ies"
+	}
+	return in + "s"
+}
+
 // formatSourceCode formats source files
 func FormatSourceCode(filename string) {
 	cmd := exec.Command("gofmt", "-w", filename)
@@ -249,6 +271,38 @@ func WriteToFile(filename, content string) {
 	MustCheck(err)
 }
 
+// WriteFileAtomic writes data to a temporary file next to filename and renames it
+// to filename, which is thus either left untouched or fully written. An existing
+// filename keeps its permissions, perm being the ones of a new file.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	if fi, err := os.Stat(filename); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
 // __FILE__ returns the file name in which the function was invoked
 func FILE() string {
 	_, file, _, _ := runtime.Caller(1)